@@ -0,0 +1,257 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+)
+
+// ActionError is published on TopicWarning when an action triggered by
+// a target fails.
+type ActionError struct {
+	ID     string // target that triggered the action
+	Action string
+	Err    error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("tracer: action %v on %v: %v", e.Action, e.ID, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// Action is a remediation step run when a target reaches a state, see
+// Actions.
+type Action interface {
+	// Name identifies the action in ActionErrors.
+	Name() string
+
+	// Run performs the action in response to m.
+	Run(ctx context.Context, m Message) error
+}
+
+// Rule describes when an Action is run.
+type Rule struct {
+	// ID is the ID of the target the rule applies to, every target
+	// when empty.
+	ID string
+
+	// State is the state that triggers Action, usually ConnOffline.
+	State int
+
+	Action Action
+
+	// MaxAttempts is the number of times Action is run while a target
+	// stays in State, one when zero. Cooldown is the minimum time between
+	// two attempts.
+	MaxAttempts int
+	Cooldown    time.Duration
+
+	// Timeout bounds each run of Action, when positive.
+	Timeout time.Duration
+}
+
+// ruleState is the progress of a Rule on a target.
+type ruleState struct {
+	attempts int
+	last     time.Time
+}
+
+// Actions runs remediation actions on the state transitions of the
+// targets of a Tracer, so that simple automatic recovery, such as
+// restarting a service, does not require an external orchestrator.
+type Actions struct {
+	Rules []Rule
+
+	mu     sync.Mutex
+	states map[string]*ruleState // by rule index and target ID
+}
+
+// Watch subscribes a to the messages of t with SubscribeFunc, whatever
+// PubSub is in use. Actions run in their own goroutines, failures are
+// published on TopicWarning as *ActionError.
+// Messages with a RootCause do not trigger actions, as the target is
+// expected to recover with the upstream one, and neither do the ones
+// published during scheduled Downtime.
+// Cancelling the subscription does not stop the actions already running.
+func (a *Actions) Watch(t *Tracer) (pubsub.CancelFunc, error) {
+	return t.SubscribeFunc(func(m Message) {
+		if m.Canceled || m.RootCause != "" || m.Downtime {
+			return
+		}
+		for _, r := range a.due(m, t.now()) {
+			go a.run(t, r, m)
+		}
+	}), nil
+}
+
+// due returns the rules whose action has to run in response to m.
+func (a *Actions) due(m Message, now time.Time) []Rule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.states == nil {
+		a.states = make(map[string]*ruleState)
+	}
+	var rules []Rule
+	for i, r := range a.Rules {
+		if r.ID != "" && r.ID != m.ID {
+			continue
+		}
+		key := strconv.Itoa(i) + "/" + m.ID
+		s, ok := a.states[key]
+		if !ok {
+			s = new(ruleState)
+			a.states[key] = s
+		}
+		if m.State != r.State {
+			s.attempts = 0
+			continue
+		}
+		max := r.MaxAttempts
+		if max < 1 {
+			max = 1
+		}
+		if s.attempts >= max || (s.attempts > 0 && now.Sub(s.last) < r.Cooldown) {
+			continue
+		}
+		s.attempts++
+		s.last = now
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func (a *Actions) run(t *Tracer, r Rule, m Message) {
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	if err := r.Action.Run(ctx, m); err != nil {
+		t.emit(TopicWarning, m.ID, &ActionError{ID: m.ID, Action: r.Action.Name(), Err: err})
+	}
+}
+
+// Command is an Action that runs an external command. The ID, state and
+// error of the target are passed to it in the TRACER_ID, TRACER_STATE and
+// TRACER_ERR environment variables.
+type Command struct {
+	Path string
+	Args []string
+}
+
+// SystemdUnit returns a Command restarting the systemd unit.
+func SystemdUnit(unit string) *Command {
+	return &Command{Path: "systemctl", Args: []string{"restart", unit}}
+}
+
+// WindowsService returns a Command restarting the Windows service, the
+// counterpart of SystemdUnit on Windows hosts.
+func WindowsService(name string) *Command {
+	quoted := "'" + strings.ReplaceAll(name, "'", "''") + "'"
+	return &Command{
+		Path: "powershell.exe",
+		Args: []string{"-NoProfile", "-NonInteractive", "-Command", "Restart-Service -Force -Name " + quoted},
+	}
+}
+
+// Name implements Action.
+func (c *Command) Name() string {
+	return "command " + c.Path
+}
+
+// Run implements Action. The output of the command is included in the
+// error when it fails.
+func (c *Command) Run(ctx context.Context, m Message) error {
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Env = append(os.Environ(),
+		"TRACER_ID="+m.ID,
+		"TRACER_STATE="+StateString(m.State),
+	)
+	if m.Err != nil {
+		cmd.Env = append(cmd.Env, "TRACER_ERR="+m.Err.Error())
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Webhook is an Action that POSTs the JSON encoded Message to URL.
+type Webhook struct {
+	URL string
+
+	// Client performs the request, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Name implements Action.
+func (w *Webhook) Name() string {
+	return "webhook " + w.URL
+}
+
+// Run implements Action. Responses with a status code of 400 or above
+// are errors.
+func (w *Webhook) Run(ctx context.Context, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
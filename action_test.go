@@ -0,0 +1,157 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+)
+
+// countAction counts its runs, failing when fail is set.
+type countAction struct {
+	runs int32
+	fail bool
+}
+
+func (a *countAction) Name() string {
+	return "count"
+}
+
+func (a *countAction) Run(ctx context.Context, m tracer.Message) error {
+	atomic.AddInt32(&a.runs, 1)
+	if a.fail {
+		return errors.New("should fail")
+	}
+	return nil
+}
+
+func TestActions(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+
+	offline, online := new(countAction), &countAction{fail: true}
+	a := &tracer.Actions{Rules: []tracer.Rule{
+		{State: tracer.ConnOffline, Action: offline, MaxAttempts: 3},
+		{ID: "fake", State: tracer.ConnOnline, Action: online, Cooldown: time.Hour},
+	}}
+	cancel, err := a.Watch(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	warnings := make(chan error, 16)
+	cancelWarnings, err := tr.Sub(&pubsub.Command{
+		Topic: tracer.TopicWarning,
+		Run: func(i interface{}) error {
+			if err, ok := i.(*tracer.ActionError); ok {
+				warnings <- err
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelWarnings()
+
+	p := &flipPinger{pg: pg{id: "fake"}, fail: 1}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&offline.runs); n != 3 {
+		t.Fatalf("unexpected offline runs: found %v, expected 3", n)
+	}
+
+	atomic.StoreInt32(&p.fail, 0)
+	select {
+	case err := <-warnings:
+		if !errors.As(err, new(*tracer.ActionError)) || err.(*tracer.ActionError).ID != "fake" {
+			t.Fatalf("unexpected warning: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed action not reported")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&online.runs); n != 1 {
+		t.Fatalf("unexpected online runs: found %v, expected 1", n)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	got := make(chan tracer.Message, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m tracer.Message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- m
+	}))
+	defer srv.Close()
+
+	w := &tracer.Webhook{URL: srv.URL}
+	if err := w.Run(context.Background(), tracer.Message{ID: "fake", State: tracer.ConnOffline}); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-got; m.ID != "fake" || m.State != tracer.ConnOffline {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+
+	w.URL = srv.URL + "/%zz"
+	if err := w.Run(context.Background(), tracer.Message{ID: "fake"}); err == nil {
+		t.Fatal("invalid URLs should fail")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	c := &tracer.Command{Path: sh, Args: []string{"-c", `test "$TRACER_ID/$TRACER_STATE" = fake/offline`}}
+	if err := c.Run(context.Background(), tracer.Message{ID: "fake", State: tracer.ConnOffline}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background(), tracer.Message{ID: "other", State: tracer.ConnOffline}); err == nil {
+		t.Fatal("command should fail")
+	}
+}
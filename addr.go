@@ -0,0 +1,96 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// netAddr is a net.Addr made of its network and string representation.
+type netAddr struct {
+	network string
+	addr    string
+}
+
+func (a *netAddr) Network() string {
+	return a.network
+}
+
+func (a *netAddr) String() string {
+	return a.addr
+}
+
+// addrIP returns the IP address carried by a, or nil if a is nil or does
+// not carry one. No name resolution is performed.
+func addrIP(a net.Addr) net.IP {
+	switch a := a.(type) {
+	case nil:
+		return nil
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+
+	host := a.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
+
+// validateAddr checks that a parses according to its network: a host and
+// a numeric port for TCP and UDP networks, an IP address for IP networks.
+// Addresses of other networks are accepted as long as they are not empty.
+func validateAddr(a net.Addr) error {
+	s := a.String()
+	switch a.Network() {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return err
+		}
+		if host == "" {
+			return fmt.Errorf("missing host in %q", s)
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid port in %q", s)
+		}
+	case "ip", "ip4", "ip6":
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("invalid IP address %q", s)
+		}
+	default:
+		if s == "" {
+			return errors.New("empty address")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff spaces out the pings of the targets that keep failing, instead
+// of checking them on every refresh: after n consecutive failures a
+// target is not pinged for Initial * Multiplier^(n-1), up to Max. The
+// first success resets the delay. Targets waiting for their delay to
+// expire are not checked, hence their last message may become Stale.
+type Backoff struct {
+	// Initial is the delay after the first failure, no backoff is
+	// applied when not positive.
+	Initial time.Duration
+
+	// Max bounds the delay, when positive.
+	Max time.Duration
+
+	// Multiplier is the growth factor of the delay, 2 when lower
+	// than 1.
+	Multiplier float64
+
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomly cut, so that targets failing together do not keep being
+	// pinged together.
+	Jitter float64
+
+	// Rand is the source of randomness, a time seeded source when nil.
+	Rand *rand.Rand
+
+	rng lockedRand
+}
+
+func (b *Backoff) float64() float64 {
+	return b.rng.float64(b.Rand)
+}
+
+// delay returns the time to wait before pinging again a target that
+// failed n times in a row.
+func (b *Backoff) delay(n int) time.Duration {
+	if b == nil || b.Initial <= 0 || n < 1 {
+		return 0
+	}
+	m := b.Multiplier
+	if m < 1 {
+		m = 2
+	}
+	d := float64(b.Initial) * math.Pow(m, float64(n-1))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if d > math.MaxInt64 {
+		d = math.MaxInt64
+	}
+	if b.Jitter > 0 {
+		d -= d * math.Min(b.Jitter, 1) * b.float64()
+	}
+	return time.Duration(d)
+}
+
+// backingOff reports whether tg has to be left alone at now, as it is
+// waiting for its backoff delay to expire.
+func (t *Tracer) backingOff(tg *target, now time.Time) bool {
+	tg.Lock()
+	defer tg.Unlock()
+	return now.Before(tg.retry)
+}
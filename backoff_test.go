@@ -0,0 +1,67 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestBackoff(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second
+	s.Tracer.Backoff = &tracer.Backoff{Initial: 2 * time.Second, Max: 8 * time.Second}
+	defer s.Close()
+
+	failing := tracertest.NewPinger("failing", append(tracertest.Repeat(tracertest.Down, 5), tracertest.Up)...)
+	steady := tracertest.NewPinger("steady", tracertest.Down)
+	if err := s.Trace(failing); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trace(steady, tracer.WithInterval(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(40 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		p     *tracertest.Pinger
+		calls int
+	}{
+		// Failing at 0s, 2s, 6s, 14s and 22s, then up at 30s and
+		// pinged on every refresh again.
+		{failing, 16},
+		// Failing at 0s, 2s, 6s, 14s, 22s, 30s and 38s.
+		{steady, 7},
+	} {
+		if n := test.p.Calls(); n != test.calls {
+			t.Fatalf("%v: unexpected pings: found %v, expected %v", test.p.ID(), n, test.calls)
+		}
+	}
+}
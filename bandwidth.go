@@ -0,0 +1,228 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Throughput is the outcome of a BandwidthPinger measurement.
+type Throughput struct {
+	Bytes    int64         // bytes transferred
+	Duration time.Duration // time the transfer took
+	Mbps     float64       // megabits per second
+	Measured time.Time     // when the measurement ended
+}
+
+func newThroughput(n int64, d time.Duration) *Throughput {
+	t := &Throughput{Bytes: n, Duration: d, Measured: time.Now()}
+	if d > 0 {
+		t.Mbps = float64(n) * 8 / d.Seconds() / 1e6
+	}
+	return t
+}
+
+// BandwidthPinger is a Pinger measuring the throughput of the link to an
+// endpoint, for ISP and link quality monitoring. It downloads the first
+// bytes of an http or https URL using a range request, or reads them from
+// a tcp://host:port endpoint that sends data as soon as a connection is
+// established. The *Throughput measured is returned as details of the
+// ping, see DetailPinger, and passed to validators, which can reject
+// measurements below a threshold.
+// Measurements are expensive, use WithMinInterval to run them at a low
+// rate whatever the refresh rate of the tracer.
+type BandwidthPinger struct {
+	url  *url.URL
+	opts *options
+
+	mu      sync.Mutex
+	last    *Throughput
+	lastErr error
+	remote  net.Addr
+}
+
+// NewBandwidthPinger returns a BandwidthPinger measuring the throughput
+// of rawurl, which is its ID as well unless WithID is used. Returns an
+// error if rawurl is not an http, https or tcp URL.
+func NewBandwidthPinger(rawurl string, opts ...Option) (*BandwidthPinger, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Host == "":
+		return nil, fmt.Errorf("tracer: missing host in %q", rawurl)
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "tcp":
+		return nil, fmt.Errorf("tracer: unsupported bandwidth URL %q", rawurl)
+	}
+
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = rawurl
+	}
+	if o.size <= 0 {
+		o.size = 1 << 20
+	}
+	return &BandwidthPinger{url: u, opts: o}, nil
+}
+
+// ID implements Pinger.
+func (p *BandwidthPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *BandwidthPinger) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remote != nil {
+		return p.remote
+	}
+	return &netAddr{network: "tcp", addr: p.url.Host}
+}
+
+// Ping implements Pinger.
+func (p *BandwidthPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the *Throughput
+// measured.
+func (p *BandwidthPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	if last := p.last; last != nil && p.opts.interval > 0 && time.Since(last.Measured) < p.opts.interval {
+		err := p.lastErr
+		p.mu.Unlock()
+		return last, err
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	var t *Throughput
+	var err error
+	if p.url.Scheme == "tcp" {
+		t, err = p.measureTCP(ctx)
+	} else {
+		t, err = p.measureHTTP(ctx)
+	}
+	if err == nil {
+		err = p.opts.validate(t)
+	}
+	if t == nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.last, p.lastErr = t, err
+	p.mu.Unlock()
+	return t, err
+}
+
+func (p *BandwidthPinger) measureHTTP(ctx context.Context) (*Throughput, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", p.opts.size-1))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             p.opts.proxy,
+			DialContext:       p.dial,
+			TLSClientConfig:   p.opts.tlsConfig,
+			DisableKeepAlives: true,
+			// Compression would measure the wrong thing.
+			DisableCompression: true,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("tracer: unexpected status %v", resp.Status)
+	}
+
+	start := time.Now()
+	n, err := io.CopyN(io.Discard, resp.Body, p.opts.size)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return newThroughput(n, time.Since(start)), nil
+}
+
+func (p *BandwidthPinger) measureTCP(ctx context.Context) (*Throughput, error) {
+	conn, err := p.dial(ctx, "tcp", p.url.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if p.opts.tlsConfig != nil {
+		config := p.opts.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = p.url.Hostname()
+		}
+		tconn := tls.Client(conn, config)
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tconn
+	}
+
+	start := time.Now()
+	n, err := io.CopyN(io.Discard, conn, p.opts.size)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return newThroughput(n, time.Since(start)), nil
+}
+
+// dial dials with the Dialer of p, recording the address reached.
+func (p *BandwidthPinger) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := p.opts.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.remote = conn.RemoteAddr()
+	p.mu.Unlock()
+	return conn, nil
+}
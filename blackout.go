@@ -0,0 +1,93 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// Blackout is a recurring maintenance window. While a window is open the
+// targets it applies to are still pinged, but their state does not
+// change: failures do not bring them offline, and the Messages published
+// about them are flagged with Downtime so that availability statistics
+// can account for the scheduled downtime.
+type Blackout struct {
+	// Schedule gives the times the windows open at.
+	Schedule *Cron
+
+	// Duration is how long each window stays open.
+	Duration time.Duration
+
+	// IDs are the IDs of the targets the blackout applies to, every
+	// target when empty.
+	IDs []string
+
+	// Location is the time zone Schedule is expressed in, the local
+	// one when nil.
+	Location *time.Location
+}
+
+// Active reports whether a window of b is open at now for the target
+// with id.
+func (b *Blackout) Active(id string, now time.Time) bool {
+	return appliesTo(b.IDs, id) && windowOpen(b.Schedule, b.Duration, b.Location, now)
+}
+
+// appliesTo reports whether id is one of ids, or ids is empty.
+func appliesTo(ids []string, id string) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// windowOpen reports whether at now one of the windows lasting d that
+// open at the times of schedule, expressed in loc, is open.
+func windowOpen(schedule *Cron, d time.Duration, loc *time.Location, now time.Time) bool {
+	if schedule == nil || d <= 0 {
+		return false
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	// A window is open if it opened in (now-d, now].
+	open := schedule.Next(now.Add(-d).In(loc))
+	return !open.IsZero() && !open.After(now)
+}
+
+// inBlackout reports whether one of the blackouts of t is active for id.
+func (t *Tracer) inBlackout(id string, now time.Time) bool {
+	for _, b := range t.Blackouts {
+		if b.Active(id, now) {
+			return true
+		}
+	}
+	return false
+}
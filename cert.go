@@ -0,0 +1,154 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// TLSPinger is implemented by Pingers that perform TLS handshakes with
+// their target, exposing the outcome of the last one so that the tracer
+// can inspect the certificates presented by the target. The built-in TCP
+// and HTTP pingers implement it.
+type TLSPinger interface {
+	Pinger
+
+	// ConnectionState returns the state of the TLS connection
+	// established by the last ping, nil if none was.
+	ConnectionState() *tls.ConnectionState
+}
+
+// CertExpiring is published on TopicCert when a certificate presented by
+// a target expires within Tracer.CertExpiryWarning, or has expired
+// already. It is published once per certificate: a renewed certificate
+// expiring soon is reported again.
+type CertExpiring struct {
+	ID string
+
+	// Depth is the position of the certificate in the chain sent by
+	// the target, 0 for the leaf.
+	Depth int
+
+	Subject  string
+	NotAfter time.Time
+
+	// Remaining is the time left before expiry, negative if the
+	// certificate has expired.
+	Remaining time.Duration
+}
+
+// CertRevocation is published on TopicCert when a certificate presented
+// by a target is revoked, or its revocation status cannot be determined,
+// see Tracer.RevocationCheck. It is published again only when the problem
+// changes.
+type CertRevocation struct {
+	ID  string
+	Err *RevocationError
+}
+
+// checkCerts inspects the certificates presented by tg in its last
+// handshake, publishing the CertExpiring and CertRevocation events that
+// were not published already.
+func (t *Tracer) checkCerts(tg *target) {
+	if t.CertExpiryWarning <= 0 && t.RevocationCheck == nil {
+		return
+	}
+	tp, ok := tg.Pinger.(TLSPinger)
+	if !ok {
+		return
+	}
+	state := tp.ConnectionState()
+	if state == nil {
+		return
+	}
+
+	var events []interface{}
+	if t.CertExpiryWarning > 0 {
+		events = append(events, t.expiringCerts(tg, state)...)
+	}
+	if t.RevocationCheck != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), t.pingTimeout(tg))
+		err := t.RevocationCheck.Check(ctx, state)
+		cancel()
+
+		var rerr *RevocationError
+		errors.As(err, &rerr)
+		tg.Lock()
+		if rerr == nil {
+			tg.revocation = ""
+		} else if key := rerr.Error(); key != tg.revocation {
+			tg.revocation = key
+			events = append(events, CertRevocation{ID: tg.ID(), Err: rerr})
+		}
+		tg.Unlock()
+	}
+
+	for _, e := range events {
+		t.emit(TopicCert, tg.ID(), e)
+	}
+}
+
+// expiringCerts returns the CertExpiring events about the certificates
+// in state that expire within CertExpiryWarning and were not reported yet.
+func (t *Tracer) expiringCerts(tg *target, state *tls.ConnectionState) []interface{} {
+	now := t.now()
+	var events []interface{}
+	expiring := make(map[string]bool)
+	tg.Lock()
+	defer tg.Unlock()
+
+	for i, cert := range state.PeerCertificates {
+		remaining := cert.NotAfter.Sub(now)
+		if remaining > t.CertExpiryWarning {
+			continue
+		}
+		key := certKey(cert)
+		expiring[key] = true
+		if tg.expiring[key] {
+			continue
+		}
+		events = append(events, CertExpiring{
+			ID:        tg.ID(),
+			Depth:     i,
+			Subject:   cert.Subject.String(),
+			NotAfter:  cert.NotAfter,
+			Remaining: remaining,
+		})
+	}
+	tg.expiring = expiring
+	return events
+}
+
+// certKey identifies cert by its fingerprint.
+func certKey(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
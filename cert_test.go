@@ -0,0 +1,80 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestCertExpiring(t *testing.T) {
+	srv := tracertest.NewTLSServer(t) // expires in 24 hours
+
+	for _, tt := range []struct {
+		warning time.Duration
+		events  int
+	}{
+		{time.Hour, 0},
+		{48 * time.Hour, 1},
+	} {
+		tr := tracer.New()
+		tr.RefreshRate = time.Millisecond
+		tr.PingTimeout = time.Second
+		tr.SkipIfRunning = true
+		tr.CertExpiryWarning = tt.warning
+		rec := new(recorder)
+		tr.PubSub = rec
+		if err := tr.Trace(tracer.NewTCPPinger(srv.Addr(), tracer.WithTLSConfig(srv.Cert.Client))); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Run(); err != nil {
+			t.Fatal(err)
+		}
+		for rec.len() < 5 {
+			time.Sleep(time.Millisecond)
+		}
+		tr.Close()
+
+		rec.Lock()
+		var events []tracer.CertExpiring
+		for _, i := range rec.other {
+			if e, ok := i.(tracer.CertExpiring); ok {
+				events = append(events, e)
+			}
+		}
+		rec.Unlock()
+		if len(events) != tt.events {
+			t.Fatalf("unexpected events with warning %v: found %v, expected %v", tt.warning, len(events), tt.events)
+		}
+		for _, e := range events {
+			if e.ID != srv.Addr() || e.Depth != 0 || e.Remaining > 24*time.Hour || e.Remaining < 23*time.Hour {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrChaos is reported by the pings that chaos mode made fail.
+var ErrChaos = errors.New("tracer: failure injected by chaos mode")
+
+// Chaos describes the faults injected into pings when chaos mode is
+// enabled, so that consumers can test how their dashboards and alert rules
+// behave when the probe layer is unreliable. Messages whose outcome was
+// altered are flagged with Chaos.
+type Chaos struct {
+	// FailRate is the fraction of pings, between 0 and 1, that are
+	// not performed and fail with ErrChaos instead.
+	FailRate float64
+
+	// DelayRate is the fraction of pings, between 0 and 1, that are
+	// delayed by a random duration up to MaxDelay before being performed.
+	DelayRate float64
+	MaxDelay  time.Duration
+
+	// Rand is the source of randomness, a time seeded source when nil.
+	Rand *rand.Rand
+
+	rng lockedRand
+}
+
+func (c *Chaos) float64() float64 {
+	return c.rng.float64(c.Rand)
+}
+
+// ping pings p, injecting the faults described by c, and reports
+// whether a fault was injected along with the details returned by p, if
+// any. after is used to wait for delays.
+func (c *Chaos) ping(ctx context.Context, p Pinger, after func(time.Duration) <-chan time.Time) (interface{}, bool, error) {
+	if c == nil {
+		details, err := safePingDetails(ctx, p)
+		return details, false, err
+	}
+	if c.FailRate > 0 && c.float64() < c.FailRate {
+		return nil, true, ErrChaos
+	}
+	if c.DelayRate > 0 && c.MaxDelay > 0 && c.float64() < c.DelayRate {
+		d := time.Duration(c.float64() * float64(c.MaxDelay))
+		select {
+		case <-after(d):
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+		details, err := safePingDetails(ctx, p)
+		return details, true, err
+	}
+	details, err := safePingDetails(ctx, p)
+	return details, false, err
+}
@@ -0,0 +1,268 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// CheckBuilder composes Pingers into a single Pinger. A check is made of
+// steps that are run in sequence and must all succeed; each step is either a
+// single Pinger, a fallback among Pingers or a quorum of Pingers:
+//
+//	p := tracer.Check("api").
+//		Then(dns).
+//		Fallback(primary, replica).
+//		Quorum(2, node1, node2, node3).
+//		Retry(2, time.Second).
+//		MaxLatency(3 * time.Second).
+//		Build()
+//
+// Built checks are Pingers themselves, hence they can be steps of other
+// checks.
+type CheckBuilder struct {
+	id         string
+	addr       net.Addr
+	steps      []step
+	retries    int
+	retryDelay time.Duration
+	maxLatency time.Duration
+}
+
+// step is a group of Pingers of which at least need must succeed.
+type step struct {
+	pingers []Pinger
+	need    int
+	quorum  bool // run concurrently rather than one after the other
+}
+
+// Check starts building a composite Pinger identified by id.
+func Check(id string) *CheckBuilder {
+	return &CheckBuilder{id: id}
+}
+
+// Then appends a step that succeeds when p succeeds.
+func (b *CheckBuilder) Then(p Pinger) *CheckBuilder {
+	b.steps = append(b.steps, step{pingers: []Pinger{p}, need: 1})
+	return b
+}
+
+// Sequence appends a step for each of ps, as Then does.
+func (b *CheckBuilder) Sequence(ps ...Pinger) *CheckBuilder {
+	for _, p := range ps {
+		b.Then(p)
+	}
+	return b
+}
+
+// Fallback appends a step that tries ps in order, and succeeds as soon as
+// one of them does.
+func (b *CheckBuilder) Fallback(ps ...Pinger) *CheckBuilder {
+	b.steps = append(b.steps, step{pingers: ps, need: 1})
+	return b
+}
+
+// Quorum appends a step that pings ps concurrently, and succeeds when at
+// least n of them do.
+func (b *CheckBuilder) Quorum(n int, ps ...Pinger) *CheckBuilder {
+	b.steps = append(b.steps, step{pingers: ps, need: n, quorum: true})
+	return b
+}
+
+// Retry makes the check run again up to n times, waiting delay between
+// attempts, before reporting a failure.
+func (b *CheckBuilder) Retry(n int, delay time.Duration) *CheckBuilder {
+	b.retries = n
+	b.retryDelay = delay
+	return b
+}
+
+// MaxLatency makes the check fail with a *LatencyError when it succeeds,
+// but takes longer than d.
+func (b *CheckBuilder) MaxLatency(d time.Duration) *CheckBuilder {
+	b.maxLatency = d
+	return b
+}
+
+// Addr sets the address of the check, which defaults to the address of its
+// first Pinger.
+func (b *CheckBuilder) Addr(addr net.Addr) *CheckBuilder {
+	b.addr = addr
+	return b
+}
+
+// Build returns the composite Pinger. Further calls to the builder do not
+// affect it.
+func (b *CheckBuilder) Build() Pinger {
+	c := *b
+	c.steps = append([]step(nil), b.steps...)
+	return &check{c}
+}
+
+// StepError is returned by a composite check or a Transaction when one
+// of its steps fails.
+type StepError struct {
+	Step int    // index of the step, starting from 0
+	Name string // name of the step, if any
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("tracer: check step %d (%v) failed: %v", e.Step, e.Name, e.Err)
+	}
+	return fmt.Sprintf("tracer: check step %d failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// QuorumError is returned by a quorum step when too few Pingers succeed.
+type QuorumError struct {
+	Need, Got int
+	Errs      []error // errors of the failed Pingers
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("tracer: quorum not reached: %d of %d needed succeeded", e.Got, e.Need)
+}
+
+func (e *QuorumError) Unwrap() []error {
+	return e.Errs
+}
+
+// LatencyError is returned when a check succeeds too slowly.
+type LatencyError struct {
+	Latency, Max time.Duration
+}
+
+func (e *LatencyError) Error() string {
+	return fmt.Sprintf("tracer: latency %v exceeds %v", e.Latency, e.Max)
+}
+
+type check struct {
+	CheckBuilder
+}
+
+func (c *check) ID() string {
+	return c.id
+}
+
+func (c *check) Addr() net.Addr {
+	if c.addr != nil {
+		return c.addr
+	}
+	for _, s := range c.steps {
+		if len(s.pingers) > 0 {
+			return s.pingers[0].Addr()
+		}
+	}
+	return &netAddr{network: "check", addr: c.id}
+}
+
+func (c *check) Ping(ctx context.Context) error {
+	var err error
+	for i := 0; i <= c.retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(c.retryDelay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		start := time.Now()
+		if err = c.run(ctx); err != nil {
+			continue
+		}
+		if d := time.Since(start); c.maxLatency > 0 && d > c.maxLatency {
+			err = &LatencyError{Latency: d, Max: c.maxLatency}
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *check) run(ctx context.Context) error {
+	for i, s := range c.steps {
+		var err error
+		if s.quorum {
+			err = s.runQuorum(ctx)
+		} else {
+			err = s.runFallback(ctx)
+		}
+		if err != nil {
+			return &StepError{Step: i, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s step) runFallback(ctx context.Context) error {
+	var errs []error
+	for _, p := range s.pingers {
+		err := safePing(ctx, p)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+func (s step) runQuorum(ctx context.Context) error {
+	errs := make([]error, len(s.pingers))
+	var wg sync.WaitGroup
+	for i, p := range s.pingers {
+		wg.Add(1)
+		go func(i int, p Pinger) {
+			defer wg.Done()
+			errs[i] = safePing(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	e := &QuorumError{Need: s.need}
+	for _, err := range errs {
+		if err == nil {
+			e.Got++
+		} else {
+			e.Errs = append(e.Errs, err)
+		}
+	}
+	if e.Got >= e.Need {
+		return nil
+	}
+	return e
+}
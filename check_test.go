@@ -0,0 +1,88 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestCheck(t *testing.T) {
+	up := func(id string) *pg { return &pg{id: id} }
+	down := func(id string) *pg { return &pg{id: id, shouldFail: true} }
+	ctx := context.Background()
+
+	p := tracer.Check("api").
+		Then(up("dns")).
+		Fallback(down("primary"), up("replica")).
+		Quorum(2, up("n1"), down("n2"), up("n3")).
+		Build()
+	if p.ID() != "api" {
+		t.Fatalf("unexpected id: found %v, expected %v", p.ID(), "api")
+	}
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	p = tracer.Check("api").
+		Sequence(up("dns"), up("tcp")).
+		Quorum(2, up("n1"), down("n2"), down("n3")).
+		Build()
+	err := p.Ping(ctx)
+	var serr *tracer.StepError
+	if !errors.As(err, &serr) || serr.Step != 2 {
+		t.Fatalf("unexpected error: found %v, expected a failure of step 2", err)
+	}
+	var qerr *tracer.QuorumError
+	if !errors.As(err, &qerr) || qerr.Got != 1 || len(qerr.Errs) != 2 {
+		t.Fatalf("unexpected error: found %v, expected a quorum error", err)
+	}
+}
+
+func TestCheckRetry(t *testing.T) {
+	p := &flipPinger{pg: pg{id: "flaky"}, fail: 1}
+	c := tracer.Check("flaky").Then(p).Retry(1, time.Millisecond*20).Build()
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		atomic.StoreInt32(&p.fail, 0)
+	}()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := newSlowPinger("slow")
+	time.AfterFunc(time.Millisecond*5, func() { close(slow.release) })
+	c = tracer.Check("slow").Then(slow).MaxLatency(time.Millisecond).Build()
+	var lerr *tracer.LatencyError
+	if err := c.Ping(context.Background()); !errors.As(err, &lerr) {
+		t.Fatalf("unexpected error: found %v, expected a latency error", err)
+	}
+}
@@ -0,0 +1,402 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Command tracer monitors the targets described by URL specs, see
+// tracer.ParsePinger, from the command line:
+//
+//	tracer watch [flags] [spec...]   print the check results until interrupted
+//	tracer wait [flags] [spec...]    exit 0 once every target is online
+//	tracer report [flags] [spec...]  check the targets and print a summary
+//
+// Specs are given as arguments, with the -t flag, which may be repeated,
+// or in the file named by the -config flag, one per line; empty lines and
+// lines starting with # are ignored. Output is human readable, or JSON
+// lines with the -json flag, written to the file named by the -o flag of
+// watch if any. wait exits 1 when -timeout expires first, every command
+// exits 2 on usage errors.
+//
+// On Windows, watch -service runs as a Windows service: the service
+// control manager stops the tracer with Stop or Shutdown.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+const usage = `usage: tracer <command> [flags] [spec...]
+
+commands:
+  watch   print the check results and state transitions until interrupted
+  wait    exit 0 once every target is online, 1 if -timeout expires first
+  report  check the targets for -duration and print a summary
+
+Run tracer <command> -h for the flags of a command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// specs is a flag.Value collecting the -t flags.
+type specs []string
+
+func (s *specs) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *specs) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// config is the configuration shared by the commands.
+type config struct {
+	specs    specs
+	file     string
+	json     bool
+	refresh  time.Duration
+	timeout  time.Duration
+	duration time.Duration
+	output   string
+	service  bool
+}
+
+// run runs the command described by args and returns its exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+
+	var c config
+	fs := flag.NewFlagSet("tracer "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Var(&c.specs, "t", "target `spec`, may be repeated")
+	fs.StringVar(&c.file, "config", "", "`file` listing the target specs, one per line")
+	fs.BoolVar(&c.json, "json", false, "print JSON lines")
+	fs.DurationVar(&c.refresh, "refresh", 4*time.Second, "time between the checks of the targets")
+	switch cmd {
+	case "watch":
+		fs.StringVar(&c.output, "o", "", "append the output to `file` instead of the standard output")
+		if serviceSupported {
+			fs.BoolVar(&c.service, "service", false, "run as a Windows service")
+		}
+	case "wait":
+		fs.DurationVar(&c.timeout, "timeout", 0, "give up after this long, never if zero")
+	case "report":
+		fs.DurationVar(&c.duration, "duration", 0, "check the targets for this long, once if zero")
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "tracer: unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	c.specs = append(c.specs, fs.Args()...)
+
+	pingers, err := c.pingers()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if len(pingers) == 0 {
+		fmt.Fprintln(stderr, "tracer: no targets")
+		return 2
+	}
+	t := tracer.New(tracer.WithPubSub(nil))
+	t.RefreshRate = c.refresh
+	for _, p := range pingers {
+		if err := t.Trace(p); err != nil {
+			fmt.Fprintf(stderr, "tracer: %v: %v\n", p.ID(), err)
+			return 2
+		}
+	}
+
+	if c.output != "" {
+		f, err := os.OpenFile(c.output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		stdout = f
+	}
+	out := &printer{w: stdout, json: c.json}
+	switch cmd {
+	case "watch":
+		if c.service {
+			code, err := runService(ctx, func(ctx context.Context) int {
+				return watch(ctx, t, out, stderr)
+			})
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			return code
+		}
+		return watch(ctx, t, out, stderr)
+	case "wait":
+		return wait(ctx, t, c.timeout, out, stderr)
+	default:
+		return report(ctx, t, c.duration, out, stderr)
+	}
+}
+
+// pingers parses the specs of c and the ones of its config file.
+func (c *config) pingers() ([]tracer.Pinger, error) {
+	all := append([]string(nil), c.specs...)
+	if c.file != "" {
+		f, err := os.Open(c.file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			all = append(all, line)
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	var pingers []tracer.Pinger
+	for _, spec := range all {
+		p, err := tracer.ParsePinger(spec)
+		if err != nil {
+			return nil, err
+		}
+		pingers = append(pingers, p)
+	}
+	return pingers, nil
+}
+
+func watch(ctx context.Context, t *tracer.Tracer, out *printer, stderr io.Writer) int {
+	events, cancel := t.SubscribeTopics("", tracer.TopicConn, tracer.TopicConnTransition)
+	defer cancel()
+	if err := t.RunContext(ctx); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer t.Close()
+	for {
+		select {
+		case e := <-events:
+			out.event(e)
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
+
+func wait(ctx context.Context, t *tracer.Tracer, timeout time.Duration, out *printer, stderr io.Writer) int {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	events, cancel := t.SubscribeTopics("", tracer.TopicConn)
+	defer cancel()
+	if err := t.RunContext(ctx); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer t.Close()
+
+	pending := make(map[string]bool)
+	for _, info := range t.Targets() {
+		pending[info.ID] = true
+	}
+	for len(pending) > 0 {
+		select {
+		case e := <-events:
+			m := e.Value.(tracer.Message)
+			if m.Err == nil && pending[m.ID] {
+				delete(pending, m.ID)
+				out.event(e)
+			}
+		case <-ctx.Done():
+			for id := range pending {
+				fmt.Fprintf(stderr, "tracer: %v: not online\n", id)
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func report(ctx context.Context, t *tracer.Tracer, d time.Duration, out *printer, stderr io.Writer) int {
+	events, cancel := t.Events()
+	defer cancel()
+	if err := t.RunContext(ctx); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+	} else {
+		// Once every target was checked.
+		checked := make(map[string]bool)
+		for n := len(t.Targets()); len(checked) < n; {
+			select {
+			case m := <-events:
+				if !m.Canceled {
+					checked[m.ID] = true
+				}
+			case <-ctx.Done():
+				n = 0
+			}
+		}
+	}
+	t.Close()
+
+	stats := t.AllStats()
+	infos := t.Targets()
+	if out.json {
+		for _, info := range infos {
+			out.line(newReportEntry(info, stats[info.ID]))
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(out.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATE\tLATENCY\tCHECKS\tFAILURES\tERROR")
+	for _, info := range infos {
+		st := stats[info.ID]
+		errMsg := ""
+		if info.Err != nil {
+			errMsg = info.Err.Error()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", info.ID, tracer.StateString(info.State),
+			info.Latency.Round(time.Microsecond), st.Successes+st.Failures, st.Failures, errMsg)
+	}
+	tw.Flush()
+	return 0
+}
+
+// transition is the JSON representation of a Transition, as in the
+// streams of tracer.StreamHandler.
+type transition struct {
+	ID       string        `json:"id"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+}
+
+// reportEntry is the JSON representation of a target in a report.
+type reportEntry struct {
+	ID        string        `json:"id"`
+	State     string        `json:"state"`
+	Latency   time.Duration `json:"latency"`
+	Successes uint64        `json:"successes"`
+	Failures  uint64        `json:"failures"`
+	Err       string        `json:"err,omitempty"`
+}
+
+func newReportEntry(info tracer.TargetInfo, st tracer.TargetStats) reportEntry {
+	e := reportEntry{
+		ID:        info.ID,
+		State:     tracer.StateString(info.State),
+		Latency:   info.Latency,
+		Successes: st.Successes,
+		Failures:  st.Failures,
+	}
+	if info.Err != nil {
+		e.Err = info.Err.Error()
+	}
+	return e
+}
+
+// printer prints events, human readable or as JSON lines.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// line prints v as a JSON line.
+func (p *printer) line(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(p.w, "{\"error\": %q}\n", err)
+		return
+	}
+	fmt.Fprintf(p.w, "%s\n", b)
+}
+
+// event prints e, a Message or a Transition.
+func (p *printer) event(e tracer.Event) {
+	switch v := e.Value.(type) {
+	case tracer.Message:
+		if p.json {
+			p.line(struct {
+				Type string         `json:"type"`
+				Data tracer.Message `json:"data"`
+			}{"message", v})
+			return
+		}
+		status := tracer.StateString(v.State)
+		if v.Err != nil {
+			status += ": " + v.Err.Error()
+		}
+		fmt.Fprintf(p.w, "%v %v %v %v\n", v.Timestamp.Format(time.RFC3339), v.ID, v.Latency.Round(time.Microsecond), status)
+	case tracer.Transition:
+		if p.json {
+			p.line(struct {
+				Type string     `json:"type"`
+				Data transition `json:"data"`
+			}{"transition", transition{v.ID, v.From, v.To, v.At, v.Duration}})
+			return
+		}
+		fmt.Fprintf(p.w, "%v %v %v -> %v after %v\n", v.At.Format(time.RFC3339), v.ID,
+			tracer.StateString(v.From), tracer.StateString(v.To), v.Duration.Round(time.Second))
+	}
+}
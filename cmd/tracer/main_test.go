@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	up := "tcp://" + l.Addr().String() + "?timeout=1s#db"
+
+	// A closed listener refuses connections.
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := "tcp://" + l2.Addr().String() + "?timeout=1s#web"
+	l2.Close()
+
+	config := filepath.Join(t.TempDir(), "targets")
+	if err := os.WriteFile(config, []byte("# targets\n\n"+up+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{"frob"}, 2},
+		{[]string{"wait"}, 2},
+		{[]string{"wait", "-t", "tcp://"}, 2},
+		{[]string{"wait", "-timeout", "5s", "-config", config}, 0},
+		{[]string{"wait", "-timeout", "200ms", up, down}, 1},
+		{[]string{"report", up, down}, 0},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(ctx, tt.args, &stdout, &stderr); code != tt.code {
+			t.Fatalf("unexpected exit code of %v: found %v, expected %v (%v)", tt.args, code, tt.code, stderr.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(ctx, []string{"report", "-json", "-t", up, down}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code: found %v, expected 0 (%v)", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected report lines: found %q, expected 2", lines)
+	}
+	states := make(map[string]reportEntry)
+	for _, line := range lines {
+		var e reportEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		states[e.ID] = e
+	}
+	if e := states["db"]; e.Err != "" || e.Successes != 1 {
+		t.Fatalf("unexpected db report: found %+v, expected a success", e)
+	}
+	if e := states["web"]; e.Err == "" || e.Failures != 1 {
+		t.Fatalf("unexpected web report: found %+v, expected a failure", e)
+	}
+
+	wctx, wcancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer wcancel()
+	stdout.Reset()
+	if code := run(wctx, []string{"watch", "-json", up}, &stdout, &stderr); code != 0 {
+		t.Fatalf("unexpected exit code: found %v, expected 0 (%v)", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), `{"type":"message","data":{`) {
+		t.Fatalf("unexpected watch output: found %q", stdout.String())
+	}
+}
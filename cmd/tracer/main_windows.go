@@ -0,0 +1,163 @@
+//go:build windows
+
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// serviceSupported enables the -service flag of watch.
+const serviceSupported = true
+
+// serviceName is the name the process registers with the service control
+// manager, ignored for services running in a process of their own.
+const serviceName = "tracer"
+
+var (
+	advapi32                     = syscall.NewLazyDLL("advapi32.dll")
+	startServiceCtrlDispatcher   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	registerServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	setServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+// Constants of the service control manager, see winsvc.h and winerror.h.
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped     = 1
+	serviceStopPending = 3
+	serviceRunning     = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented     = 120
+	errorServiceSpecificError   = 1066
+	errorFailedServiceCtrlStart = 1063
+)
+
+// serviceStatus mirrors SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry mirrors SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// service is the state of the process running as a service. The service
+// control manager calls back from threads of its own, with no way to
+// pass it along.
+var service struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	run    func(context.Context) int
+	handle uintptr
+	code   int
+}
+
+// runService runs f as the Windows service of the process, returning its
+// exit code once the service control manager stopped it, which cancels
+// the context passed to f.
+func runService(ctx context.Context, f func(context.Context) int) (int, error) {
+	service.ctx, service.cancel = context.WithCancel(ctx)
+	defer service.cancel()
+	service.run = f
+
+	name, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return 1, err
+	}
+	table := []serviceTableEntry{{name: name, proc: syscall.NewCallback(serviceMain)}, {}}
+	if ok, _, err := startServiceCtrlDispatcher.Call(uintptr(unsafe.Pointer(&table[0]))); ok == 0 {
+		if errno, is := err.(syscall.Errno); is && errno == errorFailedServiceCtrlStart {
+			return 1, fmt.Errorf("tracer: -service is for the service control manager: %w", err)
+		}
+		return 1, fmt.Errorf("StartServiceCtrlDispatcher: %w", err)
+	}
+	return service.code, nil
+}
+
+// serviceMain is the ServiceMain function of the process.
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	name, _ := syscall.UTF16PtrFromString(serviceName)
+	h, _, _ := registerServiceCtrlHandlerEx.Call(uintptr(unsafe.Pointer(name)), syscall.NewCallback(serviceHandler), 0)
+	if h == 0 {
+		service.code = 1
+		return 0
+	}
+	service.handle = h
+	setStatus(serviceRunning, serviceAcceptStop|serviceAcceptShutdown, 0)
+	service.code = service.run(service.ctx)
+	setStatus(serviceStopped, 0, service.code)
+	return 0
+}
+
+// serviceHandler is the HandlerEx function of the service, stopping it
+// on Stop and Shutdown.
+func serviceHandler(control, eventType, eventData, userContext uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setStatus(serviceStopPending, 0, 0)
+		service.cancel()
+		return 0
+	case serviceControlInterrogate:
+		return 0
+	default:
+		return errorCallNotImplemented
+	}
+}
+
+// setStatus reports the state of the service, with the exit code of the
+// process when stopped.
+func setStatus(state, accepts uint32, code int) {
+	st := serviceStatus{
+		ServiceType:      serviceWin32OwnProcess,
+		CurrentState:     state,
+		ControlsAccepted: accepts,
+	}
+	if code != 0 {
+		st.Win32ExitCode = errorServiceSpecificError
+		st.ServiceSpecificExitCode = uint32(code)
+	}
+	setServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(&st)))
+}
@@ -0,0 +1,99 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2018-01-01 was a Monday.
+	from := time.Date(2018, 1, 1, 10, 30, 15, 0, time.UTC)
+	tt := []struct {
+		spec string
+		next string
+	}{
+		{"* * * * *", "2018-01-01 10:31"},
+		{"*/15 * * * *", "2018-01-01 10:45"},
+		{"0 2 * * *", "2018-01-02 02:00"},
+		{"@weekly", "2018-01-07 00:00"},
+		{"30 22 * * 1-5", "2018-01-01 22:30"},
+		{"0 0 * * 7", "2018-01-07 00:00"},
+		{"0 0 15 * 5", "2018-01-05 00:00"},
+		{"0 12 1 3 *", "2018-03-01 12:00"},
+		{"5,10 8-18/5 * * *", "2018-01-01 13:05"},
+	}
+	for _, test := range tt {
+		c, err := tracer.ParseCron(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := c.Next(from).Format("2006-01-02 15:04"); next != test.next {
+			t.Fatalf("%v: unexpected next time: found %v, expected %v", test.spec, next, test.next)
+		}
+	}
+
+	c, _ := tracer.ParseCron("0 0 30 2 *")
+	if next := c.Next(from); !next.IsZero() {
+		t.Fatalf("unexpected next time: found %v, expected none", next)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := tracer.ParseCron(spec); err == nil {
+			t.Fatalf("%q: spec should be rejected", spec)
+		}
+	}
+}
+
+func TestBlackoutActive(t *testing.T) {
+	c, err := tracer.ParseCron("0 2 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &tracer.Blackout{Schedule: c, Duration: time.Hour, IDs: []string{"db"}, Location: time.UTC}
+	sunday := time.Date(2018, 1, 7, 2, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		id     string
+		at     time.Time
+		active bool
+	}{
+		{"db", sunday, true},
+		{"db", sunday.Add(59 * time.Minute), true},
+		{"db", sunday.Add(time.Hour), false},
+		{"db", sunday.Add(-time.Second), false},
+		{"app", sunday, false},
+	}
+	for _, test := range tt {
+		if active := b.Active(test.id, test.at); active != test.active {
+			t.Fatalf("%v at %v: found %v, expected %v", test.id, test.at, active, test.active)
+		}
+	}
+}
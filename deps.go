@@ -0,0 +1,120 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDependencyCycle is returned by DependsOn when the dependencies
+// declared would make a target depend on itself.
+var ErrDependencyCycle = errors.New("tracer: dependency cycle")
+
+// depGraph keeps the dependencies among targets along with which of them
+// are offline. Its lock may be taken while holding the lock of a target,
+// never the other way round.
+type depGraph struct {
+	sync.Mutex
+	deps    map[string][]string // upstream targets by ID
+	offline map[string]bool
+}
+
+// DependsOn declares that the target stored with id depends on the
+// upstream targets, e.g. an application on its database and the database
+// on the switch it is connected to, replacing the dependencies declared
+// before. While one of the upstream targets, directly or not, is offline,
+// the Messages about id going offline carry the ID of the most upstream
+// offline target in RootCause, so that consumers can report the root cause
+// of an outage instead of a cascade of alerts.
+// Targets do not need to be traced when their dependencies are declared.
+// Returns ErrDependencyCycle if a target would end up depending on itself.
+func (t *Tracer) DependsOn(id string, upstream ...string) error {
+	g := &t.deps
+	g.Lock()
+	defer g.Unlock()
+
+	for _, u := range upstream {
+		if u == id || g.reaches(u, id, make(map[string]bool)) {
+			return ErrDependencyCycle
+		}
+	}
+	if g.deps == nil {
+		g.deps = make(map[string][]string)
+	}
+	if len(upstream) == 0 {
+		delete(g.deps, id)
+		return nil
+	}
+	g.deps[id] = append([]string(nil), upstream...)
+	return nil
+}
+
+// reaches reports whether to is upstream of from. Must be called with g
+// locked.
+func (g *depGraph) reaches(from, to string, seen map[string]bool) bool {
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+	for _, u := range g.deps[from] {
+		if u == to || g.reaches(u, to, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// update records the state of id and returns the root cause of its
+// failure, if any.
+func (g *depGraph) update(id string, state int) string {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.offline == nil {
+		g.offline = make(map[string]bool)
+	}
+	if state != ConnOffline {
+		delete(g.offline, id)
+		return ""
+	}
+	g.offline[id] = true
+	return g.rootCause(id)
+}
+
+// rootCause returns the most upstream offline target id depends on, or
+// the empty string. Must be called with g locked.
+func (g *depGraph) rootCause(id string) string {
+	for _, u := range g.deps[id] {
+		if !g.offline[u] {
+			continue
+		}
+		if root := g.rootCause(u); root != "" {
+			return root
+		}
+		return u
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestDependsOn(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.DependsOn("app", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.DependsOn("db", "switch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.DependsOn("switch", "app"); err != tracer.ErrDependencyCycle {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrDependencyCycle)
+	}
+
+	pingers := make(map[string]*flipPinger)
+	for _, id := range []string{"switch", "db", "app"} {
+		pingers[id] = &flipPinger{pg: pg{id: id}}
+		if err := tr.Trace(pingers[id]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, id := range []string{"switch", "db", "app"} {
+		atomic.StoreInt32(&pingers[id].fail, 1)
+		if err := tr.WaitUntilOffline(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"db", "app"} {
+		m, err := tr.Last(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.RootCause != "switch" {
+			t.Fatalf("unexpected root cause of %v: found %q, expected %q", id, m.RootCause, "switch")
+		}
+	}
+	if m, _ := tr.Last("switch"); m.RootCause != "" {
+		t.Fatalf("unexpected root cause of switch: found %q, expected none", m.RootCause)
+	}
+
+	// Once the switch is back, db is the root cause of app failures.
+	atomic.StoreInt32(&pingers["switch"].fail, 0)
+	if err := tr.WaitUntilOnline(ctx, "switch"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		m, _ := tr.Last("app")
+		if m.RootCause == "db" {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("unexpected root cause of app: found %q, expected %q", m.RootCause, "db")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+)
+
+// RecordChanged is published on TopicChange when the addresses a name
+// resolves to change, see WithChangeDetection. Old and New are sorted.
+type RecordChanged struct {
+	ID   string
+	Name string
+	Old  []string
+	New  []string
+}
+
+// DNSPinger is a Pinger that considers a target reachable when its name
+// resolves to at least one address.
+type DNSPinger struct {
+	name     string
+	opts     *options
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	answers []string // last addresses resolved, sorted
+	events  []interface{}
+}
+
+// NewDNSPinger returns a DNSPinger that resolves name. Unless WithID is
+// used, name is the ID of the Pinger. WithNameserver selects the DNS server
+// to query, WithDNSSEC requires the answers to be authenticated.
+func NewDNSPinger(name string, opts ...Option) *DNSPinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = name
+	}
+	return &DNSPinger{name: name, opts: o, resolver: o.resolver()}
+}
+
+// ID implements Pinger.
+func (p *DNSPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger. Returns the address of the name server when
+// WithNameserver is used, the name being resolved otherwise.
+func (p *DNSPinger) Addr() net.Addr {
+	if p.opts.nameserver != "" {
+		return &netAddr{network: "udp", addr: p.opts.nameserver}
+	}
+	return &netAddr{network: "dns", addr: p.name}
+}
+
+// Ping implements Pinger. The addresses the name resolves to are passed
+// to validators as a []string.
+func (p *DNSPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger. Returns the addresses the name
+// resolves to as a []string.
+func (p *DNSPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	if p.opts.dnssec {
+		addrs, err := p.lookupDNSSEC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.compare(addrs)
+		return addrs, p.opts.validate(addrs)
+	}
+
+	var addrs []string
+	switch p.opts.family {
+	case IPv4, IPv6:
+		network := "ip4"
+		if p.opts.family == IPv6 {
+			network = "ip6"
+		}
+		ips, err := p.resolver.LookupIP(ctx, network, p.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+	default:
+		var err error
+		if addrs, err = p.resolver.LookupHost(ctx, p.name); err != nil {
+			return nil, err
+		}
+	}
+	p.compare(addrs)
+	return addrs, p.opts.validate(addrs)
+}
+
+// compare records a RecordChanged event if addrs differ from the
+// addresses resolved by the previous ping, when change detection is on.
+func (p *DNSPinger) compare(addrs []string) {
+	if !p.opts.changes {
+		return
+	}
+	answers := append([]string(nil), addrs...)
+	sort.Strings(answers)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.answers != nil && !equalStrings(p.answers, answers) {
+		p.events = append(p.events, RecordChanged{ID: p.ID(), Name: p.name, Old: p.answers, New: answers})
+	}
+	p.answers = answers
+}
+
+// Events implements EventPinger, returning the RecordChanged events
+// noticed since the last call.
+func (p *DNSPinger) Events() []interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := p.events
+	p.events = nil
+	return events
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
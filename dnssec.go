@@ -0,0 +1,284 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// ErrDNSSECBogus is returned by DNS pingers checking DNSSEC when the
+// resolver could not validate the signatures of the answer: the name
+// resolves, but its zone is badly signed.
+var ErrDNSSECBogus = errors.New("tracer: DNSSEC validation failed")
+
+// ErrDNSSECInsecure is returned by DNS pingers checking DNSSEC when the
+// answer was not authenticated by the resolver, e.g. because the zone is
+// not signed or the resolver does not validate.
+var ErrDNSSECInsecure = errors.New("tracer: DNS answer not authenticated")
+
+// DNS message constants used by the DNSSEC check.
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsTypeOPT  = 41
+	dnsClassIN  = 1
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+)
+
+// lookupDNSSEC resolves the name of p asking its nameserver, a
+// validating resolver, to authenticate the answers.
+func (p *DNSPinger) lookupDNSSEC(ctx context.Context) ([]string, error) {
+	types := []uint16{dnsTypeA, dnsTypeAAAA}
+	switch p.opts.family {
+	case IPv4:
+		types = types[:1]
+	case IPv6:
+		types = types[1:]
+	}
+
+	var addrs []string
+	for _, qtype := range types {
+		resp, err := p.exchange(ctx, qtype, false)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.rcode == dnsRcodeServFail:
+			// Checking disabled tells signing problems from
+			// plain failures.
+			if cd, err := p.exchange(ctx, qtype, true); err == nil && cd.rcode == dnsRcodeSuccess {
+				return nil, fmt.Errorf("%w for %v", ErrDNSSECBogus, p.name)
+			}
+			return nil, &net.DNSError{Err: "server misbehaving", Name: p.name, Server: p.nameserver(), IsTemporary: true}
+		case resp.rcode == dnsRcodeNXDomain:
+			return nil, &net.DNSError{Err: "no such host", Name: p.name, Server: p.nameserver(), IsNotFound: true}
+		case resp.rcode != dnsRcodeSuccess:
+			return nil, &net.DNSError{Err: fmt.Sprintf("unexpected rcode %d", resp.rcode), Name: p.name, Server: p.nameserver()}
+		case !resp.authenticated:
+			return nil, fmt.Errorf("%w for %v", ErrDNSSECInsecure, p.name)
+		}
+		for _, ip := range resp.ips {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: p.name, Server: p.nameserver(), IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// nameserver returns the address of the resolver queried by
+// lookupDNSSEC: the one set with WithNameserver, the first one of
+// /etc/resolv.conf otherwise.
+func (p *DNSPinger) nameserver() string {
+	if p.opts.nameserver != "" {
+		return p.opts.nameserver
+	}
+	if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if f := strings.Fields(s.Text()); len(f) >= 2 && f[0] == "nameserver" {
+				return net.JoinHostPort(f[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// dnsResponse is the part of a DNS response lookupDNSSEC cares about.
+type dnsResponse struct {
+	rcode         int
+	authenticated bool
+	truncated     bool
+	ips           []net.IP
+}
+
+// exchange sends a query for records of qtype, disabling checking if cd
+// is set, and parses the response. Truncated responses are retried over
+// TCP.
+func (p *DNSPinger) exchange(ctx context.Context, qtype uint16, cd bool) (*dnsResponse, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(b[:])
+	query, err := dnsQuery(id, p.name, qtype, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		conn, err := p.opts.dial(ctx, network, p.nameserver())
+		if err != nil {
+			return nil, err
+		}
+		msg, err := roundTrip(ctx, conn, query)
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := parseDNSResponse(msg, id, qtype)
+		if err != nil {
+			return nil, err
+		}
+		if !resp.truncated {
+			return resp, nil
+		}
+	}
+	return nil, errors.New("tracer: truncated DNS response")
+}
+
+// roundTrip writes query on conn and reads the response, with the two
+// bytes length prefix on stream connections.
+func roundTrip(ctx context.Context, conn net.Conn, query []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	_, packet := conn.(net.PacketConn)
+	if !packet {
+		query = append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	if packet {
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		return buf[:n], err
+	}
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	_, err := io.ReadFull(conn, buf)
+	return buf, err
+}
+
+// dnsQuery encodes a recursive query for records of type qtype about
+// name, asking for authenticated data and advertising DNSSEC support with
+// an EDNS0 record (RFC 4035, RFC 6840).
+func dnsQuery(id uint16, name string, qtype uint16, cd bool) ([]byte, error) {
+	flags := uint16(0x0100 | 0x0020) // recursion desired, authenticated data
+	if cd {
+		flags |= 0x0010
+	}
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = append(msg, 0, 1, 0, 0, 0, 0, 0, 1) // one question, one additional record
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("tracer: invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+
+	// OPT record: root name, type, UDP payload size, extended rcode
+	// and version, DO bit, no data.
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeOPT)
+	msg = binary.BigEndian.AppendUint16(msg, 4096)
+	msg = append(msg, 0, 0, 0x80, 0, 0, 0)
+	return msg, nil
+}
+
+// parseDNSResponse parses msg, the response to the query id about
+// records of type qtype, collecting the addresses answered.
+func parseDNSResponse(msg []byte, id, qtype uint16) (*dnsResponse, error) {
+	malformed := errors.New("tracer: malformed DNS response")
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return nil, malformed
+	}
+	resp := &dnsResponse{
+		rcode:         int(msg[3] & 0x0f),
+		authenticated: msg[3]&0x20 != 0,
+		truncated:     msg[2]&0x02 != 0,
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		if off = skipName(msg, off); off < 0 || off+4 > len(msg) {
+			return nil, malformed
+		}
+		off += 4
+	}
+	for i := 0; i < ancount; i++ {
+		if off = skipName(msg, off); off < 0 || off+10 > len(msg) {
+			return nil, malformed
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, malformed
+		}
+		data := msg[off : off+rdlen]
+		off += rdlen
+		if typ != qtype || (typ == dnsTypeA && rdlen != net.IPv4len) || (typ == dnsTypeAAAA && rdlen != net.IPv6len) {
+			continue
+		}
+		resp.ips = append(resp.ips, net.IP(append([]byte(nil), data...)))
+	}
+	return resp, nil
+}
+
+// skipName returns the offset following the name starting at off in
+// msg, -1 if the name is malformed.
+func skipName(msg []byte, off int) int {
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xc0 == 0xc0:
+			// Compression pointer, the name ends here.
+			return off + 2
+		case l > 63:
+			return -1
+		}
+		off += l + 1
+	}
+	return -1
+}
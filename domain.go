@@ -0,0 +1,269 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDomainExpired is returned by DomainPinger when the registration of
+// the domain has expired.
+var ErrDomainExpired = errors.New("tracer: domain expired")
+
+// DefaultRDAPServer is the RDAP service queried by DomainPinger unless
+// WithRDAPServer is used. It redirects queries to the registry
+// responsible for the top level domain.
+const DefaultRDAPServer = "https://rdap.org"
+
+// DomainExpiry is the outcome of a DomainPinger check.
+type DomainExpiry struct {
+	Name      string
+	Registrar string    // empty if the registry does not say
+	Expires   time.Time // expiration date of the registration
+	Checked   time.Time // when the registry was queried
+}
+
+// DomainExpiring is published on TopicDomain when the registration of a
+// domain expires within Tracer.DomainExpiryWarning, or has expired
+// already. It is published once per expiration date: a renewal that still
+// expires soon is reported again.
+type DomainExpiring struct {
+	ID      string
+	Name    string
+	Expires time.Time
+
+	// Remaining is the time left before expiry, negative if the
+	// registration has expired.
+	Remaining time.Duration
+}
+
+// DomainPinger is a Pinger watching the registration of a domain through
+// RDAP, the successor of WHOIS, so that renewals are not forgotten. Pings
+// fail with ErrDomainExpired once the registration has expired; the
+// *DomainExpiry found is returned as details of the ping, see
+// DetailPinger, and passed to validators. Registries are queried at most
+// once a day unless WithMinInterval says otherwise, set
+// Tracer.DomainExpiryWarning to be warned ahead of expiry.
+type DomainPinger struct {
+	name   string
+	server *url.URL
+	opts   *options
+	client *http.Client
+
+	mu      sync.Mutex
+	last    *DomainExpiry
+	lastErr error
+}
+
+// NewDomainPinger returns a DomainPinger watching name, which is its ID
+// as well unless WithID is used. Returns an error if the URL set by
+// WithRDAPServer is not valid.
+func NewDomainPinger(name string, opts ...Option) (*DomainPinger, error) {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = name
+	}
+	if o.interval == 0 {
+		o.interval = 24 * time.Hour
+	}
+	rawurl := o.rdap
+	if rawurl == "" {
+		rawurl = DefaultRDAPServer
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("tracer: unsupported RDAP server %q", rawurl)
+	}
+	return &DomainPinger{
+		name:   strings.TrimSuffix(name, "."),
+		server: u,
+		opts:   o,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           o.proxy,
+				DialContext:     o.dial,
+				TLSClientConfig: o.tlsConfig,
+			},
+		},
+	}, nil
+}
+
+// ID implements Pinger.
+func (p *DomainPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger, returning the address of the RDAP server.
+func (p *DomainPinger) Addr() net.Addr {
+	return &netAddr{network: "tcp", addr: p.server.Host}
+}
+
+// Ping implements Pinger.
+func (p *DomainPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the *DomainExpiry.
+func (p *DomainPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	if last := p.last; last != nil && p.opts.interval > 0 && time.Since(last.Checked) < p.opts.interval {
+		err := p.lastErr
+		p.mu.Unlock()
+		return last, err
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	d, err := p.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Expires.After(d.Checked) {
+		err = fmt.Errorf("%w on %v", ErrDomainExpired, d.Expires.Format("2006-01-02"))
+	} else {
+		err = p.opts.validate(d)
+	}
+
+	p.mu.Lock()
+	p.last, p.lastErr = d, err
+	p.mu.Unlock()
+	return d, err
+}
+
+// rdapDomain is the part of an RDAP domain object, see RFC 9083, used
+// by DomainPinger.
+type rdapDomain struct {
+	Events []struct {
+		Action string    `json:"eventAction"`
+		Date   time.Time `json:"eventDate"`
+	} `json:"events"`
+	Entities []struct {
+		Roles      []string          `json:"roles"`
+		VCardArray []json.RawMessage `json:"vcardArray"`
+	} `json:"entities"`
+}
+
+// lookup queries the RDAP server for the registration of the domain.
+func (p *DomainPinger) lookup(ctx context.Context) (*DomainExpiry, error) {
+	u := *p.server
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/domain/" + p.name
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("tracer: domain %v not registered", p.name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracer: unexpected RDAP status %v", resp.Status)
+	}
+
+	var obj rdapDomain
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("tracer: invalid RDAP response: %v", err)
+	}
+	d := &DomainExpiry{Name: p.name, Checked: time.Now()}
+	for _, e := range obj.Events {
+		if e.Action == "expiration" {
+			d.Expires = e.Date
+		}
+	}
+	if d.Expires.IsZero() {
+		return nil, fmt.Errorf("tracer: no expiration date for %v", p.name)
+	}
+	for _, e := range obj.Entities {
+		for _, r := range e.Roles {
+			if r == "registrar" {
+				d.Registrar = vcardName(e.VCardArray)
+			}
+		}
+	}
+	return d, nil
+}
+
+// vcardName returns the formatted name in a jCard, see RFC 7095: an
+// array holding "vcard" and the properties, each one being an array of
+// name, parameters, type and value.
+func vcardName(card []json.RawMessage) string {
+	if len(card) < 2 {
+		return ""
+	}
+	var props [][]interface{}
+	if err := json.Unmarshal(card[1], &props); err != nil {
+		return ""
+	}
+	for _, prop := range props {
+		if len(prop) < 4 || prop[0] != "fn" {
+			continue
+		}
+		if s, ok := prop[3].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// checkDomain publishes a DomainExpiring event when details, the outcome
+// of the last ping of tg, is a *DomainExpiry expiring within
+// DomainExpiryWarning that was not reported yet.
+func (t *Tracer) checkDomain(tg *target, details interface{}) {
+	d, ok := details.(*DomainExpiry)
+	if !ok || t.DomainExpiryWarning <= 0 {
+		return
+	}
+	remaining := d.Expires.Sub(t.now())
+	if remaining > t.DomainExpiryWarning {
+		return
+	}
+	tg.Lock()
+	reported := tg.domainExpiry.Equal(d.Expires)
+	tg.domainExpiry = d.Expires
+	tg.Unlock()
+	if reported {
+		return
+	}
+	t.emit(TopicDomain, tg.ID(), DomainExpiring{ID: tg.ID(), Name: d.Name, Expires: d.Expires, Remaining: remaining})
+}
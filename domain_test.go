@@ -0,0 +1,146 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestDomainPinger(t *testing.T) {
+	var queries int32
+	expires := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		switch r.URL.Path {
+		case "/domain/example.test":
+			fmt.Fprintf(w, `{
+				"objectClassName": "domain",
+				"events": [
+					{"eventAction": "registration", "eventDate": "2001-01-01T00:00:00Z"},
+					{"eventAction": "expiration", "eventDate": %q}
+				],
+				"entities": [{
+					"roles": ["registrar"],
+					"vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Registrar"]]]
+				}]
+			}`, expires.Format(time.RFC3339))
+		case "/domain/expired.test":
+			fmt.Fprint(w, `{"events": [{"eventAction": "expiration", "eventDate": "2001-01-01T00:00:00Z"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := tracer.NewDomainPinger("example.test", tracer.WithRDAPServer(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		details, err := p.PingDetails(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := details.(*tracer.DomainExpiry)
+		if !d.Expires.Equal(expires) || d.Registrar != "Example Registrar" {
+			t.Fatalf("unexpected details: %+v", d)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Fatalf("unexpected queries: found %v, expected 1", n)
+	}
+
+	q, err := tracer.NewDomainPinger("expired.test", tracer.WithRDAPServer(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); !errors.Is(err, tracer.ErrDomainExpired) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrDomainExpired)
+	}
+	q, err = tracer.NewDomainPinger("missing.test", tracer.WithRDAPServer(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); err == nil {
+		t.Fatal("unexpected success for an unregistered domain")
+	}
+
+	// The tracer warns once ahead of expiry, however many pings.
+	for _, tt := range []struct {
+		warning time.Duration
+		events  int
+	}{
+		{24 * time.Hour, 0},
+		{30 * 24 * time.Hour, 1},
+	} {
+		p, err := tracer.NewDomainPinger("example.test", tracer.WithRDAPServer(srv.URL), tracer.WithMinInterval(time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tracer.New()
+		tr.RefreshRate = time.Millisecond
+		tr.PingTimeout = time.Second
+		tr.SkipIfRunning = true
+		tr.DomainExpiryWarning = tt.warning
+		rec := new(recorder)
+		tr.PubSub = rec
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Run(); err != nil {
+			t.Fatal(err)
+		}
+		for rec.len() < 5 {
+			time.Sleep(time.Millisecond)
+		}
+		tr.Close()
+
+		rec.Lock()
+		var events []tracer.DomainExpiring
+		for _, i := range rec.other {
+			if e, ok := i.(tracer.DomainExpiring); ok {
+				events = append(events, e)
+			}
+		}
+		rec.Unlock()
+		if len(events) != tt.events {
+			t.Fatalf("unexpected events with warning %v: found %v, expected %v", tt.warning, len(events), tt.events)
+		}
+		for _, e := range events {
+			if e.ID != "example.test" || !e.Expires.Equal(expires) || e.Remaining > 72*time.Hour || e.Remaining < 71*time.Hour {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+// DualStack returns two Pingers checking a target over IPv4 and IPv6
+// independently, built by calling newPinger with WithFamily(IPv4) and
+// WithFamily(IPv6) respectively. Their IDs are the ones given by newPinger
+// followed by "/ipv4" and "/ipv6", hence the tracer keeps a state per
+// family and a site that is up over IPv4 while IPv6 is broken is reported
+// as such:
+//
+//	pingers, err := tracer.DualStack(func(opts ...tracer.Option) (tracer.Pinger, error) {
+//		return tracer.NewHTTPPinger("https://example.com", opts...)
+//	})
+func DualStack(newPinger func(opts ...Option) (Pinger, error)) ([]Pinger, error) {
+	var pingers []Pinger
+	for _, f := range []Family{IPv4, IPv6} {
+		p, err := newPinger(WithFamily(f))
+		if err != nil {
+			return nil, err
+		}
+		pingers = append(pingers, &familyPinger{Pinger: p, id: p.ID() + "/" + f.String()})
+	}
+	return pingers, nil
+}
+
+// familyPinger is a Pinger restricted to a family, with its own ID.
+type familyPinger struct {
+	Pinger
+	id string
+}
+
+func (p *familyPinger) ID() string {
+	return p.id
+}
+
+// PingDetails implements DetailPinger, forwarding the details of the
+// wrapped Pinger, if any.
+func (p *familyPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	if dp, ok := p.Pinger.(DetailPinger); ok {
+		return dp.PingDetails(ctx)
+	}
+	return nil, p.Pinger.Ping(ctx)
+}
+
+// ConnectionState implements TLSPinger, forwarding the state of the
+// wrapped Pinger, if any.
+func (p *familyPinger) ConnectionState() *tls.ConnectionState {
+	if tp, ok := p.Pinger.(TLSPinger); ok {
+		return tp.ConnectionState()
+	}
+	return nil
+}
+
+// Events implements EventPinger, forwarding the events of the wrapped
+// Pinger, if any.
+func (p *familyPinger) Events() []interface{} {
+	if ep, ok := p.Pinger.(EventPinger); ok {
+		return ep.Events()
+	}
+	return nil
+}
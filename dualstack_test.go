@@ -0,0 +1,132 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestDualStack(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := net.JoinHostPort("localhost", strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+
+	pingers, err := tracer.DualStack(func(opts ...tracer.Option) (tracer.Pinger, error) {
+		return tracer.NewTCPPinger(addr, opts...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pingers) != 2 || pingers[0].ID() != addr+"/ipv4" || pingers[1].ID() != addr+"/ipv6" {
+		t.Fatalf("unexpected pingers: %v", pingers)
+	}
+	if err := pingers[0].Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pingers[1].Ping(context.Background()); err == nil {
+		t.Fatal("the server does not listen on IPv6")
+	}
+}
+
+func TestDNSPingerFamily(t *testing.T) {
+	s := tracertest.NewDNSServer(t)
+	s.Set("v4only.test", "10.0.0.1")
+
+	ctx := context.Background()
+	v4 := tracer.NewDNSPinger("v4only.test", tracer.WithNameserver(s.Addr()), tracer.WithFamily(tracer.IPv4))
+	if err := v4.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	v6 := tracer.NewDNSPinger("v4only.test", tracer.WithNameserver(s.Addr()), tracer.WithFamily(tracer.IPv6))
+	if err := v6.Ping(ctx); err == nil {
+		t.Fatal("the name has no AAAA records")
+	}
+
+	p, err := tracer.ParsePinger("dns://" + s.Addr() + "/v4only.test?family=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("the name has no AAAA records")
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	addr := net.JoinHostPort("dual.test", strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+
+	dns := tracertest.NewDNSServer(t)
+	dns.Set("dual.test", "127.0.0.1", "::1")
+	p := tracer.NewHappyEyeballsPinger(addr, tracer.WithNameserver(dns.Addr()), tracer.WithAttemptDelay(time.Hour))
+	details, err := p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := details.(*tracer.HappyEyeballsResult)
+	if r.Winner != tracer.IPv6 || r.Margin <= 0 {
+		t.Fatalf("unexpected result: found winner %v by %v, expected ipv6 by more than zero", r.Winner, r.Margin)
+	}
+	if r.IPv4.Err != "" || r.IPv6.Err != "" {
+		t.Fatalf("unexpected errors: %q, %q", r.IPv4.Err, r.IPv6.Err)
+	}
+
+	dns.Set("dual.test", "127.0.0.1")
+	details, err = p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = details.(*tracer.HappyEyeballsResult)
+	if r.Winner != tracer.IPv4 || r.Margin != 0 || r.IPv6.Err == "" {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	dns.Set("dual.test")
+	if err := p.Ping(context.Background()); err == nil {
+		t.Fatal("pinged a name without addresses")
+	}
+}
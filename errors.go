@@ -0,0 +1,151 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Classes of the failures to connect to a target, see DialError.
+var (
+	ErrConnRefused = errors.New("tracer: connection refused")
+	ErrTimeout     = errors.New("tracer: timed out")
+	ErrDNS         = errors.New("tracer: name resolution failed")
+)
+
+// ErrCanceled is matched by the errors of the pings cancelled by the
+// tracer itself, see Message.Canceled.
+var ErrCanceled = errors.New("tracer: ping canceled")
+
+// Kind is the class of the error of a Message, so that subscribers can
+// tell why a target is considered down without matching error messages.
+type Kind int
+
+// Possible error kinds, see Classify.
+const (
+	KindNone Kind = iota // no error
+	KindOther
+	KindTimeout
+	KindConnRefused
+	KindDNS
+	KindCanceled
+)
+
+var kindNames = []string{"none", "other", "timeout", "conn_refused", "dns", "canceled"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Unknown kinds are
+// decoded as KindOther.
+func (k *Kind) UnmarshalText(text []byte) error {
+	for i, name := range kindNames {
+		if string(text) == name {
+			*k = Kind(i)
+			return nil
+		}
+	}
+	*k = KindOther
+	return nil
+}
+
+// Classify returns the Kind of err: timeouts, ErrPingTimeout included,
+// refused connections, name resolution failures and cancellations are
+// recognized whether they were wrapped by the pinger or not.
+func Classify(err error) Kind {
+	var derr *net.DNSError
+	switch {
+	case err == nil:
+		return KindNone
+	case errors.Is(err, ErrCanceled), errors.Is(err, context.Canceled):
+		return KindCanceled
+	case errors.Is(err, ErrDNS), errors.As(err, &derr):
+		return KindDNS
+	case errors.Is(err, ErrConnRefused), errors.Is(err, syscall.ECONNREFUSED):
+		return KindConnRefused
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrPingTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return KindTimeout
+	}
+	return KindOther
+}
+
+// DialError is returned by the built-in pingers when the connection to
+// their target cannot be established. It matches the class of the failure
+// with errors.Is, e.g. errors.Is(err, ErrConnRefused), as well as the
+// underlying error.
+type DialError struct {
+	Addr  string
+	Class error // ErrConnRefused, ErrTimeout, ErrDNS or nil when unknown
+	Err   error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("tracer: dial %v: %v", e.Addr, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DialError) Is(target error) bool {
+	return e.Class != nil && target == e.Class
+}
+
+// dialError wraps err, returned dialing addr, into a *DialError.
+func dialError(addr string, err error) error {
+	var (
+		derr *net.DNSError
+		nerr net.Error
+	)
+	e := &DialError{Addr: addr, Err: err}
+	switch {
+	case errors.As(err, &derr):
+		e.Class = ErrDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		e.Class = ErrConnRefused
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &nerr) && nerr.Timeout():
+		e.Class = ErrTimeout
+	}
+	return e
+}
@@ -0,0 +1,197 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"sync"
+
+	"github.com/tecnoporto/pubsub"
+)
+
+// eventsBuffer is the capacity of the channels returned by Events.
+const eventsBuffer = 64
+
+// Event is a value published by a tracer on Topic about the target ID,
+// see SubscribeTopics.
+type Event struct {
+	Topic string
+	ID    string
+
+	// Value is what is published on Topic, e.g. a Message on
+	// TopicConn or a Transition on TopicConnTransition.
+	Value interface{}
+}
+
+// subscriber is a channel returned by Events, SubscribeID or
+// SubscribeTopics.
+type subscriber struct {
+	msgs   chan Message // TopicConn only, if set
+	events chan Event
+	topics map[string]bool // of events, every topic when empty
+}
+
+// fanout delivers the events of a tracer to its subscribers,
+// independently of its PubSub.
+type fanout struct {
+	sync.Mutex
+	// subs are the subscribers by target ID, the ones of every target
+	// are stored with the empty ID.
+	subs map[string]map[*subscriber]struct{}
+}
+
+func (f *fanout) add(id string, s *subscriber) {
+	f.Lock()
+	defer f.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[string]map[*subscriber]struct{})
+	}
+	if f.subs[id] == nil {
+		f.subs[id] = make(map[*subscriber]struct{})
+	}
+	f.subs[id][s] = struct{}{}
+}
+
+func (f *fanout) remove(id string, s *subscriber) {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.subs[id][s]; !ok {
+		return
+	}
+	delete(f.subs[id], s)
+	if len(f.subs[id]) == 0 {
+		delete(f.subs, id)
+	}
+	if s.msgs != nil {
+		close(s.msgs)
+	} else {
+		close(s.events)
+	}
+}
+
+// send hands v, published on topic about id, over to the subscribers of
+// every target and of id that have room for it, the others miss it: a
+// slow consumer never blocks the tracer.
+func (f *fanout) send(topic, id string, v interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	for _, sid := range []string{"", id} {
+		for s := range f.subs[sid] {
+			switch {
+			case s.msgs != nil:
+				if topic != TopicConn {
+					continue
+				}
+				select {
+				case s.msgs <- v.(Message):
+				default:
+				}
+			case len(s.topics) == 0 || s.topics[topic]:
+				select {
+				case s.events <- Event{Topic: topic, ID: id, Value: v}:
+				default:
+				}
+			}
+		}
+		if id == "" {
+			break
+		}
+	}
+}
+
+// subscribe returns a channel receiving the messages about id, or every
+// target when id is empty.
+func (f *fanout) subscribe(id string) (<-chan Message, pubsub.CancelFunc) {
+	s := &subscriber{msgs: make(chan Message, eventsBuffer)}
+	f.add(id, s)
+	return s.msgs, func() { f.remove(id, s) }
+}
+
+// emit publishes v on topic, when the tracer has a PubSub, and hands it
+// over to the subscribers of id.
+func (t *Tracer) emit(topic, id string, v interface{}) {
+	if t.PubSub != nil {
+		t.Pub(v, topic)
+	}
+	t.events.send(topic, id, v)
+}
+
+// Events returns a channel receiving the messages published on TopicConn,
+// for consumers that prefer plain channels to the PubSub of the tracer.
+// Messages are delivered whatever PubSub is in use, even none. The
+// channel is buffered, messages that do not fit are dropped. Call the
+// CancelFunc returned to stop receiving, which closes the channel.
+func (t *Tracer) Events() (<-chan Message, pubsub.CancelFunc) {
+	return t.events.subscribe("")
+}
+
+// SubscribeID is Events restricted to the messages about the target
+// stored with id, which need not be traced yet. Messages are routed by
+// ID, subscribers are not woken up by the other targets. As Trace
+// rejects empty IDs, the channel is closed right away when id is empty.
+// See SubscribeTopics for the events published on the other topics.
+func (t *Tracer) SubscribeID(id string) (<-chan Message, pubsub.CancelFunc) {
+	if id == "" {
+		c := make(chan Message)
+		close(c)
+		return c, func() {}
+	}
+	return t.events.subscribe(id)
+}
+
+// SubscribeTopics returns a channel receiving the events the tracer
+// publishes about the target stored with id, or about every target when
+// id is empty, on topics, or on every topic when none is given. Events
+// are routed whatever PubSub is in use, even none. The ones that are not
+// about a single target, i.e. NetworkConditions and InFlightWarnings,
+// have an empty ID and reach the subscribers of every target only. As
+// for Events, the channel is buffered and events that do not fit are
+// dropped. Call the CancelFunc returned to stop receiving, which closes
+// the channel.
+func (t *Tracer) SubscribeTopics(id string, topics ...string) (<-chan Event, pubsub.CancelFunc) {
+	s := &subscriber{events: make(chan Event, eventsBuffer)}
+	if len(topics) > 0 {
+		s.topics = make(map[string]bool)
+		for _, topic := range topics {
+			s.topics[topic] = true
+		}
+	}
+	t.events.add(id, s)
+	return s.events, func() { t.events.remove(id, s) }
+}
+
+// SubscribeFunc calls f with the messages published on TopicConn, from
+// a goroutine of its own, until the CancelFunc returned is called. The
+// messages go through the buffered channel of Events: those published
+// while f is slow to return and the buffer is full are dropped, and f
+// sees a gap in their Seq. The messages that f receives are in order.
+func (t *Tracer) SubscribeFunc(f func(Message)) pubsub.CancelFunc {
+	c, cancel := t.Events()
+	go func() {
+		for m := range c {
+			f(m)
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,173 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestEvents(t *testing.T) {
+	tr := tracer.New(tracer.WithPubSub(nil))
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+
+	c, cancel := tr.Events()
+	got := make(chan tracer.Message, 1)
+	stop := tr.SubscribeFunc(func(m tracer.Message) {
+		select {
+		case got <- m:
+		default:
+		}
+	})
+	defer stop()
+
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	for _, ch := range []<-chan tracer.Message{c, got} {
+		select {
+		case m := <-ch:
+			if m.ID != "fake" {
+				t.Fatalf("unexpected message ID: found %v, expected fake", m.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	}
+
+	cancel()
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel not closed after cancel")
+		}
+	}
+}
+
+func TestSubscribeID(t *testing.T) {
+	tr := tracer.New(tracer.WithPubSub(nil))
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+
+	c, cancel := tr.SubscribeID("fake1")
+	defer cancel()
+	for _, id := range []string{"fake1", "fake2"} {
+		if err := tr.Trace(&pg{id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	for i := 0; i < 10; i++ {
+		select {
+		case m := <-c:
+			if m.ID != "fake1" {
+				t.Fatalf("unexpected message ID: found %v, expected fake1", m.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	}
+
+	empty, _ := tr.SubscribeID("")
+	if _, ok := <-empty; ok {
+		t.Fatal("unexpected message for the empty ID")
+	}
+}
+
+func TestSubscribeTopics(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	transitions, cancel := s.Tracer.SubscribeTopics("db", tracer.TopicConnTransition)
+	defer cancel()
+	all, cancelAll := s.Tracer.SubscribeTopics("")
+	defer cancelAll()
+	for _, p := range []tracer.Pinger{
+		tracertest.NewPinger("db", tracertest.Up, tracertest.Down),
+		tracertest.NewPinger("web", tracertest.Up),
+	} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Run(time.Second * 15); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, to := range []int{tracer.ConnOnline, tracer.ConnOffline} {
+		select {
+		case e := <-transitions:
+			tr, ok := e.Value.(tracer.Transition)
+			if e.Topic != tracer.TopicConnTransition || e.ID != "db" || !ok || tr.To != to {
+				t.Fatalf("unexpected event: found %+v, expected a transition of db to %v", e, tracer.StateString(to))
+			}
+		default:
+			t.Fatal("missing transition")
+		}
+	}
+	select {
+	case e := <-transitions:
+		t.Fatalf("unexpected event: found %+v", e)
+	default:
+	}
+
+	// 2 messages and 2 transitions about db, 2 messages and 1
+	// transition about web.
+	topics := make(map[string]int)
+	for len(all) > 0 {
+		e := <-all
+		topics[e.Topic+" "+e.ID]++
+	}
+	for k, expected := range map[string]int{
+		tracer.TopicConn + " db":            2,
+		tracer.TopicConnTransition + " db":  2,
+		tracer.TopicConn + " web":           2,
+		tracer.TopicConnTransition + " web": 1,
+	} {
+		if topics[k] != expected {
+			t.Fatalf("unexpected events on %v: found %v, expected %v", k, topics[k], expected)
+		}
+	}
+}
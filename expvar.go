@@ -0,0 +1,87 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+)
+
+// ExpvarStatus is the entry of a target in the status variable published
+// by PublishExpvar.
+type ExpvarStatus struct {
+	State    string    `json:"state"`
+	Err      string    `json:"error,omitempty"`
+	Checked  time.Time `json:"checked"`
+	Latency  float64   `json:"latency_ms"`
+	Failures int       `json:"failures"`
+}
+
+// PublishExpvar publishes the live state of the tracer with package
+// expvar, hence on /debug/vars, under the following names:
+//
+//	<prefix>.targets  the number of targets
+//	<prefix>.cycles   the number of ping cycles started
+//	<prefix>.status   the ExpvarStatus of each target, by ID
+//
+// The values are computed each time they are read. Since expvar variables
+// cannot be removed, PublishExpvar can be called only once per prefix in
+// a process; it returns an error if any of the names is taken.
+func (t *Tracer) PublishExpvar(prefix string) error {
+	vars := map[string]expvar.Func{
+		prefix + ".targets": func() interface{} {
+			return len(t.snapshot())
+		},
+		prefix + ".cycles": func() interface{} {
+			return t.cycles.Load()
+		},
+		prefix + ".status": func() interface{} {
+			status := make(map[string]ExpvarStatus)
+			for _, info := range t.Targets() {
+				s := ExpvarStatus{
+					State:    StateString(info.State),
+					Checked:  info.Checked,
+					Latency:  float64(info.Latency) / float64(time.Millisecond),
+					Failures: info.Failures,
+				}
+				if info.Err != nil {
+					s.Err = info.Err.Error()
+				}
+				status[info.ID] = s
+			}
+			return status
+		},
+	}
+	for name := range vars {
+		if expvar.Get(name) != nil {
+			return fmt.Errorf("tracer: expvar %q already published", name)
+		}
+	}
+	for name, f := range vars {
+		expvar.Publish(name, f)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	if err := s.Tracer.PublishExpvar("test_tracer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tracer.PublishExpvar("test_tracer"); err == nil {
+		t.Fatalf("unexpected success publishing the same prefix twice")
+	}
+	for _, p := range []tracer.Pinger{
+		tracertest.NewPinger("db", tracertest.Down),
+		tracertest.NewPinger("web", tracertest.Up),
+	} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Run(time.Second * 25); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := expvar.Get("test_tracer.targets").String(); v != "2" {
+		t.Fatalf("unexpected targets: found %v, expected 2", v)
+	}
+	if v := expvar.Get("test_tracer.cycles").String(); v != "3" {
+		t.Fatalf("unexpected cycles: found %v, expected 3", v)
+	}
+	var status map[string]tracer.ExpvarStatus
+	if err := json.Unmarshal([]byte(expvar.Get("test_tracer.status").String()), &status); err != nil {
+		t.Fatal(err)
+	}
+	if db := status["db"]; db.State != "offline" || db.Err == "" || db.Failures != 3 {
+		t.Fatalf("unexpected status of db: found %+v", db)
+	}
+	if web := status["web"]; web.State != "online" || web.Err != "" {
+		t.Fatalf("unexpected status of web: found %+v", web)
+	}
+}
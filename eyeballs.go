@@ -0,0 +1,172 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// FamilyResult is the outcome of the connection attempted over an IP
+// family by HappyEyeballsPinger.
+type FamilyResult struct {
+	Addr    string        // address dialed, empty if the name has none in the family
+	Latency time.Duration // time the connection took to be established
+	Err     string        // why the connection failed, if it did
+}
+
+// HappyEyeballsResult is the outcome of a HappyEyeballsPinger ping.
+type HappyEyeballsResult struct {
+	// Winner is the family a Happy Eyeballs client would have used,
+	// AnyFamily if neither connection succeeded.
+	Winner Family
+
+	// Margin is how much earlier the connection of the winner was
+	// established, on the Happy Eyeballs timeline, than the other one.
+	// Zero when only one family succeeded.
+	Margin time.Duration
+
+	IPv4 FamilyResult
+	IPv6 FamilyResult
+}
+
+// HappyEyeballsPinger is a Pinger racing IPv4 and IPv6 connections to a
+// target like real dual-stack clients do (RFC 8305), for operators tuning
+// dual-stack deployments. Both connections are attempted at the same time
+// and their latencies measured independently; the winner is then decided
+// as if the IPv4 attempt had started after the attempt delay, see
+// WithAttemptDelay. The *HappyEyeballsResult is returned as details of the
+// ping, see DetailPinger, and passed to validators. Pings fail only when
+// neither family can connect.
+type HappyEyeballsPinger struct {
+	addr     string
+	opts     *options
+	resolver *net.Resolver
+}
+
+// NewHappyEyeballsPinger returns a HappyEyeballsPinger connecting to
+// addr, in the host:port form. Unless WithID is used, addr is the ID of the
+// Pinger.
+func NewHappyEyeballsPinger(addr string, opts ...Option) *HappyEyeballsPinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = addr
+	}
+	if o.delay <= 0 {
+		o.delay = 250 * time.Millisecond
+	}
+	return &HappyEyeballsPinger{addr: addr, opts: o, resolver: o.resolver()}
+}
+
+// ID implements Pinger.
+func (p *HappyEyeballsPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *HappyEyeballsPinger) Addr() net.Addr {
+	return &netAddr{network: "tcp", addr: p.addr}
+}
+
+// Ping implements Pinger.
+func (p *HappyEyeballsPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning a *HappyEyeballsResult.
+func (p *HappyEyeballsPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	host, port, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(HappyEyeballsResult)
+	var wg sync.WaitGroup
+	for _, f := range []struct {
+		network string
+		result  *FamilyResult
+	}{
+		{"tcp4", &r.IPv4},
+		{"tcp6", &r.IPv6},
+	} {
+		wg.Add(1)
+		go func(network string, result *FamilyResult) {
+			defer wg.Done()
+			*result = p.attempt(ctx, network, host, port)
+		}(f.network, f.result)
+	}
+	wg.Wait()
+
+	ok4, ok6 := r.IPv4.Err == "", r.IPv6.Err == ""
+	at4 := r.IPv4.Latency + p.opts.delay
+	switch {
+	case ok6 && (!ok4 || r.IPv6.Latency <= at4):
+		r.Winner = IPv6
+		if ok4 {
+			r.Margin = at4 - r.IPv6.Latency
+		}
+	case ok4:
+		r.Winner = IPv4
+		if ok6 {
+			r.Margin = r.IPv6.Latency - at4
+		}
+	default:
+		return r, errors.New("tracer: neither IPv4 nor IPv6 connections succeeded")
+	}
+	return r, p.opts.validate(r)
+}
+
+// attempt resolves host in the family of network and connects to the
+// first address found.
+func (p *HappyEyeballsPinger) attempt(ctx context.Context, network, host, port string) FamilyResult {
+	ipnet := "ip4"
+	if network == "tcp6" {
+		ipnet = "ip6"
+	}
+	var r FamilyResult
+	ips, err := p.resolver.LookupIP(ctx, ipnet, host)
+	if err != nil {
+		r.Err = err.Error()
+		return r
+	}
+	r.Addr = net.JoinHostPort(ips[0].String(), port)
+
+	start := time.Now()
+	conn, err := p.opts.dialer.DialContext(ctx, network, r.Addr)
+	if err != nil {
+		r.Err = err.Error()
+		return r
+	}
+	r.Latency = time.Since(start)
+	conn.Close()
+	return r
+}
@@ -0,0 +1,116 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// FlapDetection describes when a target is considered flapping, i.e.
+// alternating between online and offline too quickly for its transitions
+// to be worth reporting one by one.
+//
+// A target starts flapping when it goes through Transitions state
+// transitions within Window: a Flap is published on TopicFlap, and its
+// transitions are no longer published on TopicConnTransition. It stops
+// flapping once its state stayed the same for Dampening, when another
+// Flap is published along with a single Transition from the state it had
+// before flapping, if different.
+type FlapDetection struct {
+	Transitions int
+	Window      time.Duration
+
+	// Dampening is the time a flapping target has to stay in the same
+	// state to settle, Window when zero.
+	Dampening time.Duration
+}
+
+func (f *FlapDetection) dampening() time.Duration {
+	if f.Dampening > 0 {
+		return f.Dampening
+	}
+	return f.Window
+}
+
+// Flap is published on TopicFlap when a target starts or stops flapping,
+// see FlapDetection.
+type Flap struct {
+	ID       string
+	Flapping bool
+	State    int // state of the target at At
+	At       time.Time
+}
+
+// flap records the outcome of the last ping of tg, which moved it from
+// state from to its current state at now, and returns the events to
+// publish: the Transition, unless suppressed, and the Flap, if any.
+// Must be called with tg locked.
+func (t *Tracer) flap(tg *target, from int, now time.Time) (*Transition, *Flap) {
+	changed := tg.state != from
+	f := t.FlapDetection
+	if f == nil || f.Transitions < 1 {
+		if !changed {
+			return nil, nil
+		}
+		return transition(tg, from, now), nil
+	}
+
+	if changed {
+		flips := tg.flips[:0]
+		for _, at := range tg.flips {
+			if now.Sub(at) < f.Window {
+				flips = append(flips, at)
+			}
+		}
+		tg.flips = append(flips, now)
+		tg.flipped = now
+	}
+
+	switch {
+	case !tg.flapping && changed && len(tg.flips) >= f.Transitions:
+		tg.flapping = true
+		tg.settled = from
+		return nil, &Flap{ID: tg.ID(), Flapping: true, State: tg.state, At: now}
+	case tg.flapping && now.Sub(tg.flipped) >= f.dampening():
+		tg.flapping = false
+		tg.flips = tg.flips[:0]
+		fl := &Flap{ID: tg.ID(), Flapping: false, State: tg.state, At: now}
+		if tg.state == tg.settled {
+			return nil, fl
+		}
+		return transition(tg, tg.settled, now), fl
+	case changed && !tg.flapping:
+		return transition(tg, from, now), nil
+	}
+	return nil, nil
+}
+
+// transition returns the Transition of tg from state from to its
+// current state at now. Must be called with tg locked.
+func transition(tg *target, from int, now time.Time) *Transition {
+	tr := &Transition{ID: tg.ID(), From: from, To: tg.state, At: now, Duration: now.Sub(tg.since)}
+	tg.since = now
+	return tr
+}
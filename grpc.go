@@ -0,0 +1,279 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GRPCError is returned by GRPCPinger when the call ends with a status
+// other than OK.
+type GRPCError struct {
+	Code    int // status code, e.g. 14 for UNAVAILABLE
+	Message string
+}
+
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+func (e *GRPCError) Error() string {
+	code := strconv.Itoa(e.Code)
+	if e.Code >= 0 && e.Code < len(grpcCodes) {
+		code = grpcCodes[e.Code]
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("tracer: grpc status %v", code)
+	}
+	return fmt.Sprintf("tracer: grpc status %v: %v", code, e.Message)
+}
+
+// GRPCCall describes the call made by a GRPCPinger.
+type GRPCCall struct {
+	// Method is the full name of a unary method, e.g.
+	// "shop.v1.Orders/GetOrder".
+	Method string
+
+	// Descriptors is a serialized FileDescriptorSet describing the
+	// method and its messages, as written by
+	// protoc --include_imports --descriptor_set_out.
+	Descriptors []byte
+
+	// Request is the JSON mapping of the request message. It may
+	// reference Vars as {{name}}, see HTTPStep.
+	Request string
+	Vars    map[string]string
+
+	// Metadata is sent along with the request, e.g. an authorization
+	// token.
+	Metadata http.Header
+
+	// Assert maps paths in the JSON mapping of the response, see
+	// HTTPStep.ExtractJSON, to the values expected, formatted as strings.
+	// Fields that are not set have their default value.
+	Assert map[string]string
+}
+
+// GRPCResponse is the outcome of a GRPCPinger call, passed to validators
+// and returned as details of its pings.
+type GRPCResponse struct {
+	// Message is the JSON mapping of the response, with 64 bits
+	// integers as strings.
+	Message  map[string]interface{}
+	Metadata http.Header
+}
+
+// GRPCPinger is a Pinger invoking an arbitrary unary gRPC method, checking
+// the health of a service beyond what the standard health service tells.
+// The request is built from a JSON template and the response is asserted
+// on, both translated with the descriptors of the method: no generated
+// code is needed. Calls are made over TLS when WithTLSConfig is used, in
+// clear text otherwise. Calls that end with an error status fail with a
+// *GRPCError.
+type GRPCPinger struct {
+	addr   string
+	call   GRPCCall
+	method protoMethod
+	reg    *protoRegistry
+	opts   *options
+	client *http.Client
+}
+
+// NewGRPCPinger returns a GRPCPinger calling the server at addr, in the
+// host:port form. Unless WithID is used, the ID of the Pinger is addr
+// followed by the method, e.g. "orders:443/shop.v1.Orders/GetOrder".
+// Returns an error if the descriptors are not valid or do not describe a
+// unary method named call.Method.
+func NewGRPCPinger(addr string, call GRPCCall, opts ...Option) (*GRPCPinger, error) {
+	reg, err := parseDescriptorSet(call.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+	method, ok := reg.methods[strings.TrimPrefix(call.Method, "/")]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("tracer: method %v not found in descriptors", call.Method)
+	case method.streaming:
+		return nil, fmt.Errorf("tracer: method %v is not unary", call.Method)
+	}
+	call.Method = strings.TrimPrefix(call.Method, "/")
+
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = addr + "/" + call.Method
+	}
+	protocols := new(http.Protocols)
+	if o.tlsConfig != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &GRPCPinger{
+		addr:   addr,
+		call:   call,
+		method: method,
+		reg:    reg,
+		opts:   o,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Protocols:       protocols,
+				DialContext:     o.dial,
+				TLSClientConfig: o.tlsConfig,
+			},
+		},
+	}, nil
+}
+
+// ID implements Pinger.
+func (p *GRPCPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *GRPCPinger) Addr() net.Addr {
+	return &netAddr{network: "tcp", addr: p.addr}
+}
+
+// Ping implements Pinger.
+func (p *GRPCPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the *GRPCResponse.
+func (p *GRPCPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	var doc map[string]interface{}
+	if req := strings.TrimSpace(expandVars(p.call.Request, p.call.Vars)); req != "" {
+		d := json.NewDecoder(strings.NewReader(req))
+		d.UseNumber()
+		if err := d.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("tracer: invalid request: %v", err)
+		}
+	}
+	msg, err := p.reg.encode(p.method.input, doc)
+	if err != nil {
+		return nil, fmt.Errorf("tracer: invalid request: %v", err)
+	}
+
+	// Length prefixed message, not compressed.
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	u := &url.URL{Scheme: "http", Host: p.addr, Path: "/" + p.call.Method}
+	if p.opts.tlsConfig != nil {
+		u.Scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range p.call.Metadata {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	if d, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(time.Until(d).Milliseconds()+1, 10)+"m")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracer: unexpected status %v", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCMessage+5))
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcStatus(resp); err != nil {
+		return nil, err
+	}
+	if len(data) < 5 || int(binary.BigEndian.Uint32(data[1:])) != len(data)-5 {
+		return nil, fmt.Errorf("tracer: invalid grpc response")
+	}
+	if data[0] != 0 {
+		return nil, fmt.Errorf("tracer: compressed grpc responses are not supported")
+	}
+	out, err := p.reg.decode(p.method.output, data[5:])
+	if err != nil {
+		return nil, fmt.Errorf("tracer: invalid grpc response: %v", err)
+	}
+
+	r := &GRPCResponse{Message: out, Metadata: resp.Header}
+	for path, want := range p.call.Assert {
+		found, ok := jsonPath(out, path)
+		if !ok {
+			return r, &ExpectationError{What: path, Expected: want, Found: "nothing"}
+		}
+		if found != want {
+			return r, &ExpectationError{What: path, Expected: want, Found: found}
+		}
+	}
+	return r, p.opts.validate(r)
+}
+
+// grpcStatus returns the *GRPCError reported by the trailers of resp, or
+// by its headers for responses without a message.
+func grpcStatus(resp *http.Response) error {
+	status, msg := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msg = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return fmt.Errorf("tracer: missing grpc status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("tracer: invalid grpc status %q", status)
+	}
+	if code == 0 {
+		return nil
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	return &GRPCError{Code: code, Message: msg}
+}
@@ -0,0 +1,184 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+// pb builds protocol buffers messages by hand.
+type pb []byte
+
+func (b pb) bytes(num int, data []byte) pb {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func (b pb) str(num int, s string) pb {
+	return b.bytes(num, []byte(s))
+}
+
+func (b pb) varint(num int, v uint64) pb {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// ordersDescriptors returns the descriptor set of:
+//
+//	package shop.v1;
+//	enum Status { STATUS_UNKNOWN = 0; STATUS_OPEN = 1; STATUS_SHIPPED = 2; }
+//	message GetOrderRequest { string order_id = 1; int64 customer = 2; }
+//	message Order {
+//		message Item { string sku = 1; uint32 qty = 2; }
+//		string order_id = 1;
+//		Status status = 2;
+//		repeated Item items = 3;
+//		map<string, int32> counts = 4;
+//		int64 total_cents = 5;
+//		bool paid = 6;
+//	}
+//	service Orders { rpc GetOrder(GetOrderRequest) returns (Order); }
+func ordersDescriptors() []byte {
+	const optional, repeated = 1, 3
+	field := func(name string, num, label, typ int, typeName string) []byte {
+		f := pb(nil).str(1, name).varint(3, uint64(num)).varint(4, uint64(label)).varint(5, uint64(typ))
+		if typeName != "" {
+			f = f.str(6, typeName)
+		}
+		return f
+	}
+	item := pb(nil).str(1, "Item").
+		bytes(2, field("sku", 1, optional, 9, "")).
+		bytes(2, field("qty", 2, optional, 13, ""))
+	entry := pb(nil).str(1, "CountsEntry").
+		bytes(2, field("key", 1, optional, 9, "")).
+		bytes(2, field("value", 2, optional, 5, "")).
+		bytes(7, pb(nil).varint(7, 1))
+	order := pb(nil).str(1, "Order").
+		bytes(2, field("order_id", 1, optional, 9, "")).
+		bytes(2, field("status", 2, optional, 14, ".shop.v1.Status")).
+		bytes(2, field("items", 3, repeated, 11, ".shop.v1.Order.Item")).
+		bytes(2, field("counts", 4, repeated, 11, ".shop.v1.Order.CountsEntry")).
+		bytes(2, field("total_cents", 5, optional, 3, "")).
+		bytes(2, field("paid", 6, optional, 8, "")).
+		bytes(3, item).
+		bytes(3, entry)
+	request := pb(nil).str(1, "GetOrderRequest").
+		bytes(2, field("order_id", 1, optional, 9, "")).
+		bytes(2, field("customer", 2, optional, 3, ""))
+	status := pb(nil).str(1, "Status")
+	for i, name := range []string{"STATUS_UNKNOWN", "STATUS_OPEN", "STATUS_SHIPPED"} {
+		status = status.bytes(2, pb(nil).str(1, name).varint(2, uint64(i)))
+	}
+	method := pb(nil).str(1, "GetOrder").str(2, ".shop.v1.GetOrderRequest").str(3, ".shop.v1.Order")
+	service := pb(nil).str(1, "Orders").bytes(2, method)
+	file := pb(nil).str(1, "orders.proto").str(2, "shop.v1").
+		bytes(4, request).
+		bytes(4, order).
+		bytes(5, status).
+		bytes(6, service)
+	return pb(nil).bytes(1, file)
+}
+
+func TestGRPCPinger(t *testing.T) {
+	srv := tracertest.NewGRPCServer(t)
+	srv.Handle("shop.v1.Orders/GetOrder", func(md http.Header, req []byte) ([]byte, int, string) {
+		if md.Get("Authorization") != "Bearer t0k3n" {
+			return nil, 16, "missing token"
+		}
+		// order_id "o-42" and customer 7.
+		if string(req) != string(pb(nil).str(1, "o-42").varint(2, 7)) {
+			return nil, 5, "order not found"
+		}
+		return pb(nil).
+			str(1, "o-42").
+			varint(2, 2).
+			bytes(3, pb(nil).str(1, "book").varint(2, 1)).
+			bytes(3, pb(nil).str(1, "pen").varint(2, 3)).
+			bytes(4, pb(nil).str(1, "a").varint(2, 2)).
+			varint(5, 1999), 0, ""
+	})
+
+	call := tracer.GRPCCall{
+		Method:      "shop.v1.Orders/GetOrder",
+		Descriptors: ordersDescriptors(),
+		Request:     `{"orderId": "{{order}}", "customer": "7"}`,
+		Vars:        map[string]string{"order": "o-42"},
+		Metadata:    http.Header{"Authorization": {"Bearer t0k3n"}},
+		Assert: map[string]string{
+			"status":      "STATUS_SHIPPED",
+			"items.1.sku": "pen",
+			"items.1.qty": "3",
+			"counts.a":    "2",
+			"totalCents":  "1999",
+			"paid":        "false",
+		},
+	}
+	p, err := tracer.NewGRPCPinger(srv.Addr(), call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := p.ID(); id != srv.Addr()+"/shop.v1.Orders/GetOrder" {
+		t.Fatalf("unexpected ID: %v", id)
+	}
+	details, err := p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := details.(*tracer.GRPCResponse); r.Message["orderId"] != "o-42" {
+		t.Fatalf("unexpected response: %v", r.Message)
+	}
+
+	call.Assert = map[string]string{"status": "STATUS_OPEN"}
+	p, _ = tracer.NewGRPCPinger(srv.Addr(), call)
+	var eerr *tracer.ExpectationError
+	if err := p.Ping(context.Background()); !errors.As(err, &eerr) || eerr.Found != "STATUS_SHIPPED" {
+		t.Fatalf("unexpected error: found %v, expected an *tracer.ExpectationError", err)
+	}
+
+	call.Vars = map[string]string{"order": "o-43"}
+	p, _ = tracer.NewGRPCPinger(srv.Addr(), call)
+	var gerr *tracer.GRPCError
+	if err := p.Ping(context.Background()); !errors.As(err, &gerr) || gerr.Code != 5 || gerr.Message != "order not found" {
+		t.Fatalf("unexpected error: found %v, expected NOT_FOUND", err)
+	}
+	if !strings.Contains(gerr.Error(), "NOT_FOUND") {
+		t.Fatalf("unexpected error message: %v", gerr)
+	}
+
+	call.Method = "shop.v1.Orders/DeleteOrder"
+	if _, err := tracer.NewGRPCPinger(srv.Addr(), call); err == nil {
+		t.Fatal("unexpected success for an unknown method")
+	}
+}
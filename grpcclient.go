@@ -0,0 +1,228 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GRPCClient calls the gRPC service of a remote tracer, see GRPCService.
+// Methods fail with a *GRPCError when the call ends with an error
+// status.
+type GRPCClient struct {
+	// Token is sent along with every call.
+	Token string
+
+	addr   string
+	opts   *options
+	client *http.Client
+}
+
+// NewGRPCClient returns a GRPCClient calling the service at addr, in the
+// host:port form, over TLS when WithTLSConfig is used and in clear text
+// otherwise. WithDialer and WithTimeout apply as well, the latter to
+// unary calls only.
+func NewGRPCClient(addr, token string, opts ...Option) *GRPCClient {
+	o := newOptions(opts)
+	protocols := new(http.Protocols)
+	if o.tlsConfig != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &GRPCClient{
+		Token: token,
+		addr:  addr,
+		opts:  o,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Protocols:       protocols,
+				DialContext:     o.dial,
+				TLSClientConfig: o.tlsConfig,
+			},
+		},
+	}
+}
+
+func (c *GRPCClient) request(ctx context.Context, method string, body io.Reader) (*http.Response, error) {
+	u := &url.URL{Scheme: "http", Host: c.addr, Path: "/" + grpcServiceName + "/" + method}
+	if c.opts.tlsConfig != nil {
+		u.Scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("tracer: unexpected status %v", resp.Status)
+	}
+	return resp, nil
+}
+
+// call makes a unary call of method with the serialized request msg,
+// returning the serialized response.
+func (c *GRPCClient) call(ctx context.Context, method string, msg []byte) ([]byte, error) {
+	ctx, cancel := c.opts.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.request(ctx, method, bytes.NewReader(grpcFrame(msg)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := readGRPCFrame(resp.Body)
+	if err == io.EOF {
+		// Trailers-only response.
+		if err := grpcStatus(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("tracer: missing grpc response")
+	}
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxGRPCMessage))
+	if err := grpcStatus(resp); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListTargets returns the targets of the remote tracer, sorted by ID.
+func (c *GRPCClient) ListTargets(ctx context.Context) ([]TargetInfo, error) {
+	resp, err := c.call(ctx, "ListTargets", nil)
+	if err != nil {
+		return nil, err
+	}
+	var infos []TargetInfo
+	err = protoWalk(resp, func(num, wire int, v uint64, data []byte) error {
+		if num != 1 {
+			return nil
+		}
+		info, err := decodeTarget(data)
+		infos = append(infos, info)
+		return err
+	})
+	return infos, err
+}
+
+// AddTarget makes the remote tracer trace the target described by
+// rawurl, see ParsePinger, WithInterval and WithPingTimeout when
+// interval and timeout are positive.
+func (c *GRPCClient) AddTarget(ctx context.Context, rawurl string, interval, timeout time.Duration) (TargetInfo, error) {
+	req := pbuf(nil).str(1, rawurl).int(2, int64(interval)).int(3, int64(timeout))
+	resp, err := c.call(ctx, "AddTarget", req)
+	if err != nil {
+		return TargetInfo{}, err
+	}
+	return decodeTarget(resp)
+}
+
+// RemoveTarget makes the remote tracer untrace the target stored with id.
+func (c *GRPCClient) RemoveTarget(ctx context.Context, id string) error {
+	_, err := c.call(ctx, "RemoveTarget", pbuf(nil).str(1, id))
+	return err
+}
+
+// Watch starts streaming the events of the targets stored with ids, or of
+// every target when none is given, until ctx is done or the GRPCWatch is
+// closed.
+func (c *GRPCClient) Watch(ctx context.Context, ids ...string) (*GRPCWatch, error) {
+	pr, pw := io.Pipe()
+	w := &GRPCWatch{pw: pw, ready: make(chan struct{})}
+	// The body is read only once the call is started.
+	go func() {
+		w.send(ids)
+		close(w.ready)
+	}()
+	resp, err := c.request(ctx, "Watch", pr)
+	if err != nil {
+		pw.CloseWithError(err)
+		return nil, err
+	}
+	w.resp = resp
+	return w, nil
+}
+
+// GRPCWatch is a Watch call, see GRPCClient.Watch.
+type GRPCWatch struct {
+	pw    *io.PipeWriter
+	resp  *http.Response
+	ready chan struct{} // closed once the first request is sent
+}
+
+// Watch replaces the targets whose events are streamed with the ones
+// stored with ids, every target when none is given.
+func (w *GRPCWatch) Watch(ids ...string) error {
+	<-w.ready
+	return w.send(ids)
+}
+
+func (w *GRPCWatch) send(ids []string) error {
+	var req pbuf
+	for _, id := range ids {
+		req = appendBytes(req, 1, []byte(id))
+	}
+	_, err := w.pw.Write(grpcFrame(req))
+	return err
+}
+
+// Recv returns the next event, whose Value is a Message on TopicConn or
+// a Transition on TopicConnTransition. Messages carry errors as plain
+// errors, as when decoded from JSON. Returns io.EOF when the server ends
+// the call with status OK.
+func (w *GRPCWatch) Recv() (Event, error) {
+	msg, err := readGRPCFrame(w.resp.Body)
+	if err == io.EOF {
+		if err := grpcStatus(w.resp); err != nil {
+			return Event{}, err
+		}
+		return Event{}, io.EOF
+	}
+	if err != nil {
+		return Event{}, err
+	}
+	return decodeEvent(msg)
+}
+
+// Close ends the call.
+func (w *GRPCWatch) Close() error {
+	w.pw.Close()
+	return w.resp.Body.Close()
+}
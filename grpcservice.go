@@ -0,0 +1,531 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file holds the gRPC service of proto/tracer.proto, served by
+// GRPCService and called by GRPCClient, encoding its messages by hand as
+// the rest of the package does.
+
+// grpcServiceName is the full name of the service of proto/tracer.proto.
+const grpcServiceName = "tracer.v1.Tracer"
+
+// maxGRPCMessage bounds the size of the messages received, as gRPC
+// implementations do by default.
+const maxGRPCMessage = 4 << 20
+
+// gRPC status codes used by the service.
+const (
+	grpcOK              = 0
+	grpcCanceled        = 1
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcAlreadyExists   = 6
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnauthenticated = 16
+)
+
+// readGRPCFrame reads a length prefixed message from r.
+func readGRPCFrame(r io.Reader) ([]byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	if h[0] != 0 {
+		return nil, errors.New("tracer: compressed grpc messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(h[1:])
+	if n > maxGRPCMessage {
+		return nil, fmt.Errorf("tracer: grpc message of %d bytes too large", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// grpcFrame returns msg prefixed by its length, not compressed.
+func grpcFrame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// pbuf builds a protocol buffers message. As in proto3, fields with the
+// default value are omitted.
+type pbuf []byte
+
+func (b pbuf) str(num int, s string) pbuf {
+	if s == "" {
+		return b
+	}
+	return appendBytes(b, num, []byte(s))
+}
+
+func (b pbuf) uint(num int, v uint64) pbuf {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendTag(b, num, wireVarint), v)
+}
+
+func (b pbuf) int(num int, v int64) pbuf {
+	return b.uint(num, uint64(v))
+}
+
+func (b pbuf) bool(num int, v bool) pbuf {
+	if !v {
+		return b
+	}
+	return b.uint(num, 1)
+}
+
+func (b pbuf) msg(num int, m []byte) pbuf {
+	return appendBytes(b, num, m)
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// errorFrom returns an error carrying msg, nil if msg is empty.
+func errorFrom(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+func encodeTarget(info TargetInfo) []byte {
+	var b pbuf
+	b = b.str(1, info.ID)
+	if info.Addr != nil {
+		b = b.str(2, info.Addr.Network()).str(3, info.Addr.String())
+	}
+	b = b.int(4, int64(info.State))
+	b = b.int(5, unixNano(info.Checked))
+	b = b.int(6, int64(info.Latency))
+	if info.Err != nil {
+		b = b.str(7, info.Err.Error())
+	}
+	b = b.int(8, int64(info.Failures))
+	return b.int(9, int64(info.Interval))
+}
+
+func decodeTarget(data []byte) (TargetInfo, error) {
+	var info TargetInfo
+	var network, addr string
+	err := protoWalk(data, func(num, wire int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			info.ID = string(data)
+		case 2:
+			network = string(data)
+		case 3:
+			addr = string(data)
+		case 4:
+			info.State = int(v)
+		case 5:
+			info.Checked = fromUnixNano(int64(v))
+		case 6:
+			info.Latency = time.Duration(v)
+		case 7:
+			info.Err = errorFrom(string(data))
+		case 8:
+			info.Failures = int(int32(v))
+		case 9:
+			info.Interval = time.Duration(v)
+		}
+		return nil
+	})
+	if addr != "" {
+		info.Addr = &netAddr{network: network, addr: addr}
+	}
+	return info, err
+}
+
+func encodeResult(m Message) []byte {
+	var b pbuf
+	b = b.int(1, int64(m.Version)).str(2, m.ID)
+	if m.Err != nil {
+		b = b.str(3, m.Err.Error()).str(4, m.Kind.String())
+	}
+	if m.Addr != nil {
+		b = b.str(5, m.Addr.Network()).str(6, m.Addr.String())
+	}
+	b = b.int(7, int64(m.State))
+	b = b.int(8, int64(m.Latency))
+	b = b.int(9, unixNano(m.Timestamp))
+	b = b.uint(10, m.Seq)
+	b = b.int(11, int64(m.Attempts))
+	b = b.bool(12, m.Canceled)
+	b = b.bool(13, m.Downtime)
+	b = b.bool(14, m.Flapping)
+	return b.str(15, m.RootCause)
+}
+
+func decodeResult(data []byte) (Message, error) {
+	var m Message
+	var network, addr string
+	err := protoWalk(data, func(num, wire int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			m.Version = int(int32(v))
+		case 2:
+			m.ID = string(data)
+		case 3:
+			m.Err = errorFrom(string(data))
+		case 4:
+			return m.Kind.UnmarshalText(data)
+		case 5:
+			network = string(data)
+		case 6:
+			addr = string(data)
+		case 7:
+			m.State = int(v)
+		case 8:
+			m.Latency = time.Duration(v)
+		case 9:
+			m.Timestamp = fromUnixNano(int64(v))
+		case 10:
+			m.Seq = v
+		case 11:
+			m.Attempts = int(int32(v))
+		case 12:
+			m.Canceled = v != 0
+		case 13:
+			m.Downtime = v != 0
+		case 14:
+			m.Flapping = v != 0
+		case 15:
+			m.RootCause = string(data)
+		}
+		return nil
+	})
+	if addr != "" {
+		m.Addr = &netAddr{network: network, addr: addr}
+		m.IP = addrIP(m.Addr)
+	}
+	return m, err
+}
+
+func encodeTransition(tr Transition) []byte {
+	var b pbuf
+	b = b.str(1, tr.ID).int(2, int64(tr.From)).int(3, int64(tr.To))
+	return b.int(4, unixNano(tr.At)).int(5, int64(tr.Duration))
+}
+
+func decodeTransition(data []byte) (Transition, error) {
+	var tr Transition
+	err := protoWalk(data, func(num, wire int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			tr.ID = string(data)
+		case 2:
+			tr.From = int(v)
+		case 3:
+			tr.To = int(v)
+		case 4:
+			tr.At = fromUnixNano(int64(v))
+		case 5:
+			tr.Duration = time.Duration(v)
+		}
+		return nil
+	})
+	return tr, err
+}
+
+// encodeEvent encodes e, whose value is a Message or a Transition.
+func encodeEvent(e Event) ([]byte, error) {
+	switch v := e.Value.(type) {
+	case Message:
+		return pbuf(nil).msg(1, encodeResult(v)), nil
+	case Transition:
+		return pbuf(nil).msg(2, encodeTransition(v)), nil
+	default:
+		return nil, fmt.Errorf("tracer: unexpected event %T", v)
+	}
+}
+
+func decodeEvent(data []byte) (Event, error) {
+	var e Event
+	err := protoWalk(data, func(num, wire int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			m, err := decodeResult(data)
+			e = Event{Topic: TopicConn, ID: m.ID, Value: m}
+			return err
+		case 2:
+			tr, err := decodeTransition(data)
+			e = Event{Topic: TopicConnTransition, ID: tr.ID, Value: tr}
+			return err
+		}
+		return nil
+	})
+	if err == nil && e.Value == nil {
+		err = errors.New("tracer: empty grpc event")
+	}
+	return e, err
+}
+
+// decodeStrings returns the values of the repeated string field num of
+// the message data.
+func decodeStrings(data []byte, num int) ([]string, error) {
+	var values []string
+	err := protoWalk(data, func(n, wire int, v uint64, data []byte) error {
+		if n == num {
+			values = append(values, string(data))
+		}
+		return nil
+	})
+	return values, err
+}
+
+// GRPCService is an http.Handler serving the gRPC service described by
+// proto/tracer.proto, so that remote processes can list, add and remove
+// the targets of Tracer and watch its events, see GRPCClient. gRPC runs
+// over HTTP/2: serve it over TLS, or in clear text with an http.Server
+// whose Protocols allow unencrypted HTTP/2.
+//
+// Calls carry the token as "authorization: Bearer <token>" metadata, and
+// are rejected while Token is empty: adding targets may make the tracer
+// read local files, see ParsePinger.
+type GRPCService struct {
+	Tracer *Tracer
+	Token  string
+
+	// Parser parses the URLs of the targets added, the zero Parser when
+	// nil.
+	Parser *Parser
+}
+
+// ServeHTTP implements http.Handler.
+func (s *GRPCService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "grpc requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	code, msg := s.serve(w, r)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(msg))
+}
+
+func (s *GRPCService) serve(w http.ResponseWriter, r *http.Request) (int, string) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.Token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		return grpcUnauthenticated, "invalid token"
+	}
+	method, ok := strings.CutPrefix(r.URL.Path, "/"+grpcServiceName+"/")
+	if !ok {
+		return grpcUnimplemented, "unknown service " + r.URL.Path
+	}
+	if method == "Watch" {
+		return s.watch(w, r)
+	}
+
+	var call func([]byte) ([]byte, int, string)
+	switch method {
+	case "ListTargets":
+		call = s.listTargets
+	case "AddTarget":
+		call = s.addTarget
+	case "RemoveTarget":
+		call = s.removeTarget
+	default:
+		return grpcUnimplemented, "unknown method " + method
+	}
+	req, err := readGRPCFrame(r.Body)
+	if err != nil {
+		return grpcInvalidArgument, err.Error()
+	}
+	resp, code, msg := call(req)
+	if code == grpcOK {
+		w.Write(grpcFrame(resp))
+	}
+	return code, msg
+}
+
+func (s *GRPCService) listTargets([]byte) ([]byte, int, string) {
+	var b pbuf
+	for _, info := range s.Tracer.Targets() {
+		b = b.msg(1, encodeTarget(info))
+	}
+	return b, grpcOK, ""
+}
+
+func (s *GRPCService) addTarget(req []byte) ([]byte, int, string) {
+	var rawurl string
+	var opts []TargetOption
+	err := protoWalk(req, func(num, wire int, v uint64, data []byte) error {
+		switch d := time.Duration(v); {
+		case num == 1:
+			rawurl = string(data)
+		case num == 2 && d > 0:
+			opts = append(opts, WithInterval(d))
+		case num == 3 && d > 0:
+			opts = append(opts, WithPingTimeout(d))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	parser := s.Parser
+	if parser == nil {
+		parser = new(Parser)
+	}
+	p, err := parser.ParsePinger(rawurl)
+	if err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	if err := s.Tracer.TraceIfAbsent(p, opts...); errors.Is(err, ErrAlreadyTraced) {
+		return nil, grpcAlreadyExists, "target " + p.ID() + " already traced"
+	} else if err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	info, err := s.Tracer.Target(p.ID())
+	if err != nil {
+		return nil, grpcNotFound, err.Error()
+	}
+	return encodeTarget(info), grpcOK, ""
+}
+
+func (s *GRPCService) removeTarget(req []byte) ([]byte, int, string) {
+	ids, err := decodeStrings(req, 1)
+	if err != nil || len(ids) != 1 {
+		return nil, grpcInvalidArgument, "invalid request"
+	}
+	if err := s.Tracer.Untrace(ids[0]); err != nil {
+		return nil, grpcNotFound, err.Error()
+	}
+	return nil, grpcOK, ""
+}
+
+// watch serves a Watch call until the client goes away.
+func (s *GRPCService) watch(w http.ResponseWriter, r *http.Request) (int, string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return grpcInternal, "streaming unsupported"
+	}
+	events, cancel := s.Tracer.SubscribeTopics("", TopicConn, TopicConnTransition)
+	defer cancel()
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	filters := make(chan map[string]bool)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			req, err := readGRPCFrame(r.Body)
+			if err == nil {
+				var ids []string
+				if ids, err = decodeStrings(req, 1); err == nil {
+					filter := make(map[string]bool)
+					for _, id := range ids {
+						filter[id] = true
+					}
+					select {
+					case filters <- filter:
+						continue
+					case <-r.Context().Done():
+						return
+					}
+				}
+			}
+			done <- err
+			return
+		}
+	}()
+
+	// Events are held until the first request.
+	var filter map[string]bool
+	select {
+	case filter = <-filters:
+	case err := <-done:
+		if err == io.EOF {
+			return grpcInvalidArgument, "missing watch request"
+		}
+		return grpcInvalidArgument, err.Error()
+	case <-r.Context().Done():
+		return grpcCanceled, "canceled"
+	}
+	for {
+		select {
+		case filter = <-filters:
+		case err := <-done:
+			if err != io.EOF {
+				return grpcInvalidArgument, err.Error()
+			}
+			// The client is done sending, keep streaming.
+			done = nil
+		case e, ok := <-events:
+			if !ok {
+				return grpcOK, ""
+			}
+			if len(filter) > 0 && !filter[e.ID] {
+				continue
+			}
+			msg, err := encodeEvent(e)
+			if err != nil {
+				continue
+			}
+			if _, err := w.Write(grpcFrame(msg)); err != nil {
+				return grpcCanceled, err.Error()
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return grpcCanceled, "canceled"
+		}
+	}
+}
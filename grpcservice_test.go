@@ -0,0 +1,129 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestGRPCService(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	srv := httptest.NewUnstartedServer(&tracer.GRPCService{Tracer: s.Tracer, Token: "secret"})
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	ctx := context.Background()
+
+	code := func(err error) int {
+		var gerr *tracer.GRPCError
+		if !errors.As(err, &gerr) {
+			t.Fatalf("unexpected error: found %v, expected a *GRPCError", err)
+		}
+		return gerr.Code
+	}
+
+	if _, err := tracer.NewGRPCClient(addr, "wrong").ListTargets(ctx); code(err) != 16 {
+		t.Fatalf("unexpected error: found %v, expected UNAUTHENTICATED", err)
+	}
+	c := tracer.NewGRPCClient(addr, "secret")
+	info, err := c.AddTarget(ctx, "tcp://127.0.0.1:1#tcp", time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "tcp" || info.Addr.String() != "127.0.0.1:1" || info.State != tracer.ConnUnknown || info.Interval != time.Minute {
+		t.Fatalf("unexpected target: found %+v", info)
+	}
+	if _, err := c.AddTarget(ctx, "tcp://127.0.0.1:1#tcp", 0, 0); code(err) != 6 {
+		t.Fatalf("unexpected error: found %v, expected ALREADY_EXISTS", err)
+	}
+	if _, err := c.AddTarget(ctx, "bogus://x", 0, 0); code(err) != 3 {
+		t.Fatalf("unexpected error: found %v, expected INVALID_ARGUMENT", err)
+	}
+	if err := c.RemoveTarget(ctx, "tcp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveTarget(ctx, "tcp"); code(err) != 5 {
+		t.Fatalf("unexpected error: found %v, expected NOT_FOUND", err)
+	}
+
+	for _, p := range []tracer.Pinger{
+		tracertest.NewPinger("db", tracertest.Up, tracertest.Down),
+		tracertest.NewPinger("web", tracertest.Up),
+	} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := c.Watch(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := s.Run(time.Second * 15); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := c.ListTargets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].ID != "db" || infos[0].State != tracer.ConnOffline || infos[0].Err == nil || infos[1].ID != "web" {
+		t.Fatalf("unexpected targets: found %+v", infos)
+	}
+
+	// The first ping of db and its transition, then the second ones.
+	for i, topic := range []string{tracer.TopicConn, tracer.TopicConnTransition, tracer.TopicConn, tracer.TopicConnTransition} {
+		e, err := w.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Topic != topic || e.ID != "db" {
+			t.Fatalf("unexpected event %d: found %+v, expected one on %v about db", i, e, topic)
+		}
+		switch v := e.Value.(type) {
+		case tracer.Message:
+			if v.Seq != uint64(i/2+1) || (v.Err != nil) != (i > 1) || v.Timestamp.IsZero() {
+				t.Fatalf("unexpected message %d: found %+v", i, v)
+			}
+		case tracer.Transition:
+			if v.To != []int{tracer.ConnOnline, tracer.ConnOffline}[i/2] {
+				t.Fatalf("unexpected transition %d: found %+v", i, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHeartbeat is returned by Heartbeat when no heartbeat was received
+// in time.
+var ErrNoHeartbeat = errors.New("tracer: no heartbeat")
+
+// Heartbeat is a passive Pinger, a dead man's switch: instead of probing
+// its target, it expects the target to report in at least once every
+// interval, by calling Beat or through HeartbeatHandler. It suits cron
+// jobs, batch pipelines and machines behind NAT that cannot be probed.
+// Pings fail with an error wrapping ErrNoHeartbeat once the last heartbeat
+// is older than the interval, or with the error reported through Fail
+// until the next heartbeat.
+type Heartbeat struct {
+	id       string
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time // last heartbeat, or creation of the Heartbeat
+	err  error     // failure reported since the last heartbeat
+}
+
+// NewHeartbeat returns a Heartbeat identified by id expecting a heartbeat
+// at least once every interval. The first one is expected within interval
+// from now.
+func NewHeartbeat(id string, interval time.Duration) *Heartbeat {
+	return &Heartbeat{id: id, interval: interval, last: time.Now()}
+}
+
+// ID implements Pinger.
+func (h *Heartbeat) ID() string {
+	return h.id
+}
+
+// Addr implements Pinger.
+func (h *Heartbeat) Addr() net.Addr {
+	return &netAddr{network: "heartbeat", addr: h.id}
+}
+
+// Beat records a heartbeat, clearing the failure reported, if any.
+func (h *Heartbeat) Beat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last, h.err = time.Now(), nil
+}
+
+// Fail reports that the target failed, e.g. a job that ended with an
+// error, making pings fail with err until the next heartbeat.
+func (h *Heartbeat) Fail(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last, h.err = time.Now(), err
+}
+
+// Ping implements Pinger.
+func (h *Heartbeat) Ping(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return h.err
+	}
+	if since := time.Since(h.last); since > h.interval {
+		return fmt.Errorf("%w for %v", ErrNoHeartbeat, since.Round(time.Second))
+	}
+	return nil
+}
+
+// HeartbeatHandler returns an http.Handler receiving the heartbeats of
+// the Heartbeat targets of t, so that scripts can report in with curl or
+// wget: a GET or POST request to /<id> calls Beat, and one to /<id>/fail
+// calls Fail with the body of the request, if any, as error message.
+// Requests about IDs that are not Heartbeat targets of t are answered 404.
+// Mount it under a prefix with http.StripPrefix.
+func HeartbeatHandler(t *Tracer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/")
+		fail := strings.HasSuffix(id, "/fail")
+		if fail {
+			id = strings.TrimSuffix(id, "/fail")
+		}
+		tg, ok := t.lookup(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h, ok := tg.Pinger.(*Heartbeat)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !fail {
+			h.Beat()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		msg, _ := io.ReadAll(io.LimitReader(r.Body, 1024))
+		err := errors.New("tracer: failure reported")
+		if s := strings.TrimSpace(string(msg)); s != "" {
+			err = fmt.Errorf("tracer: failure reported: %v", s)
+		}
+		h.Fail(err)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
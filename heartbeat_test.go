@@ -0,0 +1,99 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestHeartbeat(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.PubSub = new(recorder)
+	h := tracer.NewHeartbeat("nightly-backup", 50*time.Millisecond)
+	if err := tr.Trace(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(tracer.NewTCPPinger("db:5432")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	srv := httptest.NewServer(http.StripPrefix("/beat", tracer.HeartbeatHandler(tr)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOnline(ctx, "nightly-backup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WaitUntilOffline(ctx, "nightly-backup"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := tr.Last("nightly-backup"); !errors.Is(m.Err, tracer.ErrNoHeartbeat) {
+		t.Fatalf("unexpected error: found %v, expected %v", m.Err, tracer.ErrNoHeartbeat)
+	}
+
+	post := func(path, body string) int {
+		resp, err := http.Post(srv.URL+path, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("/beat/nightly-backup", ""); code != http.StatusNoContent {
+		t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusNoContent)
+	}
+	if err := tr.WaitUntilOnline(ctx, "nightly-backup"); err != nil {
+		t.Fatal(err)
+	}
+	if code := post("/beat/nightly-backup/fail", "disk full"); code != http.StatusNoContent {
+		t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusNoContent)
+	}
+	if err := tr.WaitUntilOffline(ctx, "nightly-backup"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := tr.Last("nightly-backup"); m.Err == nil || !strings.Contains(m.Err.Error(), "disk full") {
+		t.Fatalf("unexpected error: found %v, expected the failure reported", m.Err)
+	}
+
+	for _, path := range []string{"/beat/unknown", "/beat/db:5432"} {
+		if code := post(path, ""); code != http.StatusNotFound {
+			t.Fatalf("%v: unexpected status: found %v, expected %v", path, code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// LatencyHistogram configures the histograms the latencies of the targets
+// are recorded in, from which the percentiles of TargetStats are
+// computed. Buckets are log-linear as in HDR histograms: the relative
+// error of a percentile is at most 2^-SignificantBits, whatever the
+// latency, and memory grows with the logarithm of the latencies seen, a
+// few kilobytes per target at most with the defaults.
+type LatencyHistogram struct {
+	// SignificantBits is the resolution of the buckets, between 1 and
+	// 10, 5 when zero, i.e. about 3% of relative error.
+	SignificantBits int
+
+	// Max is the highest latency recorded as such, a minute when zero.
+	// Higher latencies are recorded as Max, bounding the memory used.
+	Max time.Duration
+}
+
+func (h *LatencyHistogram) bits() uint {
+	if h == nil || h.SignificantBits <= 0 {
+		return 5
+	}
+	if h.SignificantBits > 10 {
+		return 10
+	}
+	return uint(h.SignificantBits)
+}
+
+func (h *LatencyHistogram) max() time.Duration {
+	if h == nil || h.Max <= 0 {
+		return time.Minute
+	}
+	return h.Max
+}
+
+// histogram counts latencies, in microseconds, in log-linear buckets.
+// Each power of two is divided in 2^p buckets, p the significant bits.
+type histogram struct {
+	p      uint
+	counts []uint32
+	total  uint64
+}
+
+// index returns the bucket of v.
+func (h *histogram) index(v uint64) int {
+	s := uint64(1) << h.p
+	if v < s {
+		return int(v)
+	}
+	e := uint(bits.Len64(v)) - h.p - 1
+	return int(uint64(e+1)*s + (v >> e) - s)
+}
+
+// highest returns the highest value falling in bucket i.
+func (h *histogram) highest(i int) uint64 {
+	s := uint64(1) << h.p
+	if uint64(i) < s {
+		return uint64(i)
+	}
+	e := uint(uint64(i)/s) - 1
+	m := uint64(i)%s + s
+	return (m+1)<<e - 1
+}
+
+// record counts d, clamped at max.
+func (h *histogram) record(d time.Duration, cfg *LatencyHistogram) {
+	if h.counts == nil {
+		h.p = cfg.bits()
+	}
+	if max := cfg.max(); d > max {
+		d = max
+	}
+	if d < 0 {
+		d = 0
+	}
+	i := h.index(uint64(d / time.Microsecond))
+	if i >= len(h.counts) {
+		counts := make([]uint32, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	if h.counts[i] < math.MaxUint32 {
+		h.counts[i]++
+	}
+	h.total++
+}
+
+// percentile returns the latency below which the fraction q of the
+// recorded ones fall, zero if none was recorded.
+func (h *histogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range h.counts {
+		n += uint64(c)
+		if n >= rank {
+			return time.Duration(h.highest(i)) * time.Microsecond
+		}
+	}
+	return time.Duration(h.highest(len(h.counts)-1)) * time.Microsecond
+}
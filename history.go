@@ -0,0 +1,147 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+)
+
+// Record is a Message along with the time it was published, the unit of
+// the history written by a Journal.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Message Message   `json:"message"`
+}
+
+// Journal persists the history of a Tracer, writing the Messages it
+// publishes on TopicConn as JSON encoded Records, one per line.
+type Journal struct {
+	t      *Tracer
+	cancel pubsub.CancelFunc
+
+	sync.Mutex
+	enc *json.Encoder
+	err error // first write error
+}
+
+// NewJournal returns a Journal that writes the history of t to w until
+// closed.
+func NewJournal(t *Tracer, w io.Writer) (*Journal, error) {
+	j := &Journal{t: t, enc: json.NewEncoder(w)}
+	cancel, err := t.Sub(&pubsub.Command{
+		Topic: TopicConn,
+		Run: func(i interface{}) error {
+			m, ok := i.(Message)
+			if !ok {
+				return nil
+			}
+			return j.write(Record{Time: t.now(), Message: m})
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	j.cancel = cancel
+	return j, nil
+}
+
+func (j *Journal) write(r Record) error {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+	j.err = j.enc.Encode(r)
+	return j.err
+}
+
+// Close stops the Journal, returning the first error encountered while
+// writing, if any.
+func (j *Journal) Close() error {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.Lock()
+	defer j.Unlock()
+	return j.err
+}
+
+// ReadHistory decodes the Records written by a Journal to r.
+func ReadHistory(r io.Reader) ([]Record, error) {
+	var records []Record
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("tracer: history line %d: %w", n, err)
+		}
+		records = append(records, rec)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Replay publishes the Messages of records on TopicConn of ps, in order,
+// so that the subscribers that would have reacted to them, such as the
+// ones sending notifications, can be exercised after the fact. Between
+// two Messages Replay waits the time that originally separated them
+// divided by speed; a speed of zero or less replays them without waiting.
+// Returns ctx.Err() if ctx is done before the replay is complete.
+func Replay(ctx context.Context, ps PubSub, records []Record, speed float64) error {
+	for i, r := range records {
+		if i > 0 && speed > 0 {
+			d := time.Duration(float64(r.Time.Sub(records[i-1].Time)) / speed)
+			if d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ps.Pub(r.Message, TopicConn)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+)
+
+func TestJournalReplay(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+
+	var b bytes.Buffer
+	j, err := tracer.NewJournal(tr, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(chan tracer.Message, 16)
+	cancel, err := tr.Sub(&pubsub.Command{
+		Topic: tracer.TopicConn,
+		Run: func(i interface{}) error {
+			select {
+			case seen <- i.(tracer.Message):
+			default:
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&pg{id: "fake", shouldFail: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		<-seen
+	}
+	tr.Close()
+	time.Sleep(10 * time.Millisecond) // let the journal catch up
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := tracer.ReadHistory(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) < 3 {
+		t.Fatalf("unexpected number of records: found %v, expected at least 3", len(records))
+	}
+
+	rec := new(recorder)
+	if err := tracer.Replay(context.Background(), rec, records, 0); err != nil {
+		t.Fatal(err)
+	}
+	if rec.len() != len(records) {
+		t.Fatalf("unexpected number of replayed messages: found %v, expected %v", rec.len(), len(records))
+	}
+	for i, r := range records {
+		m := rec.msgs[i].(tracer.Message)
+		if m.ID != "fake" || m.Seq != r.Message.Seq || m.Err == nil {
+			t.Fatalf("unexpected replayed message: found %+v, expected %+v", m, r.Message)
+		}
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	now := time.Now()
+	records := []tracer.Record{
+		{Time: now, Message: tracer.Message{ID: "a"}},
+		{Time: now.Add(time.Second), Message: tracer.Message{ID: "a"}},
+	}
+
+	start := time.Now()
+	if err := tracer.Replay(context.Background(), new(recorder), records, 50); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > 500*time.Millisecond {
+		t.Fatalf("unexpected replay duration: found %v, expected about 20ms", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec := new(recorder)
+	if err := tracer.Replay(ctx, rec, records, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if rec.len() != 1 {
+		t.Fatalf("unexpected number of replayed messages: found %v, expected 1", rec.len())
+	}
+}
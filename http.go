@@ -0,0 +1,294 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MaxResponseBody bounds the bytes of a response body read by the HTTP
+// based pingers, so that a misbehaving target cannot exhaust the memory
+// of the tracer. Longer bodies are truncated.
+const MaxResponseBody = 1 << 20
+
+// HTTPResponse is the output of HTTPPinger passed to validators and
+// published as details of its pings. Body is only read when the
+// HTTPPinger has expectations or validators, or detects changes, and
+// holds at most MaxResponseBody bytes.
+type HTTPResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ContentChanged is published on TopicChange when the body served by an
+// HTTPPinger target changes, see WithChangeDetection. Old and New are the
+// hex encoded SHA-256 hashes of the normalized bodies.
+type ContentChanged struct {
+	ID  string
+	URL string
+	Old string
+	New string
+}
+
+// HTTPPinger is a Pinger that considers a target reachable when a GET
+// request to its URL is answered with a status code lower than 400, see
+// WithMethod, WithStatus, WithExpect, WithMaxLatency and WithRedirects to
+// change what is expected. Pings fail with a *url.Error wrapping a
+// *DialError when the target cannot be reached, with an *ExpectationError
+// or a *LatencyError when it answers, but not as expected.
+type HTTPPinger struct {
+	url    string
+	host   string // host:port of url
+	opts   *options
+	client *http.Client
+
+	sync.Mutex
+	remote net.Addr             // address reached by the last request
+	state  *tls.ConnectionState // TLS state of the last request
+	hash   string               // hash of the last body, see compare
+	events []interface{}
+}
+
+// NewHTTPPinger returns an HTTPPinger that requests rawurl which, unless
+// WithID is used, is the ID of the Pinger as well. Returns an error if rawurl
+// is not an absolute http or https URL.
+func NewHTTPPinger(rawurl string, opts ...Option) (*HTTPPinger, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("tracer: %q is not an absolute http(s) URL", rawurl)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = rawurl
+	}
+	if o.method == "" {
+		o.method = http.MethodGet
+	}
+	return &HTTPPinger{
+		url:  rawurl,
+		host: net.JoinHostPort(u.Hostname(), port),
+		opts: o,
+		client: &http.Client{
+			CheckRedirect: o.checkRedirect,
+			Transport: &http.Transport{
+				Proxy:               o.proxy,
+				DialContext:         o.dial,
+				TLSClientConfig:     o.tlsConfig,
+				TLSHandshakeTimeout: 10 * time.Second,
+				// Each ping measures a fresh connection.
+				DisableKeepAlives: true,
+			},
+		},
+	}, nil
+}
+
+// ID implements Pinger.
+func (p *HTTPPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger. Returns the resolved address reached by the
+// last request, or the host of the URL.
+func (p *HTTPPinger) Addr() net.Addr {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.remote != nil {
+		return p.remote
+	}
+	return &netAddr{network: "tcp", addr: p.host}
+}
+
+// ConnectionState implements TLSPinger. It is nil for http URLs.
+func (p *HTTPPinger) ConnectionState() *tls.ConnectionState {
+	p.Lock()
+	defer p.Unlock()
+	return p.state
+}
+
+// Ping implements Pinger.
+func (p *HTTPPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger. Returns the *HTTPResponse received,
+// if any.
+func (p *HTTPPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.Lock()
+			p.remote = info.Conn.RemoteAddr()
+			p.Unlock()
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, p.opts.method, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	p.state = nil
+	p.Unlock()
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+	defer resp.Body.Close()
+	p.Lock()
+	p.state = resp.TLS
+	p.Unlock()
+	if err := p.opts.checkRevocation(ctx, resp.TLS); err != nil {
+		return nil, err
+	}
+
+	r := &HTTPResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+	if err := p.opts.checkStatus(resp); err != nil {
+		return r, err
+	}
+	if p.opts.expect == nil && len(p.opts.validators) == 0 && !p.opts.changes {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, MaxResponseBody))
+		return r, p.opts.checkLatency(latency)
+	}
+	if r.Body, err = io.ReadAll(io.LimitReader(resp.Body, MaxResponseBody)); err != nil {
+		return r, err
+	}
+	p.compare(r.Body)
+	if err := p.opts.match("body", r.Body); err != nil {
+		return r, err
+	}
+	if err := p.opts.validate(r); err != nil {
+		return r, err
+	}
+	return r, p.opts.checkLatency(latency)
+}
+
+// checkStatus checks the status of resp against the codes accepted by o.
+func (o *options) checkStatus(resp *http.Response) error {
+	if len(o.status) == 0 {
+		if resp.StatusCode < 400 {
+			return nil
+		}
+		return &ExpectationError{What: "status", Expected: "a status lower than 400", Found: resp.Status}
+	}
+	for _, code := range o.status {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return &ExpectationError{What: "status", Expected: fmt.Sprintf("one of %v", o.status), Found: resp.Status}
+}
+
+// checkLatency returns a *LatencyError if latency exceeds the maximum
+// set by o, if any.
+func (o *options) checkLatency(latency time.Duration) error {
+	if o.maxLatency > 0 && latency > o.maxLatency {
+		return &LatencyError{Latency: latency, Max: o.maxLatency}
+	}
+	return nil
+}
+
+// checkRedirect implements the redirect policy of o, see WithRedirects.
+func (o *options) checkRedirect(req *http.Request, via []*http.Request) error {
+	switch {
+	case o.redirects == nil:
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	case *o.redirects == 0:
+		return http.ErrUseLastResponse
+	case len(via) > *o.redirects:
+		return &ExpectationError{
+			What:     "redirects",
+			Expected: fmt.Sprintf("at most %d", *o.redirects),
+			Found:    fmt.Sprint(len(via)),
+		}
+	}
+	return nil
+}
+
+// compare records a ContentChanged event if body, once normalized,
+// differs from the body received by the previous ping, when change
+// detection is on. Normalization drops the parts matching WithIgnore and
+// collapses white space.
+func (p *HTTPPinger) compare(body []byte) {
+	if !p.opts.changes {
+		return
+	}
+	if p.opts.ignore != nil {
+		body = p.opts.ignore.ReplaceAll(body, nil)
+	}
+	sum := sha256.Sum256(bytes.Join(bytes.Fields(body), []byte{' '}))
+	hash := hex.EncodeToString(sum[:])
+
+	p.Lock()
+	defer p.Unlock()
+	if p.hash != "" && p.hash != hash {
+		p.events = append(p.events, ContentChanged{ID: p.ID(), URL: p.url, Old: p.hash, New: hash})
+	}
+	p.hash = hash
+}
+
+// Events implements EventPinger, returning the ContentChanged events
+// noticed since the last call.
+func (p *HTTPPinger) Events() []interface{} {
+	p.Lock()
+	defer p.Unlock()
+
+	events := p.events
+	p.events = nil
+	return events
+}
@@ -0,0 +1,349 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package httpapi provides a REST API to manage the targets of a
+// tracer.Tracer over HTTP:
+//
+//	GET    /targets                 list the targets
+//	POST   /targets                 trace a target described by a URL spec
+//	GET    /targets/{id}            describe a target
+//	DELETE /targets/{id}            untrace a target
+//	POST   /targets/{id}/check      check a target right away
+//	GET    /targets/{id}/stats      statistics of a target
+//	GET    /targets/{id}/history    recent check results, ?limit=N
+//	GET    /events                  live stream of the events, see tracer.Tracer.StreamHandler
+//
+// Targets are added with a JSON body such as
+//
+//	{"url": "tcp://db:5432#db", "interval": "30s", "timeout": "2s"}
+//
+// where url is parsed with tracer.ParsePinger and the optional interval
+// and timeout translate into tracer.WithInterval and
+// tracer.WithPingTimeout. IDs are path escaped, e.g. the ID of a target
+// added without a fragment is its URL. Responses are JSON documents,
+// errors plain text.
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// maxBody bounds the size of the request bodies.
+const maxBody = 1 << 16
+
+// Middleware wraps the handler of every endpoint, e.g. to authenticate
+// the requests.
+type Middleware func(http.Handler) http.Handler
+
+// NoAuth is a Middleware letting every request through, for APIs that
+// are protected otherwise, e.g. by listening on a private address only.
+func NoAuth(h http.Handler) http.Handler {
+	return h
+}
+
+// BearerToken returns a Middleware rejecting the requests that do not
+// carry token as "Authorization: Bearer <token>". Every request is
+// rejected if token is empty.
+func BearerToken(token string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Handler serves the API of Tracer. Mount it under a prefix with
+// http.StripPrefix.
+type Handler struct {
+	Tracer *tracer.Tracer
+
+	// Auth wraps every endpoint. Requests are rejected while it is
+	// nil: the API changes what the tracer does, and specs may make
+	// it read local files, see tracer.ParsePinger. Use NoAuth to serve
+	// it unauthenticated.
+	Auth Middleware
+
+	// Parser parses the specs of the targets added, the zero
+	// tracer.Parser when nil.
+	Parser *tracer.Parser
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// New returns a Handler serving the API of t, behind auth.
+func New(t *tracer.Tracer, auth Middleware) *Handler {
+	return &Handler{Tracer: t, Auth: auth}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Auth == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.once.Do(func() {
+		h.mux = http.NewServeMux()
+		h.mux.HandleFunc("GET /targets", h.list)
+		h.mux.HandleFunc("POST /targets", h.add)
+		h.mux.HandleFunc("GET /targets/{id}", h.get)
+		h.mux.HandleFunc("DELETE /targets/{id}", h.remove)
+		h.mux.HandleFunc("POST /targets/{id}/check", h.check)
+		h.mux.HandleFunc("GET /targets/{id}/stats", h.stats)
+		h.mux.HandleFunc("GET /targets/{id}/history", h.history)
+		h.mux.Handle("GET /events", h.Tracer.StreamHandler())
+	})
+	h.Auth(h.mux).ServeHTTP(w, r)
+}
+
+// Target is the JSON representation of a tracer.TargetInfo.
+type Target struct {
+	ID       string        `json:"id"`
+	Network  string        `json:"network,omitempty"`
+	Addr     string        `json:"addr,omitempty"`
+	State    string        `json:"state"`
+	Checked  *time.Time    `json:"checked,omitempty"`
+	Latency  time.Duration `json:"latency"`
+	Err      string        `json:"err,omitempty"`
+	Failures int           `json:"failures"`
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+func newTarget(info tracer.TargetInfo) Target {
+	t := Target{
+		ID:       info.ID,
+		State:    tracer.StateString(info.State),
+		Latency:  info.Latency,
+		Failures: info.Failures,
+		Interval: info.Interval,
+	}
+	if info.Addr != nil {
+		t.Network, t.Addr = info.Addr.Network(), info.Addr.String()
+	}
+	if !info.Checked.IsZero() {
+		checked := info.Checked
+		t.Checked = &checked
+	}
+	if info.Err != nil {
+		t.Err = info.Err.Error()
+	}
+	return t
+}
+
+// Stats is the JSON representation of a tracer.TargetStats. Uptime is
+// keyed by the string representation of the windows, e.g. "1h0m0s".
+type Stats struct {
+	ID          string             `json:"id"`
+	Successes   uint64             `json:"successes"`
+	Failures    uint64             `json:"failures"`
+	Uptime      map[string]float64 `json:"uptime"`
+	MinLatency  time.Duration      `json:"min_latency"`
+	MaxLatency  time.Duration      `json:"max_latency"`
+	MeanLatency time.Duration      `json:"mean_latency"`
+	P50         time.Duration      `json:"p50"`
+	P90         time.Duration      `json:"p90"`
+	P99         time.Duration      `json:"p99"`
+}
+
+// CheckResult is the JSON representation of a tracer.CheckResult.
+type CheckResult struct {
+	At       time.Time     `json:"at"`
+	Err      string        `json:"err,omitempty"`
+	Kind     tracer.Kind   `json:"kind,omitempty"`
+	Latency  time.Duration `json:"latency"`
+	State    string        `json:"state"`
+	Downtime bool          `json:"downtime,omitempty"`
+}
+
+// AddRequest is the body of a request adding a target.
+type AddRequest struct {
+	URL      string `json:"url"`
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	targets := []Target{}
+	for _, info := range h.Tracer.Targets() {
+		targets = append(targets, newTarget(info))
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+func (h *Handler) add(w http.ResponseWriter, r *http.Request) {
+	var req AddRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var opts []tracer.TargetOption
+	for _, d := range []struct {
+		name, value string
+		opt         func(time.Duration) tracer.TargetOption
+	}{
+		{"interval", req.Interval, tracer.WithInterval},
+		{"timeout", req.Timeout, tracer.WithPingTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			http.Error(w, "invalid "+d.name+": "+d.value, http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, d.opt(v))
+	}
+
+	parser := h.Parser
+	if parser == nil {
+		parser = new(tracer.Parser)
+	}
+	p, err := parser.ParsePinger(req.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Tracer.TraceIfAbsent(p, opts...); errors.Is(err, tracer.ErrAlreadyTraced) {
+		http.Error(w, "target "+p.ID()+" already traced", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, err := h.Tracer.Target(p.ID())
+	if err != nil {
+		// Removed in the meantime.
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Location", "targets/"+url.PathEscape(p.ID()))
+	writeJSON(w, http.StatusCreated, newTarget(info))
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	info, err := h.Tracer.Target(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTarget(info))
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	if err := h.Tracer.Untrace(r.PathValue("id")); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) check(w http.ResponseWriter, r *http.Request) {
+	switch err := h.Tracer.CheckNow(r.PathValue("id")); {
+	case errors.Is(err, tracer.ErrNotTraced):
+		http.NotFound(w, r)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	st, err := h.Tracer.Stats(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s := Stats{
+		ID:          st.ID,
+		Successes:   st.Successes,
+		Failures:    st.Failures,
+		Uptime:      make(map[string]float64),
+		MinLatency:  st.MinLatency,
+		MaxLatency:  st.MaxLatency,
+		MeanLatency: st.MeanLatency,
+		P50:         st.P50,
+		P90:         st.P90,
+		P99:         st.P99,
+	}
+	for window, u := range st.Uptime {
+		s.Uptime[window.String()] = u
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(w, "invalid limit: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	id := r.PathValue("id")
+	if _, err := h.Tracer.Target(id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	results := []CheckResult{}
+	for _, c := range h.Tracer.History(id, limit) {
+		res := CheckResult{
+			At:       c.At,
+			Kind:     c.Kind,
+			Latency:  c.Latency,
+			State:    tracer.StateString(c.State),
+			Downtime: c.Downtime,
+		}
+		if c.Err != nil {
+			res.Err = c.Err.Error()
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,118 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer/httpapi"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestHandler(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	srv := httptest.NewServer(http.StripPrefix("/api", httpapi.New(s.Tracer, httpapi.BearerToken("secret"))))
+	defer srv.Close()
+
+	do := func(method, path, body string, v interface{}) int {
+		req, err := http.NewRequest(method, srv.URL+"/api"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode < 300 {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+	expect := func(found, expected int) {
+		t.Helper()
+		if found != expected {
+			t.Fatalf("unexpected status code: found %v, expected %v", found, expected)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/api/targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expect(resp.StatusCode, http.StatusUnauthorized)
+
+	var target httpapi.Target
+	expect(do("POST", "/targets", `{"url": "tcp://127.0.0.1:1#tcp", "interval": "1m"}`, &target), http.StatusCreated)
+	if target.ID != "tcp" || target.Addr != "127.0.0.1:1" || target.State != "unknown" || target.Interval != time.Minute {
+		t.Fatalf("unexpected target: found %+v", target)
+	}
+	expect(do("POST", "/targets", `{"url": "tcp://127.0.0.1:1#tcp"}`, nil), http.StatusConflict)
+	expect(do("POST", "/targets", `{"url": "bogus://x"}`, nil), http.StatusBadRequest)
+	expect(do("POST", "/targets", `{"url": "tcp://127.0.0.1:1", "timeout": "soon"}`, nil), http.StatusBadRequest)
+	expect(do("POST", "/targets/tcp/check", "", nil), http.StatusServiceUnavailable)
+	expect(do("DELETE", "/targets/tcp", "", nil), http.StatusNoContent)
+	expect(do("DELETE", "/targets/tcp", "", nil), http.StatusNotFound)
+
+	if err := s.Trace(tracertest.NewPinger("db", tracertest.Up, tracertest.Down)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Second * 5); err != nil {
+		t.Fatal(err)
+	}
+	expect(do("POST", "/targets/db/check", "", nil), http.StatusAccepted)
+	if _, err := s.Run(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var targets []httpapi.Target
+	expect(do("GET", "/targets", "", &targets), http.StatusOK)
+	if len(targets) != 1 || targets[0].ID != "db" || targets[0].State != "offline" {
+		t.Fatalf("unexpected targets: found %+v", targets)
+	}
+	var stats httpapi.Stats
+	expect(do("GET", "/targets/db/stats", "", &stats), http.StatusOK)
+	if stats.Successes != 1 || stats.Failures != 1 {
+		t.Fatalf("unexpected stats: found %+v", stats)
+	}
+	var history []httpapi.CheckResult
+	expect(do("GET", "/targets/db/history?limit=1", "", &history), http.StatusOK)
+	if len(history) != 1 || history[0].Err == "" || history[0].State != "offline" {
+		t.Fatalf("unexpected history: found %+v", history)
+	}
+	expect(do("GET", "/targets/unknown/history", "", nil), http.StatusNotFound)
+}
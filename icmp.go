@@ -0,0 +1,224 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ICMP message types of echo requests and replies.
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// ICMPPinger is a Pinger that considers a target reachable when it
+// answers ICMP echo requests. Unprivileged ICMP sockets are used where
+// available, i.e. on macOS and on Linux when the group of the process is
+// within net.ipv4.ping_group_range, and the ICMP helper API for IPv4 on
+// Windows, raw sockets otherwise, which need elevated privileges.
+type ICMPPinger struct {
+	host string
+	opts *options
+
+	// id is the identifier of the echo requests on raw sockets, on
+	// unprivileged ones the kernel sets its own.
+	id uint16
+
+	mu     sync.Mutex
+	seq    uint16
+	remote net.Addr // address reached by the last ping
+}
+
+// NewICMPPinger returns an ICMPPinger that pings host, an IP address or a
+// name to resolve. Unless WithID is used, host is the ID of the Pinger.
+// WithFamily selects the address family of the name.
+func NewICMPPinger(host string, opts ...Option) *ICMPPinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = host
+	}
+	return &ICMPPinger{host: host, opts: o, id: uint16(rand.Uint32())}
+}
+
+// ID implements Pinger.
+func (p *ICMPPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger. Returns the address pinged last, or the host
+// the Pinger was created with.
+func (p *ICMPPinger) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remote != nil {
+		return p.remote
+	}
+	return &netAddr{network: "ip", addr: p.host}
+}
+
+// Ping implements Pinger. It fails with an error wrapping ErrTimeout
+// when no reply arrives in time.
+func (p *ICMPPinger) Ping(ctx context.Context) error {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	ip, err := p.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	p.remote = &net.IPAddr{IP: ip}
+	p.mu.Unlock()
+
+	if ok, err := systemEcho(ctx, ip); ok {
+		return err
+	}
+	v6 := ip.To4() == nil
+	conn, raw, err := listenICMP(v6)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// On unprivileged sockets the kernel sets the identifier, and
+	// delivers the replies to this socket only. Raw sockets receive
+	// every reply, told apart by the identifier of the Pinger.
+	id := p.id
+	req, reply := byte(icmpEchoRequest), byte(icmpEchoReply)
+	if v6 {
+		req, reply = icmpv6EchoRequest, icmpv6EchoReply
+	}
+	msg := make([]byte, 8+32)
+	msg[0] = req
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	if !v6 {
+		// The checksum of ICMPv6 is computed by the kernel.
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	var to net.Addr = &net.UDPAddr{IP: ip}
+	if raw {
+		to = &net.IPAddr{IP: ip}
+	}
+	if _, err := conn.WriteTo(msg, to); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return fmt.Errorf("%w: no echo reply from %v", ErrTimeout, ip)
+			}
+			return err
+		}
+		if !ip.Equal(addrIP(from)) {
+			continue
+		}
+		b := buf[:n]
+		if !v6 && n >= 20 && b[0]>>4 == 4 {
+			// Unprivileged sockets of macOS deliver the IPv4
+			// header too, whose first byte is never an ICMP type.
+			b = b[int(b[0]&0x0f)*4:]
+		}
+		if n = len(b); n < 8 || b[0] != reply || binary.BigEndian.Uint16(b[6:]) != seq {
+			continue
+		}
+		if raw && binary.BigEndian.Uint16(b[4:]) != id {
+			continue
+		}
+		return nil
+	}
+}
+
+// resolve returns the address to ping.
+func (p *ICMPPinger) resolve(ctx context.Context) (net.IP, error) {
+	if ip := net.ParseIP(p.host); ip != nil {
+		return ip, nil
+	}
+	network := "ip"
+	switch p.opts.family {
+	case IPv4:
+		network = "ip4"
+	case IPv6:
+		network = "ip6"
+	}
+	ips, err := p.opts.resolver().LookupIP(ctx, network, p.host)
+	if err != nil {
+		return nil, dialError(p.host, err)
+	}
+	return ips[0], nil
+}
+
+// listenICMP returns a socket for ICMP or ICMPv6 echo requests, and
+// whether it is a raw one.
+func listenICMP(v6 bool) (net.PacketConn, bool, error) {
+	if conn, err := listenICMPDatagram(v6); err == nil {
+		return conn, false, nil
+	}
+	network := "ip4:icmp"
+	if v6 {
+		network = "ip6:ipv6-icmp"
+	}
+	conn, err := net.ListenPacket(network, "")
+	return conn, true, err
+}
+
+// icmpChecksum returns the internet checksum of msg.
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,147 @@
+//go:build windows
+
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	iphlpapi          = syscall.NewLazyDLL("iphlpapi.dll")
+	icmpCreateFile    = iphlpapi.NewProc("IcmpCreateFile")
+	icmpCloseHandle   = iphlpapi.NewProc("IcmpCloseHandle")
+	icmpSendEcho2     = iphlpapi.NewProc("IcmpSendEcho2")
+	invalidIcmpHandle = ^uintptr(0)
+)
+
+// Status codes of ICMP_ECHO_REPLY, see ipexport.h.
+const (
+	ipSuccess     = 0
+	ipReqTimedOut = 11010
+)
+
+// maxEchoTimeout bounds the echo requests sent with no deadline.
+const maxEchoTimeout = time.Minute
+
+// ipOptionInformation mirrors IP_OPTION_INFORMATION.
+type ipOptionInformation struct {
+	TTL         uint8
+	Tos         uint8
+	Flags       uint8
+	OptionsSize uint8
+	OptionsData uintptr
+}
+
+// echoReply mirrors ICMP_ECHO_REPLY.
+type echoReply struct {
+	Address       [4]byte
+	Status        uint32
+	RoundTripTime uint32
+	DataSize      uint16
+	Reserved      uint16
+	Data          uintptr
+	Options       ipOptionInformation
+}
+
+// listenICMPDatagram returns an unprivileged ICMP socket, which are not
+// available on this platform: systemEcho is used instead.
+func listenICMPDatagram(v6 bool) (net.PacketConn, error) {
+	return nil, errors.New("tracer: unprivileged ICMP not supported")
+}
+
+// systemEcho sends an ICMP echo request to ip through the ICMP helper
+// API, which does not need administrative rights, and reports whether
+// it did: IPv6 addresses are left to raw sockets.
+func systemEcho(ctx context.Context, ip net.IP) (bool, error) {
+	v4 := ip.To4()
+	if v4 == nil || iphlpapi.Load() != nil {
+		return false, nil
+	}
+	timeout := maxEchoTimeout
+	if d, ok := ctx.Deadline(); ok {
+		timeout = time.Until(d)
+	}
+	if timeout < time.Millisecond {
+		return true, fmt.Errorf("%w: no echo reply from %v", ErrTimeout, ip)
+	}
+
+	// The call blocks until the reply or the timeout, wait for it in
+	// the background so that ctx is honoured.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- icmpSendEcho(v4, timeout)
+	}()
+	select {
+	case err := <-errc:
+		if errors.Is(err, ErrTimeout) {
+			err = fmt.Errorf("%w: no echo reply from %v", ErrTimeout, ip)
+		}
+		return true, err
+	case <-ctx.Done():
+		return true, fmt.Errorf("%w: no echo reply from %v", ErrTimeout, ip)
+	}
+}
+
+// icmpSendEcho sends a single echo request to the IPv4 address v4.
+func icmpSendEcho(v4 net.IP, timeout time.Duration) error {
+	h, _, err := icmpCreateFile.Call()
+	if h == invalidIcmpHandle {
+		return fmt.Errorf("IcmpCreateFile: %w", err)
+	}
+	defer icmpCloseHandle.Call(h)
+
+	payload := make([]byte, 32)
+	reply := make([]byte, unsafe.Sizeof(echoReply{})+uintptr(len(payload))+8)
+	n, _, err := icmpSendEcho2.Call(
+		h, 0, 0, 0,
+		uintptr(*(*uint32)(unsafe.Pointer(&v4[0]))),
+		uintptr(unsafe.Pointer(&payload[0])), uintptr(len(payload)),
+		0,
+		uintptr(unsafe.Pointer(&reply[0])), uintptr(len(reply)),
+		uintptr(timeout/time.Millisecond),
+	)
+	if n == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno == ipReqTimedOut {
+			return ErrTimeout
+		}
+		return fmt.Errorf("IcmpSendEcho2: %w", err)
+	}
+	switch r := (*echoReply)(unsafe.Pointer(&reply[0])); r.Status {
+	case ipSuccess:
+		return nil
+	case ipReqTimedOut:
+		return ErrTimeout
+	default:
+		return fmt.Errorf("tracer: ICMP status %d", r.Status)
+	}
+}
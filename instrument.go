@@ -0,0 +1,51 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+)
+
+// Instrumentation observes the pings and the state transitions of a
+// tracer, to export them to a tracing or metrics backend. See the
+// tracerotel package for an OpenTelemetry implementation.
+type Instrumentation interface {
+	// StartPing is called before pinging p with ctx. The Pinger is
+	// passed the returned context instead, and end is called with
+	// the Message the ping resulted in, published or not.
+	StartPing(ctx context.Context, p Pinger) (_ context.Context, end func(Message))
+
+	// Transition is called with each Transition published on
+	// TopicConnTransition, whether the tracer has a PubSub or not. It
+	// is called with the target locked and must not block.
+	Transition(tr Transition)
+}
+
+func (t *Tracer) startPing(ctx context.Context, p Pinger) (context.Context, func(Message)) {
+	if t.Instrumentation == nil {
+		return ctx, func(Message) {}
+	}
+	return t.Instrumentation.StartPing(ctx, p)
+}
@@ -0,0 +1,100 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+type ctxKey struct{}
+
+type instrumentation struct {
+	sync.Mutex
+	pings       []tracer.Message
+	transitions []tracer.Transition
+	unmarked    int // pings whose context did not come from StartPing
+}
+
+func (i *instrumentation) StartPing(ctx context.Context, p tracer.Pinger) (context.Context, func(tracer.Message)) {
+	return context.WithValue(ctx, ctxKey{}, p.ID()), func(m tracer.Message) {
+		i.Lock()
+		defer i.Unlock()
+		i.pings = append(i.pings, m)
+	}
+}
+
+func (i *instrumentation) Transition(tr tracer.Transition) {
+	i.Lock()
+	defer i.Unlock()
+	i.transitions = append(i.transitions, tr)
+}
+
+type ctxPinger struct {
+	*tracertest.Pinger
+	i *instrumentation
+}
+
+func (p ctxPinger) Ping(ctx context.Context) error {
+	if ctx.Value(ctxKey{}) != p.ID() {
+		p.i.Lock()
+		p.i.unmarked++
+		p.i.Unlock()
+	}
+	return p.Pinger.Ping(ctx)
+}
+
+func TestInstrumentation(t *testing.T) {
+	i := new(instrumentation)
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.Instrumentation = i
+	defer s.Close()
+
+	p := ctxPinger{tracertest.NewPinger("db", tracertest.Up, tracertest.Down), i}
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Second * 15); err != nil {
+		t.Fatal(err)
+	}
+
+	i.Lock()
+	defer i.Unlock()
+	if i.unmarked != 0 {
+		t.Fatalf("unexpected pings without the instrumented context: found %v, expected 0", i.unmarked)
+	}
+	if len(i.pings) != 2 || i.pings[1].Err == nil || i.pings[1].State != tracer.ConnOffline || i.pings[1].Seq != 2 {
+		t.Fatalf("unexpected pings: found %+v, expected an online and an offline one", i.pings)
+	}
+	if len(i.transitions) != 2 || i.transitions[1].From != tracer.ConnOnline || i.transitions[1].To != tracer.ConnOffline {
+		t.Fatalf("unexpected transitions: found %+v", i.transitions)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"math"
+	"time"
+)
+
+// jitter returns the random delay of the next ping of tg, a fraction of
+// the time between two checks of tg, see period, up to Jitter. The delay never
+// exceeds the period less the ping timeout of tg, so that the ping
+// completes before the next one is due.
+func (t *Tracer) jitter(tg *target) time.Duration {
+	if t.Jitter <= 0 || t.LowPower != nil {
+		return 0
+	}
+	period := t.period(tg, t.now())
+	d := time.Duration(math.Min(t.Jitter, 1) * t.jitterRand.float64(nil) * float64(period))
+	if max := period - t.pingTimeout(tg); d > max {
+		d = max
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,123 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestJitter(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = 10 * time.Second
+	s.Tracer.Jitter = 0.5
+	defer s.Close()
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		if err := s.Trace(tracertest.NewPinger(fmt.Sprintf("fake%v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Trace(tracertest.NewPinger("interval"), tracer.WithInterval(4*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.Run(39 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := make(map[time.Duration]bool)
+	cycles := make(map[string]int)
+	for _, e := range events {
+		cycles[e.Message.ID]++
+		if e.Message.ID == "interval" {
+			continue
+		}
+		// Pings of the cycle starting at c are spread over the first
+		// half of the refresh period.
+		if off := e.At % s.Tracer.RefreshRate; off >= s.Tracer.RefreshRate/2 {
+			t.Fatalf("unexpected delay of %v: found %v, expected less than %v", e.Message.ID, off, s.Tracer.RefreshRate/2)
+		}
+		at[e.At] = true
+	}
+	if len(at) < n {
+		t.Fatalf("unexpected ping times: found %v, expected at least %v", len(at), n)
+	}
+	for i := 0; i < n; i++ {
+		if c := cycles[fmt.Sprintf("fake%v", i)]; c != 4 {
+			t.Fatalf("unexpected pings of fake%v: found %v, expected 4", i, c)
+		}
+	}
+	if c := cycles["interval"]; c != 10 {
+		t.Fatalf("unexpected pings of interval: found %v, expected 10", c)
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = 10 * time.Second
+	s.Tracer.PingTimeout = 8 * time.Second
+	s.Tracer.Jitter = 1
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := s.Trace(tracertest.NewPinger(fmt.Sprintf("fake%v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := s.Run(19 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		// The delay leaves room for the ping timeout.
+		if off := e.At % s.Tracer.RefreshRate; off > 2*time.Second {
+			t.Fatalf("unexpected delay of %v: found %v, expected at most %v", e.Message.ID, off, 2*time.Second)
+		}
+	}
+
+	// Targets traced while running are checked straight away.
+	if err := s.Trace(tracertest.NewPinger("late")); err != nil {
+		t.Fatal(err)
+	}
+	events, err = s.Run(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if e.Message.ID == "late" {
+			if e.At != 19*time.Second {
+				t.Fatalf("unexpected check of late: found %v, expected %v", e.At, 19*time.Second)
+			}
+			return
+		}
+	}
+	t.Fatalf("unexpected events: found %v, expected a check of late", events)
+}
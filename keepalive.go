@@ -0,0 +1,228 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrConnectionLost is returned by KeepalivePinger when the connection it
+// holds breaks.
+var ErrConnectionLost = errors.New("tracer: connection lost")
+
+// KeepalivePinger is a Pinger holding a long-lived TCP connection, TLS
+// when WithTLSConfig is used, to its target, catching what fresh
+// connections never see: NAT gateways and firewalls that silently drop
+// idle connections, or servers that reset them. The connection is
+// established by the first ping, later pings check that it is still
+// alive and fail with an error wrapping ErrConnectionLost when it is not,
+// the next one connecting again.
+//
+// Without WithHeartbeat, pings only notice connections closed or reset
+// by the peer, or given up by TCP keepalives, see WithKeepAlive. Connections
+// dropped silently along the path are caught sooner by heartbeats: the
+// payload set by WithHeartbeat is written on each ping, and the answer
+// read is matched against WithExpect and passed to validators.
+//
+// The tracer never closes the connection held, call Close once the
+// Pinger is untraced.
+type KeepalivePinger struct {
+	addr string
+	opts *options
+
+	ping        sync.Mutex // serializes pings, guards conn
+	conn        net.Conn
+	established time.Time
+
+	mu     sync.Mutex
+	remote net.Addr
+	state  *tls.ConnectionState
+}
+
+// NewKeepalivePinger returns a KeepalivePinger connecting to addr, in the
+// host:port form. Unless WithID is used, addr is the ID of the Pinger.
+func NewKeepalivePinger(addr string, opts ...Option) *KeepalivePinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = addr
+	}
+	return &KeepalivePinger{addr: addr, opts: o}
+}
+
+// ID implements Pinger.
+func (p *KeepalivePinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger. Returns the resolved address of the connection
+// held, or the address the Pinger was created with.
+func (p *KeepalivePinger) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remote != nil {
+		return p.remote
+	}
+	return &netAddr{network: "tcp", addr: p.addr}
+}
+
+// ConnectionState implements TLSPinger, returning the TLS state of the
+// connection held.
+func (p *KeepalivePinger) ConnectionState() *tls.ConnectionState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Ping implements Pinger, connecting to the target if no connection is
+// held, and checking that the connection is alive.
+func (p *KeepalivePinger) Ping(ctx context.Context) error {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	p.ping.Lock()
+	defer p.ping.Unlock()
+
+	held := p.conn != nil
+	if !held {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	err := p.check(ctx)
+	var verr *ValidationError
+	var eerr *ExpectationError
+	if err == nil || errors.As(err, &verr) || errors.As(err, &eerr) {
+		// A wrong answer still comes through a live connection.
+		return err
+	}
+
+	age := time.Since(p.established)
+	p.close()
+	if !held {
+		return err
+	}
+	return fmt.Errorf("%w after %v: %v", ErrConnectionLost, age.Round(time.Millisecond), err)
+}
+
+// Close closes the connection held, if any.
+func (p *KeepalivePinger) Close() error {
+	p.ping.Lock()
+	defer p.ping.Unlock()
+	return p.close()
+}
+
+// close closes the connection held. Must be called with p.ping locked.
+func (p *KeepalivePinger) close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// connect establishes the connection. Must be called with p.ping locked.
+func (p *KeepalivePinger) connect(ctx context.Context) error {
+	conn, err := p.opts.dial(ctx, "tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+		if p.opts.keepalive > 0 {
+			tc.SetKeepAlivePeriod(p.opts.keepalive)
+		}
+	}
+	p.mu.Lock()
+	p.remote, p.state = conn.RemoteAddr(), nil
+	p.mu.Unlock()
+
+	if p.opts.tlsConfig != nil {
+		config := p.opts.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(p.addr)
+		}
+		tconn := tls.Client(conn, config)
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		state := tconn.ConnectionState()
+		p.mu.Lock()
+		p.state = &state
+		p.mu.Unlock()
+		if err := p.opts.checkRevocation(ctx, &state); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tconn
+	}
+	p.conn, p.established = conn, time.Now()
+	return nil
+}
+
+// check verifies that the connection held is alive, exchanging a
+// heartbeat when configured to. Must be called with p.ping locked.
+func (p *KeepalivePinger) check(ctx context.Context) error {
+	if p.opts.heartbeat == nil {
+		// Whatever the peer sends is discarded until the read
+		// times out, which means the connection is idle and alive.
+		// A peer that keeps sending until ctx is done is alive too.
+		buf := make([]byte, 4096)
+		for ctx.Err() == nil {
+			p.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+			if _, err := p.conn.Read(buf); err != nil {
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	deadline, _ := ctx.Deadline()
+	p.conn.SetDeadline(deadline)
+	if _, err := p.conn.Write(p.opts.heartbeat); err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, err := p.conn.Read(buf)
+	if n == 0 && err != nil {
+		return err
+	}
+	if err := p.opts.match("heartbeat", buf[:n]); err != nil {
+		return err
+	}
+	return p.opts.validate(buf[:n])
+}
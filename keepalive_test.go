@@ -0,0 +1,153 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestKeepalivePinger(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					if s.Text() == "PING" {
+						conn.Write([]byte("PONG\n"))
+					} else {
+						conn.Write([]byte("ERR\n"))
+					}
+				}
+			}()
+		}
+	}()
+	accepted := func() net.Conn {
+		select {
+		case conn := <-conns:
+			return conn
+		case <-time.After(time.Second):
+			t.Fatal("connection not accepted")
+			return nil
+		}
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		opts []tracer.Option
+	}{
+		{"passive", nil},
+		{"heartbeat", []tracer.Option{tracer.WithHeartbeat([]byte("PING\n")), tracer.WithExpect(regexp.MustCompile("^PONG"))}},
+	} {
+		p := tracer.NewKeepalivePinger(l.Addr().String(), tt.opts...)
+		for i := 0; i < 3; i++ {
+			if err := p.Ping(ctx); err != nil {
+				t.Fatalf("%v: %v", tt.name, err)
+			}
+		}
+		conn := accepted()
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+		if err := p.Ping(ctx); !errors.Is(err, tracer.ErrConnectionLost) {
+			t.Fatalf("%v: unexpected error: found %v, expected %v", tt.name, err, tracer.ErrConnectionLost)
+		}
+		if err := p.Ping(ctx); err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		accepted()
+		select {
+		case <-conns:
+			t.Fatalf("%v: unexpected connection", tt.name)
+		default:
+		}
+		p.Close()
+	}
+
+	// A wrong answer is not a broken connection.
+	p := tracer.NewKeepalivePinger(l.Addr().String(), tracer.WithHeartbeat([]byte("HELLO\n")), tracer.WithExpect(regexp.MustCompile("^PONG")))
+	defer p.Close()
+	var eerr *tracer.ExpectationError
+	for i := 0; i < 2; i++ {
+		if err := p.Ping(ctx); !errors.As(err, &eerr) {
+			t.Fatalf("unexpected error: found %v, expected an *tracer.ExpectationError", err)
+		}
+	}
+	accepted()
+	select {
+	case <-conns:
+		t.Fatal("unexpected connection")
+	default:
+	}
+}
+
+func TestKeepaliveChatty(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// The peer never stops sending.
+		for {
+			if _, err := conn.Write([]byte("tick\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	p := tracer.NewKeepalivePinger(l.Addr().String(), tracer.WithTimeout(100*time.Millisecond))
+	defer p.Close()
+	start := time.Now()
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("unexpected ping duration: found %v, expected about %v", d, 100*time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogLevels are the levels of the records logged by a tracer, see
+// WithLogger.
+type LogLevels struct {
+	// Lifecycle is the level of the start and the stop of the tracer,
+	// and of targets being traced and untraced.
+	Lifecycle slog.Level
+
+	// Transition is the level of the state transitions of the targets.
+	Transition slog.Level
+
+	// Failure is the level of the failed pings, cancelled ones
+	// excluded.
+	Failure slog.Level
+}
+
+// DefaultLogLevels are used when Tracer.LogLevels is nil.
+var DefaultLogLevels = LogLevels{
+	Lifecycle:  slog.LevelInfo,
+	Transition: slog.LevelWarn,
+	Failure:    slog.LevelDebug,
+}
+
+// WithLogger makes the tracer log structured records with l, at the
+// levels of Tracer.LogLevels.
+func WithLogger(l *slog.Logger) TracerOption {
+	return func(t *Tracer) {
+		t.Logger = l
+	}
+}
+
+func (t *Tracer) logLevels() *LogLevels {
+	if t.LogLevels != nil {
+		return t.LogLevels
+	}
+	return &DefaultLogLevels
+}
+
+// log logs msg at level with attrs, if the tracer has a Logger.
+func (t *Tracer) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if t.Logger == nil {
+		return
+	}
+	t.Logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// logPing logs the transition tr, if any, and the failure of the ping
+// that resulted in m.
+func (t *Tracer) logPing(m *Message, tr *Transition) {
+	if t.Logger == nil {
+		return
+	}
+	levels := t.logLevels()
+	if tr != nil {
+		attrs := []slog.Attr{
+			slog.String("id", tr.ID),
+			slog.String("from", StateString(tr.From)),
+			slog.String("to", StateString(tr.To)),
+			slog.Duration("duration", tr.Duration),
+		}
+		if m.Err != nil {
+			attrs = append(attrs, slog.Any("error", m.Err))
+		}
+		t.log(levels.Transition, "target state changed", attrs...)
+	}
+	if m.Err != nil && !m.Canceled {
+		t.log(levels.Failure, "ping failed",
+			slog.String("id", m.ID),
+			slog.Any("error", m.Err),
+			slog.String("kind", m.Kind.String()),
+			slog.Int("attempts", m.Attempts),
+			slog.Duration("latency", m.Latency),
+			slog.String("state", StateString(m.State)),
+		)
+	}
+}
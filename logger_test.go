@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func TestWithLogger(t *testing.T) {
+	buf := new(syncBuffer)
+	s := tracertest.NewSimulation()
+	tracer.WithLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo})))(s.Tracer)
+	s.Tracer.RefreshRate = time.Second * 10
+
+	if err := s.Trace(tracertest.NewPinger("db", tracertest.Up, tracertest.Down)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Second * 15); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tracer.Untrace("db"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(&buf.Buffer)
+	for dec.More() {
+		var r map[string]interface{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	// The failure of the second ping is logged at debug level, below
+	// the one of the handler.
+	expected := []struct{ level, msg, to string }{
+		{"INFO", "target traced", ""},
+		{"INFO", "tracer started", ""},
+		{"WARN", "target state changed", "online"},
+		{"WARN", "target state changed", "offline"},
+		{"INFO", "target untraced", ""},
+		{"INFO", "tracer stopped", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("unexpected records: found %v, expected %v", records, expected)
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r["level"] != e.level || r["msg"] != e.msg || e.to != "" && r["to"] != e.to {
+			t.Fatalf("unexpected record %d: found %v, expected %+v", i, r, e)
+		}
+		if r["msg"] != "tracer started" && r["msg"] != "tracer stopped" && r["id"] != "db" {
+			t.Fatalf("unexpected id of record %d: found %v, expected db", i, r["id"])
+		}
+	}
+}
@@ -0,0 +1,247 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials are the secrets submitted by a LoginCheck.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsProvider supplies the credentials of a LoginCheck. It is
+// asked on every run, hence secrets can come from a vault and be rotated
+// without touching the configuration of the tracer.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialsProvider.
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// EnvCredentials returns a CredentialsProvider reading the username and
+// the password from the environment variables userVar and passVar.
+func EnvCredentials(userVar, passVar string) CredentialsProvider {
+	return CredentialsFunc(func(context.Context) (Credentials, error) {
+		user, ok := os.LookupEnv(userVar)
+		if !ok {
+			return Credentials{}, fmt.Errorf("tracer: %v not set", userVar)
+		}
+		pass, ok := os.LookupEnv(passVar)
+		if !ok {
+			return Credentials{}, fmt.Errorf("tracer: %v not set", passVar)
+		}
+		return Credentials{Username: user, Password: pass}, nil
+	})
+}
+
+// LoginFlow describes the login of a web application checked by a
+// LoginCheck.
+type LoginFlow struct {
+	// LoginURL is where the credentials are posted, as a form.
+	LoginURL string
+
+	// UsernameField and PasswordField are the names of the form fields
+	// holding the credentials, "username" and "password" when empty.
+	// Fields are submitted along with them, e.g. a "remember" flag.
+	UsernameField string
+	PasswordField string
+	Fields        url.Values
+
+	// Cookie is the name of the session cookie the login must set.
+	Cookie string
+
+	// ProtectedURL is a page only logged in users can see, which must
+	// answer 200 once logged in. Expect, when not nil, must match it.
+	ProtectedURL string
+	Expect       *regexp.Regexp
+
+	Credentials CredentialsProvider
+}
+
+// LoginCheck is a Pinger running the most common synthetic check of web
+// applications: post the credentials to the login form, follow the
+// redirects, check that the session cookie is set and that a protected
+// page answers 200. Pings fail with a *StepError naming the step that
+// failed: "credentials", "login", "session" or "protected". Credentials
+// never appear in the errors. See Transaction for other flows.
+type LoginCheck struct {
+	id   string
+	flow LoginFlow
+	opts *options
+}
+
+// NewLoginCheck returns a LoginCheck identified by id running flow.
+// Options apply to every request; WithExpect and WithValidator apply to
+// the protected page, whose validators receive an *HTTPResponse. Returns an
+// error if the URLs of flow are not absolute http or https URLs, or if it
+// has no CredentialsProvider.
+func NewLoginCheck(id string, flow LoginFlow, opts ...Option) (*LoginCheck, error) {
+	for _, rawurl := range []string{flow.LoginURL, flow.ProtectedURL} {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("tracer: %q is not an absolute http(s) URL", rawurl)
+		}
+	}
+	if flow.Credentials == nil {
+		return nil, fmt.Errorf("tracer: missing credentials provider")
+	}
+	if flow.UsernameField == "" {
+		flow.UsernameField = "username"
+	}
+	if flow.PasswordField == "" {
+		flow.PasswordField = "password"
+	}
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = id
+	}
+	return &LoginCheck{id: id, flow: flow, opts: o}, nil
+}
+
+// ID implements Pinger.
+func (p *LoginCheck) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger, returning the host of the login URL.
+func (p *LoginCheck) Addr() net.Addr {
+	u, _ := url.Parse(p.flow.LoginURL)
+	return &netAddr{network: "tcp", addr: u.Host}
+}
+
+// Ping implements Pinger.
+func (p *LoginCheck) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the []StepResult of the
+// requests made.
+func (p *LoginCheck) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	creds, err := p.flow.Credentials.Credentials(ctx)
+	if err != nil {
+		return nil, &StepError{Step: 0, Name: "credentials", Err: err}
+	}
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			Proxy:           p.opts.proxy,
+			DialContext:     p.opts.dial,
+			TLSClientConfig: p.opts.tlsConfig,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	form := url.Values{}
+	for k, vs := range p.flow.Fields {
+		form[k] = append([]string(nil), vs...)
+	}
+	form.Set(p.flow.UsernameField, creds.Username)
+	form.Set(p.flow.PasswordField, creds.Password)
+
+	var results []StepResult
+	do := func(name, method, rawurl string, body io.Reader) (*HTTPResponse, error) {
+		req, err := http.NewRequestWithContext(ctx, method, rawurl, body)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		r := &HTTPResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+		r.Body, err = io.ReadAll(io.LimitReader(resp.Body, MaxResponseBody))
+		results = append(results, StepResult{Name: name, StatusCode: resp.StatusCode, Latency: time.Since(start)})
+		return r, err
+	}
+
+	r, err := do("login", http.MethodPost, p.flow.LoginURL, strings.NewReader(form.Encode()))
+	if err == nil && r.StatusCode >= 400 {
+		err = fmt.Errorf("tracer: unexpected status %d", r.StatusCode)
+	}
+	if err != nil {
+		return results, &StepError{Step: 1, Name: "login", Err: err}
+	}
+
+	if p.flow.Cookie != "" {
+		found := false
+		u, _ := url.Parse(p.flow.ProtectedURL)
+		for _, c := range jar.Cookies(u) {
+			found = found || c.Name == p.flow.Cookie && c.Value != ""
+		}
+		if !found {
+			return results, &StepError{Step: 2, Name: "session", Err: fmt.Errorf("tracer: session cookie %v not set", p.flow.Cookie)}
+		}
+	}
+
+	r, err = do("protected", http.MethodGet, p.flow.ProtectedURL, nil)
+	if err == nil && r.StatusCode != http.StatusOK {
+		err = &ExpectationError{What: "status", Expected: "200", Found: strconv.Itoa(r.StatusCode)}
+	}
+	if err == nil {
+		err = expect(p.flow.Expect, "body", r.Body)
+	}
+	if err == nil {
+		if err = p.opts.match("body", r.Body); err == nil {
+			err = p.opts.validate(r)
+		}
+	}
+	if err != nil {
+		return results, &StepError{Step: 3, Name: "protected", Err: err}
+	}
+	return results, nil
+}
@@ -0,0 +1,96 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// LowPower configures the scheduling of a Tracer for battery powered or
+// single-core devices, where every wakeup of the CPU or of the radio
+// counts. The run loop wakes up only at multiples of Resolution, so that
+// the periodic refresh, the refreshes requested by Untrace and the checks
+// of the targets passed to Trace are batched into as few wakeups as
+// possible, optionally restricted to the windows in which the radio is
+// powered. The first check of the targets traced before Run is not
+// delayed.
+type LowPower struct {
+	// Resolution is the granularity of the wakeups, counted from the
+	// Unix epoch. One second when zero.
+	Resolution time.Duration
+
+	// WakePeriod and WakeWindow, when both positive, restrict the
+	// wakeups to the first WakeWindow of every WakePeriod, counted from
+	// the Unix epoch.
+	WakePeriod time.Duration
+	WakeWindow time.Duration
+}
+
+func (lp *LowPower) resolution() time.Duration {
+	if lp.Resolution <= 0 {
+		return time.Second
+	}
+	return lp.Resolution
+}
+
+// next returns the first time a wakeup is allowed at or after at.
+func (lp *LowPower) next(at time.Time) time.Time {
+	at = ceil(at, lp.resolution())
+	if lp.WakePeriod <= 0 || lp.WakeWindow <= 0 {
+		return at
+	}
+	if off := mod(at, lp.WakePeriod); off >= lp.WakeWindow {
+		at = at.Add(lp.WakePeriod - off)
+	}
+	return at
+}
+
+// mod returns the time elapsed since the last multiple of d since the Unix
+// epoch.
+func mod(t time.Time, d time.Duration) time.Duration {
+	off := time.Duration(t.UnixNano() % int64(d))
+	if off < 0 {
+		off += d
+	}
+	return off
+}
+
+// ceil rounds t up to a multiple of d since the Unix epoch.
+func ceil(t time.Time, d time.Duration) time.Time {
+	if off := mod(t, d); off > 0 {
+		return t.Add(d - off)
+	}
+	return t
+}
+
+// wakeAfter is after for the timers of the run loop, which are aligned
+// to the allowed wakeups in low-power mode.
+func (t *Tracer) wakeAfter(d time.Duration) <-chan time.Time {
+	if t.LowPower == nil {
+		return t.after(d)
+	}
+	now := t.now()
+	return t.after(t.LowPower.next(now.Add(d)).Sub(now))
+}
@@ -0,0 +1,73 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestLowPower(t *testing.T) {
+	c := tracertest.NewClock(time.Unix(1000, 300*int64(time.Millisecond)))
+	tr := tracer.New()
+	tr.Clock = c
+	tr.RefreshRate = time.Second
+	tr.LowPower = &tracer.LowPower{
+		Resolution: time.Second,
+		WakePeriod: 10 * time.Second,
+		WakeWindow: 2 * time.Second,
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	// 1001.3s rounds up to 1002s, outside of the window [1000s, 1002s).
+	for _, expected := range []int64{1010, 1011, 1020, 1021, 1030} {
+		c.BlockUntil(1)
+		next, _ := c.Next()
+		if !next.Equal(time.Unix(expected, 0)) {
+			t.Fatalf("unexpected wakeup: found %v, expected %v", next.Unix(), expected)
+		}
+		c.Advance(next.Sub(c.Now()))
+	}
+
+	// Targets traced while running wait for the next wakeup as well.
+	c.BlockUntil(1)
+	p := tracertest.NewPinger("fake")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	c.BlockUntil(2)
+	if next, _ := c.Next(); !next.Equal(time.Unix(1031, 0)) {
+		t.Fatalf("unexpected wakeup: found %v, expected %v", next.Unix(), 1031)
+	}
+	if n := p.Calls(); n != 0 {
+		t.Fatalf("unexpected pings: found %v, expected %v", n, 0)
+	}
+}
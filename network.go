@@ -0,0 +1,95 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NetworkCondition is the condition of the local network of the probe
+// host, as reported to SetNetwork. It is published on TopicNetwork each
+// time it changes.
+type NetworkCondition struct {
+	// Up is set when the host has connectivity, e.g. an interface is up
+	// and a default route exists.
+	Up bool
+
+	// Metered is set when the connectivity is billed by usage, e.g.
+	// tethering or a cellular modem, see Tracer.MeteredInterval.
+	Metered bool
+
+	// Reason describes the condition, e.g. "default route lost".
+	Reason string
+}
+
+// SetNetwork tells t the condition of the local network, usually from a
+// hook watching interfaces and routes, see traceroute.WatchNetwork.
+// While the network is down pinging is paused, and the pings that return
+// in the meantime are published as Downtime, since their failures say
+// nothing about the targets. When it comes back, every target is checked
+// right away.
+func (t *Tracer) SetNetwork(c NetworkCondition) {
+	t.Lock()
+	prev := t.network
+	t.network = &c
+	t.Unlock()
+
+	if prev != nil && *prev == c || prev == nil && c.Up && !c.Metered {
+		return
+	}
+	t.emit(TopicNetwork, "", c)
+	if c.Up && (prev == nil || !prev.Up) {
+		atomic.StoreInt32(&t.fullRefresh, 1)
+		t.refresh()
+	}
+}
+
+// Network returns the condition of the local network last reported to
+// SetNetwork, up and not metered if none was.
+func (t *Tracer) Network() NetworkCondition {
+	t.Lock()
+	defer t.Unlock()
+	if t.network == nil {
+		return NetworkCondition{Up: true}
+	}
+	return *t.network
+}
+
+// cycle reports whether the ping cycle starting at now runs given the
+// condition of the local network, and whether it checks every target
+// regardless of its profile. Called by the run loop only.
+func (t *Tracer) cycle(now time.Time) (run, full bool) {
+	c := t.Network()
+	if !c.Up {
+		return false, false
+	}
+	if c.Metered && t.MeteredInterval > 0 && now.Sub(t.lastCycle) < t.MeteredInterval {
+		return false, false
+	}
+	t.lastCycle = now
+	t.cycles.Add(1)
+	return true, atomic.SwapInt32(&t.fullRefresh, 0) == 1
+}
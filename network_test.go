@@ -0,0 +1,89 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestSetNetwork(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	rec := new(recorder)
+	tr.PubSub = rec
+	p := tracertest.NewPinger("fake")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOnline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	down := tracer.NetworkCondition{Reason: "default route lost"}
+	tr.SetNetwork(down)
+	time.Sleep(10 * time.Millisecond) // let the pings in flight return
+	calls := p.Calls()
+	time.Sleep(20 * time.Millisecond)
+	if n := p.Calls(); n != calls {
+		t.Fatalf("unexpected pings while the network is down: found %v, expected %v", n, calls)
+	}
+	if c := tr.Network(); c != down {
+		t.Fatalf("unexpected network condition: found %v, expected %v", c, down)
+	}
+
+	tr.SetNetwork(tracer.NetworkCondition{Up: true})
+	for p.Calls() == calls {
+		if ctx.Err() != nil {
+			t.Fatal("pinging did not resume")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rec.Lock()
+	defer rec.Unlock()
+	var events []tracer.NetworkCondition
+	for _, v := range rec.other {
+		if c, ok := v.(tracer.NetworkCondition); ok {
+			events = append(events, c)
+		}
+	}
+	if len(events) != 2 || events[0].Up || !events[1].Up {
+		t.Fatalf("unexpected network events: found %v, expected down and up", events)
+	}
+}
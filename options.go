@@ -0,0 +1,465 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Dialer dials network connections. *net.Dialer satisfies it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Option configures a built-in Pinger. Every built-in Pinger accepts the
+// same options, ignoring the ones that do not apply to it.
+type Option func(*options)
+
+type options struct {
+	id         string
+	timeout    time.Duration
+	tlsConfig  *tls.Config
+	certs      []tls.Certificate
+	revocation *RevocationChecker
+	dnssec     bool
+	changes    bool
+	dialer     Dialer
+	expect     *regexp.Regexp
+	ignore     *regexp.Regexp
+	validators []Validator
+	nameserver string
+	rdap       string
+	size       int64
+	interval   time.Duration
+	family     Family
+	delay      time.Duration
+	heartbeat  []byte
+	keepalive  time.Duration
+	httpProxy  *url.URL
+	noProxy    string
+	method     string
+	status     []int
+	maxLatency time.Duration
+	redirects  *int
+}
+
+func newOptions(opts []Option) *options {
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.dialer == nil {
+		o.dialer = new(net.Dialer)
+	}
+	if len(o.certs) > 0 {
+		config := new(tls.Config)
+		if o.tlsConfig != nil {
+			config = o.tlsConfig.Clone()
+		}
+		config.Certificates = append(config.Certificates, o.certs...)
+		o.tlsConfig = config
+	}
+	return o
+}
+
+// WithID sets the ID of the Pinger, which defaults to the address or URL
+// the Pinger was created with.
+func WithID(id string) Option {
+	return func(o *options) {
+		o.id = id
+	}
+}
+
+// WithTimeout bounds each ping, on top of the deadline of the context
+// passed to Ping.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithTLSConfig makes the Pinger use TLS with config. TCP pingers perform
+// a TLS handshake after connecting; HTTP pingers use config for https URLs.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithClientCertificate makes the Pinger present cert when the target
+// asks for a client certificate during the TLS handshake, so that services
+// requiring mutual TLS can be checked with real credentials. It is added
+// to the configuration set with WithTLSConfig, if any, and enables TLS for
+// TCP pingers otherwise.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.certs = append(o.certs, cert)
+	}
+}
+
+// LoadClientCertificate returns the WithClientCertificate option for the
+// PEM encoded certificate and private key stored in certFile and keyFile,
+// which may be the same file.
+func LoadClientCertificate(certFile, keyFile string) (Option, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return WithClientCertificate(cert), nil
+}
+
+// WithRevocationCheck makes pings fail with a *RevocationError when a
+// certificate presented by the target is revoked or, unless c.SoftFail is
+// set, its revocation status cannot be determined.
+func WithRevocationCheck(c *RevocationChecker) Option {
+	return func(o *options) {
+		o.revocation = c
+	}
+}
+
+// WithDialer makes the Pinger open its connections with d.
+func WithDialer(d Dialer) Option {
+	return func(o *options) {
+		o.dialer = d
+	}
+}
+
+// WithExpect makes pings fail with an *ExpectationError unless the data
+// received from the target matches the regular expression re: the
+// greeting sent by the server for TCP pingers, the response body for HTTP
+// pingers.
+func WithExpect(re *regexp.Regexp) Option {
+	return func(o *options) {
+		o.expect = re
+	}
+}
+
+// Validator checks the output of a ping, returning an error when the
+// target is reachable but answered wrong. The type of output depends on the
+// Pinger:
+//
+//	*HTTPResponse         HTTPPinger
+//	[]byte                TCPPinger, the greeting sent by the server
+//	[]string              DNSPinger, the addresses the name resolves to
+//	*Throughput           BandwidthPinger
+//	*HappyEyeballsResult  HappyEyeballsPinger
+//	*TLSReport            TLSInspector
+//	*DomainExpiry         DomainPinger
+//	[]byte                KeepalivePinger, the answer to the heartbeat
+//	*HTTPResponse         Transaction and LoginCheck, the last response
+//
+// See JSONSchema for a Validator of JSON APIs.
+type Validator func(output interface{}) error
+
+// WithValidator makes pings fail with a *ValidationError when v rejects
+// their output. The option can be used more than once.
+func WithValidator(v Validator) Option {
+	return func(o *options) {
+		o.validators = append(o.validators, v)
+	}
+}
+
+// WithNameserver makes the Pinger resolve names using the DNS server at
+// addr, in the host:port form, instead of the system resolver.
+func WithNameserver(addr string) Option {
+	return func(o *options) {
+		o.nameserver = addr
+	}
+}
+
+// WithRDAPServer sets the base URL of the RDAP service DomainPinger
+// queries, DefaultRDAPServer by default, e.g.
+// https://rdap.verisign.com/com/v1.
+func WithRDAPServer(rawurl string) Option {
+	return func(o *options) {
+		o.rdap = rawurl
+	}
+}
+
+// WithDNSSEC makes DNS pingers require the answers to be authenticated
+// by the name server, which must be a validating resolver, see
+// WithNameserver. Pings fail with ErrDNSSECBogus when the signatures of the
+// zone do not validate and with ErrDNSSECInsecure when the answers are not
+// authenticated, telling signing problems from resolution failures.
+func WithDNSSEC() Option {
+	return func(o *options) {
+		o.dnssec = true
+	}
+}
+
+// WithChangeDetection makes the Pinger report changes in what the target
+// serves, published by the tracer on TopicChange: DNS pingers report a
+// RecordChanged event when the set of addresses the name resolves to
+// changes, catching hijacks, failovers and forgotten migrations; HTTP
+// pingers report a ContentChanged event when the body of successful
+// responses changes, catching defacements and unexpected deploys.
+func WithChangeDetection() Option {
+	return func(o *options) {
+		o.changes = true
+	}
+}
+
+// WithIgnore makes change detection ignore the parts of HTTP bodies
+// matching re, e.g. timestamps or CSRF tokens that change on every
+// response, see WithChangeDetection.
+func WithIgnore(re *regexp.Regexp) Option {
+	return func(o *options) {
+		o.ignore = re
+	}
+}
+
+// Family is an IP address family.
+type Family int
+
+// Families.
+const (
+	AnyFamily Family = iota
+	IPv4
+	IPv6
+)
+
+func (f Family) String() string {
+	switch f {
+	case IPv4:
+		return "ipv4"
+	case IPv6:
+		return "ipv6"
+	default:
+		return "any"
+	}
+}
+
+// WithFamily restricts the Pinger to the addresses of family f: TCP and
+// HTTP pingers connect over it only, DNS pingers check that the name
+// has A records for IPv4 and AAAA records for IPv6. See DualStack.
+func WithFamily(f Family) Option {
+	return func(o *options) {
+		o.family = f
+	}
+}
+
+// WithHTTPProxy makes HTTP pingers send their requests through the HTTP
+// or HTTPS proxy at u, credentials included, instead of the one configured
+// by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+// Unlike the environment, u is used for loopback targets as well.
+func WithHTTPProxy(u *url.URL) Option {
+	return func(o *options) {
+		o.httpProxy = u
+	}
+}
+
+// WithNoProxy makes HTTP pingers reach the targets matching list
+// directly, bypassing the proxy. list follows the NO_PROXY conventions: a
+// comma separated list of host names, matching their subdomains as well
+// unless prefixed by a dot, IP addresses, CIDR ranges, each optionally
+// followed by a port, or * to match every target.
+func WithNoProxy(list string) Option {
+	return func(o *options) {
+		o.noProxy = list
+	}
+}
+
+// WithAttemptDelay sets the head start HappyEyeballsPinger gives to IPv6
+// connections over IPv4 ones, 250ms by default as recommended by RFC 8305.
+func WithAttemptDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.delay = d
+	}
+}
+
+// WithHeartbeat makes KeepalivePinger write payload on the connection it
+// holds on each ping and read the answer, e.g. a PING command of the
+// protocol spoken by the target.
+func WithHeartbeat(payload []byte) Option {
+	return func(o *options) {
+		o.heartbeat = payload
+	}
+}
+
+// WithKeepAlive sets the period of the TCP keepalives sent by
+// KeepalivePinger on the connection it holds, 15 seconds by default.
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = period
+	}
+}
+
+// WithTransferSize sets the number of bytes BandwidthPinger transfers
+// to measure the throughput, 1MiB by default.
+func WithTransferSize(n int64) Option {
+	return func(o *options) {
+		o.size = n
+	}
+}
+
+// WithMethod sets the method of the requests of HTTPPinger, GET by
+// default. HEAD spares the transfer of the body, which expectations and
+// validators then do not see.
+func WithMethod(method string) Option {
+	return func(o *options) {
+		o.method = method
+	}
+}
+
+// WithStatus sets the status codes HTTPPinger accepts, instead of any
+// status lower than 400. Other codes fail the ping with an
+// *ExpectationError.
+func WithStatus(codes ...int) Option {
+	return func(o *options) {
+		o.status = codes
+	}
+}
+
+// WithMaxLatency makes HTTPPinger fail with a *LatencyError when the
+// response takes longer than d to arrive, even though it is as expected.
+func WithMaxLatency(d time.Duration) Option {
+	return func(o *options) {
+		o.maxLatency = d
+	}
+}
+
+// WithRedirects makes HTTPPinger follow at most n redirects, failing
+// with an *ExpectationError when there are more, instead of up to ten.
+// With zero no redirect is followed, and the redirect itself is the
+// response checked.
+func WithRedirects(n int) Option {
+	return func(o *options) {
+		o.redirects = &n
+	}
+}
+
+// WithMinInterval makes the Pinger perform at most one measurement every
+// d, returning the outcome of the last one in the meantime, for checks that
+// are too expensive to run on every refresh. BandwidthPinger,
+// TLSInspector and DomainPinger support it.
+func WithMinInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// ValidationError is returned by the built-in pingers when a Validator
+// rejects the output of a ping: the target is reachable, but wrong.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("tracer: invalid result: %v", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ExpectationError is returned by the built-in pingers when the target
+// is reachable, but does not answer as expected.
+type ExpectationError struct {
+	What     string // what did not match, e.g. "body"
+	Expected string
+	Found    string
+}
+
+func (e *ExpectationError) Error() string {
+	return fmt.Sprintf("tracer: unexpected %v: found %q, expected %v", e.What, e.Found, e.Expected)
+}
+
+// withTimeout bounds ctx with the timeout of o, if any.
+func (o *options) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// validate runs the validators of o on output.
+func (o *options) validate(output interface{}) error {
+	for _, v := range o.validators {
+		if err := v(output); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// dial dials addr with the Dialer of o, restricting tcp and udp networks
+// to the family of o.
+func (o *options) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" || network == "udp" {
+		switch o.family {
+		case IPv4:
+			network += "4"
+		case IPv6:
+			network += "6"
+		}
+	}
+	conn, err := o.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, dialError(addr, err)
+	}
+	return conn, nil
+}
+
+// resolver returns the resolver to use according to o.
+func (o *options) resolver() *net.Resolver {
+	if o.nameserver == "" {
+		if _, ok := o.dialer.(*net.Dialer); ok {
+			return net.DefaultResolver
+		}
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if o.nameserver != "" {
+				addr = o.nameserver
+			}
+			return o.dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// match checks data against the expectation of o, if any.
+func (o *options) match(what string, data []byte) error {
+	return expect(o.expect, what, data)
+}
+
+// expect returns an *ExpectationError about what if data does not match
+// re, nil if it does or re is nil.
+func expect(re *regexp.Regexp, what string, data []byte) error {
+	if re == nil || re.Match(data) {
+		return nil
+	}
+	const max = 64
+	if len(data) > max {
+		data = data[:max]
+	}
+	return &ExpectationError{What: what, Expected: re.String(), Found: string(data)}
+}
@@ -0,0 +1,161 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultOutageRetention is how long outages are kept when
+// Tracer.OutageRetention is zero.
+const DefaultOutageRetention = 30 * 24 * time.Hour
+
+// Outage is a period of time a target spent in state ConnOffline, see
+// Outages.
+type Outage struct {
+	ID    string
+	Start time.Time
+	End   time.Time // zero while the outage is ongoing
+
+	// Duration is End - Start, or the time elapsed since Start if
+	// the outage is ongoing.
+	Duration time.Duration
+
+	// Err and Kind are the ones of the check that took the target
+	// offline.
+	Err  error
+	Kind Kind
+}
+
+// Ongoing reports whether the target is still offline.
+func (o Outage) Ongoing() bool {
+	return o.End.IsZero()
+}
+
+func (t *Tracer) outageRetention() time.Duration {
+	if t.OutageRetention > 0 {
+		return t.OutageRetention
+	}
+	return DefaultOutageRetention
+}
+
+// recordOutage opens or closes an outage of tg if m, which moved it from
+// state from to its current state at now, took it offline or back.
+// Must be called with tg locked.
+func (t *Tracer) recordOutage(tg *target, m *Message, from int, now time.Time) {
+	switch {
+	case from != ConnOffline && tg.state == ConnOffline:
+		outages := tg.outages[:0]
+		for _, o := range tg.outages {
+			if now.Sub(o.End) < t.outageRetention() {
+				outages = append(outages, o)
+			}
+		}
+		tg.outages = append(outages, Outage{ID: tg.ID(), Start: now, Err: m.Err, Kind: m.Kind})
+	case from == ConnOffline && tg.state != ConnOffline && len(tg.outages) > 0:
+		o := &tg.outages[len(tg.outages)-1]
+		o.End = now
+		o.Duration = now.Sub(o.Start)
+	}
+}
+
+// Outages returns the outages of the target stored with id that ended
+// after since, or are still ongoing, oldest first. Outages are kept for
+// OutageRetention after their end. Returns nil if no target is stored
+// with id.
+func (t *Tracer) Outages(id string, since time.Time) []Outage {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return nil
+	}
+	return outages(tg, since, t.now())
+}
+
+func outages(tg *target, since, now time.Time) []Outage {
+	tg.Lock()
+	defer tg.Unlock()
+
+	var outages []Outage
+	for _, o := range tg.outages {
+		if !o.Ongoing() && !o.End.After(since) {
+			continue
+		}
+		if o.Ongoing() {
+			o.Duration = now.Sub(o.Start)
+		}
+		outages = append(outages, o)
+	}
+	return outages
+}
+
+// DowntimeReport summarizes the outages of the targets of a tracer over
+// a period of time, see Downtime.
+type DowntimeReport struct {
+	Since time.Time
+	Until time.Time
+
+	// Targets contains an entry for each target, sorted by ID.
+	Targets []TargetDowntime
+}
+
+// TargetDowntime is the entry of a target in a DowntimeReport.
+type TargetDowntime struct {
+	ID string
+
+	// Outages are the ones overlapping the period of the report.
+	Outages []Outage
+
+	// Downtime is the time the target spent offline within the period
+	// of the report, Longest the longest of its outages, whole.
+	Downtime time.Duration
+	Longest  time.Duration
+}
+
+// Downtime reports the outages of every target from since until now.
+func (t *Tracer) Downtime(since time.Time) DowntimeReport {
+	now := t.now()
+	r := DowntimeReport{Since: since, Until: now}
+	for _, tg := range t.snapshot() {
+		td := TargetDowntime{ID: tg.ID(), Outages: outages(tg, since, now)}
+		for _, o := range td.Outages {
+			start, end := o.Start, o.Start.Add(o.Duration)
+			if start.Before(since) {
+				start = since
+			}
+			if end.After(start) {
+				td.Downtime += end.Sub(start)
+			}
+			if o.Duration > td.Longest {
+				td.Longest = o.Duration
+			}
+		}
+		r.Targets = append(r.Targets, td)
+	}
+	sort.Slice(r.Targets, func(i, j int) bool {
+		return r.Targets[i].ID < r.Targets[j].ID
+	})
+	return r
+}
@@ -0,0 +1,80 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestOutages(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	db := tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Down, tracertest.Up, tracertest.Down)
+	web := tracertest.NewPinger("web", tracertest.Up)
+	for _, p := range []tracer.Pinger{db, web} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// db is offline from 10s to 30s, then again from 40s.
+	if _, err := s.Run(time.Second * 45); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(s int) time.Time { return tracertest.Epoch.Add(time.Second * time.Duration(s)) }
+	o := s.Tracer.Outages("db", tracertest.Epoch)
+	if len(o) != 2 {
+		t.Fatalf("unexpected outages: found %+v, expected 2", o)
+	}
+	if !o[0].Start.Equal(at(10)) || !o[0].End.Equal(at(30)) || o[0].Duration != time.Second*20 || o[0].Err == nil {
+		t.Fatalf("unexpected first outage: found %+v", o[0])
+	}
+	if !o[1].Ongoing() || !o[1].Start.Equal(at(40)) || o[1].Duration != time.Second*5 {
+		t.Fatalf("unexpected second outage: found %+v", o[1])
+	}
+	if o := s.Tracer.Outages("db", at(35)); len(o) != 1 || !o[0].Ongoing() {
+		t.Fatalf("unexpected outages since 35s: found %+v, expected the ongoing one", o)
+	}
+	if o := s.Tracer.Outages("unknown", tracertest.Epoch); o != nil {
+		t.Fatalf("unexpected outages: found %+v, expected nil", o)
+	}
+
+	r := s.Tracer.Downtime(at(15))
+	if len(r.Targets) != 2 || r.Targets[0].ID != "db" || r.Targets[1].ID != "web" {
+		t.Fatalf("unexpected report targets: found %+v", r.Targets)
+	}
+	if d := r.Targets[0]; d.Downtime != time.Second*20 || d.Longest != time.Second*20 || len(d.Outages) != 2 {
+		t.Fatalf("unexpected downtime of db: found %v (longest %v), expected 20s", d.Downtime, d.Longest)
+	}
+	if d := r.Targets[1]; d.Downtime != 0 || len(d.Outages) != 0 {
+		t.Fatalf("unexpected downtime of web: found %v, expected 0", d.Downtime)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestParserStrict(t *testing.T) {
+	p := &tracer.Parser{Strict: true}
+	if _, err := p.ParsePinger("tcp://db:5432?timeout=1s&expect=^OK#db"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := p.ParsePinger("https://api.example.com/health?timeout=1s&verbose=1")
+	var perr *tracer.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("unexpected error: found %v, expected a *tracer.ParseError", err)
+	}
+	if col := strings.Index(perr.Input, "verbose") + 1; perr.Col != col {
+		t.Fatalf("unexpected column: found %v, expected %v", perr.Col, col)
+	}
+
+	// Lenient parsing forwards the unknown key to the endpoint.
+	if _, err := tracer.ParsePinger(perr.Input); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tt := []struct {
+		rawurl string
+		col    int
+	}{
+		{"tcp://db:5432?expect=(", 15},
+		{"tcp://db:5432?a=1&timeout=-1s", 19},
+		{"tcp://:5432", 7},
+		{"icmp://host:80", 8},
+		{"tcp://?timeout=1s", 7},
+		{"dns://8.8.8.8:53/", 17},
+		{"rdap://rdap.example/", 20},
+		{"tcp://db:5432?a=%zz", 15},
+		{"https://host/?status=200,ok", 15},
+		{"db:5432", 1},
+	}
+	for _, test := range tt {
+		_, err := tracer.ParsePinger(test.rawurl)
+		var perr *tracer.ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%v: unexpected error: found %v, expected a *tracer.ParseError", test.rawurl, err)
+		}
+		if perr.Col != test.col {
+			t.Fatalf("%v: unexpected column: found %v, expected %v (%v)", test.rawurl, perr.Col, test.col, err)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	input := `# databases
+tcp://db:5432#db
+
+  tcp://db-replica:5432#replica
+dns:///example.com
+`
+	var p tracer.Parser
+	pingers, err := p.ParseTargets(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range pingers {
+		ids = append(ids, p.ID())
+	}
+	if s := strings.Join(ids, ","); s != "db,replica,dns:///example.com" {
+		t.Fatalf("unexpected IDs: found %v, expected %v", s, "db,replica,dns:///example.com")
+	}
+
+	_, err = p.ParseTargets(strings.NewReader(input + "  tcp://db-backup:5432#db\n"))
+	var perr *tracer.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("unexpected error: found %v, expected a *tracer.ParseError", err)
+	}
+	if perr.Line != 6 || perr.Col != 3 {
+		t.Fatalf("unexpected position: found %v:%v, expected 6:3", perr.Line, perr.Col)
+	}
+
+	_, err = p.ParseTargets(strings.NewReader("tcp://db:5432\n\ttcp://db:5432?timeout=x\n"))
+	if !errors.As(err, &perr) {
+		t.Fatalf("unexpected error: found %v, expected a *tracer.ParseError", err)
+	}
+	if perr.Line != 2 || perr.Col != 16 {
+		t.Fatalf("unexpected position: found %v:%v, expected 2:16", perr.Line, perr.Col)
+	}
+}
+
+func FuzzParsePinger(f *testing.F) {
+	for _, s := range []string{
+		"tcp://db:5432?timeout=2s#database",
+		"https://api.example.com/health?timeout=1s&verbose=1",
+		"dns://8.8.8.8:53/example.com?expect=93%5C.",
+		"rdap://rdap.verisign.com/com/v1/example.com#example",
+		"http://[::1]:80/?a=1;b=2",
+		"tcp://db:5432?timeout=",
+		"gopher://host",
+		"://",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, rawurl string) {
+		lenient, err := tracer.ParsePinger(rawurl)
+		var perr *tracer.ParseError
+		if errors.As(err, &perr) && (perr.Col < 1 || perr.Col > len(rawurl)+1) {
+			t.Fatalf("column out of range: found %v, input length %v", perr.Col, len(rawurl))
+		}
+		if err == nil && lenient.ID() == "" {
+			t.Fatal("parsed pinger has no ID")
+		}
+
+		p := &tracer.Parser{Strict: true}
+		if _, err := p.ParsePinger(rawurl); err == nil && lenient == nil {
+			t.Fatal("strict parsing accepted a URL rejected by lenient parsing")
+		}
+	})
+}
@@ -0,0 +1,735 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestTCPPinger(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	p := tracer.NewTCPPinger(addr)
+	if p.ID() != addr {
+		t.Fatalf("unexpected id: found %v, expected %v", p.ID(), addr)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Addr().(*net.TCPAddr); !ok {
+		t.Fatalf("unexpected address: found %T, expected a resolved address", p.Addr())
+	}
+
+	l.Close()
+	if err := p.Ping(context.Background()); !errors.Is(err, tracer.ErrConnRefused) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrConnRefused)
+	}
+	var derr *tracer.DialError
+	if err := tracer.NewTCPPinger("host.invalid:80").Ping(context.Background()); !errors.Is(err, tracer.ErrDNS) || !errors.As(err, &derr) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrDNS)
+	}
+
+	stall := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	p = tracer.NewTCPPinger(addr, tracer.WithDialer(stall), tracer.WithTimeout(time.Millisecond))
+	if err := p.Ping(context.Background()); !errors.Is(err, tracer.ErrTimeout) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrTimeout)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		kind tracer.Kind
+	}{
+		{nil, tracer.KindNone},
+		{errors.New("boom"), tracer.KindOther},
+		{tracer.ErrPingTimeout, tracer.KindTimeout},
+		{&tracer.DialError{Class: tracer.ErrTimeout, Err: errors.New("i/o timeout")}, tracer.KindTimeout},
+		{&tracer.DialError{Class: tracer.ErrConnRefused, Err: errors.New("refused")}, tracer.KindConnRefused},
+		{fmt.Errorf("lookup: %w", &net.DNSError{Err: "no such host", Name: "host.invalid"}), tracer.KindDNS},
+		{fmt.Errorf("%w: %w", tracer.ErrCanceled, context.Canceled), tracer.KindCanceled},
+	} {
+		if k := tracer.Classify(test.err); k != test.kind {
+			t.Fatalf("%v: unexpected kind: found %v, expected %v", test.err, k, test.kind)
+		}
+		text, _ := test.kind.MarshalText()
+		var k tracer.Kind
+		if err := k.UnmarshalText(text); err != nil || k != test.kind {
+			t.Fatalf("unexpected kind decoded from %s: found %v, expected %v", text, k, test.kind)
+		}
+	}
+}
+
+func TestICMPPinger(t *testing.T) {
+	p, err := tracer.ParsePinger("icmp://127.0.0.1?timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); errors.Is(err, os.ErrPermission) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if p.Addr().String() != "127.0.0.1" {
+		t.Fatalf("unexpected address: found %v, expected %v", p.Addr(), "127.0.0.1")
+	}
+}
+
+func TestWindowsServicePinger(t *testing.T) {
+	p, err := tracer.ParsePinger("winsvc://Spooler#printing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID() != "printing" || p.Addr().String() != "Spooler" {
+		t.Fatalf("unexpected pinger: id %v, address %v", p.ID(), p.Addr())
+	}
+	if runtime.GOOS != "windows" {
+		if err := p.Ping(context.Background()); err == nil {
+			t.Fatalf("unexpected error: found %v, expected a failure on %v", err, runtime.GOOS)
+		}
+	}
+}
+
+func TestProcessPinger(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("process checks not supported on", runtime.GOOS)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := tracer.ParsePinger("process://" + filepath.Base(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p = tracer.NewProcessPinger("tracer-no-such-process")
+	if err := p.Ping(context.Background()); !errors.Is(err, tracer.ErrProcessNotRunning) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrProcessNotRunning)
+	}
+}
+
+func TestHTTPPinger(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p, err := tracer.NewHTTPPinger(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Addr().String() != srv.Listener.Addr().String() {
+		t.Fatalf("unexpected address: found %v, expected %v", p.Addr(), srv.Listener.Addr())
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := p.Ping(context.Background()); err == nil {
+		t.Fatal("ping should fail on 503")
+	}
+
+	if _, err := tracer.NewHTTPPinger("ftp://host/file"); err == nil {
+		t.Fatal("non http URLs should be rejected")
+	}
+}
+
+func TestHTTPExpectations(t *testing.T) {
+	var method atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method.Store(r.Method)
+		switch r.URL.Path {
+		case "/twice":
+			http.Redirect(w, r, "/once", http.StatusFound)
+		case "/once":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, "OK")
+		}
+	}))
+	defer srv.Close()
+
+	tt := []struct {
+		path string
+		opts []tracer.Option
+		err  interface{} // pointer to the type of the error expected, nil for none
+	}{
+		{"/missing", nil, new(*tracer.ExpectationError)},
+		{"/missing", []tracer.Option{tracer.WithStatus(404)}, nil},
+		{"/", []tracer.Option{tracer.WithStatus(201, 204)}, new(*tracer.ExpectationError)},
+		{"/", []tracer.Option{tracer.WithExpect(regexp.MustCompile("^KO"))}, new(*tracer.ExpectationError)},
+		{"/", []tracer.Option{tracer.WithMaxLatency(time.Nanosecond)}, new(*tracer.LatencyError)},
+		{"/twice", nil, nil},
+		{"/twice", []tracer.Option{tracer.WithRedirects(2)}, nil},
+		{"/twice", []tracer.Option{tracer.WithRedirects(1)}, new(*tracer.ExpectationError)},
+		{"/twice", []tracer.Option{tracer.WithRedirects(0)}, nil},
+		{"/twice", []tracer.Option{tracer.WithRedirects(0), tracer.WithStatus(200)}, new(*tracer.ExpectationError)},
+	}
+	for _, test := range tt {
+		p, err := tracer.NewHTTPPinger(srv.URL+test.path, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Ping(context.Background())
+		if test.err == nil && err != nil || test.err != nil && !errors.As(err, test.err) {
+			t.Fatalf("%v: unexpected error: found %v, expected %T", test.path, err, test.err)
+		}
+	}
+
+	p, err := tracer.NewHTTPPinger(srv.URL, tracer.WithMethod(http.MethodHead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m := method.Load(); m != http.MethodHead {
+		t.Fatalf("unexpected method: found %v, expected %v", m, http.MethodHead)
+	}
+
+	srv.Close()
+	var derr *tracer.DialError
+	if err := p.Ping(context.Background()); !errors.As(err, &derr) || !errors.Is(err, tracer.ErrConnRefused) {
+		t.Fatalf("unexpected error: found %v, expected a *tracer.DialError", err)
+	}
+}
+
+func TestParsePinger(t *testing.T) {
+	p, err := tracer.ParsePinger("tcp://db:5432?timeout=2s#database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*tracer.TCPPinger); !ok {
+		t.Fatalf("unexpected pinger: found %T, expected *tracer.TCPPinger", p)
+	}
+	if p.ID() != "database" || p.Addr().String() != "db:5432" {
+		t.Fatalf("unexpected pinger: id %v, address %v", p.ID(), p.Addr())
+	}
+
+	p, err = tracer.PingerFromURL("https://api.example.com/health?timeout=1s&verbose=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*tracer.HTTPPinger); !ok {
+		t.Fatalf("unexpected pinger: found %T, expected *tracer.HTTPPinger", p)
+	}
+	if p.Addr().String() != "api.example.com:443" {
+		t.Fatalf("unexpected address: found %v, expected %v", p.Addr(), "api.example.com:443")
+	}
+
+	if _, err := tracer.ParsePinger("gopher://host"); !errors.Is(err, tracer.ErrUnknownScheme) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrUnknownScheme)
+	}
+	if _, err := tracer.ParsePinger("tcp://db?timeout=soon"); err == nil {
+		t.Fatal("invalid timeouts should be rejected")
+	}
+}
+
+func TestPingerOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH\r\n"))
+			conn.Close()
+		}
+	}()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"degraded"}`))
+	}))
+	defer srv.Close()
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	var dials int32
+	dialer := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	})
+	opts := []tracer.Option{
+		tracer.WithID("target"),
+		tracer.WithTimeout(time.Second),
+		tracer.WithDialer(dialer),
+	}
+
+	tcp := tracer.NewTCPPinger(l.Addr().String(), append(opts, tracer.WithExpect(regexp.MustCompile("^SSH-2")))...)
+	if err := tcp.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tcp.ID() != "target" {
+		t.Fatalf("unexpected id: found %v, expected %v", tcp.ID(), "target")
+	}
+
+	opts = append(opts, tracer.WithTLSConfig(tlsConfig), tracer.WithExpect(regexp.MustCompile(`"ok"`)))
+	p, err := tracer.NewHTTPPinger(srv.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eerr *tracer.ExpectationError
+	if err := p.Ping(context.Background()); !errors.As(err, &eerr) {
+		t.Fatalf("unexpected error: found %v, expected an expectation error", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("unexpected dials: found %v, expected 2", n)
+	}
+}
+
+type dialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+func TestDNSPinger(t *testing.T) {
+	p := tracer.NewDNSPinger("localhost", tracer.WithValidator(func(output interface{}) error {
+		for _, a := range output.([]string) {
+			if a == "127.0.0.1" || a == "::1" {
+				return nil
+			}
+		}
+		return errors.New("localhost does not resolve to loopback")
+	}))
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p = tracer.NewDNSPinger("localhost", tracer.WithValidator(func(output interface{}) error {
+		return errors.New("wrong")
+	}))
+	var verr *tracer.ValidationError
+	if err := p.Ping(context.Background()); !errors.As(err, &verr) {
+		t.Fatalf("unexpected error: found %v, expected a validation error", err)
+	}
+
+	q, err := tracer.ParsePinger("dns://127.0.0.1:53/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Addr().String() != "127.0.0.1:53" {
+		t.Fatalf("unexpected address: found %v, expected %v", q.Addr(), "127.0.0.1:53")
+	}
+}
+
+func TestHTTPValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	p, err := tracer.NewHTTPPinger(srv.URL, tracer.WithValidator(func(output interface{}) error {
+		r := output.(*tracer.HTTPResponse)
+		if r.Header.Get("Content-Type") != "text/plain" {
+			return errors.New("not text")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verr *tracer.ValidationError
+	if err := p.Ping(context.Background()); !errors.As(err, &verr) {
+		t.Fatalf("unexpected error: found %v, expected a validation error", err)
+	}
+}
+
+func TestParseHTTPQuery(t *testing.T) {
+	queries := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	p, err := tracer.ParsePinger(srv.URL + "/health?b=2&a=1&timeout=1s&path=%2Fx+y&expect=.#api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if q := <-queries; q != "b=2&a=1&path=%2Fx+y" {
+		t.Fatalf("unexpected query: found %q, expected %q", q, "b=2&a=1&path=%2Fx+y")
+	}
+}
+
+func TestHTTPBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 2*tracer.MaxResponseBody))
+	}))
+	defer srv.Close()
+
+	var n int
+	p, err := tracer.NewHTTPPinger(srv.URL, tracer.WithValidator(func(output interface{}) error {
+		n = len(output.(*tracer.HTTPResponse).Body)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != tracer.MaxResponseBody {
+		t.Fatalf("unexpected body length: found %v, expected %v", n, tracer.MaxResponseBody)
+	}
+}
+
+func TestBandwidthPinger(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 64<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	p, err := tracer.NewBandwidthPinger(srv.URL, tracer.WithTransferSize(32<<10), tracer.WithMinInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := details.(*tracer.Throughput)
+	if tp.Bytes != 32<<10 || tp.Mbps <= 0 {
+		t.Fatalf("unexpected throughput: %+v", tp)
+	}
+	if again, _ := p.PingDetails(context.Background()); again != details {
+		t.Fatal("measurements should not be repeated within the minimum interval")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(data)
+			conn.Close()
+		}
+	}()
+	slow := errors.New("too slow")
+	p, err = tracer.NewBandwidthPinger("tcp://"+l.Addr().String(), tracer.WithValidator(func(output interface{}) error {
+		if output.(*tracer.Throughput).Mbps < 1e9 {
+			return slow
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err = p.PingDetails(context.Background())
+	if !errors.Is(err, slow) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, slow)
+	}
+	if tp := details.(*tracer.Throughput); tp.Bytes != int64(len(data)) {
+		t.Fatalf("unexpected bytes: found %v, expected %v", tp.Bytes, len(data))
+	}
+
+	if _, err := tracer.NewBandwidthPinger("udp://host:1"); err == nil {
+		t.Fatal("udp URLs should be rejected")
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "127.0.0.1:1" || r.Header.Get("Proxy-Authorization") == "" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(&proxied, 1)
+	}))
+	defer proxy.Close()
+
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("user", "secret")
+	p, err := tracer.NewHTTPPinger("http://127.0.0.1:1/health", tracer.WithHTTPProxy(u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&proxied); n != 1 {
+		t.Fatalf("unexpected proxied requests: found %v, expected %v", n, 1)
+	}
+
+	for _, list := range []string{"*", "127.0.0.1", "10.0.0.0/8, 127.0.0.0/8", "127.0.0.1:1"} {
+		q, err := tracer.ParsePinger("http://127.0.0.1:1/health?no_proxy="+url.QueryEscape(list), tracer.WithHTTPProxy(u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Ping(context.Background()); err == nil {
+			t.Fatalf("%v: the request went through the proxy", list)
+		}
+	}
+	q, err := tracer.ParsePinger("http://127.0.0.1:1/health?no_proxy=127.0.0.1:80,.example.com&proxy=" + url.QueryEscape(u.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	client, err := tracertest.NewCertificate(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := tracertest.NewMutualTLSServer(t, client)
+
+	p, err := tracer.NewHTTPPinger(srv.URL, tracer.WithTLSConfig(srv.Cert.Client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err == nil {
+		t.Fatal("pinged without client certificate")
+	}
+	p, err = tracer.NewHTTPPinger(srv.URL, tracer.WithTLSConfig(srv.Cert.Client), tracer.WithClientCertificate(client.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Cert.Client.Certificates != nil {
+		t.Fatal("the TLS configuration was modified")
+	}
+
+	certPEM, keyPEM, err := client.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	q, err := tracer.ParsePinger(srv.URL+"?cert="+url.QueryEscape(certFile)+"&key="+url.QueryEscape(keyFile), tracer.WithTLSConfig(srv.Cert.Client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracer.ParsePinger(srv.URL + "?key=" + url.QueryEscape(keyFile)); err == nil {
+		t.Fatal("parsed a key without certificate")
+	}
+}
+
+func TestDNSSEC(t *testing.T) {
+	dns := tracertest.NewDNSServer(t)
+	dns.Set("signed.test", "192.0.2.1", "2001:db8::1")
+	p, err := tracer.ParsePinger("dns://" + dns.Addr() + "/signed.test?dnssec=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := p.(tracer.DetailPinger)
+
+	if _, err := dp.PingDetails(context.Background()); !errors.Is(err, tracer.ErrDNSSECInsecure) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrDNSSECInsecure)
+	}
+	dns.SetSigned(true)
+	details, err := dp.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addrs := details.([]string); len(addrs) != 2 || addrs[0] != "192.0.2.1" || addrs[1] != "2001:db8::1" {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+	dns.SetBogus(true)
+	if err := p.Ping(context.Background()); !errors.Is(err, tracer.ErrDNSSECBogus) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrDNSSECBogus)
+	}
+
+	// Plain failures are not mistaken for signing problems.
+	dns.SetBogus(false)
+	var derr *net.DNSError
+	q := tracer.NewDNSPinger("missing.test", tracer.WithNameserver(dns.Addr()), tracer.WithDNSSEC())
+	if err := q.Ping(context.Background()); !errors.As(err, &derr) || !derr.IsNotFound {
+		t.Fatalf("unexpected error: found %v, expected a not found error", err)
+	}
+	dns.SetRefuse(true)
+	if err := p.Ping(context.Background()); !errors.As(err, &derr) || errors.Is(err, tracer.ErrDNSSECBogus) {
+		t.Fatalf("unexpected error: found %v, expected a DNS error", err)
+	}
+}
+
+func TestRecordChanged(t *testing.T) {
+	dns := tracertest.NewDNSServer(t)
+	dns.Set("moving.test", "192.0.2.1", "192.0.2.2")
+
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	rec := new(recorder)
+	tr.PubSub = rec
+	p := tracer.NewDNSPinger("moving.test", tracer.WithNameserver(dns.Addr()), tracer.WithChangeDetection())
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	changes := func() []tracer.RecordChanged {
+		rec.Lock()
+		defer rec.Unlock()
+		var events []tracer.RecordChanged
+		for _, i := range rec.other {
+			if e, ok := i.(tracer.RecordChanged); ok {
+				events = append(events, e)
+			}
+		}
+		return events
+	}
+	for rec.len() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(changes()); n != 0 {
+		t.Fatalf("unexpected changes: found %v, expected 0", n)
+	}
+
+	dns.Set("moving.test", "198.51.100.1", "192.0.2.1")
+	for len(changes()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	n := rec.len()
+	for rec.len() < n+3 {
+		time.Sleep(time.Millisecond)
+	}
+	events := changes()
+	if len(events) != 1 {
+		t.Fatalf("unexpected changes: found %v, expected 1", len(events))
+	}
+	e := events[0]
+	if e.ID != "moving.test" || e.Name != "moving.test" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if got, want := strings.Join(e.Old, ","), "192.0.2.1,192.0.2.2"; got != want {
+		t.Fatalf("unexpected old answers: found %v, expected %v", got, want)
+	}
+	if got, want := strings.Join(e.New, ","), "192.0.2.1,198.51.100.1"; got != want {
+		t.Fatalf("unexpected new answers: found %v, expected %v", got, want)
+	}
+}
+
+func TestContentChanged(t *testing.T) {
+	var body atomic.Value
+	body.Store("<h1>Welcome</h1>")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html>\n%v\n<p>generated at %v</p></html>", body.Load(), time.Now().UnixNano())
+	}))
+	defer srv.Close()
+
+	p, err := tracer.NewHTTPPinger(srv.URL, tracer.WithChangeDetection(), tracer.WithIgnore(regexp.MustCompile(`generated at \d+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping := func() []interface{} {
+		if err := p.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return p.Events()
+	}
+	for i := 0; i < 3; i++ {
+		if events := ping(); len(events) != 0 {
+			t.Fatalf("unexpected events: %v", events)
+		}
+	}
+
+	// White space does not count.
+	body.Store("<h1>Welcome</h1>  ")
+	if events := ping(); len(events) != 0 {
+		t.Fatalf("unexpected events: %v", events)
+	}
+
+	body.Store("<h1>Hacked</h1>")
+	events := ping()
+	if len(events) != 1 {
+		t.Fatalf("unexpected events: found %v, expected 1", len(events))
+	}
+	e := events[0].(tracer.ContentChanged)
+	if e.ID != srv.URL || e.URL != srv.URL || e.Old == e.New || len(e.New) != 64 {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if events := ping(); len(events) != 0 {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrProcessNotRunning is reported by ProcessPinger when no process with
+// the name is running.
+var ErrProcessNotRunning = errors.New("tracer: process not running")
+
+// ProcessPinger is a Pinger that considers a process reachable while at
+// least one process with its executable name is running, e.g. nginx, or
+// nginx.exe on Windows where the extension may be left out. Processes are
+// listed from /proc on Linux and with a Tool Help snapshot on Windows; on
+// other platforms the pings fail.
+type ProcessPinger struct {
+	name string
+	opts *options
+}
+
+// NewProcessPinger returns a ProcessPinger watching the processes named
+// name. Unless WithID is used, name is the ID of the Pinger.
+func NewProcessPinger(name string, opts ...Option) *ProcessPinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = name
+	}
+	return &ProcessPinger{name: name, opts: o}
+}
+
+// ID implements Pinger.
+func (p *ProcessPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *ProcessPinger) Addr() net.Addr {
+	return &netAddr{network: "process", addr: p.name}
+}
+
+// Ping implements Pinger. It fails with an error wrapping
+// ErrProcessNotRunning when no process with the name is running.
+func (p *ProcessPinger) Ping(ctx context.Context) error {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		n, err := countProcesses(p.name)
+		if err == nil && n == 0 {
+			err = fmt.Errorf("%w: %v", ErrProcessNotRunning, p.name)
+		}
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
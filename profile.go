@@ -0,0 +1,125 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// Profile overrides how a group of targets is checked during the windows
+// of a recurring schedule, e.g. relaxed checks outside business hours and
+// aggressive ones during trading hours:
+//
+//	trading, _ := tracer.ParseCron("30 9 * * 1-5")
+//	t.Profiles = []*tracer.Profile{{
+//		Name:          "trading",
+//		Schedule:      trading,
+//		Duration:      6*time.Hour + 30*time.Minute,
+//		IDs:           []string{"exchange"},
+//		FallThreshold: 1,
+//	}}
+//
+// When more than one profile is active for a target, the first one in
+// Tracer.Profiles wins.
+type Profile struct {
+	Name string
+
+	// Schedule, Duration and Location define the windows the profile
+	// is active in, as for Blackout.
+	Schedule *Cron
+	Duration time.Duration
+	Location *time.Location
+
+	// IDs are the IDs of the targets the profile applies to, every
+	// target when empty.
+	IDs []string
+
+	// Interval is the minimum time between two pings of a target.
+	// Targets are still pinged on refresh cycles only, hence Intervals
+	// shorter than the RefreshRate of the tracer have no effect. Zero
+	// pings the targets on every cycle.
+	Interval time.Duration
+
+	// RiseThreshold and FallThreshold replace the ones of the tracer
+	// when not zero.
+	RiseThreshold int
+	FallThreshold int
+}
+
+// Active reports whether p applies to the target with id at now.
+func (p *Profile) Active(id string, now time.Time) bool {
+	return appliesTo(p.IDs, id) && windowOpen(p.Schedule, p.Duration, p.Location, now)
+}
+
+// profile returns the profile active for id at now, if any.
+func (t *Tracer) profile(id string, now time.Time) *Profile {
+	for _, p := range t.Profiles {
+		if p.Active(id, now) {
+			return p
+		}
+	}
+	return nil
+}
+
+// thresholds returns the rise and fall thresholds in effect for id at
+// now.
+func (t *Tracer) thresholds(id string, now time.Time) (rise, fall int) {
+	rise, fall = t.RiseThreshold, t.FallThreshold
+	if p := t.profile(id, now); p != nil {
+		if p.RiseThreshold != 0 {
+			rise = p.RiseThreshold
+		}
+		if p.FallThreshold != 0 {
+			fall = p.FallThreshold
+		}
+	}
+	return rise, fall
+}
+
+// due reports whether tg has to be pinged by the refresh cycle starting
+// at now, according to its Backoff and the profile active for it.
+func (t *Tracer) due(tg *target, now time.Time) bool {
+	if t.backingOff(tg, now) {
+		return false
+	}
+	p := t.profile(tg.ID(), now)
+	if p == nil || p.Interval <= 0 {
+		return true
+	}
+
+	interval := p.Interval
+	if t.LowPower != nil {
+		// Wakeups are rounded, do not miss one by a hair.
+		interval -= t.LowPower.resolution() / 2
+	}
+
+	tg.Lock()
+	defer tg.Unlock()
+	if !tg.pinged.IsZero() && now.Sub(tg.pinged) < interval {
+		return false
+	}
+	tg.pinged = now
+	return true
+}
@@ -0,0 +1,754 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file holds the minimal protocol buffers support GRPCPinger needs:
+// reading descriptor sets, and translating messages from and to their JSON
+// mapping guided by the descriptors.
+
+var errProtoTruncated = errors.New("truncated message")
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field types, see FieldDescriptorProto.Type.
+const (
+	protoDouble   = 1
+	protoFloat    = 2
+	protoInt64    = 3
+	protoUint64   = 4
+	protoInt32    = 5
+	protoFixed64  = 6
+	protoFixed32  = 7
+	protoBool     = 8
+	protoString   = 9
+	protoMessage  = 11
+	protoBytes    = 12
+	protoUint32   = 13
+	protoEnum     = 14
+	protoSfixed32 = 15
+	protoSfixed64 = 16
+	protoSint32   = 17
+	protoSint64   = 18
+)
+
+// protoWalk calls fn for each field of the message b. v is the value of
+// varint and fixed fields, data the content of length delimited ones.
+func protoWalk(b []byte, fn func(num, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		b = b[n:]
+		num, wire := int(tag>>3), int(tag&7)
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProtoTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errProtoTruncated
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errProtoTruncated
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errProtoTruncated
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if err := fn(num, wire, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// protoField describes a field of a message.
+type protoField struct {
+	name     string
+	jsonName string
+	number   int
+	typ      int
+	repeated bool
+	typeName string // full name of message and enum types, without leading dot
+}
+
+// protoMessageType describes a message type.
+type protoMessageType struct {
+	name     string
+	fields   []*protoField
+	mapEntry bool // synthesized type of the entries of a map field
+}
+
+func (m *protoMessageType) field(num int) *protoField {
+	for _, f := range m.fields {
+		if f.number == num {
+			return f
+		}
+	}
+	return nil
+}
+
+// protoEnumType describes an enum type.
+type protoEnumType struct {
+	numbers map[string]int32
+	names   map[int32]string
+}
+
+// protoMethod describes a method of a service.
+type protoMethod struct {
+	input, output string
+	streaming     bool
+}
+
+// protoRegistry holds the types and methods of a descriptor set.
+type protoRegistry struct {
+	messages map[string]*protoMessageType
+	enums    map[string]*protoEnumType
+	methods  map[string]protoMethod // by package.Service/Method
+}
+
+// parseDescriptorSet reads a serialized FileDescriptorSet.
+func parseDescriptorSet(b []byte) (*protoRegistry, error) {
+	r := &protoRegistry{
+		messages: make(map[string]*protoMessageType),
+		enums:    make(map[string]*protoEnumType),
+		methods:  make(map[string]protoMethod),
+	}
+	err := protoWalk(b, func(num, wire int, _ uint64, data []byte) error {
+		if num != 1 || wire != wireBytes {
+			return nil
+		}
+		return r.addFile(data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tracer: invalid descriptor set: %v", err)
+	}
+	return r, nil
+}
+
+func (r *protoRegistry) addFile(b []byte) error {
+	var pkg string
+	var messages, enums, services [][]byte
+	err := protoWalk(b, func(num, wire int, _ uint64, data []byte) error {
+		switch num {
+		case 2:
+			pkg = string(data)
+		case 4:
+			messages = append(messages, data)
+		case 5:
+			enums = append(enums, data)
+		case 6:
+			services = append(services, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if err := r.addMessage(pkg, m); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := r.addEnum(pkg, e); err != nil {
+			return err
+		}
+	}
+	for _, s := range services {
+		if err := r.addService(pkg, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (r *protoRegistry) addMessage(scope string, b []byte) error {
+	m := new(protoMessageType)
+	var fields, nested, enums [][]byte
+	err := protoWalk(b, func(num, wire int, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			m.name = string(data)
+		case 2:
+			fields = append(fields, data)
+		case 3:
+			nested = append(nested, data)
+		case 4:
+			enums = append(enums, data)
+		case 7: // MessageOptions
+			return protoWalk(data, func(num, _ int, v uint64, _ []byte) error {
+				if num == 7 {
+					m.mapEntry = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.name = qualify(scope, m.name)
+	r.messages[m.name] = m
+
+	for _, fb := range fields {
+		f := new(protoField)
+		err := protoWalk(fb, func(num, wire int, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				f.name = string(data)
+			case 3:
+				f.number = int(v)
+			case 4:
+				f.repeated = v == 3
+			case 5:
+				f.typ = int(v)
+			case 6:
+				f.typeName = strings.TrimPrefix(string(data), ".")
+			case 10:
+				f.jsonName = string(data)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if f.jsonName == "" {
+			f.jsonName = jsonName(f.name)
+		}
+		m.fields = append(m.fields, f)
+	}
+	for _, nb := range nested {
+		if err := r.addMessage(m.name, nb); err != nil {
+			return err
+		}
+	}
+	for _, eb := range enums {
+		if err := r.addEnum(m.name, eb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *protoRegistry) addEnum(scope string, b []byte) error {
+	e := &protoEnumType{numbers: make(map[string]int32), names: make(map[int32]string)}
+	var name string
+	err := protoWalk(b, func(num, wire int, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			name = string(data)
+		case 2:
+			var vname string
+			var vnum int32
+			err := protoWalk(data, func(num, _ int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					vname = string(data)
+				case 2:
+					vnum = int32(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			e.numbers[vname] = vnum
+			if _, ok := e.names[vnum]; !ok {
+				e.names[vnum] = vname
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.enums[qualify(scope, name)] = e
+	return nil
+}
+
+func (r *protoRegistry) addService(pkg string, b []byte) error {
+	var name string
+	var methods [][]byte
+	err := protoWalk(b, func(num, wire int, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			name = string(data)
+		case 2:
+			methods = append(methods, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, mb := range methods {
+		var mname string
+		var m protoMethod
+		err := protoWalk(mb, func(num, wire int, v uint64, data []byte) error {
+			switch num {
+			case 1:
+				mname = string(data)
+			case 2:
+				m.input = strings.TrimPrefix(string(data), ".")
+			case 3:
+				m.output = strings.TrimPrefix(string(data), ".")
+			case 5, 6:
+				m.streaming = m.streaming || v != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		r.methods[qualify(pkg, name)+"/"+mname] = m
+	}
+	return nil
+}
+
+// jsonName returns the JSON name protoc gives to the field name.
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		switch {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			b.WriteRune(c - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(c)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// encode translates doc, the JSON mapping of a message of type name
+// decoded with json.Decoder.UseNumber, to the wire format.
+func (r *protoRegistry) encode(name string, doc map[string]interface{}) ([]byte, error) {
+	m, ok := r.messages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %v", name)
+	}
+	for key := range doc {
+		known := false
+		for _, f := range m.fields {
+			known = known || f.jsonName == key || f.name == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %v of %v", key, name)
+		}
+	}
+	// Fields are written in the order they are declared, as
+	// serializers usually do.
+	var b []byte
+	for _, f := range m.fields {
+		key := f.jsonName
+		v, ok := doc[key]
+		if !ok {
+			key = f.name
+			v = doc[key]
+		}
+		if v == nil {
+			continue
+		}
+		var err error
+		if b, err = r.encodeField(b, f, v); err != nil {
+			return nil, fmt.Errorf("%v: %v", key, err)
+		}
+	}
+	return b, nil
+}
+
+func (r *protoRegistry) encodeField(b []byte, f *protoField, v interface{}) ([]byte, error) {
+	if entry, ok := r.messages[f.typeName]; ok && entry.mapEntry && f.repeated {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object")
+		}
+		kf, vf := entry.field(1), entry.field(2)
+		if kf == nil || vf == nil {
+			return nil, fmt.Errorf("invalid map entry %v", entry.name)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			item := obj[k]
+			var key interface{} = k
+			if kf.typ != protoString {
+				key = json.Number(k)
+				if kf.typ == protoBool {
+					key = k == "true"
+				}
+			}
+			eb, err := r.encodeValue(nil, kf, key)
+			if err != nil {
+				return nil, err
+			}
+			if eb, err = r.encodeValue(eb, vf, item); err != nil {
+				return nil, err
+			}
+			b = appendBytes(b, f.number, eb)
+		}
+		return b, nil
+	}
+	if f.repeated {
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array")
+		}
+		for _, item := range items {
+			var err error
+			if b, err = r.encodeValue(b, f, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return r.encodeValue(b, f, v)
+}
+
+// encodeValue appends a single value of f.
+func (r *protoRegistry) encodeValue(b []byte, f *protoField, v interface{}) ([]byte, error) {
+	switch f.typ {
+	case protoMessage:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object")
+		}
+		data, err := r.encode(f.typeName, obj)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(b, f.number, data), nil
+	case protoString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string")
+		}
+		return appendBytes(b, f.number, []byte(s)), nil
+	case protoBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a base64 string")
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if data, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, err
+			}
+		}
+		return appendBytes(b, f.number, data), nil
+	case protoBool:
+		t, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a boolean")
+		}
+		n := uint64(0)
+		if t {
+			n = 1
+		}
+		return binary.AppendUvarint(appendTag(b, f.number, wireVarint), n), nil
+	case protoEnum:
+		var n int64
+		switch v := v.(type) {
+		case string:
+			e, ok := r.enums[f.typeName]
+			if !ok {
+				return nil, fmt.Errorf("unknown enum type %v", f.typeName)
+			}
+			num, ok := e.numbers[v]
+			if !ok {
+				return nil, fmt.Errorf("unknown value %v of %v", v, f.typeName)
+			}
+			n = int64(num)
+		case json.Number:
+			var err error
+			if n, err = v.Int64(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected an enum name or number")
+		}
+		return binary.AppendUvarint(appendTag(b, f.number, wireVarint), uint64(n)), nil
+	}
+
+	// Numbers may be quoted, as 64 bits integers are.
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return nil, fmt.Errorf("expected a number")
+	}
+	switch f.typ {
+	case protoDouble, protoFloat:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		if f.typ == protoFloat {
+			return binary.LittleEndian.AppendUint32(appendTag(b, f.number, wireFixed32), math.Float32bits(float32(x))), nil
+		}
+		return binary.LittleEndian.AppendUint64(appendTag(b, f.number, wireFixed64), math.Float64bits(x)), nil
+	case protoUint64, protoUint32, protoFixed64, protoFixed32:
+		bits := 64
+		if f.typ == protoUint32 || f.typ == protoFixed32 {
+			bits = 32
+		}
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch f.typ {
+		case protoFixed64:
+			return binary.LittleEndian.AppendUint64(appendTag(b, f.number, wireFixed64), n), nil
+		case protoFixed32:
+			return binary.LittleEndian.AppendUint32(appendTag(b, f.number, wireFixed32), uint32(n)), nil
+		}
+		return binary.AppendUvarint(appendTag(b, f.number, wireVarint), n), nil
+	case protoInt64, protoInt32, protoSint64, protoSint32, protoSfixed64, protoSfixed32:
+		bits := 64
+		if f.typ == protoInt32 || f.typ == protoSint32 || f.typ == protoSfixed32 {
+			bits = 32
+		}
+		n, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch f.typ {
+		case protoSint64, protoSint32:
+			return binary.AppendUvarint(appendTag(b, f.number, wireVarint), uint64(n<<1)^uint64(n>>63)), nil
+		case protoSfixed64:
+			return binary.LittleEndian.AppendUint64(appendTag(b, f.number, wireFixed64), uint64(n)), nil
+		case protoSfixed32:
+			return binary.LittleEndian.AppendUint32(appendTag(b, f.number, wireFixed32), uint32(n)), nil
+		}
+		return binary.AppendUvarint(appendTag(b, f.number, wireVarint), uint64(n)), nil
+	}
+	return nil, fmt.Errorf("unsupported field type %d", f.typ)
+}
+
+// decode translates the message b of type name to its JSON mapping.
+// Fields that are not set are given their default value, so that they can
+// be asserted on.
+func (r *protoRegistry) decode(name string, b []byte) (map[string]interface{}, error) {
+	m, ok := r.messages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %v", name)
+	}
+	doc := make(map[string]interface{})
+	err := protoWalk(b, func(num, wire int, v uint64, data []byte) error {
+		f := m.field(num)
+		if f == nil {
+			return nil
+		}
+		entry := r.messages[f.typeName]
+		switch {
+		case f.repeated && entry != nil && entry.mapEntry:
+			e, err := r.decode(entry.name, data)
+			if err != nil {
+				return err
+			}
+			obj, _ := doc[f.jsonName].(map[string]interface{})
+			if obj == nil {
+				obj = make(map[string]interface{})
+				doc[f.jsonName] = obj
+			}
+			kf, vf := entry.field(1), entry.field(2)
+			if kf == nil || vf == nil {
+				return fmt.Errorf("invalid map entry %v", entry.name)
+			}
+			obj[fmt.Sprint(e[kf.jsonName])] = e[vf.jsonName]
+		case f.repeated:
+			items, _ := doc[f.jsonName].([]interface{})
+			if wire == wireBytes && f.typ != protoString && f.typ != protoBytes && f.typ != protoMessage {
+				// Packed scalars.
+				var err error
+				if items, err = r.decodePacked(items, f, data); err != nil {
+					return err
+				}
+			} else {
+				item, err := r.decodeValue(f, v, data)
+				if err != nil {
+					return err
+				}
+				items = append(items, item)
+			}
+			doc[f.jsonName] = items
+		default:
+			item, err := r.decodeValue(f, v, data)
+			if err != nil {
+				return err
+			}
+			doc[f.jsonName] = item
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range m.fields {
+		if _, ok := doc[f.jsonName]; ok {
+			continue
+		}
+		entry := r.messages[f.typeName]
+		switch {
+		case f.repeated && entry != nil && entry.mapEntry:
+			doc[f.jsonName] = map[string]interface{}{}
+		case f.repeated:
+			doc[f.jsonName] = []interface{}{}
+		case f.typ != protoMessage:
+			doc[f.jsonName], _ = r.decodeValue(f, 0, nil)
+		}
+	}
+	return doc, nil
+}
+
+func (r *protoRegistry) decodePacked(items []interface{}, f *protoField, data []byte) ([]interface{}, error) {
+	for len(data) > 0 {
+		var v uint64
+		switch f.typ {
+		case protoDouble, protoFixed64, protoSfixed64:
+			if len(data) < 8 {
+				return nil, errProtoTruncated
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFloat, protoFixed32, protoSfixed32:
+			if len(data) < 4 {
+				return nil, errProtoTruncated
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			var n int
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return nil, errProtoTruncated
+			}
+			data = data[n:]
+		}
+		item, err := r.decodeValue(f, v, nil)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// decodeValue returns the JSON mapping of a single value of f. 64 bits
+// integers are strings, as in the canonical mapping.
+func (r *protoRegistry) decodeValue(f *protoField, v uint64, data []byte) (interface{}, error) {
+	switch f.typ {
+	case protoMessage:
+		return r.decode(f.typeName, data)
+	case protoString:
+		return string(data), nil
+	case protoBytes:
+		return base64.StdEncoding.EncodeToString(data), nil
+	case protoBool:
+		return v != 0, nil
+	case protoEnum:
+		if e, ok := r.enums[f.typeName]; ok {
+			if name, ok := e.names[int32(v)]; ok {
+				return name, nil
+			}
+		}
+		return float64(int32(v)), nil
+	case protoDouble:
+		return math.Float64frombits(v), nil
+	case protoFloat:
+		return float64(math.Float32frombits(uint32(v))), nil
+	case protoInt32, protoSfixed32:
+		return float64(int32(v)), nil
+	case protoSint32:
+		return float64(int32(uint32(v>>1) ^ -uint32(v&1))), nil
+	case protoUint32, protoFixed32:
+		return float64(uint32(v)), nil
+	case protoInt64, protoSfixed64:
+		return strconv.FormatInt(int64(v), 10), nil
+	case protoSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10), nil
+	case protoUint64, protoFixed64:
+		return strconv.FormatUint(v, 10), nil
+	}
+	return nil, fmt.Errorf("unsupported field type %d", f.typ)
+}
@@ -0,0 +1,219 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrResultExpired is returned by the targets of a PushGateway when their
+// last result is older than its TTL. Unlike other errors, it moves the
+// target back to ConnUnknown: nothing is known about it anymore.
+var ErrResultExpired = errors.New("tracer: pushed result expired")
+
+// PushedResult is a result submitted to a PushGateway, returned as
+// details of the pings of its target.
+type PushedResult struct {
+	Err      error
+	Latency  time.Duration // as measured by the submitter, if it says
+	Received time.Time
+	Expires  time.Time
+}
+
+// PushGateway is an http.Handler where scripts and agents written in any
+// language submit the results of their own checks, for arbitrary target
+// IDs. The first submission about an ID traces a target in Tracer, whose
+// state then follows the results submitted through the usual thresholds
+// and notifications. A result is valid for its TTL, after which the target
+// is back to ConnUnknown until the next submission.
+//
+// Results are submitted with a POST request to /<id>, carrying the token
+// as "Authorization: Bearer <token>" and an optional JSON body:
+//
+//	{"ok": false, "error": "disk full", "ttl": "10m", "latency": "250ms"}
+//
+// ok defaults to true and ttl to TTL. A DELETE request to /<id> untraces
+// the target. Mount the gateway under a prefix with http.StripPrefix.
+type PushGateway struct {
+	Tracer *Tracer
+
+	// Token authenticates the submissions. Requests are rejected while
+	// it is empty.
+	Token string
+
+	// TTL is how long results are valid when the submission does not
+	// say, five minutes when zero.
+	TTL time.Duration
+}
+
+// pushRequest is the body of a submission to a PushGateway.
+type pushRequest struct {
+	OK      *bool  `json:"ok"`
+	Error   string `json:"error"`
+	TTL     string `json:"ttl"`
+	Latency string `json:"latency"`
+}
+
+// ServeHTTP implements http.Handler.
+func (g *PushGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if g.Token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	if id == "" {
+		http.Error(w, "missing target ID", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		if _, ok := g.target(id); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		g.Tracer.Untrace(id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req pushRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	res := &PushedResult{Received: now}
+	ttl := g.TTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	var err error
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Latency != "" {
+		if res.Latency, err = time.ParseDuration(req.Latency); err != nil {
+			http.Error(w, "invalid latency", http.StatusBadRequest)
+			return
+		}
+	}
+	res.Expires = now.Add(ttl)
+	if req.OK != nil && !*req.OK || req.Error != "" {
+		msg := req.Error
+		if msg == "" {
+			msg = "check failed"
+		}
+		res.Err = errors.New(msg)
+	}
+
+	p, ok := g.target(id)
+	if !ok {
+		if _, traced := g.Tracer.lookup(id); traced {
+			http.Error(w, "target not managed by the gateway", http.StatusConflict)
+			return
+		}
+		p = &pushedPinger{id: id}
+		p.set(res)
+		if err := g.Tracer.Trace(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Check the target again, so that the result is published
+		// right away. A stopped tracer publishes it once running.
+		p.set(res)
+		_ = g.Tracer.CheckNow(id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// target returns the target of the gateway stored with id, if any.
+func (g *PushGateway) target(id string) (*pushedPinger, bool) {
+	tg, ok := g.Tracer.lookup(id)
+	if !ok {
+		return nil, false
+	}
+	p, ok := tg.Pinger.(*pushedPinger)
+	return p, ok
+}
+
+// pushedPinger is a target of a PushGateway, reporting the last result
+// submitted.
+type pushedPinger struct {
+	id string
+
+	mu   sync.Mutex
+	last *PushedResult
+}
+
+func (p *pushedPinger) ID() string {
+	return p.id
+}
+
+func (p *pushedPinger) Addr() net.Addr {
+	return &netAddr{network: "push", addr: p.id}
+}
+
+func (p *pushedPinger) set(r *PushedResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = r
+}
+
+func (p *pushedPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the last *PushedResult.
+func (p *pushedPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last == nil || time.Now().After(p.last.Expires) {
+		return p.last, ErrResultExpired
+	}
+	return p.last, p.last.Err
+}
@@ -0,0 +1,132 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestPushGateway(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	tr.PubSub = new(recorder)
+	if err := tr.Trace(tracer.NewTCPPinger("db:5432")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	srv := httptest.NewServer(http.StripPrefix("/push", &tracer.PushGateway{Tracer: tr, Token: "secret"}))
+	defer srv.Close()
+
+	do := func(method, path, token, body string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if code := do("POST", "/push/cron", token, ""); code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusUnauthorized)
+		}
+	}
+	if _, err := tr.Last("cron"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if code := do("POST", "/push/cron", "secret", ""); code != http.StatusNoContent {
+		t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusNoContent)
+	}
+	if err := tr.WaitUntilOnline(ctx, "cron"); err != nil {
+		t.Fatal(err)
+	}
+	if code := do("POST", "/push/cron", "secret", `{"ok": false, "error": "disk full"}`); code != http.StatusNoContent {
+		t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusNoContent)
+	}
+	if err := tr.WaitUntilOffline(ctx, "cron"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := tr.Last("cron")
+	if m.Err == nil || m.Err.Error() != "disk full" {
+		t.Fatalf("unexpected error: found %v, expected the failure pushed", m.Err)
+	}
+	if r, ok := tracer.DetailsAs[*tracer.PushedResult](m); !ok || r.Err == nil {
+		t.Fatalf("unexpected details: found %#v, expected a failed *PushedResult", m.Details)
+	}
+
+	if code := do("POST", "/push/cron", "secret", `{"ttl": "50ms"}`); code != http.StatusNoContent {
+		t.Fatalf("unexpected status: found %v, expected %v", code, http.StatusNoContent)
+	}
+	if err := tr.WaitUntilOnline(ctx, "cron"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.WaitState(ctx, "cron", tracer.ConnUnknown); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := tr.Last("cron"); !errors.Is(m.Err, tracer.ErrResultExpired) {
+		t.Fatalf("unexpected error: found %v, expected %v", m.Err, tracer.ErrResultExpired)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/push/db:5432", "", http.StatusConflict},
+		{"POST", "/push/cron", `{"ttl": "forever"}`, http.StatusBadRequest},
+		{"GET", "/push/cron", "", http.StatusMethodNotAllowed},
+		{"DELETE", "/push/unknown", "", http.StatusNotFound},
+		{"DELETE", "/push/cron", "", http.StatusNoContent},
+	} {
+		if code := do(tc.method, tc.path, "secret", tc.body); code != tc.code {
+			t.Fatalf("%v %v: unexpected status: found %v, expected %v", tc.method, tc.path, code, tc.code)
+		}
+	}
+	if _, err := tr.Last("cron"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand serializes the draws from a source of randomness, which
+// is not safe for concurrent use.
+type lockedRand struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+// float64 returns a number in [0, 1) drawn from r or, when nil, from a
+// time seeded source of its own.
+func (l *lockedRand) float64(r *rand.Rand) float64 {
+	l.Lock()
+	defer l.Unlock()
+
+	if r == nil {
+		if l.rand == nil {
+			l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		r = l.rand
+	}
+	return r.Float64()
+}
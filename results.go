@@ -0,0 +1,109 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// DefaultHistorySize is the number of check results kept per target when
+// Tracer.HistorySize is zero.
+const DefaultHistorySize = 100
+
+// CheckResult is the outcome of a check of a target, see History.
+type CheckResult struct {
+	At      time.Time // start of the check
+	Err     error
+	Kind    Kind
+	Latency time.Duration
+	State   int // state of the target after the check
+
+	// Downtime is set when the check did not count, see
+	// Message.Downtime.
+	Downtime bool
+}
+
+// ring is a fixed size ring buffer of check results.
+type ring struct {
+	buf  []CheckResult
+	next int // index of the next result to write
+	full bool
+}
+
+func (r *ring) add(c CheckResult, size int) {
+	if len(r.buf) != size {
+		// First use or resized, keep the most recent results.
+		old := r.last(size)
+		r.buf = make([]CheckResult, size)
+		r.next = copy(r.buf, old) % size
+		r.full = len(old) == size
+	}
+	r.buf[r.next] = c
+	r.next = (r.next + 1) % size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last returns the n most recent results, oldest first.
+func (r *ring) last(n int) []CheckResult {
+	count := r.next
+	if r.full {
+		count = len(r.buf)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	results := make([]CheckResult, 0, n)
+	for i := count - n; i < count; i++ {
+		j := i
+		if r.full {
+			j = (r.next + i) % len(r.buf)
+		}
+		results = append(results, r.buf[j])
+	}
+	return results
+}
+
+func (t *Tracer) historySize() int {
+	if t.HistorySize > 0 {
+		return t.HistorySize
+	}
+	return DefaultHistorySize
+}
+
+// History returns the results of the last limit checks of the target
+// stored with id, or all the ones kept when limit is not positive, oldest
+// first. Checks cancelled by the tracer are not kept. Returns nil if no
+// target is stored with id.
+func (t *Tracer) History(id string, limit int) []CheckResult {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return nil
+	}
+	tg.Lock()
+	defer tg.Unlock()
+	return tg.history.last(limit)
+}
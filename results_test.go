@@ -0,0 +1,73 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestHistory(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.HistorySize = 3
+	defer s.Close()
+
+	p := tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Up, tracertest.Down, tracertest.Up)
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if h := s.Tracer.History("db", 0); len(h) != 0 {
+		t.Fatalf("unexpected history: found %v, expected none", h)
+	}
+	if _, err := s.Run(time.Second * 35); err != nil {
+		t.Fatal(err)
+	}
+
+	h := s.Tracer.History("db", 0)
+	if len(h) != 3 {
+		t.Fatalf("unexpected history length: found %v, expected 3", len(h))
+	}
+	for i, down := range []bool{true, false, true} {
+		if (h[i].Err != nil) != down {
+			t.Fatalf("unexpected result %d: found %v, expected down=%v", i, h[i].Err, down)
+		}
+		if at := tracertest.Epoch.Add(time.Second * time.Duration(10*(i+1))); !h[i].At.Equal(at) {
+			t.Fatalf("unexpected time of result %d: found %v, expected %v", i, h[i].At, at)
+		}
+	}
+	if h[2].Kind == tracer.KindNone || h[1].State != tracer.ConnOnline {
+		t.Fatalf("unexpected results: found %+v", h)
+	}
+	if h := s.Tracer.History("db", 1); len(h) != 1 || h[0].Err == nil {
+		t.Fatalf("unexpected last result: found %+v, expected a failure", h)
+	}
+	if h := s.Tracer.History("unknown", 0); h != nil {
+		t.Fatalf("unexpected history: found %v, expected nil", h)
+	}
+}
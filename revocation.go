@@ -0,0 +1,477 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationStatus is the revocation status of a certificate.
+type RevocationStatus int
+
+// Possible revocation status values.
+const (
+	RevocationGood RevocationStatus = iota
+	RevocationRevoked
+	RevocationUnknown
+)
+
+func (s RevocationStatus) String() string {
+	switch s {
+	case RevocationGood:
+		return "good"
+	case RevocationRevoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// RevocationError is returned by RevocationChecker when a certificate
+// presented by a target is revoked, or its status cannot be determined.
+type RevocationError struct {
+	Subject string
+	Status  RevocationStatus
+
+	// RevokedAt is when the certificate was revoked.
+	RevokedAt time.Time
+
+	// Err is why the status is unknown.
+	Err error
+}
+
+func (e *RevocationError) Error() string {
+	if e.Status == RevocationRevoked {
+		return fmt.Sprintf("tracer: certificate %q revoked at %v", e.Subject, e.RevokedAt)
+	}
+	return fmt.Sprintf("tracer: revocation status of certificate %q unknown: %v", e.Subject, e.Err)
+}
+
+func (e *RevocationError) Unwrap() error {
+	return e.Err
+}
+
+// RevocationChecker checks whether the certificates presented by TLS
+// targets were revoked, through OCSP (RFC 6960) and CRLs (RFC 5280). Every
+// certificate of the chain but the root is checked: OCSP first, using the
+// response stapled by the target for the leaf or asking the responder of
+// the certificate otherwise, then the CRLs of the certificate when OCSP
+// gives no answer. Responses and CRLs are cached until their next update.
+// Use it with WithRevocationCheck to make pings fail, or as
+// Tracer.RevocationCheck to be warned.
+type RevocationChecker struct {
+	// OCSP and CRL enable the respective checks.
+	OCSP bool
+	CRL  bool
+
+	// SoftFail makes pings succeed when the status of a certificate
+	// cannot be determined, e.g. because the OCSP responder is down, as
+	// browsers do. Revoked certificates fail pings regardless.
+	SoftFail bool
+
+	// Client fetches OCSP responses and CRLs, http.DefaultClient when
+	// nil.
+	Client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]revocationEntry // by OCSP responder or CRL URL and serial
+}
+
+type revocationEntry struct {
+	status    RevocationStatus
+	revokedAt time.Time
+	expires   time.Time
+}
+
+// Check returns a *RevocationError if a certificate of the connection
+// described by state is revoked or its status unknown, nil if they are all
+// good.
+func (c *RevocationChecker) Check(ctx context.Context, state *tls.ConnectionState) error {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		var staple []byte
+		if i == 0 {
+			staple = state.OCSPResponse
+		}
+		if err := c.check(ctx, chain[i], chain[i+1], staple); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check checks the status of cert, issued by issuer, using the stapled
+// OCSP response if any.
+func (c *RevocationChecker) check(ctx context.Context, cert, issuer *x509.Certificate, staple []byte) error {
+	if !c.OCSP && !c.CRL {
+		return nil
+	}
+	now := time.Now()
+	e := revocationEntry{status: RevocationUnknown}
+	reason := errors.New("tracer: no revocation information")
+
+	if c.OCSP {
+		var err error
+		switch {
+		case len(staple) > 0:
+			e, err = parseOCSPResponse(staple, cert, issuer, now)
+		case len(cert.OCSPServer) > 0:
+			e, err = c.cached(cert.OCSPServer[0], cert, func() (revocationEntry, error) {
+				return c.queryOCSP(ctx, cert.OCSPServer[0], cert, issuer, now)
+			})
+		}
+		if err != nil {
+			e.status, reason = RevocationUnknown, err
+		}
+	}
+	if e.status == RevocationUnknown && c.CRL {
+		for _, url := range cert.CRLDistributionPoints {
+			crl, err := c.cached(url, cert, func() (revocationEntry, error) {
+				return c.fetchCRL(ctx, url, cert, issuer, now)
+			})
+			if err == nil {
+				e = crl
+				break
+			}
+			reason = err
+		}
+	}
+
+	switch e.status {
+	case RevocationGood:
+		return nil
+	case RevocationRevoked:
+		return &RevocationError{Subject: cert.Subject.String(), Status: RevocationRevoked, RevokedAt: e.revokedAt}
+	}
+	return &RevocationError{Subject: cert.Subject.String(), Status: RevocationUnknown, Err: reason}
+}
+
+// cached returns the entry cached for cert and source, calling fetch
+// when there is none or it has expired.
+func (c *RevocationChecker) cached(source string, cert *x509.Certificate, fetch func() (revocationEntry, error)) (revocationEntry, error) {
+	key := source + "/" + cert.SerialNumber.String()
+	c.mu.Lock()
+	e, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e, nil
+	}
+
+	e, err := fetch()
+	if err != nil {
+		return revocationEntry{status: RevocationUnknown}, err
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]revocationEntry)
+	}
+	c.cache[key] = e
+	c.mu.Unlock()
+	return e, nil
+}
+
+func (c *RevocationChecker) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// get performs req, returning the body of the response.
+func (c *RevocationChecker) get(req *http.Request) ([]byte, error) {
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracer: unexpected status %v from %v", resp.Status, req.URL)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
+
+// fetchCRL downloads the CRL at url and looks cert up in it.
+func (c *RevocationChecker) fetchCRL(ctx context.Context, url string, cert, issuer *x509.Certificate, now time.Time) (revocationEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	der, err := c.get(req)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return revocationEntry{}, err
+	}
+	if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+		return revocationEntry{}, errors.New("tracer: CRL expired")
+	}
+
+	e := revocationEntry{status: RevocationGood, expires: crl.NextUpdate}
+	for _, r := range crl.RevokedCertificateEntries {
+		if r.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			e.status, e.revokedAt = RevocationRevoked, r.RevocationTime
+			break
+		}
+	}
+	return e, nil
+}
+
+// OCSP structures, see RFC 6960 section 4.
+
+var (
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			CertID ocspCertID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID  ocspCertID
+	Good    asn1.Flag `asn1:"tag:0,optional"`
+	Revoked struct {
+		RevocationTime time.Time       `asn1:"generalized"`
+		Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+	} `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// ocspID returns the identifier of cert, issued by issuer, in OCSP
+// requests and responses.
+func ocspID(cert, issuer *x509.Certificate) (ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return ocspCertID{}, err
+	}
+	name, key := crypto.SHA1.New(), crypto.SHA1.New()
+	name.Write(issuer.RawSubject)
+	key.Write(spki.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		IssuerNameHash: name.Sum(nil),
+		IssuerKeyHash:  key.Sum(nil),
+		SerialNumber:   cert.SerialNumber,
+	}, nil
+}
+
+// queryOCSP asks the OCSP responder at url about cert.
+func (c *RevocationChecker) queryOCSP(ctx context.Context, url string, cert, issuer *x509.Certificate, now time.Time) (revocationEntry, error) {
+	id, err := ocspID(cert, issuer)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	var r ocspRequest
+	r.TBSRequest.RequestList = append(r.TBSRequest.RequestList, struct{ CertID ocspCertID }{id})
+	der, err := asn1.Marshal(r)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(der))
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := c.get(req)
+	if err != nil {
+		return revocationEntry{}, err
+	}
+	return parseOCSPResponse(resp, cert, issuer, now)
+}
+
+// parseOCSPResponse verifies the OCSP response der and returns the
+// status of cert it carries.
+func parseOCSPResponse(der []byte, cert, issuer *x509.Certificate, now time.Time) (revocationEntry, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return revocationEntry{}, fmt.Errorf("tracer: malformed OCSP response: %w", err)
+	}
+	if resp.Status != 0 {
+		return revocationEntry{}, fmt.Errorf("tracer: OCSP responder error %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return revocationEntry{}, errors.New("tracer: unsupported OCSP response type")
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return revocationEntry{}, fmt.Errorf("tracer: malformed OCSP response: %w", err)
+	}
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return revocationEntry{}, fmt.Errorf("tracer: malformed OCSP response: %w", err)
+	}
+
+	// The response is signed by the issuer, or by a responder the
+	// issuer delegated.
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		delegate, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return revocationEntry{}, err
+		}
+		if !bytes.Equal(delegate.Raw, issuer.Raw) {
+			if err := delegate.CheckSignatureFrom(issuer); err != nil {
+				return revocationEntry{}, fmt.Errorf("tracer: OCSP responder not authorized: %w", err)
+			}
+			authorized := false
+			for _, u := range delegate.ExtKeyUsage {
+				authorized = authorized || u == x509.ExtKeyUsageOCSPSigning
+			}
+			if !authorized {
+				return revocationEntry{}, errors.New("tracer: OCSP responder not authorized")
+			}
+			signer = delegate
+		}
+	}
+	algo, ok := signatureAlgorithm(basic.SignatureAlgorithm.Algorithm)
+	if !ok {
+		return revocationEntry{}, fmt.Errorf("tracer: unsupported OCSP signature algorithm %v", basic.SignatureAlgorithm.Algorithm)
+	}
+	if err := signer.CheckSignature(algo, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return revocationEntry{}, fmt.Errorf("tracer: invalid OCSP signature: %w", err)
+	}
+
+	for _, r := range data.Responses {
+		if r.CertID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		if now.Before(r.ThisUpdate) || (!r.NextUpdate.IsZero() && now.After(r.NextUpdate)) {
+			return revocationEntry{}, errors.New("tracer: OCSP response out of its validity period")
+		}
+		e := revocationEntry{status: RevocationUnknown, expires: r.NextUpdate}
+		switch {
+		case bool(r.Good):
+			e.status = RevocationGood
+		case !r.Revoked.RevocationTime.IsZero():
+			e.status, e.revokedAt = RevocationRevoked, r.Revoked.RevocationTime
+		}
+		if e.status == RevocationUnknown {
+			return e, errors.New("tracer: certificate unknown to the OCSP responder")
+		}
+		return e, nil
+	}
+	return revocationEntry{}, errors.New("tracer: OCSP response does not cover the certificate")
+}
+
+// signatureAlgorithms maps the signature algorithms OCSP responders use
+// to their x509 counterpart.
+var signatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	algo x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, x509.PureEd25519},
+}
+
+func signatureAlgorithm(oid asn1.ObjectIdentifier) (x509.SignatureAlgorithm, bool) {
+	for _, a := range signatureAlgorithms {
+		if a.oid.Equal(oid) {
+			return a.algo, true
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
+
+// checkRevocation checks the certificates of the connection described by
+// state with the RevocationChecker of o, if any.
+func (o *options) checkRevocation(ctx context.Context, state *tls.ConnectionState) error {
+	if o.revocation == nil || state == nil {
+		return nil
+	}
+	err := o.revocation.Check(ctx, state)
+	var rerr *RevocationError
+	if o.revocation.SoftFail && errors.As(err, &rerr) && rerr.Status == RevocationUnknown {
+		return nil
+	}
+	return err
+}
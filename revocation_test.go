@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestRevocationCheck(t *testing.T) {
+	ca := tracertest.NewCA(t)
+	good, err := ca.Issue(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := ca.Issue(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.Revoke(revoked)
+	stapled, err := ca.Issue(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.Staple(stapled); err != nil {
+		t.Fatal(err)
+	}
+
+	ping := func(cert *tracertest.Certificate, c *tracer.RevocationChecker) error {
+		srv := tracertest.NewTLSServerWith(t, cert)
+		p := tracer.NewTCPPinger(srv.Addr(), tracer.WithTLSConfig(cert.Client), tracer.WithRevocationCheck(c))
+		return p.Ping(context.Background())
+	}
+	for _, c := range []*tracer.RevocationChecker{{OCSP: true}, {CRL: true}, {OCSP: true, CRL: true}} {
+		if err := ping(good, c); err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		var rerr *tracer.RevocationError
+		if err := ping(revoked, c); !errors.As(err, &rerr) || rerr.Status != tracer.RevocationRevoked {
+			t.Fatalf("%+v: unexpected error: found %v, expected a revoked certificate", c, err)
+		}
+	}
+
+	// Stapled responses spare the trip to the responder.
+	n := ca.Requests()
+	if err := ping(stapled, &tracer.RevocationChecker{OCSP: true}); err != nil {
+		t.Fatal(err)
+	}
+	if ca.Requests() != n {
+		t.Fatal("the OCSP responder was queried for a stapled certificate")
+	}
+
+	// Unknown status, failing unless soft failing.
+	ca.SetDown(true)
+	var rerr *tracer.RevocationError
+	if err := ping(good, &tracer.RevocationChecker{OCSP: true, CRL: true}); !errors.As(err, &rerr) || rerr.Status != tracer.RevocationUnknown {
+		t.Fatalf("unexpected error: found %v, expected an unknown status", err)
+	}
+	if err := ping(good, &tracer.RevocationChecker{OCSP: true, CRL: true, SoftFail: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tracer warns without failing the pings.
+	ca.SetDown(false)
+	srv := tracertest.NewTLSServerWith(t, revoked)
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	tr.RevocationCheck = &tracer.RevocationChecker{OCSP: true}
+	rec := new(recorder)
+	tr.PubSub = rec
+	if err := tr.Trace(tracer.NewTCPPinger(srv.Addr(), tracer.WithTLSConfig(revoked.Client))); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	rec.Lock()
+	defer rec.Unlock()
+	var events int
+	for _, i := range rec.other {
+		if e, ok := i.(tracer.CertRevocation); ok {
+			events++
+			if e.ID != srv.Addr() || e.Err.Status != tracer.RevocationRevoked {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+		}
+	}
+	if events != 1 {
+		t.Fatalf("unexpected revocation events: found %v, expected 1", events)
+	}
+	for _, i := range rec.msgs {
+		if m := i.(tracer.Message); m.Err != nil {
+			t.Fatalf("unexpected error: %v", m.Err)
+		}
+	}
+}
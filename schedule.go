@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"container/heap"
+	"time"
+)
+
+// TargetOption configures how a target is traced, see Trace.
+type TargetOption func(*target)
+
+// WithInterval makes the tracer ping the target every d instead of on
+// each refresh, so that fast critical targets and slow background ones can
+// share a tracer. Such targets are scheduled on their own, profiles do not
+// change their interval and refreshes requested by Untrace do not ping
+// them.
+func WithInterval(d time.Duration) TargetOption {
+	return func(tg *target) {
+		tg.interval = d
+	}
+}
+
+// WithPingTimeout bounds the pings of the target at d, overriding the
+// PingTimeout of the tracer. Pings exceeding it fail with ErrPingTimeout.
+func WithPingTimeout(d time.Duration) TargetOption {
+	return func(tg *target) {
+		tg.timeout = d
+	}
+}
+
+// schedule is a min-heap of the targets traced WithInterval, ordered by
+// the time of their next ping. It is owned by the run loop.
+type schedule []*target
+
+func (s schedule) Len() int           { return len(s) }
+func (s schedule) Less(i, j int) bool { return s[i].next.Before(s[j].next) }
+func (s schedule) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *schedule) Push(x interface{}) {
+	*s = append(*s, x.(*target))
+}
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	tg := old[len(old)-1]
+	old[len(old)-1] = nil
+	*s = old[:len(old)-1]
+	return tg
+}
+
+// add schedules the next ping of tg at time at.
+func (s *schedule) add(tg *target, at time.Time) {
+	tg.next = at
+	heap.Push(s, tg)
+}
+
+// due pops the targets whose ping is due at now.
+func (s *schedule) due(now time.Time) []*target {
+	var due []*target
+	for s.Len() > 0 && !(*s)[0].next.After(now) {
+		due = append(due, heap.Pop(s).(*target))
+	}
+	return due
+}
+
+// following returns the time of the next ping of tg, which was due at
+// tg.next and is pinged at now, keeping the pace unless late by more than
+// an interval.
+func following(tg *target, now time.Time) time.Time {
+	next := tg.next.Add(tg.interval)
+	if next.Before(now) {
+		next = now.Add(tg.interval)
+	}
+	return next
+}
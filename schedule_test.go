@@ -0,0 +1,104 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestWithInterval(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = 5 * time.Second
+	defer s.Close()
+
+	fast, slow, other := tracertest.NewPinger("fast"), tracertest.NewPinger("slow"), tracertest.NewPinger("other")
+	if err := s.Trace(fast, tracer.WithInterval(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trace(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(20 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// Traced while running.
+	if err := s.Trace(slow, tracer.WithInterval(8*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(20 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		p     *tracertest.Pinger
+		calls int
+	}{
+		{fast, 41}, // at 0s, 1s, ... 40s
+		{slow, 3},  // at 20s, 28s, 36s
+		{other, 9}, // at 0s, 5s, ... 40s
+	} {
+		if n := test.p.Calls(); n != test.calls {
+			t.Fatalf("%v: unexpected pings: found %v, expected %v", test.p.ID(), n, test.calls)
+		}
+	}
+	if m, err := s.Tracer.Last("slow"); err != nil || m.Stale {
+		t.Fatalf("unexpected message: found %+v (%v), expected a fresh one", m, err)
+	}
+}
+
+func TestIntervalPingTimeout(t *testing.T) {
+	// Ping timeouts are measured on the system clock, hence this test
+	// does not run in a Simulation.
+	tr := tracer.New(tracer.WithPubSub(nil))
+	tr.RefreshRate = time.Hour
+	c, cancel := tr.SubscribeID("fast")
+	defer cancel()
+
+	p := tracertest.NewPinger("fast", tracertest.Result{Latency: 150 * time.Millisecond})
+	if err := tr.Trace(p, tracer.WithInterval(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	// Pings are bounded at half of the interval, not of the refresh
+	// rate, hence they never overlap.
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-c:
+			if m.Err != tracer.ErrPingTimeout {
+				t.Fatalf("unexpected error: found %v, expected %v", m.Err, tracer.ErrPingTimeout)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	}
+}
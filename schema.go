@@ -0,0 +1,327 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaError is the error returned by the Validator of JSONSchema when
+// a document does not conform to the schema.
+type SchemaError struct {
+	Path   string // JSON pointer to the offending value, empty for the document
+	Reason string
+}
+
+func (e *SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("tracer: schema violation at %v: %v", path, e.Reason)
+}
+
+// JSONSchema returns a Validator checking JSON documents against schema,
+// so that breaking changes of the APIs a service depends on make its
+// pings fail. Documents are the body of an *HTTPResponse or a []byte, such
+// as the greeting of a TCPPinger. Errors wrap a *SchemaError locating the
+// first violation found.
+//
+// The keywords of JSON Schema supported are type, enum, const,
+// properties, required, additionalProperties, items, minItems, maxItems,
+// uniqueItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf and
+// not, along with boolean schemas. Other keywords, such as format and
+// $ref, are ignored. Returns an error if schema is not valid.
+func JSONSchema(schema []byte) (Validator, error) {
+	s := new(jsonSchema)
+	if err := json.Unmarshal(schema, s); err != nil {
+		return nil, fmt.Errorf("tracer: invalid schema: %v", err)
+	}
+	return func(output interface{}) error {
+		var data []byte
+		switch v := output.(type) {
+		case *HTTPResponse:
+			data = v.Body
+		case []byte:
+			data = v
+		default:
+			return fmt.Errorf("tracer: cannot validate %T against a JSON schema", output)
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return &SchemaError{Reason: fmt.Sprintf("invalid JSON: %v", err)}
+		}
+		return s.validate(doc, "")
+	}, nil
+}
+
+// jsonSchema is a JSON Schema, see JSONSchema for the keywords supported.
+type jsonSchema struct {
+	boolean *bool // set for the true and false schemas
+
+	Type                 typeList               `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                json.RawMessage        `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	UniqueItems          bool                   `json:"uniqueItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MultipleOf           *float64               `json:"multipleOf"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Not                  *jsonSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if b, err := strconv.ParseBool(string(data)); err == nil {
+		s.boolean = &b
+		return nil
+	}
+	type plain jsonSchema
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+// typeList is the value of the type keyword, a name or a list of names.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = typeList{name}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// jsonType returns the JSON Schema type of v, a value decoded by
+// encoding/json.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// validate returns a *SchemaError if v, found at path, does not conform
+// to s.
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &SchemaError{Path: path, Reason: fmt.Sprintf(format, args...)}
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			return fail("no value allowed")
+		}
+		return nil
+	}
+
+	if len(s.Type) > 0 {
+		typ, ok := jsonType(v), false
+		for _, t := range s.Type {
+			ok = ok || t == typ || t == "number" && typ == "integer"
+		}
+		if !ok {
+			return fail("found %v, expected %v", typ, strings.Join(s.Type, " or "))
+		}
+	}
+	if s.Enum != nil {
+		ok := false
+		for _, e := range s.Enum {
+			ok = ok || reflect.DeepEqual(e, v)
+		}
+		if !ok {
+			return fail("%v is not one of the values allowed", compactJSON(v))
+		}
+	}
+	if s.Const != nil {
+		var c interface{}
+		json.Unmarshal(s.Const, &c)
+		if !reflect.DeepEqual(c, v) {
+			return fail("found %v, expected %v", compactJSON(v), compactJSON(c))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				return fail("missing property %q", k)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := s.Properties[k]
+			if !ok {
+				sub = s.AdditionalProperties
+			}
+			if sub == nil {
+				continue
+			}
+			if err := sub.validate(v[k], path+"/"+escapePointer(k)); err != nil {
+				if !ok && sub.boolean != nil {
+					return fail("unexpected property %q", k)
+				}
+				return err
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fail("%d items, expected at least %d", len(v), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fail("%d items, expected at most %d", len(v), *s.MaxItems)
+		}
+		for i, item := range v {
+			if s.UniqueItems {
+				for j := 0; j < i; j++ {
+					if reflect.DeepEqual(v[j], item) {
+						return fail("items %d and %d are equal", j, i)
+					}
+				}
+			}
+			if s.Items == nil {
+				continue
+			}
+			if err := s.Items.validate(item, path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("length %d, expected at least %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("length %d, expected at most %d", n, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fail("%q does not match %v", v, s.Pattern)
+		}
+	case float64:
+		switch {
+		case s.Minimum != nil && v < *s.Minimum:
+			return fail("%v is less than %v", v, *s.Minimum)
+		case s.Maximum != nil && v > *s.Maximum:
+			return fail("%v is greater than %v", v, *s.Maximum)
+		case s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum:
+			return fail("%v is not greater than %v", v, *s.ExclusiveMinimum)
+		case s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum:
+			return fail("%v is not less than %v", v, *s.ExclusiveMaximum)
+		case s.MultipleOf != nil && *s.MultipleOf > 0 && math.Abs(math.Remainder(v, *s.MultipleOf)) > 1e-9:
+			return fail("%v is not a multiple of %v", v, *s.MultipleOf)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if s.AnyOf != nil {
+		ok := false
+		for _, sub := range s.AnyOf {
+			ok = ok || sub.validate(v, path) == nil
+		}
+		if !ok {
+			return fail("no schema of anyOf matches")
+		}
+	}
+	if s.OneOf != nil {
+		n := 0
+		for _, sub := range s.OneOf {
+			if sub.validate(v, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return fail("%d schemas of oneOf match, expected 1", n)
+		}
+	}
+	if s.Not != nil && s.Not.validate(v, path) == nil {
+		return fail("value matches the schema of not")
+	}
+	return nil
+}
+
+// escapePointer escapes key for use in a JSON pointer, see RFC 6901.
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func compactJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
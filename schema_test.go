@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tecnoporto/tracer"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["id", "name", "roles"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+		"email": {"type": ["string", "null"]},
+		"status": {"enum": ["active", "suspended"]},
+		"roles": {"type": "array", "minItems": 1, "uniqueItems": true, "items": {"type": "string"}},
+		"score": {"type": "number", "exclusiveMaximum": 10},
+		"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+		"plan": {"oneOf": [{"const": "free"}, {"type": "object", "required": ["seats"]}]}
+	}
+}`
+
+func TestJSONSchema(t *testing.T) {
+	validate, err := tracer.JSONSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		doc  string
+		path string // empty when valid
+	}{
+		{`{"id": 1, "name": "Ada", "roles": ["admin"]}`, ""},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "email": null, "status": "active", "score": 9.5, "tags": {"a": "b"}, "plan": {"seats": 3}}`, ""},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "plan": "free"}`, ""},
+		{`{"id": "1", "name": "Ada", "roles": ["admin"]}`, "/id"},
+		{`{"id": 1.5, "name": "Ada", "roles": ["admin"]}`, "/id"},
+		{`{"id": 0, "name": "Ada", "roles": ["admin"]}`, "/id"},
+		{`{"id": 1, "name": "ada", "roles": ["admin"]}`, "/name"},
+		{`{"id": 1, "roles": ["admin"]}`, "/"},
+		{`{"id": 1, "name": "Ada", "roles": []}`, "/roles"},
+		{`{"id": 1, "name": "Ada", "roles": ["a", "a"]}`, "/roles"},
+		{`{"id": 1, "name": "Ada", "roles": [1]}`, "/roles/0"},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "status": "gone"}`, "/status"},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "score": 10}`, "/score"},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "tags": {"a/b": 1}}`, "/tags/a~1b"},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "plan": {}}`, "/plan"},
+		{`{"id": 1, "name": "Ada", "roles": ["admin"], "admin": true}`, "/"},
+		{`[]`, "/"},
+		{`{"id": 1,`, "/"},
+	} {
+		err := validate([]byte(tt.doc))
+		var serr *tracer.SchemaError
+		switch {
+		case tt.path == "" && err != nil:
+			t.Fatalf("%v: unexpected error: %v", tt.doc, err)
+		case tt.path == "":
+		case !errors.As(err, &serr):
+			t.Fatalf("%v: unexpected error: found %v, expected a *tracer.SchemaError", tt.doc, err)
+		case serr.Error() != fmt.Sprintf("tracer: schema violation at %v: %v", tt.path, serr.Reason):
+			t.Fatalf("%v: unexpected error: found %v, expected a violation at %v", tt.doc, err, tt.path)
+		}
+	}
+
+	if _, err := tracer.JSONSchema([]byte(`{"pattern": "("}`)); err == nil {
+		t.Fatal("unexpected success for an invalid pattern")
+	}
+}
+
+func TestJSONSchemaPinger(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"id": 1, "name": "Ada", "roles": ["admin"]}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body.Load())
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "user.json")
+	if err := os.WriteFile(path, []byte(userSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := tracer.ParsePinger(srv.URL + "/users/1?schema=" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The API renames a field.
+	body.Store(`{"id": 1, "full_name": "Ada", "roles": ["admin"]}`)
+	var verr *tracer.ValidationError
+	var serr *tracer.SchemaError
+	if err := p.Ping(context.Background()); !errors.As(err, &verr) || !errors.As(err, &serr) {
+		t.Fatalf("unexpected error: found %v, expected a *tracer.SchemaError", err)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoneOnline is returned by Fastest when none of the targets is
+// online.
+var ErrNoneOnline = errors.New("tracer: no target online")
+
+// latencyWeight is the weight of the last successful ping in the moving
+// average of the latency of a target, see Fastest.
+const latencyWeight = 0.25
+
+// recordLatency folds d, the latency of a successful ping, into the
+// moving average of the latency of tg. Must be called with tg locked.
+func (tg *target) recordLatency(d time.Duration) {
+	if tg.latency == 0 {
+		tg.latency = d
+		return
+	}
+	tg.latency += time.Duration(latencyWeight * float64(d-tg.latency))
+}
+
+// Fastest returns the ID of the online target, among the ones stored
+// with ids, whose recent successful pings were the fastest, so that
+// applications can pick among equivalent endpoints, e.g. replicas or
+// mirrors, the one to use. Latencies are averaged giving more weight to the
+// recent pings; ties go to the target that comes first in ids.
+// Returns ErrNotTraced if a target is not stored with one of ids, and
+// ErrNoneOnline if no target is online.
+func (t *Tracer) Fastest(ids ...string) (string, error) {
+	best, bestLatency := "", time.Duration(0)
+	for _, id := range ids {
+		tg, ok := t.lookup(id)
+		if !ok {
+			return "", ErrNotTraced
+		}
+		tg.Lock()
+		state, latency := tg.state, tg.latency
+		tg.Unlock()
+
+		if state != ConnOnline {
+			continue
+		}
+		if best == "" || latency < bestLatency {
+			best, bestLatency = id, latency
+		}
+	}
+	if best == "" {
+		return "", ErrNoneOnline
+	}
+	return best, nil
+}
@@ -0,0 +1,79 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestFastest(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	tr.PubSub = new(recorder)
+
+	slow := tracertest.NewPinger("slow", tracertest.Result{Latency: 20 * time.Millisecond})
+	fast := tracertest.NewPinger("fast", tracertest.Result{Latency: time.Millisecond})
+	down := tracertest.NewPinger("down", tracertest.Down)
+	for _, p := range []tracer.Pinger{slow, fast, down} {
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, id := range []string{"slow", "fast"} {
+		if err := tr.WaitUntilOnline(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.WaitUntilOffline(ctx, "down"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := tr.Fastest("down", "slow", "fast"); err != nil || id != "fast" {
+		t.Fatalf("unexpected fastest: found %v (%v), expected fast", id, err)
+	}
+	if id, err := tr.Fastest("down", "slow"); err != nil || id != "slow" {
+		t.Fatalf("unexpected fastest: found %v (%v), expected slow", id, err)
+	}
+	if _, err := tr.Fastest("down"); err != tracer.ErrNoneOnline {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNoneOnline)
+	}
+	if _, err := tr.Fastest("fast", "missing"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// ErrProxyAuth is returned when a SOCKS5 proxy rejects the credentials,
+// or accepts none of the authentication methods offered.
+var ErrProxyAuth = errors.New("tracer: proxy authentication failed")
+
+// ErrProxyNetwork is returned when dialing through a SOCKS5 proxy a
+// network other than TCP.
+var ErrProxyNetwork = errors.New("tracer: network not supported by proxy")
+
+// ProxyError is returned when a SOCKS5 proxy refuses to connect to the
+// target, carrying the reply code sent by the proxy.
+type ProxyError struct {
+	Code byte
+}
+
+var proxyReplies = map[byte]string{
+	1: "general server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+func (e *ProxyError) Error() string {
+	if s, ok := proxyReplies[e.Code]; ok {
+		return "tracer: proxy: " + s
+	}
+	return fmt.Sprintf("tracer: proxy: unknown reply code %d", e.Code)
+}
+
+// SOCKS5 is a Dialer routing TCP connections through a SOCKS5 proxy (RFC
+// 1928), so that targets reachable only through a jump proxy can be
+// probed. Use it with WithDialer for a single Pinger, or as Parser.Proxy
+// for every parsed target. Host names are resolved by the proxy, hence
+// the family set with WithFamily is not enforced for them. DNS pingers
+// cannot be routed through the proxy, which does not carry UDP.
+type SOCKS5 struct {
+	// Addr is the address of the proxy, in the host:port form.
+	Addr string
+
+	// Username and Password authenticate to the proxy (RFC 1929), when
+	// Username is not empty.
+	Username string
+	Password string
+
+	// Forward dials the proxy, a *net.Dialer when nil.
+	Forward Dialer
+}
+
+// DialContext implements Dialer.
+func (s *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("%w %q", ErrProxyNetwork, network)
+	}
+	host, portstr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portstr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("tracer: invalid port %q", portstr)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("tracer: host name too long for proxy: %q", host)
+	}
+
+	forward := s.Forward
+	if forward == nil {
+		forward = new(net.Dialer)
+	}
+	conn, err := forward.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the handshake by ctx.
+	done := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			errc <- ctx.Err()
+		case <-done:
+			errc <- nil
+		}
+	}()
+	err = s.handshake(conn, host, uint16(port))
+	close(done)
+	if cerr := <-errc; cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, remote: &netAddr{network: "tcp", addr: address}}, nil
+}
+
+// handshake authenticates to the proxy on conn and asks it to connect to
+// host:port.
+func (s *SOCKS5) handshake(conn net.Conn, host string, port uint16) error {
+	methods := []byte{0} // no authentication
+	if s.Username != "" {
+		methods = []byte{2} // username and password
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != 5 {
+		return fmt.Errorf("tracer: unexpected proxy version: found %d, expected 5", buf[0])
+	}
+	switch buf[1] {
+	case 0:
+	case 2:
+		if len(s.Username) > 255 || len(s.Password) > 255 {
+			return errors.New("tracer: proxy credentials too long")
+		}
+		req := []byte{1, byte(len(s.Username))}
+		req = append(req, s.Username...)
+		req = append(req, byte(len(s.Password)))
+		req = append(req, s.Password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return ErrProxyAuth
+		}
+	default:
+		return ErrProxyAuth
+	}
+
+	req := []byte{5, 1, 0} // connect
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// Reply, followed by the address bound by the proxy.
+	buf = make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		return &ProxyError{Code: buf[1]}
+	}
+	var n int
+	switch buf[3] {
+	case 1:
+		n = net.IPv4len
+	case 4:
+		n = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		n = int(buf[0])
+	default:
+		return fmt.Errorf("tracer: unexpected proxy address type %d", buf[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+// proxyConn is a connection established through a proxy, reporting the
+// target as remote address instead of the proxy.
+type proxyConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
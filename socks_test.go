@@ -0,0 +1,83 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestSOCKS5(t *testing.T) {
+	srv := tracertest.NewTCPServer(t)
+	srv.SetGreeting("hello")
+	proxy := tracertest.NewSOCKS5Server(t)
+	proxy.Route("db.internal", srv.Addr())
+
+	d := &tracer.SOCKS5{Addr: proxy.Addr()}
+	p := tracer.NewTCPPinger("db.internal:5432", tracer.WithDialer(d))
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Addr().String() != "db.internal:5432" {
+		t.Fatalf("unexpected address: found %v, expected %v", p.Addr(), "db.internal:5432")
+	}
+	if r := proxy.Requests(); len(r) != 1 || r[0] != "db.internal:5432" {
+		t.Fatalf("unexpected proxy requests: %v", r)
+	}
+
+	proxy.SetAuth("user", "secret")
+	if err := p.Ping(context.Background()); !errors.Is(err, tracer.ErrProxyAuth) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrProxyAuth)
+	}
+	q, err := tracer.ParsePinger("tcp://db.internal:5432?expect=^hello&proxy=socks5://user:secret@" + proxy.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := &tracer.Parser{Proxy: &tracer.SOCKS5{Addr: proxy.Addr(), Username: "user", Password: "secret"}}
+	if q, err = parser.ParsePinger("tcp://db.internal:5432"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetDown(true)
+	var perr *tracer.ProxyError
+	if err := q.Ping(context.Background()); !errors.As(err, &perr) || perr.Code != 5 {
+		t.Fatalf("unexpected error: found %v, expected a connection refused proxy error", err)
+	}
+
+	if _, err := tracer.ParsePinger("tcp://db:5432?proxy=ftp://jump:21"); err == nil {
+		t.Fatal("parsed an unsupported proxy")
+	}
+}
@@ -0,0 +1,217 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"time"
+)
+
+// DefaultStatsWindows are the windows uptime is computed over when
+// Tracer.StatsWindows is empty.
+var DefaultStatsWindows = []time.Duration{time.Hour, 24 * time.Hour, 30 * 24 * time.Hour}
+
+// TargetStats are the statistics of the checks of a target, see Stats.
+// Checks cancelled by the tracer or happening during Downtime are not
+// accounted.
+type TargetStats struct {
+	ID string
+
+	Successes uint64
+	Failures  uint64
+
+	// Uptime is the fraction, between 0 and 1, of the time the target
+	// was online within each of the StatsWindows of the tracer, ending
+	// now. The time the target spent in state ConnUnknown or in
+	// Downtime, from the first check flagged with Downtime until the next
+	// one that is not, or before it was traced, does not count; windows
+	// with no time left are missing.
+	Uptime map[time.Duration]float64
+
+	// MinLatency, MaxLatency and MeanLatency are computed over the
+	// successful checks.
+	MinLatency  time.Duration
+	MaxLatency  time.Duration
+	MeanLatency time.Duration
+
+	// P50, P90 and P99 are percentiles of the latency of the successful
+	// checks, see LatencyHistogram.
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// stats are the raw statistics of a target.
+type stats struct {
+	successes uint64
+	failures  uint64
+
+	latencySum time.Duration
+	latencyMin time.Duration
+	latencyMax time.Duration
+	latencies  histogram
+
+	// segments are the states of the target since the start of the
+	// longest window, in chronological order.
+	segments []segment
+}
+
+// segment is a period of time spent in state, from start until the start
+// of the next one.
+type segment struct {
+	start time.Time
+	state int
+}
+
+// stateDowntime is the state of the segments spent in Downtime, which
+// do not count towards uptime.
+const stateDowntime = -1
+
+// record accounts m, published at now about a target whose state is
+// state after it.
+func (s *stats) record(m *Message, state int, now time.Time, keep time.Duration, h *LatencyHistogram) {
+	if m.Err == nil {
+		s.successes++
+		s.latencies.record(m.Latency, h)
+		s.latencySum += m.Latency
+		if s.successes == 1 || m.Latency < s.latencyMin {
+			s.latencyMin = m.Latency
+		}
+		if m.Latency > s.latencyMax {
+			s.latencyMax = m.Latency
+		}
+	} else {
+		s.failures++
+	}
+	s.enter(state, now, keep)
+}
+
+// enter records that the target is in state from now on, unless it was
+// already, dropping the segments older than keep.
+func (s *stats) enter(state int, now time.Time, keep time.Duration) {
+	if n := len(s.segments); n == 0 || s.segments[n-1].state != state {
+		s.segments = append(s.segments, segment{start: now, state: state})
+	}
+	// Drop the segments that ended before the longest window.
+	i := 0
+	for i+1 < len(s.segments) && !s.segments[i+1].start.After(now.Add(-keep)) {
+		i++
+	}
+	s.segments = s.segments[i:]
+}
+
+// uptime returns the fraction of the known time within the window w
+// ending at now that was spent online, and false if there is none.
+func (s *stats) uptime(w time.Duration, now time.Time) (float64, bool) {
+	from := now.Add(-w)
+	var online, known time.Duration
+	for i, seg := range s.segments {
+		end := now
+		if i+1 < len(s.segments) {
+			end = s.segments[i+1].start
+		}
+		start := seg.start
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) || seg.state == ConnUnknown || seg.state == stateDowntime {
+			continue
+		}
+		known += end.Sub(start)
+		if seg.state == ConnOnline {
+			online += end.Sub(start)
+		}
+	}
+	if known == 0 {
+		return 0, false
+	}
+	return float64(online) / float64(known), true
+}
+
+// statsWindows returns the windows uptime is computed over.
+func (t *Tracer) statsWindows() []time.Duration {
+	if len(t.StatsWindows) > 0 {
+		return t.StatsWindows
+	}
+	return DefaultStatsWindows
+}
+
+// maxStatsWindow returns the longest of the windows uptime is computed
+// over.
+func (t *Tracer) maxStatsWindow() time.Duration {
+	var max time.Duration
+	for _, w := range t.statsWindows() {
+		if w > max {
+			max = w
+		}
+	}
+	return max
+}
+
+// Stats returns the statistics of the target stored with id. Returns
+// ErrNotTraced if no target is stored with id.
+func (t *Tracer) Stats(id string) (TargetStats, error) {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return TargetStats{}, ErrNotTraced
+	}
+	return t.targetStats(tg, t.now()), nil
+}
+
+// AllStats returns the statistics of every target, by ID.
+func (t *Tracer) AllStats() map[string]TargetStats {
+	now := t.now()
+	all := make(map[string]TargetStats)
+	for id, tg := range t.snapshot() {
+		all[id] = t.targetStats(tg, now)
+	}
+	return all
+}
+
+func (t *Tracer) targetStats(tg *target, now time.Time) TargetStats {
+	tg.Lock()
+	defer tg.Unlock()
+
+	s := &tg.stats
+	ts := TargetStats{
+		ID:         tg.ID(),
+		Successes:  s.successes,
+		Failures:   s.failures,
+		Uptime:     make(map[time.Duration]float64),
+		MinLatency: s.latencyMin,
+		MaxLatency: s.latencyMax,
+		P50:        s.latencies.percentile(0.5),
+		P90:        s.latencies.percentile(0.9),
+		P99:        s.latencies.percentile(0.99),
+	}
+	if s.successes > 0 {
+		ts.MeanLatency = s.latencySum / time.Duration(s.successes)
+	}
+	for _, w := range t.statsWindows() {
+		if u, ok := s.uptime(w, now); ok {
+			ts.Uptime[w] = u
+		}
+	}
+	return ts
+}
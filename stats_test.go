@@ -0,0 +1,155 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestStats(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.StatsWindows = []time.Duration{time.Second * 30, time.Hour}
+	defer s.Close()
+
+	p := tracertest.NewPinger("db",
+		tracertest.Result{Latency: time.Second},
+		tracertest.Result{Latency: time.Second * 3},
+		tracertest.Down,
+		tracertest.Down,
+		tracertest.Result{Latency: time.Second * 2},
+	)
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	// Online from 1s to 20s, offline until 42s, then online again.
+	if _, err := s.Run(time.Second * 50); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := s.Tracer.Stats("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Successes != 3 || st.Failures != 2 {
+		t.Fatalf("unexpected counts: found %v/%v, expected 3/2", st.Successes, st.Failures)
+	}
+	if st.MinLatency != time.Second || st.MaxLatency != time.Second*3 || st.MeanLatency != time.Second*2 {
+		t.Fatalf("unexpected latencies: found %v/%v/%v, expected 1s/3s/2s", st.MinLatency, st.MaxLatency, st.MeanLatency)
+	}
+	for w, expected := range map[time.Duration]float64{
+		time.Second * 30: 8.0 / 30,
+		time.Hour:        27.0 / 49,
+	} {
+		if u, ok := st.Uptime[w]; !ok || u != expected {
+			t.Fatalf("unexpected uptime over %v: found %v, expected %v", w, u, expected)
+		}
+	}
+
+	if _, err := s.Tracer.Stats("unknown"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+	if all := s.Tracer.AllStats(); len(all) != 1 || all["db"].Successes != 3 {
+		t.Fatalf("unexpected stats: found %+v, expected the ones of db", all)
+	}
+}
+
+func TestStatsDowntime(t *testing.T) {
+	daily, err := tracer.ParseCron("10 0 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Minute
+	s.Tracer.StatsWindows = []time.Duration{time.Hour}
+	s.Tracer.Blackouts = []*tracer.Blackout{{Schedule: daily, Duration: 20 * time.Minute, Location: time.UTC}}
+	defer s.Close()
+
+	// Offline until the maintenance window opens at 10m, online once
+	// it closes at 30m.
+	script := make([]tracertest.Result, 30)
+	for i := range script {
+		script[i] = tracertest.Down
+	}
+	if err := s.Trace(tracertest.NewPinger("db", append(script, tracertest.Up)...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := s.Tracer.Stats("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := st.Uptime[time.Hour]; u != 0.75 {
+		t.Fatalf("unexpected uptime: found %v, expected %v", u, 0.75)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	for _, test := range []struct {
+		histogram     *tracer.LatencyHistogram
+		p50, p90, p99 time.Duration
+	}{
+		{nil, 50 * time.Millisecond, 90 * time.Millisecond, 99 * time.Millisecond},
+		// Latencies above Max are recorded as Max.
+		{&tracer.LatencyHistogram{SignificantBits: 8, Max: 80 * time.Millisecond}, 50 * time.Millisecond, 80 * time.Millisecond, 80 * time.Millisecond},
+	} {
+		s := tracertest.NewSimulation()
+		s.Tracer.RefreshRate = time.Second
+		s.Tracer.LatencyHistogram = test.histogram
+
+		var results []tracertest.Result
+		for i := 1; i <= 100; i++ {
+			results = append(results, tracertest.Result{Latency: time.Duration(i) * time.Millisecond})
+		}
+		if err := s.Trace(tracertest.NewPinger("db", results...)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Run(time.Second * 99); err != nil {
+			t.Fatal(err)
+		}
+		st, err := s.Tracer.Stats("db")
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Percentiles are at most 1/2^SignificantBits above the
+		// actual latencies.
+		for _, p := range []struct{ found, expected time.Duration }{
+			{st.P50, test.p50}, {st.P90, test.p90}, {st.P99, test.p99},
+		} {
+			if p.found < p.expected || p.found > p.expected+p.expected/32 {
+				t.Fatalf("unexpected percentile: found %v, expected %v", p.found, p.expected)
+			}
+		}
+	}
+}
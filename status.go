@@ -0,0 +1,159 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statusRecent is the number of checks summarized by the status page.
+const statusRecent = 20
+
+// statusPage is the data rendered by StatusHandler.
+type statusPage struct {
+	Generated time.Time      `json:"generated"`
+	Windows   []string       `json:"-"`
+	Targets   []statusTarget `json:"targets"`
+}
+
+type statusTarget struct {
+	ID      string             `json:"id"`
+	Addr    string             `json:"addr,omitempty"`
+	State   string             `json:"state"`
+	Checked *time.Time         `json:"checked,omitempty"`
+	Latency float64            `json:"latency_ms"`
+	Err     string             `json:"error,omitempty"`
+	Uptime  map[string]float64 `json:"uptime"`
+
+	// Recent are the outcomes of the last checks, oldest first, one
+	// ✓ or ✗ each.
+	Recent string `json:"recent"`
+
+	// Uptimes are the cells of Uptime in the order of the windows.
+	Uptimes []string `json:"-"`
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: .3em .8em; text-align: left; border-bottom: 1px solid #ddd; }
+.online { color: #1a7f37; }
+.offline { color: #cf222e; }
+.unknown { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>Status</h1>
+<p>Generated at {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+<table>
+<tr><th>Target</th><th>Address</th><th>State</th><th>Last check</th><th>Latency</th>{{range .Windows}}<th>Uptime {{.}}</th>{{end}}<th>Recent</th><th>Error</th></tr>
+{{- range .Targets}}
+<tr><td>{{.ID}}</td><td>{{.Addr}}</td><td class="{{.State}}">{{.State}}</td><td>{{with .Checked}}{{.Format "2006-01-02 15:04:05"}}{{else}}-{{end}}</td><td>{{printf "%.1f" .Latency}} ms</td>{{range .Uptimes}}<td>{{.}}</td>{{end}}<td>{{.Recent}}</td><td>{{.Err}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// StatusHandler returns an http.Handler rendering an overview of the
+// targets of t: their state, last check, latency, uptime over the
+// StatsWindows and the outcome of their recent checks. The overview is
+// an HTML page, or a JSON document when the request accepts
+// application/json or has the query parameter format=json.
+func (t *Tracer) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		page := t.statusPage()
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusTemplate.Execute(w, page)
+	})
+}
+
+func (t *Tracer) statusPage() statusPage {
+	windows := t.statsWindows()
+	page := statusPage{Generated: t.now(), Targets: []statusTarget{}}
+	for _, w := range windows {
+		page.Windows = append(page.Windows, w.String())
+	}
+	all := t.AllStats()
+	for _, info := range t.Targets() {
+		st := statusTarget{
+			ID:      info.ID,
+			State:   StateString(info.State),
+			Latency: float64(info.Latency) / float64(time.Millisecond),
+			Uptime:  make(map[string]float64),
+		}
+		if info.Addr != nil {
+			st.Addr = info.Addr.String()
+		}
+		if !info.Checked.IsZero() {
+			checked := info.Checked
+			st.Checked = &checked
+		}
+		if info.Err != nil {
+			st.Err = info.Err.Error()
+		}
+		stats := all[info.ID]
+		for _, w := range windows {
+			u, ok := stats.Uptime[w]
+			if !ok {
+				st.Uptimes = append(st.Uptimes, "-")
+				continue
+			}
+			st.Uptime[w.String()] = u
+			st.Uptimes = append(st.Uptimes, fmt.Sprintf("%.2f%%", u*100))
+		}
+		var recent strings.Builder
+		for _, c := range t.History(info.ID, statusRecent) {
+			if c.Err == nil {
+				recent.WriteString("✓")
+			} else {
+				recent.WriteString("✗")
+			}
+		}
+		st.Recent = recent.String()
+		page.Targets = append(page.Targets, st)
+	}
+	return page
+}
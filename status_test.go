@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestStatusHandler(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.StatsWindows = []time.Duration{time.Minute}
+	defer s.Close()
+
+	if err := s.Trace(tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Up)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Second * 20); err != nil {
+		t.Fatal(err)
+	}
+	h := s.Tracer.StatusHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?format=json", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected content type: found %v, expected application/json", ct)
+	}
+	var page struct {
+		Targets []struct {
+			ID     string             `json:"id"`
+			State  string             `json:"state"`
+			Uptime map[string]float64 `json:"uptime"`
+			Recent string             `json:"recent"`
+		} `json:"targets"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Targets) != 1 {
+		t.Fatalf("unexpected targets: found %+v, expected db", page.Targets)
+	}
+	db := page.Targets[0]
+	if db.ID != "db" || db.State != "online" || db.Recent != "✓✗✓" {
+		t.Fatalf("unexpected status of db: found %+v", db)
+	}
+	if u := db.Uptime["1m0s"]; u != 0.5 {
+		t.Fatalf("unexpected uptime: found %v, expected 0.5", u)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `<td class="online">online</td>`) || !strings.Contains(body, "50.00%") {
+		t.Fatalf("unexpected page: found %v", body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status code: found %v, expected %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,344 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+)
+
+// streamKeepAlive is the period of the comments sent to idle Server-Sent
+// Events clients, so that proxies do not time the connection out.
+const streamKeepAlive = 15 * time.Second
+
+// websocketGUID is appended to the key of the WebSocket handshake, see
+// RFC 6455, section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// streamTransition is the JSON representation of a Transition in a
+// stream, states are encoded as in Message.
+type streamTransition struct {
+	ID       string        `json:"id"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+}
+
+// streamEvent returns the type and the JSON encoding of e, which is a
+// Message or a Transition.
+func streamEvent(e Event) (string, []byte, error) {
+	switch v := e.Value.(type) {
+	case Message:
+		data, err := json.Marshal(v)
+		return "message", data, err
+	case Transition:
+		data, err := json.Marshal(streamTransition{ID: v.ID, From: v.From, To: v.To, At: v.At, Duration: v.Duration})
+		return "transition", data, err
+	default:
+		return "", nil, fmt.Errorf("tracer: unexpected event %T", v)
+	}
+}
+
+// StreamHandler returns an http.Handler streaming the Messages and the
+// Transitions of t to its clients as they are published, to build live
+// dashboards in the browser. Each client chooses the targets it receives
+// events about with the id query parameter, which may be repeated, e.g.
+// ?id=db&id=web, or receives the events about every target.
+//
+// Requests upgrading to WebSocket receive a text message per event,
+// {"type": "message", "data": {...}} or {"type": "transition", "data":
+// {...}}; WebSocket requests from an origin other than the host are
+// rejected. Other requests receive a Server-Sent Events stream where
+// each event is named message or transition and carries the data as
+// JSON. Messages are encoded as by Message.MarshalJSON. Events that a
+// slow client cannot keep up with are dropped, as for SubscribeTopics,
+// which shows as a gap in the Seq of its messages.
+func (t *Tracer) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		events, cancel := t.subscribeStream(r.URL.Query()["id"])
+		defer cancel()
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			serveWebSocket(w, r, events)
+			return
+		}
+		serveSSE(w, r, events)
+	})
+}
+
+// subscribeStream subscribes to the messages and transitions about ids,
+// or about every target if ids is empty.
+func (t *Tracer) subscribeStream(ids []string) (<-chan Event, pubsub.CancelFunc) {
+	if len(ids) == 1 {
+		return t.SubscribeTopics(ids[0], TopicConn, TopicConnTransition)
+	}
+	events, cancel := t.SubscribeTopics("", TopicConn, TopicConnTransition)
+	if len(ids) == 0 {
+		return events, cancel
+	}
+	filter := make(map[string]bool)
+	for _, id := range ids {
+		filter[id] = true
+	}
+	filtered := make(chan Event, eventsBuffer)
+	go func() {
+		defer close(filtered)
+		for e := range events {
+			if !filter[e.ID] {
+				continue
+			}
+			select {
+			case filtered <- e:
+			default:
+			}
+		}
+	}()
+	return filtered, cancel
+}
+
+func serveSSE(w http.ResponseWriter, r *http.Request, events <-chan Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			typ, data, err := streamEvent(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// WebSocket opcodes, see RFC 6455, section 5.2.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// wsConn is the server side of a WebSocket connection, which only sends
+// data.
+type wsConn struct {
+	sync.Mutex // serializes writes
+	conn       net.Conn
+	rw         *bufio.ReadWriter
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request, events <-chan Event) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket request", http.StatusBadRequest)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	ws := &wsConn{conn: conn, rw: rw}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		ws.readLoop()
+	}()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				ws.write(wsClose, nil)
+				return
+			}
+			typ, data, err := streamEvent(e)
+			if err != nil {
+				continue
+			}
+			payload, _ := json.Marshal(struct {
+				Type string          `json:"type"`
+				Data json.RawMessage `json:"data"`
+			}{typ, data})
+			if err := ws.write(wsText, payload); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// write sends a single unmasked frame.
+func (ws *wsConn) write(opcode byte, payload []byte) error {
+	ws.Lock()
+	defer ws.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	ws.rw.Write(header)
+	ws.rw.Write(payload)
+	return ws.rw.Flush()
+}
+
+// readLoop reads the frames sent by the client, which are discarded,
+// answering pings, until the connection fails or is closed.
+func (ws *wsConn) readLoop() {
+	for {
+		opcode, payload, err := ws.read()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsClose:
+			ws.write(wsClose, payload)
+			return
+		case wsPing:
+			ws.write(wsPong, payload)
+		}
+	}
+}
+
+// maxControlPayload is the maximum payload of control frames, see RFC
+// 6455, section 5.5.
+const maxControlPayload = 125
+
+// read returns the opcode of the next frame and, for control frames, its
+// unmasked payload.
+func (ws *wsConn) read() (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(ws.rw, h[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := h[0] & 0x0f
+	masked := h[1]&0x80 != 0
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if !masked {
+		return 0, nil, errors.New("tracer: unmasked websocket frame")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	if opcode < wsClose {
+		// Data frames are not for us.
+		_, err := io.CopyN(io.Discard, ws.rw, int64(n))
+		return opcode, nil, err
+	}
+	if n > maxControlPayload {
+		return 0, nil, errors.New("tracer: websocket control frame too large")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,180 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestStreamSSE(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+	srv := httptest.NewServer(s.Tracer.StreamHandler())
+	defer srv.Close()
+
+	for _, p := range []tracer.Pinger{
+		tracertest.NewPinger("db", tracertest.Up),
+		tracertest.NewPinger("web", tracertest.Up),
+	} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := http.Get(srv.URL + "?id=db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type: found %v, expected text/event-stream", ct)
+	}
+	if _, err := s.Run(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for _, typ := range []string{"message", "transition"} {
+		var event, data string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				event = v
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = v
+			}
+		}
+		var v struct{ ID string }
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			t.Fatal(err)
+		}
+		if event != typ || v.ID != "db" {
+			t.Fatalf("unexpected event: found %v %v, expected a %v about db", event, data, typ)
+		}
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+	srv := httptest.NewServer(s.Tracer.StreamHandler())
+	defer srv.Close()
+
+	for _, p := range []tracer.Pinger{
+		tracertest.NewPinger("db", tracertest.Up),
+		tracertest.NewPinger("web", tracertest.Up),
+		tracertest.NewPinger("other", tracertest.Up),
+	} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /?id=db&id=web HTTP/1.1\r\nHost: "+srv.Listener.Addr().String()+"\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response: found %v %v", resp.Status, resp.Header)
+	}
+	if _, err := s.Run(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A message and a transition about both db and web.
+	found := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		var h [2]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			t.Fatal(err)
+		}
+		if h[0] != 0x81 {
+			t.Fatalf("unexpected frame header: found %#x, expected a final text frame", h[0])
+		}
+		n := int(h[1])
+		if n == 126 {
+			var b [2]byte
+			io.ReadFull(r, b[:])
+			n = int(binary.BigEndian.Uint16(b[:]))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatal(err)
+		}
+		var e struct {
+			Type string
+			Data struct{ ID string }
+		}
+		if err := json.Unmarshal(payload, &e); err != nil {
+			t.Fatal(err)
+		}
+		found[e.Type+" "+e.Data.ID]++
+	}
+	for _, k := range []string{"message db", "transition db", "message web", "transition web"} {
+		if found[k] != 1 {
+			t.Fatalf("unexpected events: found %v, expected one %v", found, k)
+		}
+	}
+
+	// Masked close frame, answered with a close frame.
+	conn.Write([]byte{0x88, 0x80, 1, 2, 3, 4})
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	if h[0] != 0x88 {
+		t.Fatalf("unexpected frame header: found %#x, expected a close frame", h[0])
+	}
+}
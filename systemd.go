@@ -0,0 +1,117 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SdNotify sends state, e.g. "READY=1" or "STATUS=...", to the service
+// manager through the socket named by $NOTIFY_SOCKET, see sd_notify(3).
+// Does nothing when the process was not started by systemd.
+func SdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		// Abstract socket.
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the period of the keep-alives systemd expects
+// from this process, zero when the watchdog is not enabled for it.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// NotifySystemd tells systemd that t is ready, hence is meant to be
+// called after Run by daemons running as Type=notify units. When the unit
+// sets WatchdogSec=, a keep-alive is sent every half period as long as the
+// run loop of t is responsive: if the loop wedges, or t is closed, systemd
+// notices and restarts the service.
+// The returned function stops the keep-alives, telling systemd that the
+// service is stopping. Does nothing when the process was not started by
+// systemd.
+func NotifySystemd(t *Tracer) (stop func(), err error) {
+	if err := SdNotify("READY=1"); err != nil {
+		return func() {}, err
+	}
+	interval := watchdogInterval() / 2
+	if interval <= 0 {
+		return func() { SdNotify("STOPPING=1") }, nil
+	}
+
+	stopc := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stopc:
+				return
+			case <-tick.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			alive := t.alive(ctx)
+			cancel()
+			if alive {
+				SdNotify("WATCHDOG=1")
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopc)
+			wg.Wait()
+			SdNotify("STOPPING=1")
+		})
+	}, nil
+}
@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// TargetInfo describes a target of a Tracer, see Targets.
+type TargetInfo struct {
+	ID   string
+	Addr net.Addr
+
+	// State is the current state of the target.
+	State int
+
+	// Checked is when the target was last checked, zero if never,
+	// Latency the latency of that check and Err its error.
+	Checked time.Time
+	Latency time.Duration
+	Err     error
+
+	// Failures is the number of consecutive failed checks.
+	Failures int
+
+	// Interval is the interval the target was traced WithInterval,
+	// zero when checked on each refresh.
+	Interval time.Duration
+}
+
+// Targets returns the targets traced by t, sorted by ID. It may be called
+// while the tracer is running.
+func (t *Tracer) Targets() []TargetInfo {
+	conns := t.snapshot()
+	infos := make([]TargetInfo, 0, len(conns))
+	for _, tg := range conns {
+		infos = append(infos, tg.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Target returns the TargetInfo of the target stored with id. Returns
+// ErrNotTraced if no target is stored with id.
+func (t *Tracer) Target(id string) (TargetInfo, error) {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return TargetInfo{}, ErrNotTraced
+	}
+	return tg.info(), nil
+}
+
+func (tg *target) info() TargetInfo {
+	tg.Lock()
+	defer tg.Unlock()
+
+	info := TargetInfo{
+		ID:       tg.ID(),
+		State:    tg.state,
+		Failures: tg.falls,
+		Interval: tg.interval,
+	}
+	if tg.last != nil {
+		info.Addr = tg.last.Addr
+		info.Checked = tg.checked
+		info.Latency = tg.last.Latency
+		info.Err = tg.last.Err
+	} else {
+		info.Addr = tg.Addr()
+	}
+	return info
+}
@@ -0,0 +1,74 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestTargets(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+
+	db := tracertest.NewPinger("db", tracertest.Result{Latency: time.Second})
+	web := tracertest.NewPinger("web", tracertest.Down)
+	if err := s.Trace(web, tracer.WithInterval(time.Second*5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trace(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tracer.Targets()) != 2 {
+		t.Fatalf("unexpected targets: found %v, expected 2", s.Tracer.Targets())
+	}
+	if _, err := s.Run(time.Second * 12); err != nil {
+		t.Fatal(err)
+	}
+
+	infos := s.Tracer.Targets()
+	expected := []tracer.TargetInfo{
+		{ID: "db", Addr: tracertest.Addr("db"), State: tracer.ConnOnline, Checked: tracertest.Epoch.Add(time.Second * 11), Latency: time.Second},
+		{ID: "web", Addr: tracertest.Addr("web"), State: tracer.ConnOffline, Checked: tracertest.Epoch.Add(time.Second * 10), Err: tracertest.ErrDown, Failures: 3, Interval: time.Second * 5},
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("unexpected targets: found %+v, expected %+v", infos, expected)
+	}
+	for i, info := range infos {
+		if info != expected[i] {
+			t.Fatalf("unexpected target %d: found %+v, expected %+v", i, info, expected[i])
+		}
+	}
+	if info, err := s.Tracer.Target("db"); err != nil || info != expected[0] {
+		t.Fatalf("unexpected target: found %+v (%v), expected %+v", info, err, expected[0])
+	}
+	if _, err := s.Tracer.Target("unknown"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
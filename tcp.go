@@ -0,0 +1,134 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// TCPPinger is a Pinger that considers a target reachable when a TCP
+// connection to it can be established.
+type TCPPinger struct {
+	addr string
+	opts *options
+
+	sync.Mutex
+	remote net.Addr             // address reached by the last successful dial
+	state  *tls.ConnectionState // TLS state of the last ping
+}
+
+// NewTCPPinger returns a TCPPinger that dials addr, in the host:port
+// form. Unless WithID is used, addr is the ID of the Pinger.
+func NewTCPPinger(addr string, opts ...Option) *TCPPinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = addr
+	}
+	return &TCPPinger{addr: addr, opts: o}
+}
+
+// ID implements Pinger.
+func (p *TCPPinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger. Returns the resolved address reached by the
+// last successful ping, or the address the Pinger was created with.
+func (p *TCPPinger) Addr() net.Addr {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.remote != nil {
+		return p.remote
+	}
+	return &netAddr{network: "tcp", addr: p.addr}
+}
+
+// ConnectionState implements TLSPinger.
+func (p *TCPPinger) ConnectionState() *tls.ConnectionState {
+	p.Lock()
+	defer p.Unlock()
+	return p.state
+}
+
+// Ping implements Pinger. It dials the target, performs the TLS handshake
+// and reads the server greeting when configured to, and closes the
+// connection. The greeting is read only when WithExpect or WithValidator
+// are used. Failures to connect are returned as *DialError, telling
+// refused connections, timeouts and name resolution failures apart.
+func (p *TCPPinger) Ping(ctx context.Context) error {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	p.Lock()
+	p.state = nil
+	p.Unlock()
+	conn, err := p.opts.dial(ctx, "tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	p.Lock()
+	p.remote = conn.RemoteAddr()
+	p.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if p.opts.tlsConfig != nil {
+		config := p.opts.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(p.addr)
+		}
+		tconn := tls.Client(conn, config)
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		state := tconn.ConnectionState()
+		p.Lock()
+		p.state = &state
+		p.Unlock()
+		if err := p.opts.checkRevocation(ctx, &state); err != nil {
+			return err
+		}
+		conn = tconn
+	}
+	if p.opts.expect == nil && len(p.opts.validators) == 0 {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if n == 0 && err != nil {
+		return err
+	}
+	if err := p.opts.match("greeting", buf[:n]); err != nil {
+		return err
+	}
+	return p.opts.validate(buf[:n])
+}
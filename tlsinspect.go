@@ -0,0 +1,285 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// TLSReport describes the TLS configuration of a target, as inspected by
+// TLSInspector.
+type TLSReport struct {
+	// Version and CipherSuite are the ones negotiated by a client with
+	// the default configuration.
+	Version     uint16
+	CipherSuite uint16
+
+	// Versions are the protocol versions the target accepts, in
+	// ascending order.
+	Versions []uint16
+
+	// WeakCiphers is set when the target accepts cipher suites with
+	// known security issues, see tls.InsecureCipherSuites.
+	WeakCiphers bool
+
+	// KeyAlgorithm and KeyBits describe the public key of the leaf
+	// certificate, e.g. "ECDSA" and 256.
+	KeyAlgorithm string
+	KeyBits      int
+
+	// Grade summarizes the configuration: A for TLS 1.2 and later with
+	// strong ciphers and keys, B when older protocol versions are
+	// accepted as well, C when weak cipher suites are accepted or the key
+	// is weak (RSA below 2048 bits, ECDSA below 256), F when the
+	// configuration negotiated by default uses an old version or a weak
+	// cipher suite.
+	Grade string
+
+	// Inspected is when the inspection ended.
+	Inspected time.Time
+}
+
+// grade computes the grade of r, see TLSReport.Grade.
+func (r *TLSReport) grade() string {
+	weakKey := (r.KeyAlgorithm == "RSA" && r.KeyBits < 2048) || (r.KeyAlgorithm == "ECDSA" && r.KeyBits < 256)
+	switch {
+	case r.Version < tls.VersionTLS12 || insecureSuite(r.CipherSuite):
+		return "F"
+	case r.WeakCiphers || weakKey:
+		return "C"
+	case len(r.Versions) > 0 && r.Versions[0] < tls.VersionTLS12:
+		return "B"
+	}
+	return "A"
+}
+
+// regressions returns the ways r is worse than prev, if any.
+func (r *TLSReport) regressions(prev *TLSReport) []string {
+	var found []string
+	if len(r.Versions) > 0 && len(prev.Versions) > 0 && r.Versions[0] < prev.Versions[0] {
+		found = append(found, "accepts "+tls.VersionName(r.Versions[0]))
+	}
+	if r.Version < prev.Version {
+		found = append(found, "negotiates "+tls.VersionName(r.Version))
+	}
+	if r.WeakCiphers && !prev.WeakCiphers {
+		found = append(found, "accepts weak cipher suites")
+	}
+	if r.KeyAlgorithm == prev.KeyAlgorithm && r.KeyBits < prev.KeyBits {
+		found = append(found, fmt.Sprintf("uses a %d bits key", r.KeyBits))
+	}
+	if r.Grade > prev.Grade {
+		found = append(found, "grade "+prev.Grade+" to "+r.Grade)
+	}
+	return found
+}
+
+// TLSRegression is published on TopicCert when the TLS configuration of
+// a target inspected by a TLSInspector gets worse, e.g. it starts accepting
+// TLS 1.0.
+type TLSRegression struct {
+	ID       string
+	Previous *TLSReport
+	Current  *TLSReport
+
+	// Reasons describe the regressions, e.g. "accepts TLS 1.0".
+	Reasons []string
+}
+
+// TLSInspector is a Pinger inspecting the TLS configuration of a target,
+// for security-minded operators: besides a handshake with the default
+// configuration, it tries each protocol version and the weak cipher suites
+// to find out which ones the target accepts. The *TLSReport is returned as
+// details of the ping, see DetailPinger, and passed to validators. The
+// tracer publishes a TLSRegression event when a report is worse than the
+// previous one. Pings fail only when the default handshake fails.
+// Inspections take several handshakes, use WithMinInterval to run them at
+// a low rate.
+type TLSInspector struct {
+	addr string
+	opts *options
+
+	mu      sync.Mutex
+	last    *TLSReport
+	lastErr error
+	state   *tls.ConnectionState
+}
+
+// NewTLSInspector returns a TLSInspector connecting to addr, in the
+// host:port form, with the configuration set by WithTLSConfig, if any.
+// Unless WithID is used, tls://addr is the ID of the Pinger.
+func NewTLSInspector(addr string, opts ...Option) *TLSInspector {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = "tls://" + addr
+	}
+	return &TLSInspector{addr: addr, opts: o}
+}
+
+// ID implements Pinger.
+func (p *TLSInspector) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *TLSInspector) Addr() net.Addr {
+	return &netAddr{network: "tcp", addr: p.addr}
+}
+
+// ConnectionState implements TLSPinger, returning the state of the
+// default handshake of the last inspection.
+func (p *TLSInspector) ConnectionState() *tls.ConnectionState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Ping implements Pinger.
+func (p *TLSInspector) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the *TLSReport.
+func (p *TLSInspector) PingDetails(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	if last := p.last; last != nil && p.opts.interval > 0 && time.Since(last.Inspected) < p.opts.interval {
+		err := p.lastErr
+		p.mu.Unlock()
+		return last, err
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	state, err := p.handshake(ctx, nil)
+	p.mu.Lock()
+	p.state = state
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &TLSReport{Version: state.Version, CipherSuite: state.CipherSuite}
+	for _, v := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		if _, err := p.handshake(ctx, func(c *tls.Config) { c.MinVersion, c.MaxVersion = v, v }); err == nil {
+			r.Versions = append(r.Versions, v)
+		}
+	}
+	_, err = p.handshake(ctx, func(c *tls.Config) {
+		c.MinVersion, c.MaxVersion = tls.VersionTLS10, tls.VersionTLS12
+		c.CipherSuites = nil
+		for _, s := range tls.InsecureCipherSuites() {
+			c.CipherSuites = append(c.CipherSuites, s.ID)
+		}
+	})
+	r.WeakCiphers = err == nil
+	if len(state.PeerCertificates) > 0 {
+		switch k := state.PeerCertificates[0].PublicKey.(type) {
+		case *rsa.PublicKey:
+			r.KeyAlgorithm, r.KeyBits = "RSA", k.N.BitLen()
+		case *ecdsa.PublicKey:
+			r.KeyAlgorithm, r.KeyBits = "ECDSA", k.Curve.Params().BitSize
+		case ed25519.PublicKey:
+			r.KeyAlgorithm, r.KeyBits = "Ed25519", 256
+		}
+	}
+	r.Grade = r.grade()
+	r.Inspected = time.Now()
+	err = p.opts.validate(r)
+
+	p.mu.Lock()
+	p.last, p.lastErr = r, err
+	p.mu.Unlock()
+	return r, err
+}
+
+// handshake performs a TLS handshake with the target, using the
+// configuration of p modified by edit, if any.
+func (p *TLSInspector) handshake(ctx context.Context, edit func(*tls.Config)) (*tls.ConnectionState, error) {
+	config := new(tls.Config)
+	if p.opts.tlsConfig != nil {
+		config = p.opts.tlsConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(p.addr)
+	}
+	if edit != nil {
+		// Only the protocol is under inspection here, whoever
+		// the target is.
+		config.InsecureSkipVerify = true
+		edit(config)
+	}
+
+	conn, err := p.opts.dial(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	tconn := tls.Client(conn, config)
+	if err := tconn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tconn.ConnectionState()
+	return &state, nil
+}
+
+// insecureSuite reports whether id is one of tls.InsecureCipherSuites.
+func insecureSuite(id uint16) bool {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTLS publishes a TLSRegression event when details, the outcome of
+// the last ping of tg, is a *TLSReport worse than the previous one.
+func (t *Tracer) checkTLS(tg *target, details interface{}) {
+	r, ok := details.(*TLSReport)
+	if !ok {
+		return
+	}
+	tg.Lock()
+	prev := tg.tls
+	tg.tls = r
+	tg.Unlock()
+	if prev == nil || prev == r {
+		return
+	}
+	if reasons := r.regressions(prev); len(reasons) > 0 {
+		t.emit(TopicCert, tg.ID(), TLSRegression{ID: tg.ID(), Previous: prev, Current: r, Reasons: reasons})
+	}
+}
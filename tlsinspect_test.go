@@ -0,0 +1,94 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestTLSInspector(t *testing.T) {
+	srv := tracertest.NewTLSServer(t)
+	p := tracer.NewTLSInspector(srv.Addr(), tracer.WithTLSConfig(srv.Cert.Client))
+	if p.ID() != "tls://"+srv.Addr() {
+		t.Fatalf("unexpected ID: found %v, expected %v", p.ID(), "tls://"+srv.Addr())
+	}
+	details, err := p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := details.(*tracer.TLSReport)
+	if r.Version != tls.VersionTLS13 || r.Versions[0] != tls.VersionTLS12 || r.WeakCiphers || r.KeyAlgorithm != "ECDSA" || r.KeyBits != 256 || r.Grade != "A" {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+
+	// The tracer reports regressions.
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.SkipIfRunning = true
+	rec := new(recorder)
+	tr.PubSub = rec
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	for rec.len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	srv.SetTLS(tls.VersionTLS10, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec.Lock()
+		var regression *tracer.TLSRegression
+		for _, i := range rec.other {
+			// An inspection running across the change may have
+			// noticed part of it only.
+			if e, ok := i.(tracer.TLSRegression); ok && e.Current.Versions[0] == tls.VersionTLS10 {
+				regression = &e
+			}
+		}
+		rec.Unlock()
+		if regression != nil {
+			if regression.ID != p.ID() || !regression.Current.WeakCiphers || regression.Current.Grade != "C" {
+				t.Fatalf("unexpected regression: %+v, %+v", regression, regression.Current)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("regression not reported")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
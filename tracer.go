@@ -24,13 +24,28 @@ SOFTWARE.
 
 // Package tracer provides basic functionalities to monitor a network address
 // until it is online.
+//
+// Durations reported by the tracer, such as ping latencies, are measured
+// with the monotonic clock when the tracer runs on the system Clock: they
+// are not affected by wall clock adjustments like NTP steps, and are never
+// negative.
+//
+// Programs that need a target before going on block with the Wait
+// methods: WaitUntilOnline returns once the target is in state ConnOnline,
+// after RiseThreshold successful pings, while WaitOnline returns on its
+// first successful ping; WaitAllOnline waits for several targets.
 package tracer
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tecnoporto/pubsub"
@@ -41,18 +56,109 @@ const (
 	TopicConn = "topic_connection"
 )
 
+// Topic used to publish warnings about the tracer itself.
+const (
+	TopicWarning = "topic_warning"
+)
+
+// Topic used to publish events about the TLS certificates of the targets,
+// see CertExpiring.
+const (
+	TopicCert = "topic_cert"
+)
+
+// Topic used to publish events about the registration of the domains
+// of the targets, see DomainExpiring.
+const (
+	TopicDomain = "topic_domain"
+)
+
+// Topic used to publish the changes noticed in what targets serve, see
+// EventPinger.
+const (
+	TopicChange = "topic_change"
+)
+
+// Topic used to publish the state transitions of the targets, see
+// Transition.
+const (
+	TopicConnTransition = "topic_connection_transition"
+)
+
+// Topic used to publish the changes of the condition of the local
+// network, see SetNetwork.
+const (
+	TopicNetwork = "topic_network"
+)
+
+// Topic used to publish when targets start and stop flapping, see
+// FlapDetection.
+const (
+	TopicFlap = "topic_flap"
+)
+
 // Possible Tracer status value.
 const (
 	StatusRunning = iota
 	StatusStopped
 )
 
-// Possible connection states.
+// Possible connection states. A target is in state ConnUnknown until
+// its first ping is reported, and when the result pushed for it expires,
+// see PushGateway.
 const (
 	ConnOnline = iota
 	ConnOffline
+	ConnUnknown
 )
 
+// StateString returns the name of the connection state s.
+func StateString(s int) string {
+	switch s {
+	case ConnOnline:
+		return "online"
+	case ConnOffline:
+		return "offline"
+	case ConnUnknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("state(%d)", s)
+	}
+}
+
+// ErrNotTraced is returned when an operation refers to an ID that
+// is not being traced.
+var ErrNotTraced = errors.New("tracer: target not traced")
+
+// ErrAlreadyTraced is returned by TraceIfAbsent when a target is already
+// traced with the same ID.
+var ErrAlreadyTraced = errors.New("tracer: target already traced")
+
+// ErrNotRunning is returned when an operation needs the tracer to be
+// running.
+var ErrNotRunning = errors.New("tracer: not running")
+
+// Errors returned by Trace when the Pinger cannot be registered.
+var (
+	ErrEmptyID     = errors.New("tracer: pinger has empty ID")
+	ErrNilAddr     = errors.New("tracer: pinger has nil address")
+	ErrInvalidAddr = errors.New("tracer: pinger has invalid address")
+)
+
+// ErrPingTimeout is reported in place of the Pinger's error when a
+// ping is cut short by the tracer's ping timeout.
+var ErrPingTimeout = errors.New("tracer: ping timed out")
+
+// PanicError is reported when a Pinger panics during Ping.
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("tracer: ping panicked: %v", e.Value)
+}
+
 // Pinger wraps the basic Ping function.
 type Pinger interface {
 	Addr() net.Addr
@@ -60,6 +166,27 @@ type Pinger interface {
 	ID() string
 }
 
+// DetailPinger is implemented by Pingers that return, along with the
+// outcome of a ping, a payload describing it, such as the status of an HTTP
+// response or the offset of an NTP server. The tracer calls PingDetails
+// instead of Ping and publishes the payload in Message.Details, so that
+// consumers do not have to parse it out of error strings.
+type DetailPinger interface {
+	Pinger
+	PingDetails(ctx context.Context) (interface{}, error)
+}
+
+// EventPinger is implemented by Pingers that notice events worth
+// reporting besides the outcome of their pings, such as a change in the
+// addresses a name resolves to. The tracer calls Events after each ping and
+// publishes the events returned on TopicChange.
+type EventPinger interface {
+	Pinger
+
+	// Events returns the events noticed since the last call.
+	Events() []interface{}
+}
+
 // PubSub describes the required functionalities of a publication/subscription object.
 type PubSub interface {
 	Sub(cmd *pubsub.Command) (pubsub.CancelFunc, error)
@@ -71,28 +198,480 @@ type Tracer struct {
 	PubSub
 
 	refreshc    chan struct{}
-	stopc       chan struct{}
-	conns       map[string]Pinger
+	tracec      chan *target
+	checkc      chan *target  // targets to ping right away, see CheckNow
+	alivec      chan struct{} // received by the run loop, see alive
+	run         *run          // the current or last run, nil before Run
 	RefreshRate time.Duration
 
+	// conns is replaced, never modified, by Trace and Untrace so that
+	// it can be ranged over while targets are added and removed, see
+	// snapshot.
+	conns   map[string]*target
+	connsMu sync.RWMutex
+
+	// events are the subscribers of Events.
+	events fanout
+
+	// Clock is the source of time of the tracer, the system clock
+	// by default.
+	Clock Clock
+
+	// CoalesceWindow is the time the tracer waits after a refresh is
+	// requested, e.g. by Untrace, before starting the ping cycle. The
+	// requests that arrive in the meantime are served by the same cycle.
+	CoalesceWindow time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of the refresh rate, or
+	// of the interval of the targets traced WithInterval, over which the
+	// pings due at the same time are randomly spread, so that many
+	// targets do not hit the network all at once. The delay is capped
+	// so that the ping, bounded by its timeout, still completes within
+	// the period, and there is none when the timeout takes the whole
+	// period. The first ping of a target after Trace, and the ones
+	// requested by CheckNow, are never delayed. Ignored in LowPower
+	// mode, whose point is to batch the pings instead.
+	Jitter     float64
+	jitterRand lockedRand
+
+	// PingTimeout bounds the duration of each ping, unless the target
+	// was traced WithPingTimeout. When zero, pings
+	// are bounded at half of RefreshRate, or of the interval of the
+	// target when traced WithInterval or checked less often by a
+	// Profile.
+	PingTimeout time.Duration
+
+	// Retries is the number of times a failed ping is attempted again
+	// within the same check, RetryDelay apart, before the failure is
+	// published: a single transient failure does not make it to the
+	// subscribers. Each attempt is bounded by PingTimeout.
+	Retries    int
+	RetryDelay time.Duration
+
+	// GracePeriod is the warm-up window that follows Run and Trace.
+	// Failures happening in that window are published but do not
+	// bring the target to state ConnOffline, so that starting the tracer
+	// before the network is fully up does not produce an alert storm.
+	GracePeriod time.Duration
+	started     time.Time
+
+	// RiseThreshold and FallThreshold are the number of consecutive
+	// successful and failed pings required before a target flips to
+	// ConnOnline and ConnOffline respectively. Values below 2 make the
+	// target flip on the first ping. Thresholds do not apply to the first
+	// transition out of ConnUnknown.
+	RiseThreshold int
+	FallThreshold int
+
+	// ValidateAddr makes Trace check that the address of the Pinger
+	// parses according to its network, see validateAddr.
+	ValidateAddr bool
+
+	// Profiles override the checking policy of groups of targets
+	// during recurring windows, see Profile.
+	Profiles []*Profile
+
+	// Blackouts are the recurring maintenance windows during which
+	// state transitions are suppressed, see Blackout.
+	Blackouts []*Blackout
+
+	// CertExpiryWarning makes the tracer publish a CertExpiring event
+	// on TopicCert when a certificate presented by a TLSPinger target
+	// expires within CertExpiryWarning. Zero disables the check.
+	CertExpiryWarning time.Duration
+
+	// RevocationCheck makes the tracer publish a CertRevocation event
+	// on TopicCert when a certificate presented by a TLSPinger target is
+	// revoked or its status cannot be determined. The state of the target
+	// is not affected, see WithRevocationCheck for that.
+	RevocationCheck *RevocationChecker
+
+	// DomainExpiryWarning makes the tracer publish a DomainExpiring
+	// event on TopicDomain when the registration of a domain watched by a
+	// DomainPinger expires within DomainExpiryWarning. Zero disables the
+	// check.
+	DomainExpiryWarning time.Duration
+
+	// LowPower, when set, enables the resource-constrained scheduling
+	// mode described by it.
+	LowPower *LowPower
+
+	// MeteredInterval throttles pinging while the local network is
+	// metered, see SetNetwork: ping cycles start at most once per
+	// MeteredInterval. Zero disables throttling.
+	MeteredInterval time.Duration
+	network         *NetworkCondition // nil until SetNetwork is called
+	fullRefresh     int32             // 1 when the next cycle checks every target
+	lastCycle       time.Time
+	cycles          atomic.Uint64 // ping cycles started, see PublishExpvar
+
+	// Chaos, when set, enables chaos mode: faults are injected into
+	// the pings as described by it.
+	Chaos *Chaos
+
+	// Backoff, when set, spaces out the pings of the targets that keep
+	// failing.
+	Backoff *Backoff
+
+	// Instrumentation, when set, is notified of every ping and state
+	// transition.
+	Instrumentation Instrumentation
+
+	// Logger, when set, logs the lifecycle of the tracer and of its
+	// targets, the state transitions and the failed pings, at the
+	// levels of LogLevels, DefaultLogLevels when nil. See WithLogger.
+	Logger    *slog.Logger
+	LogLevels *LogLevels
+
+	// StatsWindows are the windows the uptime of the targets is
+	// computed over, DefaultStatsWindows when empty. See Stats.
+	StatsWindows []time.Duration
+
+	// HistorySize is the number of check results kept per target,
+	// DefaultHistorySize when zero. See History.
+	HistorySize int
+
+	// OutageRetention is how long outages are kept after their end,
+	// DefaultOutageRetention when zero. See Outages.
+	OutageRetention time.Duration
+
+	// LatencyHistogram configures the resolution and the bounds of the
+	// latency percentiles of Stats, the defaults when nil.
+	LatencyHistogram *LatencyHistogram
+
+	// FlapDetection, when set, holds back the transitions of the
+	// targets that keep flipping between states.
+	FlapDetection *FlapDetection
+
+	// SkipIfRunning, when set, prevents a refresh from cancelling the
+	// ping of a target that is still running: the target is skipped
+	// instead, and the number of skipped refreshes is reported in the
+	// Message published when the ping eventually returns.
+	SkipIfRunning bool
+
+	// MaxConcurrentPings bounds the number of pings running at the
+	// same time, which are then run by a pool of as many workers: when
+	// they are all busy, the refresh waits for one of them to be free
+	// instead of starting more goroutines. Zero means no bound. Changes
+	// take effect on the next Run.
+	MaxConcurrentPings int
+
+	// InFlightWarning is published on TopicWarning when the number of
+	// pings in flight exceeds InFlightWatermark, a sign that targets are
+	// slower than the schedule. Zero disables the warning.
+	InFlightWatermark int
+	inflight          int32
+	overflow          int32 // 1 while above InFlightWatermark
+
+	// deps are the dependencies among targets, see DependsOn.
+	deps depGraph
+
+	// lifecycle serializes Run and Close.
+	lifecycle sync.Mutex
+
 	sync.Mutex
 	status int
 }
 
+// Message is published on TopicConn each time a ping returns.
 type Message struct {
+	// Version is the schema version the message conforms to, see
+	// MessageVersion.
+	Version int
+
 	ID  string
 	Err error
+
+	// Kind is the class of Err, see Classify. Err matches ErrCanceled
+	// when the ping was Canceled.
+	Kind Kind
+
+	// Addr is the address of the target, as returned by its Pinger
+	// after the ping.
+	Addr net.Addr
+
+	// IP is the IP address of the target, when Addr carries one.
+	IP net.IP
+
+	// State is the connection state of the target after this ping.
+	State int
+
+	// Latency is the time the Pinger took to return, measured with the
+	// monotonic clock.
+	Latency time.Duration
+
+	// Timestamp is when the ping started, according to the Clock of
+	// the tracer.
+	Timestamp time.Time
+
+	// Seq is incremented by one for each Message published about
+	// ID, starting from 1. Messages about the same ID are published in Seq
+	// order, hence a gap in the sequence means that a message was lost
+	// on the way. The sequence starts again when ID is traced anew.
+	Seq uint64
+
+	// Skipped is the number of refreshes that skipped the target while
+	// this ping was running. Always zero unless SkipIfRunning is set.
+	Skipped uint64
+
+	// Attempts is the number of times the target was pinged for this
+	// message, more than one when failures were retried, see
+	// Tracer.Retries. Err and Latency are the ones of the last attempt.
+	Attempts int
+
+	// Canceled is set when the ping was cancelled by the tracer itself,
+	// because a refresh started a new cycle: Err says nothing about the
+	// target, which keeps its previous State.
+	Canceled bool
+
+	// Chaos is set when the outcome of the ping was altered by chaos
+	// mode, see Tracer.Chaos.
+	Chaos bool
+
+	// Initial is set on the first message published about ID.
+	Initial bool
+
+	// Downtime is set when the ping happened during a maintenance
+	// window, see Blackout, or while the local network was down, see
+	// SetNetwork: State did not change whatever the outcome.
+	Downtime bool
+
+	// RootCause is the ID of the most upstream offline target ID
+	// depends on, when ID is offline too, see DependsOn. Alerts about
+	// messages with a RootCause are better suppressed or demoted.
+	RootCause string
+
+	// Flapping is set while the target is flapping, see FlapDetection.
+	Flapping bool
+
+	// Details is the payload returned by the ping when the Pinger is
+	// a DetailPinger, see DetailsAs.
+	Details interface{}
+
+	// Stale is set by Last when the message is older than twice the
+	// refresh rate, i.e. the target has not been checked lately.
+	// Published messages are never stale.
+	Stale bool
+}
+
+// InFlightWarning is published on TopicWarning when the pings running
+// at the same time exceed the configured watermark. It is published again
+// only after the number of pings falls back below the watermark.
+type InFlightWarning struct {
+	InFlight  int
+	Watermark int
 }
 
-// New returns a new instance of Tracer.
-func New() *Tracer {
+// Transition is published on TopicConnTransition when the state of a
+// target changes, right after the Message that caused it. The transitions
+// of flapping targets are held back, see FlapDetection.
+type Transition struct {
+	ID   string
+	From int
+	To   int
+	At   time.Time
+
+	// Duration is the time the target spent in state From.
+	Duration time.Duration
+}
+
+// target is the tracer's record of a traced Pinger.
+type target struct {
+	Pinger
+
+	sync.Mutex
+	seq     uint64
+	running int
+	skipped uint64
+
+	last    *Message  // last published message
+	checked time.Time // when last was published
+
+	state  int
+	since  time.Time // when state was entered
+	rises  int       // consecutive successes
+	falls  int       // consecutive failures
+	traced time.Time
+	pinged time.Time // start of the last cycle that pinged the target, see due
+	retry  time.Time // no ping before, see Backoff
+
+	flips    []time.Time // transitions within the window, see FlapDetection
+	flipped  time.Time   // last transition
+	flapping bool
+	settled  int // state before flapping
+
+	changed chan struct{} // closed and replaced when last changes
+	removed bool          // set when the target is untraced or replaced
+
+	expiring   map[string]bool // certificates reported as expiring, see checkCerts
+	revocation string          // last revocation problem reported, see checkCerts
+	tls        *TLSReport      // last TLS report, see checkTLS
+
+	domainExpiry time.Time // expiration date reported, see checkDomain
+
+	latency time.Duration // moving average of successful pings, see Fastest
+	stats   stats         // see Stats
+	history ring          // see History
+	outages []Outage      // see Outages
+
+	interval time.Duration // set by WithInterval
+	timeout  time.Duration // set by WithPingTimeout
+	next     time.Time     // next ping, when interval is set, see schedule
+}
+
+// snapshot returns the targets of t by ID, as they are now. The map must
+// not be modified.
+func (t *Tracer) snapshot() map[string]*target {
+	t.connsMu.RLock()
+	defer t.connsMu.RUnlock()
+	return t.conns
+}
+
+// lookup returns the target stored with id.
+func (t *Tracer) lookup(id string) (*target, bool) {
+	tg, ok := t.snapshot()[id]
+	return tg, ok
+}
+
+// store replaces the target stored with id by tg, or removes it when tg
+// is nil. Returns the target replaced, if any, which is marked removed
+// so that the goroutines waiting for it give up on it.
+func (t *Tracer) store(id string, tg *target) (*target, bool) {
+	old, ok := t.swap(id, tg)
+	if ok {
+		old.Lock()
+		old.removed = true
+		old.notify()
+		old.Unlock()
+	}
+	return old, ok
+}
+
+// swap is store, without marking the target replaced.
+func (t *Tracer) swap(id string, tg *target) (*target, bool) {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+
+	old, ok := t.conns[id]
+	t.put(id, tg)
+	return old, ok
+}
+
+// storeIfAbsent stores tg with id, unless a target is already stored with
+// it. The check and the insert happen under the same lock. Reports whether
+// tg was stored.
+func (t *Tracer) storeIfAbsent(id string, tg *target) bool {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+
+	if _, ok := t.conns[id]; ok {
+		return false
+	}
+	t.put(id, tg)
+	return true
+}
+
+// put replaces the targets map with a copy where id maps to tg, or where
+// id is missing when tg is nil. Must be called with connsMu held.
+func (t *Tracer) put(id string, tg *target) {
+	conns := make(map[string]*target, len(t.conns)+1)
+	for k, v := range t.conns {
+		conns[k] = v
+	}
+	if tg != nil {
+		conns[id] = tg
+	} else {
+		delete(conns, id)
+	}
+	t.conns = conns
+}
+
+func newTarget(p Pinger, now time.Time) *target {
+	return &target{
+		Pinger:  p,
+		state:   ConnUnknown,
+		since:   now,
+		traced:  now,
+		changed: make(chan struct{}),
+	}
+}
+
+// notify wakes up the goroutines waiting for tg to change. Must be
+// called with tg locked.
+func (tg *target) notify() {
+	close(tg.changed)
+	tg.changed = make(chan struct{})
+}
+
+// begin records that a ping of tg is about to start. If skip is true
+// and tg has a ping running already, the skip is counted and begin returns
+// false: no new ping should be started.
+func (tg *target) begin(skip bool) bool {
+	tg.Lock()
+	defer tg.Unlock()
+
+	if skip && tg.running > 0 {
+		tg.skipped++
+		return false
+	}
+	tg.running++
+	return true
+}
+
+// end records that a ping of tg returned, and returns the number of
+// refreshes skipped in the meantime.
+func (tg *target) end() uint64 {
+	tg.Lock()
+	defer tg.Unlock()
+
+	tg.running--
+	skipped := tg.skipped
+	tg.skipped = 0
+	return skipped
+}
+
+// TracerOption configures a Tracer at construction, see New.
+type TracerOption func(*Tracer)
+
+// WithPubSub makes the tracer publish and subscribe through ps, which
+// becomes the only path of its events, instead of a new pubsub.PubSub.
+// A nil ps discards every event.
+func WithPubSub(ps PubSub) TracerOption {
+	return func(t *Tracer) {
+		if ps == nil {
+			ps = noPubSub{}
+		}
+		t.PubSub = ps
+	}
+}
+
+// noPubSub is a PubSub that discards every event.
+type noPubSub struct{}
+
+func (noPubSub) Sub(cmd *pubsub.Command) (pubsub.CancelFunc, error) {
+	return func() {}, nil
+}
+
+func (noPubSub) Pub(message interface{}, topic string) {}
+
+// New returns a new instance of Tracer, configured by opts.
+func New(opts ...TracerOption) *Tracer {
 	t := &Tracer{
-		PubSub:      pubsub.New(),
-		conns:       make(map[string]Pinger),
-		refreshc:    make(chan struct{}),
-		stopc:       make(chan struct{}),
-		status:      StatusStopped,
-		RefreshRate: time.Second * 4,
+		Clock:          systemClock{},
+		conns:          make(map[string]*target),
+		refreshc:       make(chan struct{}),
+		tracec:         make(chan *target),
+		checkc:         make(chan *target),
+		alivec:         make(chan struct{}),
+		status:         StatusStopped,
+		RefreshRate:    time.Second * 4,
+		CoalesceWindow: time.Millisecond * 50,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.PubSub == nil {
+		t.PubSub = pubsub.New()
 	}
 
 	return t
@@ -101,49 +680,156 @@ func New() *Tracer {
 // Run makes the tracer listen for refresh calls and perform ping operations
 // on each connection that is labeled with pending.
 // Quits immediately when Close is called, runs in its own gorountine.
+// See RunContext to bind it to a context.
 func (t *Tracer) Run() error {
-	if t.Status() == StatusRunning {
+	t.lifecycle.Lock()
+	defer t.lifecycle.Unlock()
+
+	t.Lock()
+	if t.status == StatusRunning {
+		t.Unlock()
 		return errors.New("tracer: already running")
 	}
-	t.setStatus(StatusRunning)
-
-	ping := func() context.CancelFunc {
-		ctx, cancel := context.WithCancel(context.Background())
+	t.status = StatusRunning
+	r := &run{stopc: make(chan struct{}), donec: make(chan struct{})}
+	if t.MaxConcurrentPings > 0 {
+		r.jobs = make(chan pingJob)
+		for i := 0; i < t.MaxConcurrentPings; i++ {
+			go t.worker(r)
+		}
+	}
+	t.run = r
+	t.Unlock()
+	t.started = t.now()
+	t.log(t.logLevels().Lifecycle, "tracer started", slog.Duration("refresh_rate", t.RefreshRate))
 
-		for _, c := range t.conns {
-			go func(c Pinger) {
-				err := c.Ping(ctx)
-				m := Message{ID: c.ID(), Err: err}
+	// runCtx is cancelled only when the tracer is closed, each
+	// ping cycle derives its context from it.
+	runCtx, stop := context.WithCancel(context.Background())
+	ctx := runCtx
+	var cancel context.CancelFunc
+	refresh := func(conns map[string]*target) {
+		// When SkipIfRunning is set, pings that are still running
+		// are left alone, hence the cycle has nothing to cancel.
+		if !t.SkipIfRunning {
+			if cancel != nil {
+				cancel()
+			}
+			ctx, cancel = context.WithCancel(runCtx)
+		}
+		now := t.now()
+		run, full := t.cycle(now)
+		if !run {
+			return
+		}
+		for _, c := range conns {
+			if c.interval > 0 && !full {
+				continue
+			}
+			if full || t.due(c, now) {
+				t.ping(ctx, r, c, true)
+			}
+		}
+	}
 
-				if t.PubSub != nil {
-					t.Pub(m, TopicConn)
+	// sched holds the targets traced WithInterval, wake fires when the
+	// earliest of them is due.
+	var (
+		sched  schedule
+		wake   <-chan time.Time
+		wakeAt time.Time
+	)
+	arm := func(now time.Time) {
+		if sched.Len() == 0 || wake != nil && !sched[0].next.Before(wakeAt) {
+			return
+		}
+		if wake != nil {
+			// The earlier timer is abandoned, still receive from it
+			// as fake clocks wait for their timers to be received.
+			go func(c <-chan time.Time) {
+				select {
+				case <-c:
+				case <-r.donec:
 				}
-			}(c)
+			}(wake)
 		}
-
-		return cancel
+		wakeAt = sched[0].next
+		wake = t.wakeAfter(wakeAt.Sub(now))
+	}
+	pingDue := func() {
+		now := t.now()
+		for _, c := range sched.due(now) {
+			if tg, _ := t.lookup(c.ID()); tg != c {
+				// Untraced or replaced.
+				continue
+			}
+			if t.Network().Up && !t.backingOff(c, now) {
+				t.ping(runCtx, r, c, true)
+			}
+			sched.add(c, following(c, now))
+		}
+		wake = nil
+		arm(now)
 	}
 
+	// Targets traced before Run are checked immediately, from the loop
+	// as pings may wait for a worker. Later ones are handed over by Trace.
+	initial := t.snapshot()
+
 	go func() {
-		var cancel context.CancelFunc
-		for {
-			refresh := func() {
-				if cancel != nil {
-					cancel()
-				}
-				cancel = ping()
+		refresh(initial)
+		now := t.now()
+		for _, c := range initial {
+			if c.interval > 0 {
+				sched.add(c, now)
 			}
+		}
+		pingDue()
 
+		// tick fires the periodic refresh, coalesce is set while a
+		// requested refresh is pending.
+		tick := t.wakeAfter(t.RefreshRate)
+		var coalesce <-chan time.Time
+		for {
 			select {
+			case <-wake:
+				pingDue()
 			case <-t.refreshc:
-				refresh()
-			case <-t.stopc:
-				if cancel != nil {
-					cancel()
+				if coalesce == nil {
+					coalesce = t.wakeAfter(t.CoalesceWindow)
+				}
+			case <-coalesce:
+				coalesce = nil
+				refresh(t.snapshot())
+			case <-t.alivec:
+			case c := <-t.tracec:
+				switch {
+				case c.interval > 0:
+					now := t.now()
+					sched.add(c, now)
+					arm(now)
+				case coalesce != nil:
+					// The pending refresh takes care of c.
+				case t.LowPower != nil:
+					coalesce = t.wakeAfter(t.CoalesceWindow)
+				default:
+					t.ping(ctx, r, c, false)
+				}
+			case c := <-t.checkc:
+				t.ping(ctx, r, c, false)
+			case <-r.stopc:
+				stop()
+				// Pings delayed by Jitter may still be handed over
+				// to the workers until they return.
+				r.pings.Wait()
+				if r.jobs != nil {
+					close(r.jobs)
 				}
+				close(r.donec)
 				return
-			case <-time.After(t.RefreshRate):
-				refresh()
+			case <-tick:
+				refresh(t.snapshot())
+				tick = t.wakeAfter(t.RefreshRate)
 			}
 		}
 	}()
@@ -151,10 +837,467 @@ func (t *Tracer) Run() error {
 	return nil
 }
 
-// Trace makes the tracer keep track of the entity at addr.
-func (t *Tracer) Trace(p Pinger) error {
-	t.conns[p.ID()] = p
-	t.refresh()
+// ping starts a ping of c as part of r, publishing the outcome. ctx is
+// the context of the current ping cycle. The ping is delayed according
+// to Jitter when jitter is set, i.e. unless it was requested explicitly by
+// Trace or CheckNow, then runs in its own goroutine or, when
+// MaxConcurrentPings is set, in the first worker available: ping blocks
+// until there is one, or the tracer is closed.
+func (t *Tracer) ping(ctx context.Context, r *run, c *target, jitter bool) {
+	if !c.begin(t.SkipIfRunning) {
+		return
+	}
+	r.pings.Add(1)
+	if d := t.jitter(c); jitter && d > 0 {
+		go func() {
+			wait := t.after(d)
+			select {
+			case <-wait:
+				t.dispatch(ctx, r, c)
+			case <-ctx.Done():
+				// The cycle is over before its turn came. Still
+				// receive from wait, as fake clocks wait for their
+				// timers to be received.
+				t.drop(r, c)
+				select {
+				case <-wait:
+				case <-r.donec:
+				}
+			}
+		}()
+		return
+	}
+	t.dispatch(ctx, r, c)
+}
+
+// dispatch hands the ping of c started by ping over to a worker, or to a
+// goroutine of its own.
+func (t *Tracer) dispatch(ctx context.Context, r *run, c *target) {
+	t.enter()
+	if r.jobs == nil {
+		go t.pingTarget(ctx, r, c)
+		return
+	}
+	select {
+	case r.jobs <- pingJob{ctx: ctx, target: c}:
+	case <-r.stopc:
+		t.leave()
+		t.drop(r, c)
+	}
+}
+
+// drop gives up the ping of c started by ping.
+func (t *Tracer) drop(r *run, c *target) {
+	c.end()
+	r.pings.Done()
+}
+
+// run is the state of a single Run of a Tracer. It is renewed by every
+// Run, so that a stopped tracer can be started again while the pings of
+// the previous run are still returning.
+type run struct {
+	stopc chan struct{} // closed by Close
+	donec chan struct{} // closed when the run loop exits
+	jobs  chan pingJob  // nil when MaxConcurrentPings is not set
+
+	// pings keeps track of the ping goroutines that are still running.
+	pings sync.WaitGroup
+}
+
+// stopped reports whether r has been closed.
+func (r *run) stopped() bool {
+	select {
+	case <-r.stopc:
+		return true
+	default:
+		return false
+	}
+}
+
+// pingJob is a ping waiting for a worker, see MaxConcurrentPings.
+type pingJob struct {
+	ctx    context.Context
+	target *target
+}
+
+// worker runs the pings received from the jobs of r until they are
+// closed.
+func (t *Tracer) worker(r *run) {
+	for j := range r.jobs {
+		t.pingTarget(j.ctx, r, j.target)
+	}
+}
+
+// pingTarget pings c and publishes the outcome, unless r has been stopped
+// in the meantime.
+func (t *Tracer) pingTarget(ctx context.Context, r *run, c *target) {
+	defer r.pings.Done()
+	defer t.leave()
+
+	ctx, end := t.startPing(ctx, c.Pinger)
+	start := t.now()
+	details, chaos, latency, err := t.attempt(ctx, c)
+	attempts := 1
+	for err != nil && attempts <= t.Retries && t.retryWait(ctx, r) {
+		attempts++
+		details, chaos, latency, err = t.attempt(ctx, c)
+	}
+	canceled := err != nil && ctx.Err() == context.Canceled
+	if canceled && !errors.Is(err, ErrCanceled) {
+		err = fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+	skipped := c.end()
+	addr := c.Addr()
+	m := Message{
+		Version:   MessageVersion,
+		ID:        c.ID(),
+		Err:       err,
+		Kind:      Classify(err),
+		Addr:      addr,
+		IP:        addrIP(addr),
+		Latency:   latency,
+		Timestamp: start,
+		Skipped:   skipped,
+		Attempts:  attempts,
+		Canceled:  canceled,
+		Chaos:     chaos,
+		Details:   details,
+	}
+	if r.stopped() {
+		// The run is over, nobody should hear from
+		// this ping anymore.
+		end(m)
+		return
+	}
+	end(t.publish(c, m))
+	if !canceled {
+		t.checkCerts(c)
+		t.checkTLS(c, details)
+		t.checkDomain(c, details)
+	}
+	t.publishEvents(c)
+}
+
+// attempt pings c once, bounded by PingTimeout, returning its outcome
+// and latency.
+func (t *Tracer) attempt(ctx context.Context, c *target) (interface{}, bool, time.Duration, error) {
+	pctx, cancel := context.WithTimeout(ctx, t.pingTimeout(c))
+	defer cancel()
+
+	start := t.now()
+	details, chaos, err := t.Chaos.ping(pctx, c.Pinger, t.after)
+	latency := t.now().Sub(start)
+	if err != nil && ctx.Err() != context.Canceled && pctx.Err() == context.DeadlineExceeded {
+		err = ErrPingTimeout
+	}
+	return details, chaos, latency, err
+}
+
+// retryWait waits RetryDelay before the next attempt of a ping of r
+// whose context is ctx, reporting false if ctx is done first. The ping
+// does not count as in flight while waiting, as for Jitter.
+func (t *Tracer) retryWait(ctx context.Context, r *run) bool {
+	if t.RetryDelay <= 0 {
+		return ctx.Err() == nil
+	}
+	t.leave()
+	defer t.enter()
+
+	wait := t.after(t.RetryDelay)
+	select {
+	case <-wait:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		// Still receive from wait, as fake clocks wait for their
+		// timers to be received.
+		go func() {
+			select {
+			case <-wait:
+			case <-r.donec:
+			}
+		}()
+		return false
+	}
+}
+
+// publishEvents publishes the events noticed by tg, if it is an
+// EventPinger.
+func (t *Tracer) publishEvents(tg *target) {
+	ep, ok := tg.Pinger.(EventPinger)
+	if !ok {
+		return
+	}
+	for _, e := range ep.Events() {
+		t.emit(TopicChange, tg.ID(), e)
+	}
+}
+
+// enter and leave keep track of the number of pings in flight, publishing
+// an InFlightWarning when InFlightWatermark is exceeded.
+func (t *Tracer) enter() {
+	n := atomic.AddInt32(&t.inflight, 1)
+	if t.InFlightWatermark <= 0 || int(n) <= t.InFlightWatermark {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&t.overflow, 0, 1) {
+		t.emit(TopicWarning, "", InFlightWarning{InFlight: int(n), Watermark: t.InFlightWatermark})
+	}
+}
+
+func (t *Tracer) leave() {
+	n := atomic.AddInt32(&t.inflight, -1)
+	if int(n) <= t.InFlightWatermark {
+		atomic.StoreInt32(&t.overflow, 0)
+	}
+}
+
+// InFlight returns the number of pings that are currently running.
+func (t *Tracer) InFlight() int {
+	return int(atomic.LoadInt32(&t.inflight))
+}
+
+// safePing calls p.Ping, converting a panic into a *PanicError so that a
+// buggy Pinger cannot take the whole process down.
+func safePing(ctx context.Context, p Pinger) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return p.Ping(ctx)
+}
+
+// safePingDetails is safePing for Pingers that may be DetailPingers,
+// returning their payload as well.
+func safePingDetails(ctx context.Context, p Pinger) (details interface{}, err error) {
+	dp, ok := p.(DetailPinger)
+	if !ok {
+		return nil, safePing(ctx, p)
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			details, err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return dp.PingDetails(ctx)
+}
+
+// DetailsAs returns the Details of m as a T, reporting whether they are
+// one. Details decoded from JSON, which are kept as a json.RawMessage, are
+// decoded into a T.
+func DetailsAs[T any](m Message) (T, bool) {
+	var v T
+	switch d := m.Details.(type) {
+	case T:
+		return d, true
+	case json.RawMessage:
+		if err := json.Unmarshal(d, &v); err != nil {
+			return v, false
+		}
+		return v, true
+	}
+	return v, false
+}
+
+// pingTimeout returns the bound of the pings of tg: the one set
+// WithPingTimeout, PingTimeout or, when zero, half of the time between two
+// checks of tg, so that its pings do not overlap.
+func (t *Tracer) pingTimeout(tg *target) time.Duration {
+	if tg.timeout > 0 {
+		return tg.timeout
+	}
+	if t.PingTimeout > 0 {
+		return t.PingTimeout
+	}
+	return t.period(tg, t.now()) / 2
+}
+
+// period returns the time between two checks of tg at now: its interval
+// when traced WithInterval, otherwise the refresh rate, or the interval
+// of the Profile active for tg when longer.
+func (t *Tracer) period(tg *target, now time.Time) time.Duration {
+	if tg.interval > 0 {
+		return tg.interval
+	}
+	period := t.RefreshRate
+	if p := t.profile(tg.ID(), now); p != nil && p.Interval > period {
+		period = p.Interval
+	}
+	return period
+}
+
+// publish assigns the next sequence number of tg to m and publishes it,
+// returning the published message. Holding the target's lock while
+// publishing keeps the messages about the same target in order.
+func (t *Tracer) publish(tg *target, m Message) Message {
+	tg.Lock()
+	defer tg.Unlock()
+
+	now := t.now()
+	from := tg.state
+	m.Downtime = t.inBlackout(m.ID, now) || !t.Network().Up
+	if !m.Canceled && !m.Downtime {
+		t.updateState(tg, m.Err, now)
+		tg.retry = now.Add(t.Backoff.delay(tg.falls))
+	}
+	if !m.Canceled && m.Err == nil {
+		tg.recordLatency(m.Latency)
+	}
+	switch {
+	case m.Canceled:
+	case m.Downtime:
+		tg.stats.enter(stateDowntime, now, t.maxStatsWindow())
+	default:
+		tg.stats.record(&m, tg.state, now, t.maxStatsWindow(), t.LatencyHistogram)
+	}
+	m.State = tg.state
+	t.recordOutage(tg, &m, from, now)
+	m.RootCause = t.deps.update(m.ID, m.State)
+	tr, fl := t.flap(tg, from, now)
+	m.Flapping = tg.flapping
+
+	tg.seq++
+	m.Seq = tg.seq
+	m.Initial = tg.seq == 1
+	if !m.Canceled {
+		tg.last = &m
+		tg.checked = now
+		tg.notify()
+		tg.history.add(CheckResult{
+			At:       m.Timestamp,
+			Err:      m.Err,
+			Kind:     m.Kind,
+			Latency:  m.Latency,
+			State:    m.State,
+			Downtime: m.Downtime,
+		}, t.historySize())
+	}
+	t.emit(TopicConn, m.ID, m)
+	t.logPing(&m, tr)
+	if tr != nil && t.Instrumentation != nil {
+		t.Instrumentation.Transition(*tr)
+	}
+	if tr != nil {
+		t.emit(TopicConnTransition, tr.ID, *tr)
+	}
+	if fl != nil {
+		t.emit(TopicFlap, fl.ID, *fl)
+	}
+	return m
+}
+
+// updateState moves tg to its next state given the outcome of its last
+// ping, taking rise and fall thresholds and grace period into account.
+// Must be called with tg locked.
+func (t *Tracer) updateState(tg *target, err error, now time.Time) {
+	if errors.Is(err, ErrResultExpired) {
+		tg.state, tg.rises, tg.falls = ConnUnknown, 0, 0
+		return
+	}
+	rise, fall := t.thresholds(tg.ID(), now)
+	if err == nil {
+		tg.rises++
+		tg.falls = 0
+		if tg.state == ConnUnknown || tg.rises >= rise {
+			tg.state = ConnOnline
+		}
+		return
+	}
+
+	tg.falls++
+	tg.rises = 0
+	if t.inGracePeriod(tg, now) {
+		// Failure recorded, but the state is left as is.
+		return
+	}
+	if tg.state == ConnUnknown || tg.falls >= fall {
+		tg.state = ConnOffline
+	}
+}
+
+// inGracePeriod reports whether at time now tg is still within the
+// warm-up window that follows both Run and its Trace call.
+func (t *Tracer) inGracePeriod(tg *target, now time.Time) bool {
+	start := t.started
+	if tg.traced.After(start) {
+		start = tg.traced
+	}
+	return now.Before(start.Add(t.GracePeriod))
+}
+
+// Last returns the last message published about the target stored with
+// id. If the target was not checked in the last two refresh periods, or
+// intervals when traced WithInterval or checked less often by a Profile,
+// or was never checked at all, the message returned is flagged as Stale.
+// Returns ErrNotTraced if no target is stored with id.
+func (t *Tracer) Last(id string) (Message, error) {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return Message{}, ErrNotTraced
+	}
+
+	tg.Lock()
+	defer tg.Unlock()
+
+	if tg.last == nil {
+		return Message{ID: id, Stale: true}, nil
+	}
+	now := t.now()
+	m := *tg.last
+	m.Stale = now.Sub(tg.checked) > 2*t.period(tg, now)
+	return m, nil
+}
+
+// Trace makes the tracer keep track of the entity at addr. If the
+// tracer is running, the entity is checked immediately, otherwise as soon
+// as Run is called. opts configure how the entity is traced, e.g.
+// WithInterval.
+// Returns ErrEmptyID or ErrNilAddr when p cannot be keyed or located, and
+// an error wrapping ErrInvalidAddr when ValidateAddr is set and the address
+// of p does not parse.
+func (t *Tracer) Trace(p Pinger, opts ...TargetOption) error {
+	return t.trace(p, true, opts)
+}
+
+// TraceIfAbsent is Trace, but leaves the target already traced with the ID
+// of p in place and returns ErrAlreadyTraced instead of replacing it.
+// Concurrent calls with the same ID succeed at most once.
+func (t *Tracer) TraceIfAbsent(p Pinger, opts ...TargetOption) error {
+	return t.trace(p, false, opts)
+}
+
+// trace implements Trace and TraceIfAbsent; replace tells whether a target
+// already traced with the same ID is replaced.
+func (t *Tracer) trace(p Pinger, replace bool, opts []TargetOption) error {
+	if p.ID() == "" {
+		return ErrEmptyID
+	}
+	addr := p.Addr()
+	if addr == nil {
+		return ErrNilAddr
+	}
+	if t.ValidateAddr {
+		if err := validateAddr(addr); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAddr, err)
+		}
+	}
+
+	tg := newTarget(p, t.now())
+	for _, opt := range opts {
+		opt(tg)
+	}
+	if replace {
+		t.store(p.ID(), tg)
+	} else if !t.storeIfAbsent(p.ID(), tg) {
+		return ErrAlreadyTraced
+	}
+	t.log(t.logLevels().Lifecycle, "target traced", slog.String("id", p.ID()), slog.String("addr", addr.String()))
+	if donec, ok := t.loop(); ok {
+		select {
+		case t.tracec <- tg:
+		case <-donec:
+		}
+	}
 
 	return nil
 }
@@ -166,25 +1309,140 @@ func (t *Tracer) Status() int {
 	return t.status
 }
 
-func (t *Tracer) setStatus(status int) {
+// loop returns the channel closed when the run loop exits, and whether
+// the loop is running. Callers that need to hand something over to the loop
+// should give up when the channel is closed.
+func (t *Tracer) loop() (<-chan struct{}, bool) {
 	t.Lock()
 	defer t.Unlock()
-	t.status = status
+	if t.run == nil {
+		return nil, false
+	}
+	return t.run.donec, t.status == StatusRunning
+}
+
+// alive reports whether the run loop of t is responsive, i.e. it takes
+// a request within ctx.
+func (t *Tracer) alive(ctx context.Context) bool {
+	donec, ok := t.loop()
+	if !ok {
+		return false
+	}
+	select {
+	case t.alivec <- struct{}{}:
+		return true
+	case <-donec:
+	case <-ctx.Done():
+	}
+	return false
 }
 
 // Untrace removes the entity stored with id from the monitored
-// entities.
-func (t *Tracer) Untrace(id string) {
-	delete(t.conns, id)
+// entities. Returns ErrNotTraced if no entity is stored with id.
+func (t *Tracer) Untrace(id string) error {
+	_, ok := t.store(id, nil)
+	if !ok {
+		return ErrNotTraced
+	}
+
+	t.deps.update(id, ConnUnknown)
+	t.log(t.logLevels().Lifecycle, "target untraced", slog.String("id", id))
+
 	t.refresh()
+
+	return nil
 }
 
 func (t *Tracer) refresh() {
-	t.refreshc <- struct{}{}
+	if donec, ok := t.loop(); ok {
+		select {
+		case t.refreshc <- struct{}{}:
+		case <-donec:
+		}
+	}
+}
+
+// CheckNow pings the target stored with id right away, out of its
+// schedule, and returns without waiting for the outcome. Returns
+// ErrNotTraced if no target is stored with id and ErrNotRunning if the
+// tracer is not running.
+func (t *Tracer) CheckNow(id string) error {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return ErrNotTraced
+	}
+	donec, ok := t.loop()
+	if !ok {
+		return ErrNotRunning
+	}
+	select {
+	case t.checkc <- tg:
+		return nil
+	case <-donec:
+		return ErrNotRunning
+	}
+}
+
+// RunContext is Run bound to ctx: the tracer is closed as soon as ctx is
+// done. Call Close or Shutdown to wait for it to stop.
+func (t *Tracer) RunContext(ctx context.Context) error {
+	if err := t.Run(); err != nil {
+		return err
+	}
+	donec, _ := t.loop()
+	go func() {
+		select {
+		case <-ctx.Done():
+			t.Close()
+		case <-donec:
+		}
+	}()
+	return nil
 }
 
 // Close makes the tracer pass from status running to status stopped.
+// The contexts of the pings that are still in flight are cancelled, and
+// Close returns only when the run loop and every ping have returned: no
+// Message is published after that.
+// Close is idempotent and may be called from multiple goroutines; it is
+// a no-op if the tracer was never started. A closed tracer may be started
+// again with Run.
 func (t *Tracer) Close() {
-	t.setStatus(StatusStopped)
-	t.stopc <- struct{}{}
+	t.Shutdown(context.Background())
+}
+
+// Shutdown is Close bounded by ctx, for pingers that do not honour the
+// cancellation of their context. If ctx is done before every ping has
+// returned Shutdown returns its error, the tracer is stopped anyway and
+// the remaining pings are discarded as they complete.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.lifecycle.Lock()
+	defer t.lifecycle.Unlock()
+
+	t.Lock()
+	r := t.run
+	stopping := t.status == StatusRunning
+	if stopping {
+		t.status = StatusStopped
+		close(r.stopc)
+	}
+	t.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	var err error
+	select {
+	case <-r.donec:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if stopping {
+		var attrs []slog.Attr
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		t.log(t.logLevels().Lifecycle, "tracer stopped", attrs...)
+	}
+	return err
 }
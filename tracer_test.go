@@ -27,12 +27,17 @@ package tracer_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/tecnoporto/pubsub"
 	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
 )
 
 type pg struct {
@@ -67,6 +72,71 @@ func (p *pg) Ping(ctx context.Context) error {
 	return nil
 }
 
+// slowPinger blocks until its context is cancelled or release
+// is closed.
+type slowPinger struct {
+	id      string
+	started chan struct{}
+	release chan struct{}
+	running int32
+}
+
+func newSlowPinger(id string) *slowPinger {
+	return &slowPinger{
+		id:      id,
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (p *slowPinger) Addr() net.Addr {
+	return new(addr)
+}
+
+func (p *slowPinger) ID() string {
+	return p.id
+}
+
+func (p *slowPinger) Ping(ctx context.Context) error {
+	atomic.AddInt32(&p.running, 1)
+	defer atomic.AddInt32(&p.running, -1)
+
+	p.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.release:
+		return nil
+	}
+}
+
+// recorder is a PubSub that remembers what was published.
+type recorder struct {
+	sync.Mutex
+	msgs  []interface{} // published on TopicConn
+	other []interface{} // published on any other topic
+}
+
+func (r *recorder) Sub(cmd *pubsub.Command) (pubsub.CancelFunc, error) {
+	return nil, nil
+}
+
+func (r *recorder) Pub(message interface{}, topic string) {
+	r.Lock()
+	defer r.Unlock()
+	if topic != tracer.TopicConn {
+		r.other = append(r.other, message)
+		return
+	}
+	r.msgs = append(r.msgs, message)
+}
+
+func (r *recorder) len() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.msgs)
+}
+
 func TestRun(t *testing.T) {
 	tr := tracer.New()
 
@@ -125,3 +195,1255 @@ func TestTrace(t *testing.T) {
 
 	<-wait
 }
+
+func TestWithPubSub(t *testing.T) {
+	rec := new(recorder)
+	for _, ps := range []tracer.PubSub{rec, nil} {
+		tr := tracer.New(tracer.WithPubSub(ps))
+		tr.RefreshRate = time.Millisecond
+		if err := tr.Trace(&pg{id: "fake"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Sub(&pubsub.Command{Topic: tracer.TopicConn, Run: func(interface{}) error { return nil }}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Run(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, done := context.WithTimeout(context.Background(), time.Second)
+		err := tr.WaitUntilOnline(ctx, "fake")
+		done()
+		tr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rec.len() == 0 {
+		t.Fatal("no messages published on the injected PubSub")
+	}
+}
+
+func TestTransition(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.FallThreshold = 2
+	defer s.Close()
+
+	var transitions []tracer.Transition
+	if _, err := s.Tracer.Sub(&pubsub.Command{
+		Topic: tracer.TopicConnTransition,
+		Run: func(i interface{}) error {
+			transitions = append(transitions, i.(tracer.Transition))
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	p := tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Down, tracertest.Up)
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Run(time.Second * 35); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []tracer.Transition{
+		{ID: "db", From: tracer.ConnUnknown, To: tracer.ConnOnline, Duration: 0},
+		{ID: "db", From: tracer.ConnOnline, To: tracer.ConnOffline, Duration: time.Second * 20},
+		{ID: "db", From: tracer.ConnOffline, To: tracer.ConnOnline, Duration: time.Second * 10},
+	}
+	if len(transitions) != len(expected) {
+		t.Fatalf("unexpected transitions: found %v, expected %v", transitions, expected)
+	}
+	for i, tr := range transitions {
+		tr.At = time.Time{}
+		if tr != expected[i] {
+			t.Fatalf("unexpected transition %d: found %+v, expected %+v", i, tr, expected[i])
+		}
+	}
+}
+
+func TestFlapDetection(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.FlapDetection = &tracer.FlapDetection{Transitions: 3, Window: time.Minute, Dampening: time.Second * 30}
+	defer s.Close()
+
+	var (
+		transitions []tracer.Transition
+		flaps       []tracer.Flap
+	)
+	for topic, run := range map[string]func(interface{}) error{
+		tracer.TopicConnTransition: func(i interface{}) error {
+			transitions = append(transitions, i.(tracer.Transition))
+			return nil
+		},
+		tracer.TopicFlap: func(i interface{}) error {
+			flaps = append(flaps, i.(tracer.Flap))
+			return nil
+		},
+	} {
+		if _, err := s.Tracer.Sub(&pubsub.Command{Topic: topic, Run: run}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Up, tracertest.Down, tracertest.Up)
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.Run(time.Second * 75)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ from, to int }{
+		{tracer.ConnUnknown, tracer.ConnOnline},
+		{tracer.ConnOnline, tracer.ConnOffline},
+		// Held back while flapping, from 20s to 70s.
+		{tracer.ConnOffline, tracer.ConnOnline},
+	}
+	if len(transitions) != len(expected) {
+		t.Fatalf("unexpected transitions: found %v, expected %v", transitions, expected)
+	}
+	for i, tr := range transitions {
+		if tr.From != expected[i].from || tr.To != expected[i].to {
+			t.Fatalf("unexpected transition %d: found %+v, expected %+v", i, tr, expected[i])
+		}
+	}
+	if len(flaps) != 2 || !flaps[0].Flapping || flaps[1].Flapping {
+		t.Fatalf("unexpected flaps: found %+v, expected a start and an end", flaps)
+	}
+	if d := flaps[1].At.Sub(flaps[0].At); d != time.Second*50 {
+		t.Fatalf("unexpected flapping duration: found %v, expected %v", d, time.Second*50)
+	}
+	for _, e := range events {
+		flapping := e.At >= time.Second*20 && e.At < time.Second*70
+		if e.Message.Flapping != flapping {
+			t.Fatalf("unexpected flapping flag at %v: found %v, expected %v", e.At, e.Message.Flapping, flapping)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	s.Tracer.Retries = 2
+	s.Tracer.RetryDelay = time.Second
+	defer s.Close()
+
+	flaky := tracertest.NewPinger("flaky", tracertest.Down, tracertest.Up)
+	down := tracertest.NewPinger("down", tracertest.Down)
+	for _, p := range []*tracertest.Pinger{flaky, down} {
+		if err := s.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := s.Run(time.Second * 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []tracertest.Event{
+		{At: time.Second, Message: tracer.Message{ID: "flaky", Attempts: 2}},
+		{At: time.Second * 2, Message: tracer.Message{ID: "down", Err: tracertest.ErrDown, Attempts: 3}},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected events: found %v, expected %v", events, expected)
+	}
+	for i, e := range events {
+		x := expected[i]
+		if e.At != x.At || e.Message.ID != x.Message.ID || e.Message.Err != x.Message.Err || e.Message.Attempts != x.Message.Attempts {
+			t.Fatalf("unexpected event %d: found %v (attempts %v), expected %v (attempts %v)", i, e, e.Message.Attempts, x, x.Message.Attempts)
+		}
+	}
+	if n := down.Calls(); n != 3 {
+		t.Fatalf("unexpected pings: found %v, expected 3", n)
+	}
+}
+
+func TestCloseCancelsPings(t *testing.T) {
+	tr := tracer.New()
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := []*slowPinger{newSlowPinger("slow1"), newSlowPinger("slow2")}
+	for _, p := range ps {
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range ps {
+		<-p.started
+	}
+
+	tr.Close()
+
+	for _, p := range ps {
+		if n := atomic.LoadInt32(&p.running); n != 0 {
+			t.Fatalf("%v: unexpected pings still running after Close: found %v, expected 0", p.id, n)
+		}
+	}
+
+	n := rec.len()
+	time.Sleep(time.Millisecond * 10)
+	if rec.len() != n {
+		t.Fatalf("unexpected messages after Close: found %v, expected %v", rec.len(), n)
+	}
+}
+
+func TestUntrace(t *testing.T) {
+	tr := tracer.New()
+	tr.PubSub = new(recorder)
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Untrace("fake"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Untrace("fake"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
+
+func TestTraceIfAbsent(t *testing.T) {
+	tr := tracer.New()
+	tr.PubSub = new(recorder)
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	const n = 16
+	var wg sync.WaitGroup
+	var traced, refused int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := tr.TraceIfAbsent(&pg{id: "fake"}); err {
+			case nil:
+				atomic.AddInt32(&traced, 1)
+			case tracer.ErrAlreadyTraced:
+				atomic.AddInt32(&refused, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if traced != 1 || refused != n-1 {
+		t.Fatalf("unexpected outcome: found %d traced and %d refused, expected 1 and %d", traced, refused, n-1)
+	}
+
+	if err := tr.Untrace("fake"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.TraceIfAbsent(&pg{id: "fake"}); err != nil {
+		t.Fatalf("unexpected error: found %v, expected <nil>", err)
+	}
+}
+
+func TestTraceWhileRunning(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.PubSub = new(recorder)
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("fake%v", i)
+			for j := 0; j < 100; j++ {
+				if err := tr.Trace(&pg{id: id}); err != nil {
+					t.Error(err)
+					return
+				}
+				tr.Last(id)
+				if err := tr.Untrace(id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if _, err := tr.Last(fmt.Sprintf("fake%v", i)); err != tracer.ErrNotTraced {
+			t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+		}
+	}
+}
+
+func TestSeq(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"fake1", "fake2"} {
+		if err := tr.Trace(&pg{id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for rec.len() < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	last := make(map[string]uint64)
+	for _, i := range rec.msgs {
+		m := i.(tracer.Message)
+		if m.Seq != last[m.ID]+1 {
+			t.Fatalf("%v: unexpected sequence number: found %v, expected %v", m.ID, m.Seq, last[m.ID]+1)
+		}
+		last[m.ID] = m.Seq
+	}
+}
+
+func TestSkipIfRunning(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Hour
+	tr.SkipIfRunning = true
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := newSlowPinger("slow")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+	time.Sleep(time.Millisecond * 20)
+
+	if n := atomic.LoadInt32(&p.running); n != 1 {
+		t.Fatalf("unexpected running pings: found %v, expected 1", n)
+	}
+	if n := rec.len(); n != 0 {
+		t.Fatalf("unexpected messages: found %v, expected 0", n)
+	}
+
+	close(p.release)
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	m := rec.msgs[0].(tracer.Message)
+	if m.Err != nil {
+		t.Fatal(m.Err)
+	}
+	if m.Skipped == 0 {
+		t.Fatal("refreshes should have been skipped")
+	}
+}
+
+func TestLast(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 10
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if _, err := tr.Last("fake"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := &pg{id: "fake", shouldFail: true}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	m, err := tr.Last("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Err == nil {
+		t.Fatal("last message should carry the ping error")
+	}
+
+	time.Sleep(tr.RefreshRate * 3)
+	if m, _ = tr.Last("fake"); !m.Stale {
+		t.Fatal("last message should be stale")
+	}
+}
+
+func TestTraceImmediate(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Hour
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Trace(&pg{id: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&pg{id: "after"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for rec.len() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected messages: found %v, expected 2", rec.len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	for _, i := range rec.msgs {
+		if m := i.(tracer.Message); !m.Initial {
+			t.Fatalf("%v: first message should be flagged as initial", m.ID)
+		}
+	}
+}
+
+func TestMessageAddr(t *testing.T) {
+	tr := tracer.New()
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	m := rec.msgs[0].(tracer.Message)
+	if m.Addr == nil || m.Addr.String() != "host:port" {
+		t.Fatalf("unexpected address: found %v, expected %v", m.Addr, "host:port")
+	}
+	if m.IP != nil {
+		t.Fatalf("unexpected IP: found %v, expected none", m.IP)
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.GracePeriod = time.Millisecond * 50
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&pg{id: "fake", shouldFail: true}); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	m, err := tr.Last("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Err == nil {
+		t.Fatal("failure should be recorded during the grace period")
+	}
+	if m.State != tracer.ConnUnknown {
+		t.Fatalf("unexpected state: found %v, expected %v", m.State, tracer.ConnUnknown)
+	}
+
+	time.Sleep(tr.GracePeriod * 2)
+	tr.Close()
+
+	if m, _ = tr.Last("fake"); m.State != tracer.ConnOffline {
+		t.Fatalf("unexpected state: found %v, expected %v", m.State, tracer.ConnOffline)
+	}
+}
+
+// flipPinger fails when fail is set.
+type flipPinger struct {
+	pg
+	fail int32
+}
+
+func (p *flipPinger) Ping(ctx context.Context) error {
+	if atomic.LoadInt32(&p.fail) == 1 {
+		return errors.New("should fail")
+	}
+	return nil
+}
+
+func TestThresholds(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.RiseThreshold = 3
+	tr.FallThreshold = 2
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	p := &flipPinger{pg: pg{id: "fake"}}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	atomic.StoreInt32(&p.fail, 1)
+	for n := rec.len(); rec.len() < n+5; {
+		time.Sleep(time.Millisecond)
+	}
+	atomic.StoreInt32(&p.fail, 0)
+	for n := rec.len(); rec.len() < n+5; {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	var rises, falls int
+	state := tracer.ConnUnknown
+	for _, i := range rec.msgs {
+		m := i.(tracer.Message)
+		if m.Err == nil {
+			rises++
+			falls = 0
+		} else {
+			falls++
+			rises = 0
+		}
+		if m.State == state {
+			continue
+		}
+		switch {
+		case state == tracer.ConnUnknown:
+		case m.State == tracer.ConnOnline && rises != tr.RiseThreshold:
+			t.Fatalf("went online after %v successes, expected %v", rises, tr.RiseThreshold)
+		case m.State == tracer.ConnOffline && falls != tr.FallThreshold:
+			t.Fatalf("went offline after %v failures, expected %v", falls, tr.FallThreshold)
+		}
+		state = m.State
+	}
+	if state != tracer.ConnOnline {
+		t.Fatalf("unexpected final state: found %v, expected %v", state, tracer.ConnOnline)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	tr := tracer.New()
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := newSlowPinger("slow")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+	d := time.Millisecond * 10
+	time.Sleep(d)
+	close(p.release)
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	if m := rec.msgs[0].(tracer.Message); m.Latency < d {
+		t.Fatalf("unexpected latency: found %v, expected at least %v", m.Latency, d)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 20
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(newSlowPinger("slow")); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	if err := rec.msgs[0].(tracer.Message).Err; err != tracer.ErrPingTimeout {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrPingTimeout)
+	}
+}
+
+type panicPinger struct {
+	pg
+}
+
+func (p *panicPinger) Ping(ctx context.Context) error {
+	panic("boom")
+}
+
+func TestWithPingTimeout(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Hour
+	tr.PingTimeout = time.Hour
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if err := tr.Trace(newSlowPinger("slow"), tracer.WithPingTimeout(time.Millisecond*10)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOffline(ctx, "slow"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := tr.Last("slow"); m.Err != tracer.ErrPingTimeout {
+		t.Fatalf("unexpected error: found %v, expected %v", m.Err, tracer.ErrPingTimeout)
+	}
+}
+
+func TestPingPanic(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&panicPinger{pg{id: "panic"}}); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	err, ok := rec.msgs[0].(tracer.Message).Err.(*tracer.PanicError)
+	if !ok {
+		t.Fatalf("unexpected error: found %v, expected a panic error", rec.msgs[0].(tracer.Message).Err)
+	}
+	if err.Value != "boom" {
+		t.Fatalf("unexpected panic value: found %v, expected %v", err.Value, "boom")
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 5
+	tr.PingTimeout = time.Hour
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(newSlowPinger("slow")); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	m := rec.msgs[0].(tracer.Message)
+	if !m.Canceled {
+		t.Fatal("message should be flagged as canceled")
+	}
+	if !errors.Is(m.Err, tracer.ErrCanceled) || m.Kind != tracer.KindCanceled {
+		t.Fatalf("unexpected error: found %v (%v), expected %v", m.Err, m.Kind, tracer.ErrCanceled)
+	}
+	if m.State != tracer.ConnUnknown {
+		t.Fatalf("unexpected state: found %v, expected %v", m.State, tracer.ConnUnknown)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	tr := tracer.New()
+	tr.PingTimeout = time.Hour
+	tr.InFlightWatermark = 2
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ps := []*slowPinger{newSlowPinger("slow1"), newSlowPinger("slow2"), newSlowPinger("slow3")}
+	for _, p := range ps {
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+		<-p.started
+	}
+
+	if n := tr.InFlight(); n != len(ps) {
+		t.Fatalf("unexpected pings in flight: found %v, expected %v", n, len(ps))
+	}
+	tr.Close()
+	if n := tr.InFlight(); n != 0 {
+		t.Fatalf("unexpected pings in flight: found %v, expected 0", n)
+	}
+
+	if len(rec.other) != 1 {
+		t.Fatalf("unexpected warnings: found %v, expected 1", len(rec.other))
+	}
+	w := rec.other[0].(tracer.InFlightWarning)
+	if w.InFlight != 3 || w.Watermark != 2 {
+		t.Fatalf("unexpected warning: %+v", w)
+	}
+}
+
+func TestMaxConcurrentPings(t *testing.T) {
+	tr := tracer.New()
+	tr.PingTimeout = time.Hour
+	tr.SkipIfRunning = true
+	tr.MaxConcurrentPings = 2
+	ps := []*slowPinger{newSlowPinger("slow1"), newSlowPinger("slow2"), newSlowPinger("slow3")}
+	for _, p := range ps {
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	running := func() int32 {
+		var n int32
+		for _, p := range ps {
+			n += atomic.LoadInt32(&p.running)
+		}
+		return n
+	}
+	started := func() int {
+		var n int
+		for _, p := range ps {
+			n += len(p.started)
+		}
+		return n
+	}
+	for started() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := running(); n != 2 {
+		t.Fatalf("unexpected pings running: found %v, expected %v", n, 2)
+	}
+
+	// Releasing the pings lets the third one start.
+	for _, p := range ps {
+		close(p.release)
+	}
+	for started() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCloseNeverStarted(t *testing.T) {
+	tr := tracer.New()
+	tr.Close()
+	tr.Close()
+
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Untrace("fake"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	tr := tracer.New()
+	tr.PingTimeout = time.Hour
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := newSlowPinger("slow")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr.Close()
+
+			// Close must not return before the run loop and the
+			// pings are gone.
+			if n := atomic.LoadInt32(&p.running); n != 0 {
+				t.Errorf("unexpected pings still running after Close: found %v, expected 0", n)
+			}
+			if s := tr.Status(); s != tracer.StatusStopped {
+				t.Errorf("unexpected tracer status: found %v, expected %v", s, tracer.StatusStopped)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRestart(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.PingTimeout = time.Second
+	tr.MaxConcurrentPings = 2
+	rec := new(recorder)
+	tr.PubSub = rec
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := tr.Run(); err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+		if err := tr.Run(); err == nil {
+			t.Fatalf("run %v: unexpected nil error running twice", i)
+		}
+		n := rec.len()
+		for rec.len() < n+3 {
+			time.Sleep(time.Millisecond)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tr.Close()
+			}()
+		}
+		wg.Wait()
+		if s := tr.Status(); s != tracer.StatusStopped {
+			t.Fatalf("run %v: unexpected tracer status: found %v, expected %v", i, s, tracer.StatusStopped)
+		}
+		n = rec.len()
+		time.Sleep(time.Millisecond * 10)
+		if rec.len() != n {
+			t.Fatalf("run %v: unexpected messages after Close: found %v, expected %v", i, rec.len(), n)
+		}
+	}
+}
+
+func TestRestartAfterShutdown(t *testing.T) {
+	tr := tracer.New()
+	tr.PingTimeout = time.Hour
+	tr.SkipIfRunning = true
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := stubbornPinger{newSlowPinger("stubborn")}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := tr.Shutdown(ctx); err == nil {
+		t.Fatal("unexpected nil error: the ping is still running")
+	}
+
+	// The ping of the previous run returns while the tracer is running
+	// again: its outcome belongs to a closed run and is discarded.
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	time.Sleep(time.Millisecond * 10) // the new run skips the target
+	n := rec.len()
+	close(p.release)
+	for atomic.LoadInt32(&p.running) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if rec.len() != n {
+		t.Fatalf("unexpected messages from the previous run: found %v, expected %v", rec.len(), n)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tr := tracer.New()
+	tr.PubSub = new(recorder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := tr.RunContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p := newSlowPinger("slow")
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+
+	cancel()
+	sctx, scancel := context.WithTimeout(context.Background(), time.Second)
+	defer scancel()
+	if err := tr.Shutdown(sctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := tr.Status(); s != tracer.StatusStopped {
+		t.Fatalf("unexpected tracer status: found %v, expected %v", s, tracer.StatusStopped)
+	}
+	if n := atomic.LoadInt32(&p.running); n != 0 {
+		t.Fatalf("unexpected pings still running after Shutdown: found %v, expected 0", n)
+	}
+}
+
+// stubbornPinger is a slowPinger that ignores the cancellation of its
+// context.
+type stubbornPinger struct {
+	*slowPinger
+}
+
+func (p stubbornPinger) Ping(ctx context.Context) error {
+	return p.slowPinger.Ping(context.Background())
+}
+
+func TestShutdown(t *testing.T) {
+	tr := tracer.New()
+	tr.PingTimeout = time.Hour
+	tr.PubSub = new(recorder)
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	p := stubbornPinger{newSlowPinger("stubborn")}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tr.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: found %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if s := tr.Status(); s != tracer.StatusStopped {
+		t.Fatalf("unexpected tracer status: found %v, expected %v", s, tracer.StatusStopped)
+	}
+
+	close(p.release)
+	tr.Close()
+	if n := atomic.LoadInt32(&p.running); n != 0 {
+		t.Fatalf("unexpected pings still running after Close: found %v, expected 0", n)
+	}
+}
+
+// addrPinger has a configurable address.
+type addrPinger struct {
+	pg
+	addr net.Addr
+}
+
+func (p *addrPinger) Addr() net.Addr {
+	return p.addr
+}
+
+func TestTraceValidation(t *testing.T) {
+	tr := tracer.New()
+	tr.ValidateAddr = true
+
+	if err := tr.Trace(&pg{}); err != tracer.ErrEmptyID {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrEmptyID)
+	}
+	if err := tr.Trace(&addrPinger{pg: pg{id: "fake"}}); err != tracer.ErrNilAddr {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNilAddr)
+	}
+	if err := tr.Trace(&pg{id: "fake"}); !errors.Is(err, tracer.ErrInvalidAddr) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrInvalidAddr)
+	}
+
+	tcp := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}
+	if err := tr.Trace(&addrPinger{pg: pg{id: "fake"}, addr: tcp}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshCoalescing(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Hour
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Trace(&pg{id: "keep"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("fake%d", i)
+		if err := tr.Trace(&pg{id: ids[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range ids {
+		if err := tr.Untrace(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(tr.CoalesceWindow * 3)
+	tr.Close()
+
+	var n int
+	for _, i := range rec.msgs {
+		if i.(tracer.Message).ID == "keep" {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Fatalf("unexpected messages: found %v, expected 2", n)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.Chaos = &tracer.Chaos{FailRate: 0.5, Rand: rand.New(rand.NewSource(1))}
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Trace(&pg{id: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	var injected int
+	for _, i := range rec.msgs {
+		m := i.(tracer.Message)
+		switch {
+		case m.Chaos && m.Err != tracer.ErrChaos:
+			t.Fatalf("unexpected error: found %v, expected %v", m.Err, tracer.ErrChaos)
+		case !m.Chaos && m.Err != nil:
+			t.Fatalf("unexpected error: %v", m.Err)
+		case m.Chaos:
+			injected++
+		}
+	}
+	if injected == 0 || injected == len(rec.msgs) {
+		t.Fatalf("unexpected injected failures: found %v out of %v", injected, len(rec.msgs))
+	}
+}
+
+// detailPinger is a pg returning its ID length as details.
+type detailPinger struct {
+	pg
+}
+
+func (p *detailPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	return len(p.id), p.Ping(ctx)
+}
+
+func TestDetails(t *testing.T) {
+	tr := tracer.New()
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&detailPinger{pg{id: "fake"}}); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	m := rec.msgs[0].(tracer.Message)
+	if n, ok := tracer.DetailsAs[int](m); !ok || n != 4 {
+		t.Fatalf("unexpected details: found %v, expected %v", m.Details, 4)
+	}
+	if _, ok := tracer.DetailsAs[string](m); ok {
+		t.Fatal("details should not be a string")
+	}
+}
+
+func TestBlackout(t *testing.T) {
+	always, err := tracer.ParseCron("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.Blackouts = []*tracer.Blackout{{Schedule: always, Duration: time.Hour, IDs: []string{"fake"}}}
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	if err := tr.Trace(&pg{id: "fake", shouldFail: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(&pg{id: "other", shouldFail: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	for _, i := range rec.msgs {
+		m := i.(tracer.Message)
+		switch {
+		case m.ID == "fake" && (!m.Downtime || m.State != tracer.ConnUnknown):
+			t.Fatalf("unexpected message during blackout: %+v", m)
+		case m.ID == "other" && (m.Downtime || m.State != tracer.ConnOffline):
+			t.Fatalf("unexpected message outside blackout: %+v", m)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	always, err := tracer.ParseCron("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.FallThreshold = 1000
+	tr.Profiles = []*tracer.Profile{{
+		Name:          "relaxed",
+		Schedule:      always,
+		Duration:      time.Hour,
+		IDs:           []string{"relaxed"},
+		Interval:      time.Hour,
+		FallThreshold: 1,
+	}}
+	rec := new(recorder)
+	tr.PubSub = rec
+
+	for _, id := range []string{"relaxed", "other"} {
+		if err := tr.Trace(&pg{id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for rec.len() < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	tr.Close()
+
+	var relaxed int
+	for _, i := range rec.msgs {
+		if i.(tracer.Message).ID == "relaxed" {
+			relaxed++
+		}
+	}
+	if relaxed != 1 {
+		t.Fatalf("unexpected pings of the relaxed target: found %v, expected 1", relaxed)
+	}
+	// Checked on the schedule of its profile, the target is not stale.
+	if m, err := tr.Last("relaxed"); err != nil || m.Stale {
+		t.Fatalf("unexpected last message: found %+v (%v), expected a fresh one", m, err)
+	}
+
+	// Thresholds of the profile replace the ones of the tracer.
+	tr = tracer.New()
+	tr.RefreshRate = time.Millisecond
+	tr.FallThreshold = 1000
+	tr.Profiles = []*tracer.Profile{{Schedule: always, Duration: time.Hour, FallThreshold: 2}}
+	p := &flipPinger{pg: pg{id: "fake"}}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOnline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&p.fail, 1)
+	if err := tr.WaitUntilOffline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckNow(t *testing.T) {
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Minute
+	defer s.Close()
+
+	if err := s.Tracer.CheckNow("db"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+	p := tracertest.NewPinger("db", tracertest.Up, tracertest.Down)
+	if err := s.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tracer.CheckNow("db"); err != tracer.ErrNotRunning {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotRunning)
+	}
+	if _, err := s.Run(time.Second * 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tracer.CheckNow("db"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.Run(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Message.Err == nil || events[0].At != time.Second*10 {
+		t.Fatalf("unexpected events: found %+v, expected a single failure at 10s", events)
+	}
+}
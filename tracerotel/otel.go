@@ -0,0 +1,173 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package tracerotel exports the pings and the state transitions of a
+// tracer.Tracer to OpenTelemetry: each ping becomes a span, and
+// transitions are recorded by metric instruments.
+//
+//	t := tracer.New(tracerotel.WithTelemetry(tp, mp))
+package tracerotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// ScopeName is the name of the instrumentation scope of the spans and
+// the instruments.
+const ScopeName = "github.com/tecnoporto/tracer"
+
+// Attribute keys of the spans and the measurements.
+const (
+	TargetIDKey   = attribute.Key("tracer.target.id")
+	TargetAddrKey = attribute.Key("tracer.target.addr")
+	ProtocolKey   = attribute.Key("network.transport")
+	OutcomeKey    = attribute.Key("tracer.ping.outcome")
+	LatencyKey    = attribute.Key("tracer.ping.latency")
+	AttemptsKey   = attribute.Key("tracer.ping.attempts")
+	StateKey      = attribute.Key("tracer.target.state")
+	FromKey       = attribute.Key("tracer.transition.from")
+	ToKey         = attribute.Key("tracer.transition.to")
+)
+
+type telemetry struct {
+	tracer      trace.Tracer
+	pings       metric.Float64Histogram
+	transitions metric.Int64Counter
+	durations   metric.Float64Histogram
+}
+
+// WithTelemetry makes the tracer create a span with tp for each ping, and
+// record with mp:
+//
+//	tracer.ping.duration      histogram of the latency of the pings, in seconds
+//	tracer.transitions        counter of the state transitions
+//	tracer.state.duration     histogram of the time spent in a state before leaving it, in seconds
+//
+// Either provider may be nil to disable spans or metrics. Errors creating
+// the instruments are reported to otel.Handle.
+func WithTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) tracer.TracerOption {
+	return func(t *tracer.Tracer) {
+		t.Instrumentation = NewInstrumentation(tp, mp)
+	}
+}
+
+// NewInstrumentation returns the tracer.Instrumentation installed by
+// WithTelemetry, for tracers that are already created.
+func NewInstrumentation(tp trace.TracerProvider, mp metric.MeterProvider) tracer.Instrumentation {
+	if tp == nil {
+		tp = tracenoop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+	meter := mp.Meter(ScopeName)
+	t := &telemetry{tracer: tp.Tracer(ScopeName)}
+
+	var err error
+	if t.pings, err = meter.Float64Histogram("tracer.ping.duration",
+		metric.WithDescription("Latency of the pings of the targets."),
+		metric.WithUnit("s"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if t.transitions, err = meter.Int64Counter("tracer.transitions",
+		metric.WithDescription("State transitions of the targets."),
+		metric.WithUnit("{transition}"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if t.durations, err = meter.Float64Histogram("tracer.state.duration",
+		metric.WithDescription("Time spent by the targets in a state before leaving it."),
+		metric.WithUnit("s"),
+	); err != nil {
+		otel.Handle(err)
+	}
+	return t
+}
+
+// StartPing starts the span of a ping of p, ended with the resulting
+// Message.
+func (t *telemetry) StartPing(ctx context.Context, p tracer.Pinger) (context.Context, func(tracer.Message)) {
+	attrs := []attribute.KeyValue{TargetIDKey.String(p.ID())}
+	if addr := p.Addr(); addr != nil {
+		attrs = append(attrs, TargetAddrKey.String(addr.String()), ProtocolKey.String(addr.Network()))
+	}
+	ctx, span := t.tracer.Start(ctx, "tracer.ping",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, func(m tracer.Message) {
+		span.SetAttributes(
+			OutcomeKey.String(outcome(m)),
+			LatencyKey.Float64(m.Latency.Seconds()),
+			AttemptsKey.Int(m.Attempts),
+			StateKey.String(tracer.StateString(m.State)),
+		)
+		if m.Err != nil && !m.Canceled {
+			span.RecordError(m.Err)
+			span.SetStatus(codes.Error, m.Err.Error())
+		}
+		span.End()
+
+		if !m.Canceled {
+			t.pings.Record(ctx, m.Latency.Seconds(), metric.WithAttributes(
+				TargetIDKey.String(m.ID),
+				OutcomeKey.String(outcome(m)),
+			))
+		}
+	}
+}
+
+// Transition counts tr and records the time spent in its From state.
+func (t *telemetry) Transition(tr tracer.Transition) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(
+		TargetIDKey.String(tr.ID),
+		FromKey.String(tracer.StateString(tr.From)),
+		ToKey.String(tracer.StateString(tr.To)),
+	)
+	t.transitions.Add(ctx, 1, attrs)
+	if tr.Duration > 0 {
+		t.durations.Record(ctx, tr.Duration.Seconds(), attrs)
+	}
+}
+
+// outcome is "success" for successful pings, the Kind of the error
+// otherwise.
+func outcome(m tracer.Message) string {
+	if m.Err == nil {
+		return "success"
+	}
+	return m.Kind.String()
+}
@@ -0,0 +1,250 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoRoute is returned by GatewayPinger when a route it expects is
+// missing from the routing table.
+var ErrNoRoute = errors.New("traceroute: no route")
+
+// GatewayError is returned by GatewayPinger when a gateway does not
+// answer.
+type GatewayError struct {
+	Addr net.IP
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("traceroute: gateway %v unreachable", e.Addr)
+}
+
+// Route is an entry of the routing table of the host.
+type Route struct {
+	Dst     *net.IPNet
+	Gateway net.IP // nil for directly connected networks
+	Iface   string
+	Metric  int
+}
+
+// Default reports whether r is a default route.
+func (r Route) Default() bool {
+	ones, _ := r.Dst.Mask.Size()
+	return ones == 0
+}
+
+// Routes returns the IPv4 and IPv6 routes of the main routing table of
+// the host, sorted by metric.
+func Routes() ([]Route, error) {
+	routes, err := routes()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Metric < routes[j].Metric
+	})
+	return routes, nil
+}
+
+// GatewayOptions configure a GatewayPinger.
+type GatewayOptions struct {
+	// NextHops are gateways checked besides the one of the default
+	// route, e.g. the routers of VPNs or of static routes.
+	NextHops []net.IP
+
+	// Routes are destinations the routing table must have a route to,
+	// with that exact prefix, e.g. 10.0.0.0/8 for a VPN.
+	Routes []*net.IPNet
+
+	// NoDefault disables the check of the default route, for hosts
+	// that are not supposed to have one.
+	NoDefault bool
+
+	// Timeout is how long each gateway is waited for, one second when
+	// zero.
+	Timeout time.Duration
+}
+
+// GatewayStatus is the outcome of the check of a gateway.
+type GatewayStatus struct {
+	Addr  net.IP
+	Iface string // empty when no route tells
+
+	// Reachable is set when the gateway answered an ICMP echo request
+	// or, failing that, when its hardware address was resolved through
+	// ARP, which routers that drop pings still answer.
+	Reachable bool
+	Method    string           // "icmp" or "arp"
+	MAC       net.HardwareAddr // set when resolved through ARP
+	RTT       time.Duration    // set when answered through ICMP
+}
+
+// GatewayPinger is a tracer.Pinger checking the connectivity of the host
+// it runs on: the default route and the Routes configured must exist and
+// their gateways, along with the NextHops configured, must answer. When
+// every target goes offline at once, a failing GatewayPinger attributes
+// the outage to the probe host rather than to the targets, see
+// tracer.Tracer.DependsOn. The []GatewayStatus of the gateways checked
+// are returned as details of each ping, see tracer.DetailPinger.
+// Only Linux is supported.
+type GatewayPinger struct {
+	opts GatewayOptions
+
+	mu   sync.Mutex
+	addr net.IP // first gateway checked by the last ping
+}
+
+// NewGatewayPinger returns a GatewayPinger. Its ID is "gateway".
+func NewGatewayPinger(opts GatewayOptions) *GatewayPinger {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	return &GatewayPinger{opts: opts}
+}
+
+// ID implements tracer.Pinger.
+func (p *GatewayPinger) ID() string {
+	return "gateway"
+}
+
+// Addr implements tracer.Pinger, returning the address of the first
+// gateway checked by the last ping.
+func (p *GatewayPinger) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &net.IPAddr{IP: p.addr}
+}
+
+// Ping implements tracer.Pinger.
+func (p *GatewayPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements tracer.DetailPinger.
+func (p *GatewayPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	routes, err := Routes()
+	if err != nil {
+		return nil, err
+	}
+
+	var gateways []GatewayStatus
+	add := func(ip net.IP, iface string) {
+		for _, g := range gateways {
+			if g.Addr.Equal(ip) {
+				return
+			}
+		}
+		gateways = append(gateways, GatewayStatus{Addr: ip, Iface: iface})
+	}
+	if !p.opts.NoDefault {
+		found := false
+		for _, r := range routes {
+			if r.Default() && r.Gateway != nil {
+				add(r.Gateway, r.Iface)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: missing default route", ErrNoRoute)
+		}
+	}
+	for _, dst := range p.opts.Routes {
+		if !hasRoute(routes, dst) {
+			return nil, fmt.Errorf("%w to %v", ErrNoRoute, dst)
+		}
+	}
+	for _, ip := range p.opts.NextHops {
+		iface := ""
+		for _, r := range routes {
+			if r.Gateway == nil && r.Dst.Contains(ip) {
+				iface = r.Iface
+				break
+			}
+		}
+		add(ip, iface)
+	}
+
+	if len(gateways) > 0 {
+		p.mu.Lock()
+		p.addr = gateways[0].Addr
+		p.mu.Unlock()
+	}
+	for i := range gateways {
+		g := &gateways[i]
+		if err := p.check(ctx, g); err != nil {
+			return gateways, err
+		}
+		if !g.Reachable {
+			return gateways, &GatewayError{Addr: g.Addr}
+		}
+	}
+	return gateways, nil
+}
+
+// check probes g through ICMP first and ARP then.
+func (p *GatewayPinger) check(ctx context.Context, g *GatewayStatus) error {
+	hop, err := probe(ctx, g.Addr, 64, Options{Mode: ICMP, Timeout: p.opts.Timeout})
+	if err == nil && hop.Reached {
+		g.Reachable, g.Method, g.RTT = true, "icmp", hop.RTT
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if g.Addr.To4() == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+	mac, err := neighbor(ctx, g.Addr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	g.Reachable, g.Method, g.MAC = true, "arp", mac
+	return nil
+}
+
+// hasRoute reports whether routes has a route to exactly dst.
+func hasRoute(routes []Route, dst *net.IPNet) bool {
+	for _, r := range routes {
+		if r.Dst.IP.Equal(dst.IP) && r.Dst.Mask.String() == dst.Mask.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// routes reads the routing tables from /proc.
+func routes() ([]Route, error) {
+	v4, err := readProc("/proc/net/route", parseRoute4)
+	if err != nil {
+		return nil, err
+	}
+	v6, err := readProc("/proc/net/ipv6_route", parseRoute6)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return append(v4, v6...), nil
+}
+
+// readProc parses the lines of the table at path with parse, which
+// returns false for the lines to skip.
+func readProc(path string, parse func(fields []string) (Route, bool, error)) ([]Route, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var routes []Route
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		r, ok, err := parse(strings.Fields(s.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("traceroute: %v: %v", path, err)
+		}
+		if ok {
+			routes = append(routes, r)
+		}
+	}
+	return routes, s.Err()
+}
+
+// parseRoute4 parses a line of /proc/net/route: Iface, Destination,
+// Gateway, Flags, RefCnt, Use, Metric, Mask and more, addresses being
+// hexadecimal in host byte order.
+func parseRoute4(fields []string) (Route, bool, error) {
+	const rtfUp = 0x1
+	if len(fields) < 8 || fields[0] == "Iface" {
+		return Route{}, false, nil
+	}
+	var v [4]uint32
+	for i, f := range []string{fields[1], fields[2], fields[3], fields[7]} {
+		n, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return Route{}, false, err
+		}
+		v[i] = uint32(n)
+	}
+	metric, err := strconv.Atoi(fields[6])
+	if err != nil {
+		return Route{}, false, err
+	}
+	if v[2]&rtfUp == 0 {
+		return Route{}, false, nil
+	}
+	ip := func(n uint32) net.IP {
+		b := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(b, n)
+		return b
+	}
+	r := Route{
+		Dst:    &net.IPNet{IP: ip(v[0]), Mask: net.IPMask(ip(v[3]))},
+		Iface:  fields[0],
+		Metric: metric,
+	}
+	if v[1] != 0 {
+		r.Gateway = ip(v[1])
+	}
+	return r, true, nil
+}
+
+// parseRoute6 parses a line of /proc/net/ipv6_route: destination,
+// prefix length, source, source prefix length, next hop, metric, RefCnt,
+// Use, flags and device, in hexadecimal.
+func parseRoute6(fields []string) (Route, bool, error) {
+	const rtfUp = 0x1
+	if len(fields) < 10 {
+		return Route{}, false, nil
+	}
+	dst, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return Route{}, false, err
+	}
+	gw, err := hex.DecodeString(fields[4])
+	if err != nil {
+		return Route{}, false, err
+	}
+	var v [3]uint64
+	for i, f := range []string{fields[1], fields[5], fields[8]} {
+		if v[i], err = strconv.ParseUint(f, 16, 32); err != nil {
+			return Route{}, false, err
+		}
+	}
+	if len(dst) != net.IPv6len || len(gw) != net.IPv6len || v[2]&rtfUp == 0 || fields[9] == "lo" {
+		return Route{}, false, nil
+	}
+	r := Route{
+		Dst:    &net.IPNet{IP: dst, Mask: net.CIDRMask(int(v[0]), 128)},
+		Iface:  fields[9],
+		Metric: int(v[1]),
+	}
+	if !net.IP(gw).IsUnspecified() {
+		r.Gateway = gw
+	}
+	return r, true, nil
+}
+
+// neighbor resolves the hardware address of ip, sending it a datagram to
+// make the kernel resolve it if it is not in the ARP table already, and
+// waiting for the entry to complete.
+func neighbor(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", net.JoinHostPort(ip.String(), "9"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for {
+		mac, err := arpEntry(ip)
+		if mac != nil || err != nil {
+			return mac, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// arpEntry returns the hardware address of ip in the ARP table, nil if
+// the entry is missing or incomplete.
+func arpEntry(ip net.IP) (net.HardwareAddr, error) {
+	const atfCom = 0x2 // completed entry
+	b, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !ip.Equal(net.ParseIP(fields[0])) {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || flags&atfCom == 0 {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		return mac, nil
+	}
+	return nil, nil
+}
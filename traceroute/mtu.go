@@ -0,0 +1,178 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MTUError is returned by MTUPinger when the path MTU is lower than the
+// minimum configured.
+type MTUError struct {
+	MTU int
+	Min int
+}
+
+func (e *MTUError) Error() string {
+	return fmt.Sprintf("traceroute: path MTU %d below %d", e.MTU, e.Min)
+}
+
+// MTUOptions configure an MTUPinger.
+type MTUOptions struct {
+	// Min is the lowest acceptable path MTU, pings fail with an
+	// *MTUError below it.
+	Min int
+
+	// Max is the largest MTU probed, 1500 when zero.
+	Max int
+
+	// Port is the UDP port probes are sent to, 33434 when zero. The
+	// destination is expected to answer with a port unreachable error,
+	// hence the port should be closed.
+	Port int
+
+	// Timeout is how long the answer to each probe is waited for, one
+	// second when zero. Probes that get no answer are considered too
+	// big, as tunnels that black-hole large packets are what the check
+	// is for.
+	Timeout time.Duration
+}
+
+// MTUPinger is a tracer.Pinger verifying the path MTU to a host by
+// sending UDP probes of different sizes with the don't fragment bit set,
+// catching VPN and tunnel misconfigurations that break large packets.
+// The path MTU found is returned as an int in the details of each ping,
+// see tracer.DetailPinger.
+type MTUPinger struct {
+	host string
+	opts MTUOptions
+}
+
+// NewMTUPinger returns an MTUPinger probing the path to host, an IP
+// address or a name to resolve. Its ID is "mtu://" followed by host.
+func NewMTUPinger(host string, opts MTUOptions) *MTUPinger {
+	if opts.Max <= 0 {
+		opts.Max = 1500
+	}
+	if opts.Port == 0 {
+		opts.Port = 33434
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	return &MTUPinger{host: host, opts: opts}
+}
+
+// ID implements tracer.Pinger.
+func (p *MTUPinger) ID() string {
+	return "mtu://" + p.host
+}
+
+// Addr implements tracer.Pinger.
+func (p *MTUPinger) Addr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP(p.host), Port: p.opts.Port}
+}
+
+// Ping implements tracer.Pinger.
+func (p *MTUPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements tracer.DetailPinger.
+func (p *MTUPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	mtu, err := PathMTU(ctx, p.host, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	if mtu < p.opts.Min {
+		return mtu, &MTUError{MTU: mtu, Min: p.opts.Min}
+	}
+	return mtu, nil
+}
+
+// PathMTU returns the largest packet size, up to opts.Max, that reaches
+// host without being fragmented.
+func PathMTU(ctx context.Context, host string, opts MTUOptions) (int, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return 0, err
+	}
+	dst := ips[0]
+	if opts.Max <= 0 {
+		opts.Max = 1500
+	}
+	if opts.Port == 0 {
+		opts.Port = 33434
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	c, err := newMTUProber(dst, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	// The smallest MTU every IPv4 and IPv6 link supports has to get
+	// through, or the destination is not answering at all.
+	lo := 576
+	if dst.To4() == nil {
+		lo = 1280
+	}
+	if lo > opts.Max {
+		lo = opts.Max
+	}
+	ok, _, err := c.probe(ctx, lo)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("traceroute: no answer from %v", dst)
+	}
+
+	// Binary search of the largest size that fits in [lo, hi].
+	hi := opts.Max
+	for lo < hi {
+		size := (lo + hi + 1) / 2
+		ok, hint, err := c.probe(ctx, size)
+		switch {
+		case err != nil:
+			return 0, err
+		case ok:
+			lo = size
+		case hint >= lo && hint < size:
+			// The router told us the MTU of the next hop.
+			hi = hint
+		default:
+			hi = size - 1
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,163 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Values of IP_MTU_DISCOVER and IPV6_MTU_DISCOVER that set the don't
+// fragment bit ignoring the path MTU cached by the kernel.
+const (
+	ipPMTUDiscProbe   = 3
+	ipv6PMTUDiscProbe = 3
+)
+
+// mtuProber sends probes of a given size to a destination.
+type mtuProber struct {
+	conn   *net.UDPConn
+	dst    *net.UDPAddr
+	header int // size of the IP and UDP headers
+	opts   MTUOptions
+}
+
+func newMTUProber(dst net.IP, opts MTUOptions) (*mtuProber, error) {
+	v4 := dst.To4() != nil
+	network, laddr, header := "udp4", "0.0.0.0:0", 28
+	if !v4 {
+		network, laddr, header = "udp6", "[::]:0", 48
+	}
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				level, discOpt, disc, errOpt := syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, ipPMTUDiscProbe, syscall.IP_RECVERR
+				if !v4 {
+					level, discOpt, disc, errOpt = syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, ipv6PMTUDiscProbe, syscall.IPV6_RECVERR
+				}
+				if err = syscall.SetsockoptInt(int(fd), level, discOpt, disc); err != nil {
+					return
+				}
+				err = syscall.SetsockoptInt(int(fd), level, errOpt, 1)
+			}); cerr != nil {
+				return cerr
+			}
+			return os.NewSyscallError("setsockopt", err)
+		},
+	}
+	c, err := lc.ListenPacket(context.Background(), network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &mtuProber{
+		conn:   c.(*net.UDPConn),
+		dst:    &net.UDPAddr{IP: dst, Port: opts.Port},
+		header: header,
+		opts:   opts,
+	}, nil
+}
+
+func (c *mtuProber) Close() error {
+	return c.conn.Close()
+}
+
+// probe sends a packet of size bytes, reporting whether it reached the
+// destination and, if not, the MTU of the next hop when known.
+func (c *mtuProber) probe(ctx context.Context, size int) (bool, int, error) {
+	rc, err := c.conn.SyscallConn()
+	if err != nil {
+		return false, 0, err
+	}
+	buf, oob := make([]byte, 64), make([]byte, 512)
+	readErr := func(fd uintptr) (recvErr, bool) {
+		for {
+			_, oobn, _, _, err := syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE)
+			if err != nil {
+				return recvErr{}, false
+			}
+			if e, ok := parseRecvErr(oob[:oobn]); ok {
+				return e, true
+			}
+		}
+	}
+	// Errors caused by earlier probes that arrived too late.
+	rc.Control(func(fd uintptr) {
+		for {
+			if _, ok := readErr(fd); !ok {
+				return
+			}
+		}
+	})
+
+	payload := make([]byte, size-c.header)
+	for i := 0; ; i++ {
+		_, err = c.conn.WriteToUDP(payload, c.dst)
+		if errors.Is(err, syscall.ECONNREFUSED) && i == 0 {
+			// Pending error of an earlier probe.
+			continue
+		}
+		break
+	}
+	if errors.Is(err, syscall.EMSGSIZE) {
+		// Larger than the MTU of the local interface.
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetReadDeadline(deadline)
+	var fits bool
+	var hint int
+	err = rc.Read(func(fd uintptr) bool {
+		e, ok := readErr(fd)
+		if !ok {
+			return false
+		}
+		switch {
+		case e.errno == syscall.EMSGSIZE:
+			hint = int(e.info)
+		case e.portUnreachable() && e.offender.Equal(c.dst.IP):
+			fits = true
+		}
+		return true
+	})
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false, 0, err
+	}
+	if ctx.Err() != nil {
+		return false, 0, ctx.Err()
+	}
+	return fits, hint, nil
+}
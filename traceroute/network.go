@@ -0,0 +1,80 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// WatchNetwork reports the condition of the local network to t every
+// interval, see tracer.Tracer.SetNetwork: the network is up while a
+// default route goes through an interface that is up. metered, when not
+// nil, tells whether the connectivity through an interface is metered,
+// e.g. by matching the names of cellular modems.
+// Returns when ctx is done, right away with ErrUnsupported where the
+// routing table cannot be read.
+func WatchNetwork(ctx context.Context, t *tracer.Tracer, interval time.Duration, metered func(iface string) bool) error {
+	if _, err := Routes(); err != nil {
+		return err
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		t.SetNetwork(networkCondition(metered))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+func networkCondition(metered func(iface string) bool) tracer.NetworkCondition {
+	routes, err := Routes()
+	if err != nil {
+		return tracer.NetworkCondition{Reason: err.Error()}
+	}
+	reason := "default route lost"
+	for _, r := range routes {
+		if !r.Default() {
+			continue
+		}
+		ifi, err := net.InterfaceByName(r.Iface)
+		if err != nil || ifi.Flags&net.FlagUp == 0 {
+			reason = "interface " + r.Iface + " down"
+			continue
+		}
+		return tracer.NetworkCondition{
+			Up:      true,
+			Metered: metered != nil && metered(r.Iface),
+			Reason:  "default route through " + r.Iface,
+		}
+	}
+	return tracer.NetworkCondition{Reason: reason}
+}
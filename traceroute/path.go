@@ -0,0 +1,165 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// HopStats are the statistics of the probes sent to a hop of a path.
+type HopStats struct {
+	TTL  int
+	Addr net.IP // last address that answered
+
+	Sent     int
+	Received int
+
+	Last, Best, Worst, Avg time.Duration
+}
+
+// Loss returns the fraction of probes that got no answer.
+func (s HopStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+func (s HopStats) String() string {
+	addr := "?"
+	if s.Addr != nil {
+		addr = s.Addr.String()
+	}
+	return fmt.Sprintf("%2d  %-15v  loss %5.1f%%  sent %d  last %v  avg %v  best %v  worst %v",
+		s.TTL, addr, s.Loss()*100, s.Sent, s.Last, s.Avg, s.Best, s.Worst)
+}
+
+func (s *HopStats) add(h Hop) {
+	s.Sent++
+	if h.RTT == 0 {
+		return
+	}
+	if h.Addr != nil {
+		s.Addr = h.Addr
+	}
+	s.Received++
+	s.Last = h.RTT
+	if s.Best == 0 || h.RTT < s.Best {
+		s.Best = h.RTT
+	}
+	if h.RTT > s.Worst {
+		s.Worst = h.RTT
+	}
+	s.Avg += (h.RTT - s.Avg) / time.Duration(s.Received)
+}
+
+// PathPinger is a tracer.Pinger monitoring the path to a host in the
+// style of mtr: each ping probes every hop of the path once, accumulating
+// per hop loss and latency statistics. Pings fail when the destination
+// is not reached. The statistics are returned as details of each ping, see
+// tracer.DetailPinger, hence they reach the subscribers of the tracer and
+// the exporters built on top of them.
+type PathPinger struct {
+	host string
+	id   string
+	opts Options
+
+	mu    sync.Mutex
+	stats []HopStats
+	dst   net.IP // last destination address
+}
+
+// NewPathPinger returns a PathPinger monitoring the path to host, whose
+// ID is "path://" followed by host.
+func NewPathPinger(host string, opts Options) *PathPinger {
+	return &PathPinger{host: host, id: "path://" + host, opts: opts.withDefaults()}
+}
+
+// ID implements tracer.Pinger.
+func (p *PathPinger) ID() string {
+	return p.id
+}
+
+// Addr implements tracer.Pinger.
+func (p *PathPinger) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dst != nil {
+		return &net.IPAddr{IP: p.dst}
+	}
+	return &net.IPAddr{IP: net.ParseIP(p.host)}
+}
+
+// Ping implements tracer.Pinger.
+func (p *PathPinger) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements tracer.DetailPinger, returning the statistics
+// of the path as a []HopStats.
+func (p *PathPinger) PingDetails(ctx context.Context) (interface{}, error) {
+	hops, err := Run(ctx, p.host, p.opts)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(hops) > len(p.stats) {
+		p.stats = append(p.stats, make([]HopStats, len(hops)-len(p.stats))...)
+	}
+	var reached bool
+	for i, h := range hops {
+		p.stats[i].TTL = h.TTL
+		p.stats[i].add(h)
+		if h.Reached {
+			reached = true
+			p.dst = h.Addr
+		}
+	}
+	if reached {
+		// The path got shorter, hops past the destination are gone.
+		p.stats = p.stats[:len(hops)]
+	}
+	stats := append([]HopStats(nil), p.stats...)
+
+	switch {
+	case err != nil:
+		return stats, err
+	case !reached:
+		return stats, fmt.Errorf("traceroute: %v not reached in %d hops", p.host, len(hops))
+	}
+	return stats, nil
+}
+
+// Stats returns the statistics of the hops of the path, by TTL.
+func (p *PathPinger) Stats() []HopStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]HopStats(nil), p.stats...)
+}
@@ -0,0 +1,264 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ICMP types of interest.
+const (
+	icmpEchoReply       = 0
+	icmpUnreachable     = 3
+	icmpEcho            = 8
+	icmpTimeExceeded    = 11
+	icmpv6Unreachable   = 1
+	icmpv6TimeExceeded  = 3
+	icmpv6Echo          = 128
+	icmpv6EchoReply     = 129
+	soEeOriginICMP      = 2
+	soEeOriginICMP6     = 3
+	sockExtendedErrSize = 16
+)
+
+func probe(ctx context.Context, dst net.IP, ttl int, opts Options) (Hop, error) {
+	switch opts.Mode {
+	case UDP, ICMP:
+		return probeDatagram(ctx, dst, ttl, opts)
+	case TCP:
+		return probeTCP(ctx, dst, ttl, opts)
+	default:
+		return Hop{}, fmt.Errorf("%w mode %v", ErrUnsupported, opts.Mode)
+	}
+}
+
+// setsockopts sets the TTL of the packets sent through fd and asks the
+// kernel to queue the ICMP errors they cause.
+func setsockopts(fd uintptr, v4 bool, ttl int) error {
+	level, ttlOpt, errOpt := syscall.IPPROTO_IP, syscall.IP_TTL, syscall.IP_RECVERR
+	if !v4 {
+		level, ttlOpt, errOpt = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, syscall.IPV6_RECVERR
+	}
+	if err := syscall.SetsockoptInt(int(fd), level, ttlOpt, ttl); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(int(fd), level, errOpt, 1))
+}
+
+// probeDatagram sends a UDP datagram or an ICMP echo request to dst,
+// reading the ICMP error it causes from the error queue of the socket.
+func probeDatagram(ctx context.Context, dst net.IP, ttl int, opts Options) (Hop, error) {
+	v4 := dst.To4() != nil
+	family, proto := syscall.AF_INET, syscall.IPPROTO_UDP
+	switch {
+	case !v4 && opts.Mode == ICMP:
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	case !v4:
+		family = syscall.AF_INET6
+	case opts.Mode == ICMP:
+		proto = syscall.IPPROTO_ICMP
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return Hop{}, os.NewSyscallError("socket", err)
+	}
+	if err := setsockopts(uintptr(fd), v4, ttl); err != nil {
+		syscall.Close(fd)
+		return Hop{}, err
+	}
+	f := os.NewFile(uintptr(fd), "traceroute")
+	c, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return Hop{}, err
+	}
+	defer c.Close()
+	conn := c.(*net.UDPConn)
+
+	deadline := time.Now().Add(opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	to := &net.UDPAddr{IP: dst}
+	payload := make([]byte, 32)
+	if opts.Mode == UDP {
+		to.Port = opts.Port + ttl - 1
+	} else {
+		// Echo request; identifier and checksum are filled in by the
+		// kernel.
+		payload[0] = icmpEcho
+		if !v4 {
+			payload[0] = icmpv6Echo
+		}
+		payload[7] = byte(ttl)
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(payload, to); err != nil {
+		return Hop{}, err
+	}
+
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return Hop{}, err
+	}
+	hop := Hop{TTL: ttl}
+	buf, oob := make([]byte, 512), make([]byte, 512)
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			_, oobn, _, _, err := syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE)
+			if err != nil {
+				break
+			}
+			e, ok := parseRecvErr(oob[:oobn])
+			if !ok || e.origin != soEeOriginICMP && e.origin != soEeOriginICMP6 {
+				continue
+			}
+			hop.Addr, hop.RTT = e.offender, time.Since(start)
+			hop.Reached = e.offender.Equal(dst)
+			hop.Unreachable = e.unreachable() && !hop.Reached
+			return true
+		}
+		for opts.Mode == ICMP {
+			n, _, err := syscall.Recvfrom(int(fd), buf, 0)
+			if err != nil {
+				break
+			}
+			if n > 0 && (buf[0] == icmpEchoReply || buf[0] == icmpv6EchoReply) {
+				hop.Addr, hop.RTT, hop.Reached = dst, time.Since(start), true
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return hop, err
+	}
+	if hop.RTT == 0 && ctx.Err() != nil {
+		return hop, ctx.Err()
+	}
+	return hop, nil
+}
+
+// recvErr is an error read from the error queue of a socket.
+type recvErr struct {
+	errno    syscall.Errno
+	origin   uint8
+	typ      uint8
+	code     uint8
+	info     uint32 // next hop MTU for EMSGSIZE errors
+	offender net.IP // host that sent the ICMP error
+}
+
+// unreachable reports whether e is an ICMP destination unreachable
+// error.
+func (e recvErr) unreachable() bool {
+	return e.origin == soEeOriginICMP && e.typ == icmpUnreachable ||
+		e.origin == soEeOriginICMP6 && e.typ == icmpv6Unreachable
+}
+
+// portUnreachable reports whether e is an ICMP port unreachable error.
+func (e recvErr) portUnreachable() bool {
+	return e.origin == soEeOriginICMP && e.typ == icmpUnreachable && e.code == 3 ||
+		e.origin == soEeOriginICMP6 && e.typ == icmpv6Unreachable && e.code == 4
+}
+
+// parseRecvErr parses the control messages read from an error queue,
+// which carry a struct sock_extended_err followed by the address of the
+// offender.
+func parseRecvErr(oob []byte) (recvErr, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return recvErr{}, false
+	}
+	for _, m := range msgs {
+		v4 := m.Header.Level == syscall.SOL_IP && m.Header.Type == syscall.IP_RECVERR
+		v6 := m.Header.Level == syscall.SOL_IPV6 && m.Header.Type == syscall.IPV6_RECVERR
+		if !v4 && !v6 || len(m.Data) < sockExtendedErrSize {
+			continue
+		}
+		d := m.Data
+		e := recvErr{
+			errno:  syscall.Errno(binary.NativeEndian.Uint32(d[0:])),
+			origin: d[4],
+			typ:    d[5],
+			code:   d[6],
+			info:   binary.NativeEndian.Uint32(d[8:]),
+		}
+		sa := d[sockExtendedErrSize:]
+		switch {
+		case len(sa) >= 8 && binary.NativeEndian.Uint16(sa) == syscall.AF_INET:
+			e.offender = net.IP(append([]byte(nil), sa[4:8]...))
+		case len(sa) >= 24 && binary.NativeEndian.Uint16(sa) == syscall.AF_INET6:
+			e.offender = net.IP(append([]byte(nil), sa[8:24]...))
+		}
+		return e, true
+	}
+	return recvErr{}, false
+}
+
+// probeTCP attempts a connection to dst with the given TTL. Without a raw
+// socket the address of the intermediate hop that answered is unknown.
+func probeTCP(ctx context.Context, dst net.IP, ttl int, opts Options) (Hop, error) {
+	v4 := dst.To4() != nil
+	d := net.Dialer{
+		Timeout: opts.Timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = setsockopts(fd, v4, ttl)
+			}); cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+
+	hop := Hop{TTL: ttl}
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(dst.String(), strconv.Itoa(opts.Port)))
+	switch {
+	case err == nil:
+		conn.Close()
+		hop.Addr, hop.RTT, hop.Reached = dst, time.Since(start), true
+	case errors.Is(err, syscall.ECONNREFUSED):
+		hop.Addr, hop.RTT, hop.Reached = dst, time.Since(start), true
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		// Most likely the TTL expired on the way.
+		hop.RTT = time.Since(start)
+	case ctx.Err() != nil:
+		return hop, ctx.Err()
+	}
+	return hop, nil
+}
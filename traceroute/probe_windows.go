@@ -0,0 +1,139 @@
+//go:build windows
+
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	iphlpapi          = syscall.NewLazyDLL("iphlpapi.dll")
+	icmpCreateFile    = iphlpapi.NewProc("IcmpCreateFile")
+	icmpCloseHandle   = iphlpapi.NewProc("IcmpCloseHandle")
+	icmpSendEcho2     = iphlpapi.NewProc("IcmpSendEcho2")
+	invalidIcmpHandle = ^uintptr(0)
+)
+
+// Status codes of ICMP_ECHO_REPLY, see ipexport.h.
+const (
+	ipSuccess              = 0
+	ipDestNetUnreachable   = 11002
+	ipDestHostUnreachable  = 11003
+	ipDestProtUnreachable  = 11004
+	ipDestPortUnreachable  = 11005
+	ipReqTimedOut          = 11010
+	ipTTLExpiredTransit    = 11013
+	ipTTLExpiredReassembly = 11014
+)
+
+// ipOptionInformation mirrors IP_OPTION_INFORMATION.
+type ipOptionInformation struct {
+	TTL         uint8
+	Tos         uint8
+	Flags       uint8
+	OptionsSize uint8
+	OptionsData uintptr
+}
+
+// icmpEchoReply mirrors ICMP_ECHO_REPLY.
+type icmpEchoReply struct {
+	Address       [4]byte
+	Status        uint32
+	RoundTripTime uint32
+	DataSize      uint16
+	Reserved      uint16
+	Data          uintptr
+	Options       ipOptionInformation
+}
+
+// probe sends an ICMP echo request through the ICMP helper API, which does
+// not need administrative rights. Only ICMP mode over IPv4 is supported.
+func probe(ctx context.Context, dst net.IP, ttl int, opts Options) (Hop, error) {
+	v4 := dst.To4()
+	if opts.Mode != ICMP || v4 == nil {
+		return Hop{}, fmt.Errorf("%w mode %v over %v", ErrUnsupported, opts.Mode, dst)
+	}
+	if err := iphlpapi.Load(); err != nil {
+		return Hop{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	h, _, err := icmpCreateFile.Call()
+	if h == invalidIcmpHandle {
+		return Hop{}, fmt.Errorf("IcmpCreateFile: %w", err)
+	}
+	defer icmpCloseHandle.Call(h)
+
+	timeout := opts.Timeout
+	if d, ok := ctx.Deadline(); ok && time.Until(d) < timeout {
+		timeout = time.Until(d)
+	}
+	if timeout < time.Millisecond {
+		return Hop{TTL: ttl}, ctx.Err()
+	}
+
+	payload := make([]byte, 32)
+	payload[7] = byte(ttl)
+	reply := make([]byte, unsafe.Sizeof(icmpEchoReply{})+uintptr(len(payload))+8)
+	info := ipOptionInformation{TTL: uint8(ttl)}
+	start := time.Now()
+	n, _, err := icmpSendEcho2.Call(
+		h, 0, 0, 0,
+		uintptr(*(*uint32)(unsafe.Pointer(&v4[0]))),
+		uintptr(unsafe.Pointer(&payload[0])), uintptr(len(payload)),
+		uintptr(unsafe.Pointer(&info)),
+		uintptr(unsafe.Pointer(&reply[0])), uintptr(len(reply)),
+		uintptr(timeout/time.Millisecond),
+	)
+	rtt := time.Since(start)
+
+	hop := Hop{TTL: ttl}
+	if n == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno == ipReqTimedOut {
+			return hop, ctx.Err()
+		}
+		return hop, fmt.Errorf("IcmpSendEcho2: %w", err)
+	}
+	r := (*icmpEchoReply)(unsafe.Pointer(&reply[0]))
+	switch r.Status {
+	case ipSuccess, ipTTLExpiredTransit, ipTTLExpiredReassembly:
+	case ipDestNetUnreachable, ipDestHostUnreachable, ipDestProtUnreachable, ipDestPortUnreachable:
+		hop.Unreachable = true
+	case ipReqTimedOut:
+		return hop, ctx.Err()
+	default:
+		return hop, fmt.Errorf("traceroute: ICMP status %d", r.Status)
+	}
+	hop.Addr = net.IPv4(r.Address[0], r.Address[1], r.Address[2], r.Address[3])
+	hop.RTT = rtt
+	hop.Reached = hop.Addr.Equal(dst)
+	hop.Unreachable = hop.Unreachable && !hop.Reached
+	return hop, nil
+}
@@ -0,0 +1,229 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package traceroute discovers the path packets take to reach a host. It
+// provides a tracer.Action that runs a traceroute when a target goes
+// offline, so that network engineers can see where the path broke without
+// logging into the probe host, and tracer.Pingers that monitor the loss
+// and latency of each hop of a path continuously and verify its MTU.
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// TopicTraceroute is the topic Reports are published on by Action.
+const TopicTraceroute = "topic_traceroute"
+
+// ErrUnsupported is returned on platforms or modes that are not
+// supported. Every mode is supported on Linux, only ICMP over IPv4 on
+// Windows.
+var ErrUnsupported = errors.New("traceroute: unsupported")
+
+// Mode is the kind of probes sent.
+type Mode int
+
+// Modes.
+const (
+	// UDP sends datagrams to unlikely ports, the destination answers
+	// with a port unreachable error.
+	UDP Mode = iota
+
+	// ICMP sends echo requests through unprivileged ICMP sockets,
+	// which the system has to allow, see net.ipv4.ping_group_range on
+	// Linux.
+	ICMP
+
+	// TCP attempts connections to Port, which gets through firewalls
+	// that only let traffic to the service in. The addresses of the
+	// intermediate hops are not available in this mode, only whether
+	// they answered.
+	TCP
+)
+
+func (m Mode) String() string {
+	switch m {
+	case UDP:
+		return "udp"
+	case ICMP:
+		return "icmp"
+	case TCP:
+		return "tcp"
+	default:
+		return fmt.Sprintf("mode(%d)", int(m))
+	}
+}
+
+// Hop is the outcome of the probe sent with a given TTL.
+type Hop struct {
+	TTL int
+
+	// Addr is the address that answered the probe, nil if none did in
+	// time or its address is not known.
+	Addr net.IP
+
+	// RTT is the time the answer took, zero if there was none.
+	RTT time.Duration
+
+	// Reached is set when the answer came from the destination.
+	Reached bool
+
+	// Unreachable is set when Addr reported that the destination
+	// cannot be reached.
+	Unreachable bool
+}
+
+func (h Hop) String() string {
+	switch {
+	case h.RTT == 0:
+		return fmt.Sprintf("%2d  *", h.TTL)
+	case h.Addr == nil:
+		return fmt.Sprintf("%2d  ?  %v", h.TTL, h.RTT)
+	case h.Unreachable:
+		return fmt.Sprintf("%2d  %v  %v  !H", h.TTL, h.Addr, h.RTT)
+	default:
+		return fmt.Sprintf("%2d  %v  %v", h.TTL, h.Addr, h.RTT)
+	}
+}
+
+// Options configure a traceroute.
+type Options struct {
+	Mode Mode
+
+	// MaxHops is the maximum TTL probed, 30 when zero.
+	MaxHops int
+
+	// Timeout is how long the answer to each probe is waited for, one
+	// second when zero.
+	Timeout time.Duration
+
+	// Port is the destination port of TCP probes and the first one of
+	// UDP probes, 80 and 33434 respectively when zero.
+	Port int
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxHops <= 0 {
+		o.MaxHops = 30
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second
+	}
+	if o.Port == 0 {
+		o.Port = 33434
+		if o.Mode == TCP {
+			o.Port = 80
+		}
+	}
+	return o
+}
+
+// Run traces the path to host, an IP address or a name to resolve,
+// returning one Hop per TTL probed up to the destination or MaxHops.
+func Run(ctx context.Context, host string, opts Options) ([]Hop, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	dst := ips[0]
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			dst = ip
+			break
+		}
+	}
+
+	opts = opts.withDefaults()
+	var hops []Hop
+	for ttl := 1; ttl <= opts.MaxHops; ttl++ {
+		if err := ctx.Err(); err != nil {
+			return hops, err
+		}
+		hop, err := probe(ctx, dst, ttl, opts)
+		if err != nil {
+			return hops, err
+		}
+		hops = append(hops, hop)
+		if hop.Reached || hop.Unreachable {
+			break
+		}
+	}
+	return hops, nil
+}
+
+// Report is published on TopicTraceroute by Action.
+type Report struct {
+	ID   string // target that triggered the traceroute
+	Host string
+	Hops []Hop
+	Err  error
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "traceroute to %v (%v)", r.Host, r.ID)
+	if r.Err != nil {
+		fmt.Fprintf(&b, ": %v", r.Err)
+	}
+	for _, h := range r.Hops {
+		fmt.Fprintf(&b, "\n%v", h)
+	}
+	return b.String()
+}
+
+// Action is a tracer.Action that traces the path to the host of the
+// target that triggered it, publishing a *Report on TopicTraceroute of
+// PubSub. Use it with a tracer.Rule on state tracer.ConnOffline.
+type Action struct {
+	Options
+	PubSub tracer.PubSub
+}
+
+// Name implements tracer.Action.
+func (a *Action) Name() string {
+	return "traceroute"
+}
+
+// Run implements tracer.Action. The Report is published even when the
+// traceroute fails, carrying the hops discovered until then.
+func (a *Action) Run(ctx context.Context, m tracer.Message) error {
+	if m.Addr == nil {
+		return errors.New("traceroute: target has no address")
+	}
+	host := m.Addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	hops, err := Run(ctx, host, a.Options)
+	a.PubSub.Pub(&Report{ID: m.ID, Host: host, Hops: hops, Err: err}, TopicTraceroute)
+	return err
+}
@@ -0,0 +1,180 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package traceroute_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/traceroute"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestRunLoopback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	ctx := context.Background()
+	for _, mode := range []traceroute.Mode{traceroute.UDP, traceroute.TCP, traceroute.ICMP} {
+		hops, err := traceroute.Run(ctx, "127.0.0.1", traceroute.Options{Mode: mode, Port: port, MaxHops: 3})
+		if errors.Is(err, traceroute.ErrUnsupported) {
+			t.Skip(err)
+		}
+		if err != nil {
+			if mode == traceroute.ICMP {
+				t.Logf("icmp mode not available: %v", err)
+				continue
+			}
+			t.Fatalf("%v: %v", mode, err)
+		}
+		if len(hops) != 1 || !hops[0].Reached || !hops[0].Addr.Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Fatalf("%v: unexpected hops: %v", mode, hops)
+		}
+	}
+}
+
+func TestAction(t *testing.T) {
+	ps := tracertest.NewPubSub()
+	a := &traceroute.Action{Options: traceroute.Options{MaxHops: 2, Timeout: 100 * time.Millisecond}, PubSub: ps}
+	m := tracer.Message{ID: "fake", Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}}
+	if err := a.Run(context.Background(), m); errors.Is(err, traceroute.ErrUnsupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	pubs := ps.Publications()
+	if len(pubs) != 1 || pubs[0].Topic != traceroute.TopicTraceroute {
+		t.Fatalf("unexpected publications: %v", pubs)
+	}
+	r := pubs[0].Message.(*traceroute.Report)
+	if r.ID != "fake" || r.Host != "127.0.0.1" || len(r.Hops) != 1 {
+		t.Fatalf("unexpected report: %v", r)
+	}
+}
+
+func TestPathPinger(t *testing.T) {
+	p := traceroute.NewPathPinger("127.0.0.1", traceroute.Options{MaxHops: 2})
+	for i := 0; i < 3; i++ {
+		if err := p.Ping(context.Background()); errors.Is(err, traceroute.ErrUnsupported) {
+			t.Skip(err)
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := p.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("unexpected hops: found %v, expected 1", len(stats))
+	}
+	if s := stats[0]; s.Sent != 3 || s.Received != 3 || s.Loss() != 0 || s.Best > s.Avg || s.Avg > s.Worst {
+		t.Fatalf("unexpected statistics: %v", s)
+	}
+	if p.Addr().String() != "127.0.0.1" {
+		t.Fatalf("unexpected address: found %v, expected 127.0.0.1", p.Addr())
+	}
+}
+
+func TestMTUPinger(t *testing.T) {
+	p := traceroute.NewMTUPinger("127.0.0.1", traceroute.MTUOptions{Min: 1400, Max: 1500, Timeout: 100 * time.Millisecond})
+	details, err := p.PingDetails(context.Background())
+	if errors.Is(err, traceroute.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu := details.(int); mtu != 1500 {
+		t.Fatalf("unexpected MTU: found %v, expected 1500", mtu)
+	}
+
+	p = traceroute.NewMTUPinger("127.0.0.1", traceroute.MTUOptions{Min: 9000, Timeout: 100 * time.Millisecond})
+	var merr *traceroute.MTUError
+	if _, err := p.PingDetails(context.Background()); !errors.As(err, &merr) || merr.MTU != 1500 {
+		t.Fatalf("unexpected error: found %v, expected an *MTUError", err)
+	}
+}
+
+func TestGatewayPinger(t *testing.T) {
+	routes, err := traceroute.Routes()
+	if errors.Is(err, traceroute.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var local, def *traceroute.Route
+	for i, r := range routes {
+		switch {
+		case r.Default() && r.Gateway != nil && def == nil:
+			def = &routes[i]
+		case !r.Default() && r.Gateway == nil && r.Dst.IP.To4() != nil && local == nil:
+			local = &routes[i]
+		}
+	}
+	if local == nil {
+		t.Skip("no directly connected IPv4 network")
+	}
+
+	ctx := context.Background()
+	p := traceroute.NewGatewayPinger(traceroute.GatewayOptions{NoDefault: true, Routes: []*net.IPNet{local.Dst}})
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, missing, _ := net.ParseCIDR("198.51.100.0/24")
+	p = traceroute.NewGatewayPinger(traceroute.GatewayOptions{NoDefault: true, Routes: []*net.IPNet{local.Dst, missing}})
+	if err := p.Ping(ctx); !errors.Is(err, traceroute.ErrNoRoute) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, traceroute.ErrNoRoute)
+	}
+
+	if def == nil {
+		t.Skip("no default route")
+	}
+	p = traceroute.NewGatewayPinger(traceroute.GatewayOptions{})
+	details, err := p.PingDetails(ctx)
+	var gerr *traceroute.GatewayError
+	if err != nil && !errors.As(err, &gerr) {
+		t.Fatal(err)
+	}
+	gateways := details.([]traceroute.GatewayStatus)
+	if len(gateways) != 1 || !gateways[0].Addr.Equal(def.Gateway) || gateways[0].Iface != def.Iface {
+		t.Fatalf("unexpected gateways: found %+v, expected %v via %v", gateways, def.Gateway, def.Iface)
+	}
+	if err == nil && !gateways[0].Reachable {
+		t.Fatalf("unexpected status: %+v", gateways[0])
+	}
+	t.Logf("%+v", gateways[0])
+	if a := p.Addr().(*net.IPAddr); !a.IP.Equal(def.Gateway) {
+		t.Fatalf("unexpected address: found %v, expected %v", a, def.Gateway)
+	}
+}
@@ -0,0 +1,328 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// CA is a certificate authority for tests of revocation checks. It
+// issues certificates pointing to its OCSP responder and CRL, both served
+// over HTTP from a local server, and can revoke them.
+type CA struct {
+	// Cert is the self-signed certificate of the CA.
+	Cert *Certificate
+
+	key *ecdsa.PrivateKey
+	srv *httptest.Server
+
+	sync.Mutex
+	serial   int64
+	revoked  map[string]time.Time // by serial number
+	down     bool
+	requests int
+}
+
+// NewCA starts a CA, closed when tb completes.
+func NewCA(tb testing.TB) *CA {
+	tb.Helper()
+
+	cert := newCertificate(tb)
+	ca := &CA{Cert: cert, key: cert.PrivateKey.(*ecdsa.PrivateKey), serial: 1, revoked: make(map[string]time.Time)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp", ca.serveOCSP)
+	mux.HandleFunc("/crl", ca.serveCRL)
+	ca.srv = httptest.NewServer(mux)
+	tb.Cleanup(ca.srv.Close)
+	return ca
+}
+
+// Issue returns a new certificate valid for 127.0.0.1, ::1 and localhost
+// until notAfter, signed by ca. Its chain includes the certificate of ca,
+// which its Client configuration trusts.
+func (ca *CA) Issue(notAfter time.Time) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ca.Lock()
+	ca.serial++
+	serial := ca.serial
+	ca.Unlock()
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{Organization: []string{"tracertest"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+		OCSPServer:            []string{ca.srv.URL + "/ocsp"},
+		CRLDistributionPoints: []string{ca.srv.URL + "/crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert.Leaf, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{
+		Certificate: tls.Certificate{Certificate: [][]byte{der, ca.Cert.Leaf.Raw}, PrivateKey: key, Leaf: leaf},
+		Leaf:        leaf,
+		Client:      ca.Cert.Client,
+	}, nil
+}
+
+// Revoke revokes cert, which is reported as such by the OCSP responder
+// and in the CRL from now on.
+func (ca *CA) Revoke(cert *Certificate) {
+	ca.Lock()
+	defer ca.Unlock()
+	ca.revoked[cert.Leaf.SerialNumber.String()] = time.Now().Add(-time.Minute).Truncate(time.Second)
+}
+
+// SetDown makes the OCSP responder and the CRL endpoint answer with 503
+// Service Unavailable when down is true.
+func (ca *CA) SetDown(down bool) {
+	ca.Lock()
+	defer ca.Unlock()
+	ca.down = down
+}
+
+// Requests returns the number of OCSP and CRL requests received so far.
+func (ca *CA) Requests() int {
+	ca.Lock()
+	defer ca.Unlock()
+	return ca.requests
+}
+
+// Staple sets the OCSP response about cert as the one cert staples in
+// the TLS handshakes.
+func (ca *CA) Staple(cert *Certificate) error {
+	resp, err := ca.OCSPResponse(cert.Leaf)
+	if err != nil {
+		return err
+	}
+	cert.OCSPStaple = resp
+	return nil
+}
+
+// OCSP structures, see RFC 6960 section 4.
+
+var (
+	oidSHA1            = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasic       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time `asn1:"generalized"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPResponse returns the OCSP response of ca about cert, valid for an
+// hour.
+func (ca *CA) OCSPResponse(cert *x509.Certificate) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(ca.Cert.Leaf.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+	name, key := crypto.SHA1.New(), crypto.SHA1.New()
+	name.Write(ca.Cert.Leaf.RawSubject)
+	key.Write(spki.PublicKey.RightAlign())
+
+	now := time.Now().Truncate(time.Second)
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+			IssuerNameHash: name.Sum(nil),
+			IssuerKeyHash:  key.Sum(nil),
+			SerialNumber:   cert.SerialNumber,
+		},
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+	}
+	ca.Lock()
+	revokedAt, revoked := ca.revoked[cert.SerialNumber.String()]
+	ca.Unlock()
+	if revoked {
+		single.Revoked.RevocationTime = revokedAt
+	} else {
+		single.Good = true
+	}
+
+	responder, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: ca.Cert.Leaf.RawSubject})
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := asn1.Marshal(ocspResponseData{
+		ResponderID: asn1.RawValue{FullBytes: responder},
+		ProducedAt:  now,
+		Responses:   []ocspSingleResponse{single},
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := ecdsa.SignASN1(rand.Reader, ca.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ocspResponse{Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+}
+
+// unavailable counts a request and reports whether ca is down, answering
+// it if so.
+func (ca *CA) unavailable(w http.ResponseWriter) bool {
+	ca.Lock()
+	defer ca.Unlock()
+
+	ca.requests++
+	if ca.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return ca.down
+}
+
+func (ca *CA) serveOCSP(w http.ResponseWriter, r *http.Request) {
+	if ca.unavailable(w) {
+		return
+	}
+	der, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	var req struct {
+		TBSRequest struct {
+			RequestList []struct {
+				CertID ocspCertID
+			}
+		}
+	}
+	if _, err := asn1.Unmarshal(der, &req); err != nil || len(req.TBSRequest.RequestList) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp, err := ca.OCSPResponse(&x509.Certificate{SerialNumber: req.TBSRequest.RequestList[0].CertID.SerialNumber})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+func (ca *CA) serveCRL(w http.ResponseWriter, r *http.Request) {
+	if ca.unavailable(w) {
+		return
+	}
+	now := time.Now()
+	list := &x509.RevocationList{
+		Number:     big.NewInt(now.UnixNano()),
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+	}
+	ca.Lock()
+	for serial, at := range ca.revoked {
+		n, _ := new(big.Int).SetString(serial, 10)
+		list.RevokedCertificateEntries = append(list.RevokedCertificateEntries, x509.RevocationListEntry{SerialNumber: n, RevocationTime: at})
+	}
+	ca.Unlock()
+	der, err := x509.CreateRevocationList(rand.Reader, list, ca.Cert.Leaf, ca.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Write(der)
+}
@@ -0,0 +1,200 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package tracertest provides utilities for testing code built on top of
+// package tracer: scriptable Pingers, a fake Clock, helpers that collect
+// the messages published by a Tracer and local TCP, TLS, HTTP and DNS
+// servers with controllable behavior for end to end tests of real Pingers.
+package tracertest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a fake tracer.Clock whose time moves only when told to.
+type Clock struct {
+	sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	fired   []*waiter     // fired, possibly not received yet
+	changed chan struct{} // closed and replaced when waiters change
+}
+
+type waiter struct {
+	at   time.Time
+	c    chan time.Time
+	ping bool // registered by a Pinger of this package
+}
+
+// NewClock returns a Clock set at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time of the clock once it
+// has been advanced by at least d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.after(d, false).c
+}
+
+func (c *Clock) after(d time.Duration, ping bool) *waiter {
+	c.Lock()
+	defer c.Unlock()
+
+	w := &waiter{at: c.now.Add(d), c: make(chan time.Time, 1), ping: ping}
+	if d <= 0 {
+		w.c <- c.now
+		c.fired = append(c.fired, w)
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	c.notify()
+	return w
+}
+
+// sleep waits until the clock is advanced by d, or ctx is done.
+func (c *Clock) sleep(ctx context.Context, d time.Duration) error {
+	w := c.after(d, true)
+	select {
+	case <-w.c:
+		return nil
+	case <-ctx.Done():
+		c.remove(w)
+		return ctx.Err()
+	}
+}
+
+func (c *Clock) remove(w *waiter) {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, v := range c.waiters {
+		if v == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notify()
+			return
+		}
+	}
+}
+
+// Advance moves the clock forward by d, firing the channels returned by
+// After whose time has come.
+func (c *Clock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- c.now
+		c.fired = append(c.fired, w)
+	}
+	c.waiters = pending
+	c.notify()
+}
+
+// Next returns the time at which the earliest channel returned by After
+// fires, and false if there is none.
+func (c *Clock) Next() (time.Time, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	var next time.Time
+	for i, w := range c.waiters {
+		if i == 0 || w.at.Before(next) {
+			next = w.at
+		}
+	}
+	return next, len(c.waiters) > 0
+}
+
+// state returns the number of fired channels that were not received
+// from yet, and the number of pending waiters registered by Pingers and
+// by anybody else.
+func (c *Clock) state() (unreceived, pings, others int) {
+	c.Lock()
+	defer c.Unlock()
+
+	fired := c.fired[:0]
+	for _, w := range c.fired {
+		if len(w.c) > 0 {
+			fired = append(fired, w)
+		}
+	}
+	c.fired = fired
+	for _, w := range c.waiters {
+		if w.ping {
+			pings++
+		} else {
+			others++
+		}
+	}
+	return len(c.fired), pings, others
+}
+
+// Waiters returns the number of channels returned by After that did not
+// fire yet.
+func (c *Clock) Waiters() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n channels returned by After are
+// waiting for the clock to be advanced. Useful to make sure that the
+// tracer is ready for the next Advance.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.Lock()
+		if len(c.waiters) >= n {
+			c.Unlock()
+			return
+		}
+		changed := c.changed
+		c.Unlock()
+		<-changed
+	}
+}
+
+// notify wakes up BlockUntil callers. Must be called with c locked.
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
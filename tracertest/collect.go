@@ -0,0 +1,120 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+)
+
+// Collector collects the messages published by a Tracer on
+// tracer.TopicConn.
+type Collector struct {
+	cancel pubsub.CancelFunc
+
+	sync.Mutex
+	msgs    []tracer.Message
+	arrived chan struct{} // closed and replaced on each message
+}
+
+// Collect subscribes a new Collector to the messages published by t.
+func Collect(t *tracer.Tracer) (*Collector, error) {
+	c := &Collector{arrived: make(chan struct{})}
+	cancel, err := t.Sub(&pubsub.Command{
+		Topic: tracer.TopicConn,
+		Run: func(i interface{}) error {
+			m, ok := i.(tracer.Message)
+			if !ok {
+				return fmt.Errorf("tracertest: unexpected message %v", i)
+			}
+			c.add(m)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.cancel = cancel
+	return c, nil
+}
+
+func (c *Collector) add(m tracer.Message) {
+	c.Lock()
+	defer c.Unlock()
+	c.msgs = append(c.msgs, m)
+	close(c.arrived)
+	c.arrived = make(chan struct{})
+}
+
+// Messages returns the messages collected so far.
+func (c *Collector) Messages() []tracer.Message {
+	c.Lock()
+	defer c.Unlock()
+	return append([]tracer.Message(nil), c.msgs...)
+}
+
+// ByID returns the messages collected so far about id.
+func (c *Collector) ByID(id string) []tracer.Message {
+	var msgs []tracer.Message
+	for _, m := range c.Messages() {
+		if m.ID == id {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Wait blocks until at least n messages are collected, and returns
+// them. Returns an error if that does not happen within timeout.
+func (c *Collector) Wait(n int, timeout time.Duration) ([]tracer.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		c.Lock()
+		if len(c.msgs) >= n {
+			msgs := append([]tracer.Message(nil), c.msgs...)
+			c.Unlock()
+			return msgs, nil
+		}
+		arrived := c.arrived
+		c.Unlock()
+
+		select {
+		case <-arrived:
+		case <-deadline:
+			return c.Messages(), fmt.Errorf("tracertest: collected %d messages, expected %d", len(c.Messages()), n)
+		}
+	}
+}
+
+// Close stops collecting messages.
+func (c *Collector) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
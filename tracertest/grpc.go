@@ -0,0 +1,113 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// GRPCHandler answers a unary gRPC call given the metadata and the
+// serialized request message, returning the serialized response message
+// and the status of the call, 0 for OK.
+type GRPCHandler func(md http.Header, req []byte) (resp []byte, code int, msg string)
+
+// GRPCServer is a local gRPC server speaking HTTP/2 in clear text, for
+// tests of gRPC Pingers that do without generated code: handlers work on
+// serialized messages.
+type GRPCServer struct {
+	srv *httptest.Server
+
+	sync.Mutex
+	handlers map[string]GRPCHandler
+}
+
+// NewGRPCServer starts a GRPCServer on a loopback address, closed when
+// tb completes. Methods without a handler answer UNIMPLEMENTED.
+func NewGRPCServer(tb testing.TB) *GRPCServer {
+	tb.Helper()
+
+	s := &GRPCServer{handlers: make(map[string]GRPCHandler)}
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.srv.Config.Protocols = new(http.Protocols)
+	s.srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	s.srv.Start()
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *GRPCServer) Addr() string {
+	return s.srv.Listener.Addr().String()
+}
+
+// Handle makes h answer the calls to method, e.g.
+// "shop.v1.Orders/GetOrder".
+func (s *GRPCServer) Handle(method string, h GRPCHandler) {
+	s.Lock()
+	defer s.Unlock()
+	s.handlers["/"+method] = h
+}
+
+// Close stops the server.
+func (s *GRPCServer) Close() {
+	s.srv.Close()
+}
+
+func (s *GRPCServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	h := s.handlers[r.URL.Path]
+	s.Unlock()
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	status := func(code int, msg string) {
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	}
+	body, err := io.ReadAll(r.Body)
+	switch {
+	case err != nil || len(body) < 5 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5:
+		status(13, "invalid request")
+		return
+	case h == nil:
+		status(12, "unknown method "+r.URL.Path)
+		return
+	}
+
+	resp, code, msg := h(r.Header, body[5:])
+	if code == 0 {
+		frame := make([]byte, 5, 5+len(resp))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+		w.Write(append(frame, resp...))
+	}
+	status(code, msg)
+}
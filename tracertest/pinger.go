@@ -0,0 +1,168 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// ErrDown is the error returned by Down results.
+var ErrDown = errors.New("tracertest: target down")
+
+// Result is the scripted outcome of a ping.
+type Result struct {
+	Err     error
+	Latency time.Duration // time Ping takes to return
+}
+
+// Results of a reachable and an unreachable target.
+var (
+	Up   = Result{}
+	Down = Result{Err: ErrDown}
+)
+
+// Repeat returns a script made of n times r.
+func Repeat(r Result, n int) []Result {
+	rs := make([]Result, n)
+	for i := range rs {
+		rs[i] = r
+	}
+	return rs
+}
+
+// Addr is the net.Addr of the Pingers of this package.
+type Addr string
+
+func (a Addr) Network() string {
+	return "tracertest"
+}
+
+func (a Addr) String() string {
+	return string(a)
+}
+
+// Pinger is a tracer.Pinger that plays a script of results, one per
+// call to Ping. Once the script is over, the last result is repeated; an
+// empty script behaves as Up.
+type Pinger struct {
+	// Clock is used to wait for the latency of the results. The system
+	// clock is used when nil.
+	Clock tracer.Clock
+
+	id string
+
+	sync.Mutex
+	addr   net.Addr
+	script []Result
+	last   Result
+	calls  int
+}
+
+// NewPinger returns a Pinger identified by id that plays results.
+func NewPinger(id string, results ...Result) *Pinger {
+	return &Pinger{
+		id:     id,
+		addr:   Addr(id),
+		script: results,
+	}
+}
+
+// ID implements tracer.Pinger.
+func (p *Pinger) ID() string {
+	return p.id
+}
+
+// Addr implements tracer.Pinger.
+func (p *Pinger) Addr() net.Addr {
+	p.Lock()
+	defer p.Unlock()
+	return p.addr
+}
+
+// SetAddr changes the address returned by Addr. It may be called while
+// the Pinger is traced.
+func (p *Pinger) SetAddr(addr net.Addr) {
+	p.Lock()
+	defer p.Unlock()
+	p.addr = addr
+}
+
+// Push appends results to the script.
+func (p *Pinger) Push(results ...Result) {
+	p.Lock()
+	defer p.Unlock()
+	p.script = append(p.script, results...)
+}
+
+// Calls returns the number of times Ping was called.
+func (p *Pinger) Calls() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.calls
+}
+
+// Ping implements tracer.Pinger. It waits for the latency of the next
+// result, and returns its error. If ctx is done first, its error is
+// returned instead.
+func (p *Pinger) Ping(ctx context.Context) error {
+	p.Lock()
+	p.calls++
+	if len(p.script) > 0 {
+		p.last, p.script = p.script[0], p.script[1:]
+	}
+	r := p.last
+	p.Unlock()
+
+	if r.Latency > 0 {
+		if err := p.sleep(ctx, r.Latency); err != nil {
+			return err
+		}
+	}
+	return r.Err
+}
+
+func (p *Pinger) sleep(ctx context.Context, d time.Duration) error {
+	var after <-chan time.Time
+	switch c := p.Clock.(type) {
+	case *Clock:
+		return c.sleep(ctx, d)
+	case nil:
+		after = time.After(d)
+	default:
+		after = c.After(d)
+	}
+	select {
+	case <-after:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
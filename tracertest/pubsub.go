@@ -0,0 +1,126 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"sync"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+)
+
+// Publication is a message published on a topic.
+type Publication struct {
+	Topic   string
+	Message interface{}
+}
+
+// PubSub is an in-memory tracer.PubSub that records every publication.
+// Subscribers are run synchronously by Pub, in subscription order, hence
+// they must not call back into the Tracer that is publishing.
+type PubSub struct {
+	sync.Mutex
+	pubs []Publication
+	subs []*subscription
+}
+
+type subscription struct {
+	cmd *pubsub.Command
+}
+
+// NewPubSub returns an empty PubSub.
+func NewPubSub() *PubSub {
+	return new(PubSub)
+}
+
+// Inject replaces the PubSub of t with a new PubSub, and returns it.
+// Must be called before t is started.
+func Inject(t *tracer.Tracer) *PubSub {
+	ps := NewPubSub()
+	t.PubSub = ps
+	return ps
+}
+
+// Sub implements tracer.PubSub.
+func (ps *PubSub) Sub(cmd *pubsub.Command) (pubsub.CancelFunc, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	s := &subscription{cmd: cmd}
+	ps.subs = append(ps.subs, s)
+	return func() {
+		ps.Lock()
+		defer ps.Unlock()
+		for i, v := range ps.subs {
+			if v == s {
+				ps.subs = append(ps.subs[:i], ps.subs[i+1:]...)
+				return
+			}
+		}
+	}, nil
+}
+
+// Pub implements tracer.PubSub.
+func (ps *PubSub) Pub(message interface{}, topic string) {
+	ps.Lock()
+	ps.pubs = append(ps.pubs, Publication{Topic: topic, Message: message})
+	var cmds []*pubsub.Command
+	for _, s := range ps.subs {
+		if s.cmd.Topic == topic {
+			cmds = append(cmds, s.cmd)
+		}
+	}
+	ps.Unlock()
+
+	for _, cmd := range cmds {
+		cmd.Run(message)
+	}
+}
+
+// Publications returns everything published so far, in order.
+func (ps *PubSub) Publications() []Publication {
+	ps.Lock()
+	defer ps.Unlock()
+	return append([]Publication(nil), ps.pubs...)
+}
+
+// Messages returns the tracer.Message values published so far on
+// tracer.TopicConn, in order.
+func (ps *PubSub) Messages() []tracer.Message {
+	var msgs []tracer.Message
+	for _, p := range ps.Publications() {
+		if m, ok := p.Message.(tracer.Message); ok && p.Topic == tracer.TopicConn {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Reset forgets the publications recorded so far.
+func (ps *PubSub) Reset() {
+	ps.Lock()
+	defer ps.Unlock()
+	ps.pubs = nil
+}
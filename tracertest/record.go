@@ -0,0 +1,219 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+)
+
+// UpdateEnv is the environment variable that, when set, makes
+// Recorder.Golden rewrite golden files instead of comparing against them.
+const UpdateEnv = "TRACERTEST_UPDATE"
+
+// Recorder captures the events published by a Tracer on every topic in a
+// normalized text format, one event per line, suitable for golden-file
+// tests. Events go through SubscribeTopics, whatever PubSub is in use.
+// Latencies and times, which depend on timing, are left out. Messages are
+// sorted by target ID and sequence number, and followed by the
+// Transitions sorted by target ID, so that the output does not depend on
+// the scheduling of concurrent pings. The other events follow in the
+// order they were published.
+type Recorder struct {
+	cancel pubsub.CancelFunc
+	done   chan struct{}
+
+	sync.Mutex
+	msgs  []tracer.Message
+	trs   []tracer.Transition
+	other []string
+}
+
+// Record subscribes a new Recorder to the topics of t.
+func Record(t *tracer.Tracer) (*Recorder, error) {
+	events, cancel := t.SubscribeTopics("")
+	r := &Recorder{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		for e := range events {
+			r.Add(e.Value)
+		}
+	}()
+	return r, nil
+}
+
+// Add records event.
+func (r *Recorder) Add(event interface{}) {
+	r.Lock()
+	defer r.Unlock()
+
+	switch e := event.(type) {
+	case tracer.Message:
+		r.msgs = append(r.msgs, e)
+		return
+	case tracer.Transition:
+		r.trs = append(r.trs, e)
+		return
+	}
+	r.other = append(r.other, Format(event))
+}
+
+// Bytes returns the normalized recording.
+func (r *Recorder) Bytes() []byte {
+	r.Lock()
+	msgs := append([]tracer.Message(nil), r.msgs...)
+	trs := append([]tracer.Transition(nil), r.trs...)
+	other := append([]string(nil), r.other...)
+	r.Unlock()
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if msgs[i].ID != msgs[j].ID {
+			return msgs[i].ID < msgs[j].ID
+		}
+		return msgs[i].Seq < msgs[j].Seq
+	})
+	// Transitions about the same target are published in order.
+	sort.SliceStable(trs, func(i, j int) bool {
+		return trs[i].ID < trs[j].ID
+	})
+
+	var b bytes.Buffer
+	for _, m := range msgs {
+		fmt.Fprintln(&b, Format(m))
+	}
+	for _, tr := range trs {
+		fmt.Fprintln(&b, Format(tr))
+	}
+	for _, s := range other {
+		fmt.Fprintln(&b, s)
+	}
+	return b.Bytes()
+}
+
+// Golden compares the recording with the content of the file at path,
+// failing tb if they differ. When the UpdateEnv environment variable is
+// set, the file is written with the recording instead.
+func (r *Recorder) Golden(tb testing.TB, path string) {
+	tb.Helper()
+
+	got := r.Bytes()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		tb.Fatalf("recording differs from %v (set %v to update):\n--- found\n%s--- expected\n%s", path, UpdateEnv, got, want)
+	}
+}
+
+// Close stops recording, once the events received are recorded.
+func (r *Recorder) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// Format returns the normalized representation of event used by
+// Recorder.
+func Format(event interface{}) string {
+	switch e := event.(type) {
+	case tracer.Message:
+		f := []string{e.ID, fmt.Sprintf("#%d", e.Seq), tracer.StateString(e.State)}
+		if e.Addr != nil {
+			f = append(f, fmt.Sprintf("addr=%v/%v", e.Addr.Network(), e.Addr))
+		}
+		if e.Err != nil {
+			f = append(f, fmt.Sprintf("err=%q", e.Err.Error()))
+		}
+		if e.Initial {
+			f = append(f, "initial")
+		}
+		if e.Canceled {
+			f = append(f, "canceled")
+		}
+		if e.Chaos {
+			f = append(f, "chaos")
+		}
+		if e.Downtime {
+			f = append(f, "downtime")
+		}
+		if e.RootCause != "" {
+			f = append(f, "root="+e.RootCause)
+		}
+		if e.Flapping {
+			f = append(f, "flapping")
+		}
+		if e.Skipped > 0 {
+			f = append(f, fmt.Sprintf("skipped=%d", e.Skipped))
+		}
+		if e.Attempts > 1 {
+			f = append(f, fmt.Sprintf("attempts=%d", e.Attempts))
+		}
+		return strings.Join(f, " ")
+	case tracer.Transition:
+		return fmt.Sprintf("%v %v -> %v", e.ID, tracer.StateString(e.From), tracer.StateString(e.To))
+	case tracer.Flap:
+		if e.Flapping {
+			return fmt.Sprintf("%v flapping %v", e.ID, tracer.StateString(e.State))
+		}
+		return fmt.Sprintf("%v stable %v", e.ID, tracer.StateString(e.State))
+	case tracer.CertExpiring:
+		return fmt.Sprintf("%v cert-expiring subject=%q depth=%d", e.ID, e.Subject, e.Depth)
+	case tracer.DomainExpiring:
+		return fmt.Sprintf("%v domain-expiring name=%v", e.ID, e.Name)
+	case *tracer.ActionError:
+		return fmt.Sprintf("%v action-error action=%q err=%q", e.ID, e.Action, e.Err.Error())
+	case tracer.NetworkCondition:
+		f := []string{"network", "down"}
+		if e.Up {
+			f[1] = "up"
+		}
+		if e.Metered {
+			f = append(f, "metered")
+		}
+		if e.Reason != "" {
+			f = append(f, fmt.Sprintf("reason=%q", e.Reason))
+		}
+		return strings.Join(f, " ")
+	case tracer.InFlightWarning:
+		return fmt.Sprintf("warning in-flight=%d watermark=%d", e.InFlight, e.Watermark)
+	default:
+		return fmt.Sprintf("%T %+v", e, e)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// Phase kinds of a Scenario.
+const (
+	PhaseUp = iota
+	PhaseDown
+	PhaseFlapping
+	PhaseSlow
+)
+
+// Phase is a period of a Scenario during which the target behaves in
+// the same way.
+type Phase struct {
+	Kind     int
+	Duration time.Duration
+	Latency  time.Duration // latency of the pings, PhaseSlow only
+}
+
+// Scenario is a tracer.Pinger whose outcome depends on the time elapsed
+// since it was first pinged, rather than on the number of pings: up for
+// 5 minutes, then down for 30 seconds, then flapping... Once the last phase
+// is over, the scenario stays in it.
+//
+// Scenarios are built either with the chainable methods
+//
+//	NewScenario("db").Up(5 * time.Minute).Down(30 * time.Second)
+//
+// or parsed from a description, see ParseScenario.
+type Scenario struct {
+	// Clock is the clock the scenario is played on. The system clock
+	// is used when nil; Simulation.Trace sets it to the virtual clock.
+	Clock tracer.Clock
+
+	id     string
+	phases []Phase
+
+	sync.Mutex
+	start time.Time
+	flaps int
+}
+
+// NewScenario returns an empty Scenario identified by id, which behaves
+// as always up.
+func NewScenario(id string) *Scenario {
+	return &Scenario{id: id}
+}
+
+// ParseScenario returns the Scenario identified by id described by desc,
+// a comma separated list of phases. Each phase is a kind followed by a
+// duration, as accepted by time.ParseDuration; slow phases take the latency
+// of the pings as well:
+//
+//	up 5m, down 30s, flapping 2m, slow 1m 2s
+func ParseScenario(id, desc string) (*Scenario, error) {
+	s := NewScenario(id)
+	for _, p := range strings.Split(desc, ",") {
+		f := strings.Fields(p)
+		if len(f) == 0 {
+			continue
+		}
+		var args []time.Duration
+		for _, a := range f[1:] {
+			d, err := time.ParseDuration(a)
+			if err != nil {
+				return nil, fmt.Errorf("tracertest: phase %q: %v", strings.TrimSpace(p), err)
+			}
+			args = append(args, d)
+		}
+
+		want := 1
+		if f[0] == "slow" {
+			want = 2
+		}
+		if len(args) != want {
+			return nil, fmt.Errorf("tracertest: phase %q: expected %d durations, found %d", strings.TrimSpace(p), want, len(args))
+		}
+
+		switch f[0] {
+		case "up":
+			s.Up(args[0])
+		case "down":
+			s.Down(args[0])
+		case "flapping":
+			s.Flapping(args[0])
+		case "slow":
+			s.Slow(args[0], args[1])
+		default:
+			return nil, fmt.Errorf("tracertest: phase %q: unknown kind %q", strings.TrimSpace(p), f[0])
+		}
+	}
+	return s, nil
+}
+
+// Up appends a phase of duration d during which pings succeed.
+func (s *Scenario) Up(d time.Duration) *Scenario {
+	return s.add(Phase{Kind: PhaseUp, Duration: d})
+}
+
+// Down appends a phase of duration d during which pings fail with
+// ErrDown.
+func (s *Scenario) Down(d time.Duration) *Scenario {
+	return s.add(Phase{Kind: PhaseDown, Duration: d})
+}
+
+// Flapping appends a phase of duration d during which pings succeed and
+// fail alternately.
+func (s *Scenario) Flapping(d time.Duration) *Scenario {
+	return s.add(Phase{Kind: PhaseFlapping, Duration: d})
+}
+
+// Slow appends a phase of duration d during which pings succeed after
+// latency.
+func (s *Scenario) Slow(d, latency time.Duration) *Scenario {
+	return s.add(Phase{Kind: PhaseSlow, Duration: d, Latency: latency})
+}
+
+func (s *Scenario) add(p Phase) *Scenario {
+	s.phases = append(s.phases, p)
+	return s
+}
+
+// Phases returns the phases of the scenario.
+func (s *Scenario) Phases() []Phase {
+	return append([]Phase(nil), s.phases...)
+}
+
+// ID implements tracer.Pinger.
+func (s *Scenario) ID() string {
+	return s.id
+}
+
+// Addr implements tracer.Pinger.
+func (s *Scenario) Addr() net.Addr {
+	return Addr(s.id)
+}
+
+// Ping implements tracer.Pinger.
+func (s *Scenario) Ping(ctx context.Context) error {
+	p := s.phase()
+	switch p.Kind {
+	case PhaseDown:
+		return ErrDown
+	case PhaseFlapping:
+		s.Lock()
+		s.flaps++
+		down := s.flaps%2 == 0
+		s.Unlock()
+		if down {
+			return ErrDown
+		}
+	case PhaseSlow:
+		return s.sleep(ctx, p.Latency)
+	}
+	return nil
+}
+
+// phase returns the phase the scenario is in, starting the scenario on
+// the first call.
+func (s *Scenario) phase() Phase {
+	now := s.now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.start.IsZero() {
+		s.start = now
+	}
+	if len(s.phases) == 0 {
+		return Phase{Kind: PhaseUp}
+	}
+
+	elapsed := now.Sub(s.start)
+	for _, p := range s.phases {
+		if elapsed < p.Duration {
+			return p
+		}
+		elapsed -= p.Duration
+	}
+	return s.phases[len(s.phases)-1]
+}
+
+func (s *Scenario) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Scenario) sleep(ctx context.Context, d time.Duration) error {
+	p := Pinger{Clock: s.Clock}
+	return p.sleep(ctx, d)
+}
@@ -0,0 +1,606 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Certificate is a self-signed certificate valid for 127.0.0.1, ::1 and
+// localhost, along with a client configuration that trusts it. It can be
+// used as client certificate as well.
+type Certificate struct {
+	tls.Certificate
+	Leaf   *x509.Certificate
+	Client *tls.Config // trusts the certificate
+}
+
+// NewCertificate generates a Certificate expiring at notAfter.
+func NewCertificate(notAfter time.Time) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"tracertest"}},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return &Certificate{
+		Certificate: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf},
+		Leaf:        leaf,
+		Client:      &tls.Config{RootCAs: pool},
+	}, nil
+}
+
+// PEM returns the PEM encoding of the certificate and of its private key.
+func (c *Certificate) PEM() (cert, key []byte, err error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Leaf.Raw})
+	key = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return cert, key, nil
+}
+
+// newCertificate is NewCertificate for servers, failing tb on error.
+func newCertificate(tb testing.TB) *Certificate {
+	tb.Helper()
+
+	cert, err := NewCertificate(time.Now().Add(24 * time.Hour))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return cert
+}
+
+// TCPServer is a local TCP server, optionally speaking TLS, for end to end
+// tests of TCP based Pingers. It accepts connections, waits for the
+// configured delay and writes the configured greeting, if any, before
+// closing them.
+type TCPServer struct {
+	// Cert is the certificate of a TLS server, nil otherwise.
+	Cert *Certificate
+
+	addr string
+	wg   sync.WaitGroup
+
+	sync.Mutex
+	ln         net.Listener
+	greeting   []byte
+	delay      time.Duration
+	accepted   int
+	minVersion uint16
+	suites     []uint16
+}
+
+// NewTCPServer starts a TCPServer on a loopback address, closed when tb
+// completes.
+func NewTCPServer(tb testing.TB) *TCPServer {
+	return newTCPServer(tb, nil)
+}
+
+// NewTLSServer starts a TCPServer speaking TLS with a fresh self-signed
+// certificate, closed when tb completes.
+func NewTLSServer(tb testing.TB) *TCPServer {
+	return newTCPServer(tb, newCertificate(tb))
+}
+
+// NewTLSServerWith starts a TCPServer speaking TLS with cert, e.g. one
+// issued by a CA, closed when tb completes.
+func NewTLSServerWith(tb testing.TB, cert *Certificate) *TCPServer {
+	return newTCPServer(tb, cert)
+}
+
+func newTCPServer(tb testing.TB, cert *Certificate) *TCPServer {
+	tb.Helper()
+
+	s := &TCPServer{Cert: cert}
+	ln, err := s.listen("127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s.addr = ln.Addr().String()
+	s.ln = ln
+	s.serve(ln)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+func (s *TCPServer) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cert != nil {
+		ln = tls.NewListener(ln, &tls.Config{GetConfigForClient: s.tlsConfig})
+	}
+	return ln, nil
+}
+
+// tlsConfig returns the configuration of the TLS handshakes.
+func (s *TCPServer) tlsConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.Lock()
+	defer s.Unlock()
+	return &tls.Config{
+		Certificates: []tls.Certificate{s.Cert.Certificate},
+		MinVersion:   s.minVersion,
+		CipherSuites: s.suites,
+	}, nil
+}
+
+// SetTLS sets the minimum protocol version accepted by a TLS server and
+// the cipher suites it supports for versions up to TLS 1.2, nil for the
+// defaults.
+func (s *TCPServer) SetTLS(minVersion uint16, suites []uint16) {
+	s.Lock()
+	defer s.Unlock()
+	s.minVersion, s.suites = minVersion, suites
+}
+
+func (s *TCPServer) serve(ln net.Listener) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.accepted++
+			greeting, delay := s.greeting, s.delay
+			s.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer conn.Close()
+				time.Sleep(delay)
+				if tconn, ok := conn.(*tls.Conn); ok {
+					if err := tconn.Handshake(); err != nil {
+						return
+					}
+				}
+				if len(greeting) > 0 {
+					conn.Write(greeting)
+				}
+			}()
+		}
+	}()
+}
+
+// Addr returns the address the server listens on, which does not change
+// when the server is brought down and up again.
+func (s *TCPServer) Addr() string {
+	return s.addr
+}
+
+// SetGreeting sets the data written to each accepted connection.
+func (s *TCPServer) SetGreeting(greeting string) {
+	s.Lock()
+	defer s.Unlock()
+	s.greeting = []byte(greeting)
+}
+
+// SetDelay sets how long the server waits before serving an accepted
+// connection.
+func (s *TCPServer) SetDelay(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.delay = d
+}
+
+// SetDown stops listening when down is true, so that connections are
+// refused, and listens again on the same address otherwise.
+func (s *TCPServer) SetDown(down bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	switch {
+	case down && s.ln != nil:
+		err := s.ln.Close()
+		s.ln = nil
+		return err
+	case !down && s.ln == nil:
+		ln, err := s.listen(s.addr)
+		if err != nil {
+			return err
+		}
+		s.ln = ln
+		s.serve(ln)
+	}
+	return nil
+}
+
+// Accepted returns the number of connections accepted so far.
+func (s *TCPServer) Accepted() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.accepted
+}
+
+// Close stops the server and waits for the connections being served.
+func (s *TCPServer) Close() {
+	s.SetDown(true)
+	s.wg.Wait()
+}
+
+// HTTPServer is a local HTTP server answering every request with the
+// configured status and body, for end to end tests of HTTP based Pingers.
+type HTTPServer struct {
+	*httptest.Server
+
+	// Cert is the certificate of an HTTPS server, nil otherwise.
+	Cert *Certificate
+
+	sync.Mutex
+	status   int
+	body     string
+	delay    time.Duration
+	requests int
+}
+
+// NewHTTPServer starts an HTTPServer answering 200 OK, closed when tb
+// completes.
+func NewHTTPServer(tb testing.TB) *HTTPServer {
+	return newHTTPServer(tb, nil)
+}
+
+// NewHTTPSServer starts an HTTPServer speaking HTTPS with a fresh
+// self-signed certificate, closed when tb completes.
+func NewHTTPSServer(tb testing.TB) *HTTPServer {
+	return newHTTPServer(tb, newCertificate(tb))
+}
+
+// NewMutualTLSServer starts an HTTPServer speaking HTTPS that requires
+// clients to present client, closed when tb completes.
+func NewMutualTLSServer(tb testing.TB, client *Certificate) *HTTPServer {
+	return newHTTPServer(tb, newCertificate(tb), client)
+}
+
+func newHTTPServer(tb testing.TB, cert *Certificate, client ...*Certificate) *HTTPServer {
+	s := &HTTPServer{Cert: cert, status: http.StatusOK}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	if cert != nil {
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{cert.Certificate}}
+		if len(client) > 0 {
+			s.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			s.TLS.ClientCAs = x509.NewCertPool()
+			for _, c := range client {
+				s.TLS.ClientCAs.AddCert(c.Leaf)
+			}
+		}
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+func (s *HTTPServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests++
+	status, body, delay := s.status, s.body, s.delay
+	s.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+// SetStatus sets the status code of the responses.
+func (s *HTTPServer) SetStatus(code int) {
+	s.Lock()
+	defer s.Unlock()
+	s.status = code
+}
+
+// SetBody sets the body of the responses.
+func (s *HTTPServer) SetBody(body string) {
+	s.Lock()
+	defer s.Unlock()
+	s.body = body
+}
+
+// SetDelay sets how long the server waits before responding.
+func (s *HTTPServer) SetDelay(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.delay = d
+}
+
+// Requests returns the number of requests received so far.
+func (s *HTTPServer) Requests() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests
+}
+
+// DNS response codes used by DNSServer.
+const (
+	rcodeSuccess  = 0
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeRefused  = 5
+)
+
+// DNS record types and class answered by DNSServer.
+const (
+	typeA    = 1
+	typeAAAA = 28
+	classIN  = 1
+)
+
+// DNSServer is a local DNS server answering A and AAAA queries over UDP
+// from a table of names, for end to end tests of DNS based Pingers. Names
+// that are not in the table do not exist.
+type DNSServer struct {
+	conn net.PacketConn
+	done chan struct{}
+
+	sync.Mutex
+	hosts   map[string][]net.IP
+	delay   time.Duration
+	refuse  bool
+	signed  bool
+	bogus   bool
+	queries int
+}
+
+// NewDNSServer starts a DNSServer on a loopback address, closed when tb
+// completes.
+func NewDNSServer(tb testing.TB) *DNSServer {
+	tb.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := &DNSServer{conn: conn, done: make(chan struct{}), hosts: make(map[string][]net.IP)}
+	go s.serve()
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *DNSServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Set makes name resolve to ips, removing name from the table when ips
+// is empty. Names are matched without the trailing dot, case sensitively.
+func (s *DNSServer) Set(name string, ips ...string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(ips) == 0 {
+		delete(s.hosts, name)
+		return
+	}
+	s.hosts[name] = nil
+	for _, ip := range ips {
+		s.hosts[name] = append(s.hosts[name], net.ParseIP(ip))
+	}
+}
+
+// SetDelay sets how long the server waits before answering.
+func (s *DNSServer) SetDelay(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.delay = d
+}
+
+// SetRefuse makes the server refuse every query when refuse is true.
+func (s *DNSServer) SetRefuse(refuse bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.refuse = refuse
+}
+
+// SetSigned makes the server behave as a validating resolver answering
+// about signed zones when signed is true: the authenticated data bit is set
+// in the responses to the queries asking for it, see RFC 6840.
+func (s *DNSServer) SetSigned(signed bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.signed = signed
+}
+
+// SetBogus makes the server behave as a validating resolver answering
+// about zones whose signatures do not validate when bogus is true: queries
+// fail with SERVFAIL unless they disable checking.
+func (s *DNSServer) SetBogus(bogus bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.bogus = bogus
+}
+
+// Queries returns the number of queries received so far.
+func (s *DNSServer) Queries() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.queries
+}
+
+// Close stops the server.
+func (s *DNSServer) Close() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+		s.conn.Close()
+	}
+}
+
+func (s *DNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			resp, err := s.answer(query)
+			if err != nil {
+				return
+			}
+			s.conn.WriteTo(resp, addr)
+		}()
+	}
+}
+
+// answer builds the response to query, a DNS message with a single
+// question.
+func (s *DNSServer) answer(query []byte) ([]byte, error) {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return nil, errors.New("unsupported query")
+	}
+	// Question name, a sequence of labels.
+	var name []byte
+	off := 12
+	for {
+		if off >= len(query) {
+			return nil, errors.New("truncated query")
+		}
+		l := int(query[off])
+		off++
+		if l == 0 {
+			break
+		}
+		if l > 63 || off+l > len(query) {
+			return nil, errors.New("invalid label")
+		}
+		if len(name) > 0 {
+			name = append(name, '.')
+		}
+		name = append(name, query[off:off+l]...)
+		off += l
+	}
+	if off+4 > len(query) {
+		return nil, errors.New("truncated query")
+	}
+	qtype := binary.BigEndian.Uint16(query[off:])
+	question := query[12 : off+4]
+
+	s.Lock()
+	s.queries++
+	ips, ok := s.hosts[string(name)]
+	delay, refuse, signed, bogus := s.delay, s.refuse, s.signed, s.bogus
+	s.Unlock()
+	time.Sleep(delay)
+
+	// Authenticated data and checking disabled bits of the query.
+	ad, cd := query[3]&0x20 != 0, query[3]&0x10 != 0
+	rcode := rcodeSuccess
+	switch {
+	case refuse:
+		rcode = rcodeRefused
+	case bogus && !cd:
+		rcode = rcodeServFail
+	case !ok:
+		rcode = rcodeNXDomain
+	}
+	var answers [][]byte
+	if rcode == rcodeSuccess {
+		for _, ip := range ips {
+			data := ip.To4()
+			if qtype == typeAAAA {
+				if data != nil {
+					continue
+				}
+				data = ip.To16()
+			} else if qtype != typeA || data == nil {
+				continue
+			}
+			// Name pointer to the question, type, class, TTL, data.
+			rr := []byte{0xc0, 12}
+			rr = binary.BigEndian.AppendUint16(rr, qtype)
+			rr = binary.BigEndian.AppendUint16(rr, classIN)
+			rr = binary.BigEndian.AppendUint32(rr, 0)
+			rr = binary.BigEndian.AppendUint16(rr, uint16(len(data)))
+			answers = append(answers, append(rr, data...))
+		}
+	}
+
+	// Header: same ID, response bit, opcode and recursion desired
+	// copied, recursion available, authenticated data when signed and
+	// asked for, checking disabled copied.
+	flags := 0x80 | query[3]&0x10 | byte(rcode)
+	if signed && !bogus && ad && rcode == rcodeSuccess {
+		flags |= 0x20
+	}
+	resp := append([]byte(nil), query[:2]...)
+	resp = append(resp, 0x80|query[2]&0x79, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(answers)))
+	resp = binary.BigEndian.AppendUint16(resp, 0)
+	resp = binary.BigEndian.AppendUint16(resp, 0)
+	resp = append(resp, question...)
+	for _, rr := range answers {
+		resp = append(resp, rr...)
+	}
+	return resp, nil
+}
@@ -0,0 +1,127 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest_test
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestTCPServer(t *testing.T) {
+	s := tracertest.NewTLSServer(t)
+	s.SetGreeting("+OK ready\r\n")
+
+	ctx := context.Background()
+	p := tracer.NewTCPPinger(s.Addr(),
+		tracer.WithTLSConfig(s.Cert.Client),
+		tracer.WithExpect(regexp.MustCompile(`^\+OK`)),
+		tracer.WithTimeout(time.Second),
+	)
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SetDown(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("ping should fail while the server is down")
+	}
+	if err := s.SetDown(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Accepted(); n != 2 {
+		t.Fatalf("unexpected accepted connections: found %v, expected 2", n)
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	s := tracertest.NewHTTPSServer(t)
+	s.SetBody("healthy")
+
+	ctx := context.Background()
+	p, err := tracer.NewHTTPPinger(s.URL, tracer.WithTLSConfig(s.Cert.Client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := p.PingDetails(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := details.(*tracer.HTTPResponse); r.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: found %v, expected %v", r.StatusCode, http.StatusOK)
+	}
+
+	s.SetStatus(http.StatusServiceUnavailable)
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("ping should fail on 503")
+	}
+
+	s.SetStatus(http.StatusOK)
+	s.SetDelay(time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("ping should time out")
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+	s := tracertest.NewDNSServer(t)
+	s.Set("db.test", "10.0.0.1", "fd00::1")
+
+	ctx := context.Background()
+	p := tracer.NewDNSPinger("db.test", tracer.WithNameserver(s.Addr()), tracer.WithTimeout(time.Second))
+	details, err := p.PingDetails(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addrs := details.([]string); len(addrs) != 2 {
+		t.Fatalf("unexpected addresses: found %v, expected 10.0.0.1 and fd00::1", addrs)
+	}
+
+	s.Set("db.test")
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("unknown names should not resolve")
+	}
+
+	s.Set("db.test", "10.0.0.1")
+	s.SetRefuse(true)
+	if err := p.Ping(ctx); err == nil {
+		t.Fatal("refused queries should fail")
+	}
+	if s.Queries() == 0 {
+		t.Fatal("the server should have been queried")
+	}
+}
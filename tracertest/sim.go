@@ -0,0 +1,172 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+// Epoch is the virtual time at which simulations start.
+var Epoch = time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Event is a message published during a simulation.
+type Event struct {
+	At      time.Duration // virtual time elapsed since the start
+	Message tracer.Message
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%v %v", e.At, Format(e.Message))
+}
+
+// Simulation drives a Tracer with a virtual Clock against scripted
+// Pingers. Virtual time only moves when the tracer and its pings are
+// idle, hence the events of a simulation, and their virtual times, are the
+// same on every run.
+type Simulation struct {
+	Tracer *tracer.Tracer
+	Clock  *Clock
+	PubSub *PubSub
+
+	events  []Event
+	started bool
+}
+
+// NewSimulation returns a Simulation of a new Tracer, whose Clock is set
+// at Epoch and whose messages are recorded by PubSub. The Tracer can be
+// configured before the simulation runs.
+func NewSimulation() *Simulation {
+	s := &Simulation{
+		Tracer: tracer.New(),
+		Clock:  NewClock(Epoch),
+	}
+	s.Tracer.Clock = s.Clock
+	s.PubSub = Inject(s.Tracer)
+	return s
+}
+
+// Trace makes the tracer keep track of p, see tracer.Tracer.Trace. The
+// Pingers and Scenarios of this package are played on the virtual clock.
+func (s *Simulation) Trace(p tracer.Pinger, opts ...tracer.TargetOption) error {
+	switch p := p.(type) {
+	case *Pinger:
+		p.Clock = s.Clock
+	case *Scenario:
+		p.Clock = s.Clock
+	}
+	err := s.Tracer.Trace(p, opts...)
+	s.settle()
+	return err
+}
+
+// Run advances the virtual clock by d, waking the tracer each time one
+// of its timers or ping latencies expires, and returns the events published
+// since the previous call. The tracer is started on the first call.
+func (s *Simulation) Run(d time.Duration) ([]Event, error) {
+	if !s.started {
+		if err := s.Tracer.Run(); err != nil {
+			return nil, err
+		}
+		s.started = true
+	}
+	s.settle()
+
+	end := s.Clock.Now().Add(d)
+	for {
+		next, ok := s.Clock.Next()
+		if !ok || next.After(end) {
+			break
+		}
+		s.Clock.Advance(next.Sub(s.Clock.Now()))
+		s.settle()
+	}
+	if now := s.Clock.Now(); now.Before(end) {
+		s.Clock.Advance(end.Sub(now))
+	}
+
+	events := s.events
+	s.events = nil
+	return events, nil
+}
+
+// Close stops the simulated tracer.
+func (s *Simulation) Close() {
+	s.Tracer.Close()
+}
+
+// String returns the events in the format used by Event.String, one per
+// line.
+func String(events []Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		fmt.Fprintln(&b, e)
+	}
+	return b.String()
+}
+
+// settle waits until the tracer is idle: every expired timer has been
+// received, the run loop is waiting for the next one and every ping in
+// flight is waiting on the virtual clock. It then collects the messages
+// published in the meantime, which all happened at the current virtual
+// time.
+func (s *Simulation) settle() {
+	idle := func() bool {
+		unreceived, pings, others := s.Clock.state()
+		return unreceived == 0 && others > 0 && pings == s.Tracer.InFlight()
+	}
+	if s.started {
+		// Require the condition to hold twice in a row, so that a
+		// goroutine caught between receiving a timer and starting its
+		// work is given the chance to run.
+		for stable := 0; stable < 2; {
+			if idle() {
+				stable++
+			} else {
+				stable = 0
+			}
+			runtime.Gosched()
+			time.Sleep(time.Microsecond * 50)
+		}
+	}
+
+	msgs := s.PubSub.Messages()
+	s.PubSub.Reset()
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if msgs[i].ID != msgs[j].ID {
+			return msgs[i].ID < msgs[j].ID
+		}
+		return msgs[i].Seq < msgs[j].Seq
+	})
+	at := s.Clock.Now().Sub(Epoch)
+	for _, m := range msgs {
+		s.events = append(s.events, Event{At: at, Message: m})
+	}
+}
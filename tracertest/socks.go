@@ -0,0 +1,241 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// SOCKS5Server is a local SOCKS5 proxy supporting the connect command,
+// for end to end tests of Pingers routed through a proxy. Host names are
+// resolved by the proxy, through the routes configured with Route first.
+type SOCKS5Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	sync.Mutex
+	username string
+	password string
+	routes   map[string]string
+	requests []string
+}
+
+// NewSOCKS5Server starts a SOCKS5Server on a loopback address, closed
+// when tb completes. It requires no authentication until SetAuth is
+// called.
+func NewSOCKS5Server(tb testing.TB) *SOCKS5Server {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := &SOCKS5Server{ln: ln, routes: make(map[string]string)}
+	s.wg.Add(1)
+	go s.serve()
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *SOCKS5Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// SetAuth makes the server require the username and password
+// authentication with the given credentials.
+func (s *SOCKS5Server) SetAuth(username, password string) {
+	s.Lock()
+	defer s.Unlock()
+	s.username, s.password = username, password
+}
+
+// Route makes the server connect to addr when asked to connect to host,
+// whatever the port requested, so that names reachable only through the
+// proxy can be simulated.
+func (s *SOCKS5Server) Route(host, addr string) {
+	s.Lock()
+	defer s.Unlock()
+	s.routes[host] = addr
+}
+
+// Requests returns the addresses the server was asked to connect to so
+// far, in the host:port form.
+func (s *SOCKS5Server) Requests() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close stops the server and waits for the connections being served.
+func (s *SOCKS5Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *SOCKS5Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle serves a client connection, relaying it to the target once
+// connected.
+func (s *SOCKS5Server) handle(conn net.Conn) error {
+	s.Lock()
+	username, password := s.username, s.password
+	s.Unlock()
+
+	buf := make([]byte, 255)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return err
+	}
+	if buf[0] != 5 {
+		return errors.New("unsupported version")
+	}
+	methods := buf[:buf[1]]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	want := byte(0)
+	if username != "" {
+		want = 2
+	}
+	found := false
+	for _, m := range methods {
+		found = found || m == want
+	}
+	if !found {
+		conn.Write([]byte{5, 0xff})
+		return errors.New("no acceptable method")
+	}
+	conn.Write([]byte{5, want})
+
+	if want == 2 {
+		readString := func() (string, error) {
+			if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+				return "", err
+			}
+			b := buf[:buf[0]]
+			_, err := io.ReadFull(conn, b)
+			return string(b), err
+		}
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		u, err := readString()
+		if err != nil {
+			return err
+		}
+		p, err := readString()
+		if err != nil {
+			return err
+		}
+		if u != username || p != password {
+			conn.Write([]byte{1, 1})
+			return errors.New("authentication failed")
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return err
+	}
+	if buf[1] != 1 {
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return errors.New("unsupported command")
+	}
+	var host string
+	switch buf[3] {
+	case 1, 4:
+		ip := make(net.IP, 4)
+		if buf[3] == 4 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return err
+		}
+		host = ip.String()
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		b := buf[:buf[0]]
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		host = string(b)
+	default:
+		conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return errors.New("unsupported address type")
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf))))
+
+	s.Lock()
+	s.requests = append(s.requests, addr)
+	route, ok := s.routes[host]
+	s.Unlock()
+	if ok {
+		addr = route
+	}
+
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(conn, target)
+		conn.Close()
+		close(done)
+	}()
+	io.Copy(target, conn)
+	target.Close()
+	<-done
+	return nil
+}
@@ -0,0 +1,311 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracertest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+	"github.com/tecnoporto/tracer"
+	"github.com/tecnoporto/tracer/tracertest"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := tracertest.NewClock(start)
+
+	after := c.After(time.Second)
+	c.Advance(time.Millisecond * 500)
+	select {
+	case <-after:
+		t.Fatal("clock fired too early")
+	default:
+	}
+	if n := c.Waiters(); n != 1 {
+		t.Fatalf("unexpected waiters: found %v, expected 1", n)
+	}
+
+	c.Advance(time.Millisecond * 500)
+	if now := <-after; !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("unexpected time: found %v, expected %v", now, start.Add(time.Second))
+	}
+}
+
+func TestPinger(t *testing.T) {
+	p := tracertest.NewPinger("fake", tracertest.Up, tracertest.Down)
+	ctx := context.Background()
+
+	if err := p.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Ping(ctx); err != tracertest.ErrDown {
+			t.Fatalf("unexpected error: found %v, expected %v", err, tracertest.ErrDown)
+		}
+	}
+	if n := p.Calls(); n != 3 {
+		t.Fatalf("unexpected calls: found %v, expected 3", n)
+	}
+
+	// The address may change while it is read.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.Addr()
+		}
+	}()
+	p.SetAddr(tracertest.Addr("moved"))
+	<-done
+	if a := p.Addr(); a.String() != tracertest.Addr("moved").String() {
+		t.Fatalf("unexpected address: found %v, expected %v", a, tracertest.Addr("moved"))
+	}
+}
+
+func TestPingerLatency(t *testing.T) {
+	c := tracertest.NewClock(time.Now())
+	p := tracertest.NewPinger("fake", tracertest.Result{Latency: time.Second})
+	p.Clock = c
+
+	errc := make(chan error)
+	go func() {
+		errc <- p.Ping(context.Background())
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	c := tracertest.NewClock(time.Now())
+	tr := tracer.New()
+	tr.Clock = c
+	tr.RefreshRate = time.Second
+
+	col, err := tracertest.Collect(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer col.Close()
+
+	p := tracertest.NewPinger("fake", tracertest.Up, tracertest.Down)
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	if _, err := col.Wait(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	c.BlockUntil(1)
+	c.Advance(tr.RefreshRate)
+
+	msgs, err := col.Wait(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[0].State != tracer.ConnOnline || msgs[1].State != tracer.ConnOffline {
+		t.Fatalf("unexpected states: found %v and %v", msgs[0].State, msgs[1].State)
+	}
+	if msgs := col.ByID("fake"); len(msgs) != 2 {
+		t.Fatalf("unexpected messages: found %v, expected 2", len(msgs))
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	tr := tracer.New()
+	ps := tracertest.Inject(tr)
+
+	col, err := tracertest.Collect(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Trace(tracertest.NewPinger("fake", tracertest.Down)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := col.Wait(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	col.Close()
+	tr.Close()
+
+	msgs := ps.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("unexpected messages: found %v, expected 1", len(msgs))
+	}
+	if msgs[0].ID != "fake" || msgs[0].Err != tracertest.ErrDown {
+		t.Fatalf("unexpected message: %+v", msgs[0])
+	}
+
+	var runs int
+	cancel, err := ps.Sub(&pubsub.Command{Topic: "test", Run: func(interface{}) error {
+		runs++
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Pub(nil, "test")
+	cancel()
+	cancel()
+	ps.Pub(nil, "test")
+	if runs != 1 {
+		t.Fatalf("unexpected runs: found %v, expected 1", runs)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	c := tracertest.NewClock(time.Now())
+	tr := tracer.New()
+	tr.Clock = c
+	tr.RefreshRate = time.Second
+	tr.FallThreshold = 2
+	tracertest.Inject(tr)
+
+	r, err := tracertest.Record(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col, err := tracertest.Collect(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := []tracertest.Result{tracertest.Up, tracertest.Down, tracertest.Down, tracertest.Up}
+	for _, id := range []string{"db", "web"} {
+		if err := tr.Trace(tracertest.NewPinger(id, script...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(script); i++ {
+		if _, err := col.Wait(i*2, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		c.BlockUntil(1)
+		c.Advance(tr.RefreshRate)
+	}
+	if _, err := col.Wait(len(script)*2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	tr.Close()
+	tr.SetNetwork(tracer.NetworkCondition{Up: false, Reason: "default route lost"})
+	r.Close()
+
+	r.Golden(t, "testdata/recorder.golden")
+}
+
+func TestSimulation(t *testing.T) {
+	run := func() string {
+		s := tracertest.NewSimulation()
+		s.Tracer.RefreshRate = time.Second * 10
+		s.Tracer.PingTimeout = time.Hour
+		s.Tracer.FallThreshold = 2
+		defer s.Close()
+
+		slow := tracertest.Result{Latency: time.Second * 3}
+		pingers := []*tracertest.Pinger{
+			tracertest.NewPinger("db", tracertest.Up, tracertest.Down, tracertest.Down, tracertest.Up),
+			tracertest.NewPinger("web", slow, tracertest.Result{Err: tracertest.ErrDown, Latency: time.Second}),
+		}
+		for _, p := range pingers {
+			if err := s.Trace(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		events, err := s.Run(time.Second * 35)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tracertest.String(events)
+	}
+
+	want := `0s db #1 online addr=tracertest/db initial
+3s web #1 online addr=tracertest/web initial
+10s db #2 online addr=tracertest/db err="tracertest: target down"
+11s web #2 online addr=tracertest/web err="tracertest: target down"
+20s db #3 offline addr=tracertest/db err="tracertest: target down"
+21s web #3 offline addr=tracertest/web err="tracertest: target down"
+30s db #4 online addr=tracertest/db
+31s web #4 offline addr=tracertest/web err="tracertest: target down"
+`
+	for i := 0; i < 3; i++ {
+		if got := run(); got != want {
+			t.Fatalf("unexpected events:\n%v\nexpected:\n%v", got, want)
+		}
+	}
+}
+
+func TestScenario(t *testing.T) {
+	sc, err := tracertest.ParseScenario("db", "up 20s, down 20s, flapping 20s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := tracertest.NewScenario("db").Up(time.Second * 20).Down(time.Second * 20).Flapping(time.Second * 20)
+	if got, want := sc.Phases(), b.Phases(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("unexpected phases: found %v, expected %v", got, want)
+	}
+
+	s := tracertest.NewSimulation()
+	s.Tracer.RefreshRate = time.Second * 10
+	defer s.Close()
+	if err := s.Trace(sc); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.Run(time.Second * 70)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range events {
+		got = append(got, tracer.StateString(e.Message.State))
+	}
+	want := "[online online offline offline online offline online offline]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("unexpected states: found %v, expected %v", got, want)
+	}
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	for _, desc := range []string{"up", "down 1x", "sideways 1m", "slow 1m"} {
+		if _, err := tracertest.ParseScenario("db", desc); err == nil {
+			t.Fatalf("%q: expected an error", desc)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPStep is a request of a Transaction. URL, Header values and Body
+// may reference the variables extracted by the previous steps, and the
+// ones given to the Transaction, as {{name}}.
+type HTTPStep struct {
+	// Name identifies the step in errors and results, e.g. "login".
+	Name string
+
+	Method string // GET when empty
+	URL    string
+	Header http.Header
+	Body   string
+
+	// Status is the status code expected, any lower than 400 when
+	// zero. Redirects are followed.
+	Status int
+
+	// Expect, when not nil, must match the body of the response.
+	Expect *regexp.Regexp
+
+	// Extract maps variable names to regular expressions matched
+	// against the body of the response: the variable is set to the
+	// first submatch, or to the whole match if there is no submatch.
+	Extract map[string]*regexp.Regexp
+
+	// ExtractJSON maps variable names to paths in the JSON body of the
+	// response, made of object keys and array indexes separated by dots,
+	// e.g. "data.items.0.id".
+	ExtractJSON map[string]string
+}
+
+// StepResult is the outcome of a step of a Transaction.
+type StepResult struct {
+	Name       string
+	StatusCode int
+	Latency    time.Duration
+}
+
+// Transaction is a Pinger running a sequence of HTTP requests as a single
+// target, e.g. logging in, fetching a page and checking its content, to
+// monitor what users actually do. Cookies are kept across the steps of a
+// run, and dropped at the end of it. A failing step stops the run, and the
+// ping fails with a *StepError reporting which one.
+// The []StepResult of the steps run are returned as details of each ping,
+// see DetailPinger.
+type Transaction struct {
+	id    string
+	steps []HTTPStep
+	vars  map[string]string
+	opts  *options
+}
+
+// NewTransaction returns a Transaction identified by id running steps,
+// whose variables are initialized with vars. Options apply to every
+// request; WithExpect and WithValidator apply to the last response, whose
+// validators receive an *HTTPResponse.
+func NewTransaction(id string, steps []HTTPStep, vars map[string]string, opts ...Option) *Transaction {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = id
+	}
+	return &Transaction{
+		id:    id,
+		steps: append([]HTTPStep(nil), steps...),
+		vars:  vars,
+		opts:  o,
+	}
+}
+
+// ID implements Pinger.
+func (p *Transaction) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger, returning the host of the first step.
+func (p *Transaction) Addr() net.Addr {
+	if len(p.steps) > 0 {
+		if u, err := url.Parse(p.steps[0].URL); err == nil && u.Host != "" {
+			return &netAddr{network: "tcp", addr: u.Host}
+		}
+	}
+	return &netAddr{network: "transaction", addr: p.id}
+}
+
+// Ping implements Pinger.
+func (p *Transaction) Ping(ctx context.Context) error {
+	_, err := p.PingDetails(ctx)
+	return err
+}
+
+// PingDetails implements DetailPinger, returning the []StepResult of the
+// steps run.
+func (p *Transaction) PingDetails(ctx context.Context) (interface{}, error) {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			Proxy:           p.opts.proxy,
+			DialContext:     p.opts.dial,
+			TLSClientConfig: p.opts.tlsConfig,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	vars := make(map[string]string, len(p.vars))
+	for k, v := range p.vars {
+		vars[k] = v
+	}
+	var results []StepResult
+	for i, s := range p.steps {
+		name := s.Name
+		if name == "" {
+			name = "step " + strconv.Itoa(i+1)
+		}
+		start := time.Now()
+		r, err := s.run(ctx, client, vars)
+		if r != nil {
+			results = append(results, StepResult{Name: name, StatusCode: r.StatusCode, Latency: time.Since(start)})
+		}
+		if err == nil && i == len(p.steps)-1 {
+			if err = p.opts.match("body", r.Body); err == nil {
+				err = p.opts.validate(r)
+			}
+		}
+		if err != nil {
+			return results, &StepError{Step: i, Name: name, Err: err}
+		}
+	}
+	return results, nil
+}
+
+// run performs the request of s, setting the variables it extracts in
+// vars.
+func (s *HTTPStep) run(ctx context.Context, client *http.Client, vars map[string]string) (*HTTPResponse, error) {
+	expand := func(v string) string {
+		return expandVars(v, vars)
+	}
+	method := s.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(expand(s.Body))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, expand(s.URL), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range s.Header {
+		for _, v := range vs {
+			req.Header.Add(k, expand(v))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	r := &HTTPResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+	if r.Body, err = io.ReadAll(io.LimitReader(resp.Body, MaxResponseBody)); err != nil {
+		return r, err
+	}
+	switch {
+	case s.Status != 0 && resp.StatusCode != s.Status:
+		return r, &ExpectationError{What: "status", Expected: strconv.Itoa(s.Status), Found: resp.Status}
+	case s.Status == 0 && resp.StatusCode >= 400:
+		return r, fmt.Errorf("tracer: unexpected status %v", resp.Status)
+	}
+	if err := expect(s.Expect, "body", r.Body); err != nil {
+		return r, err
+	}
+
+	for k, re := range s.Extract {
+		m := re.FindSubmatch(r.Body)
+		if m == nil {
+			return r, fmt.Errorf("tracer: no match for %v in body", k)
+		}
+		vars[k] = string(m[len(m)-1])
+	}
+	if len(s.ExtractJSON) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(r.Body, &doc); err != nil {
+			return r, fmt.Errorf("tracer: invalid JSON body: %v", err)
+		}
+		for k, path := range s.ExtractJSON {
+			v, ok := jsonPath(doc, path)
+			if !ok {
+				return r, fmt.Errorf("tracer: no %v in JSON body", path)
+			}
+			vars[k] = v
+		}
+	}
+	return r, nil
+}
+
+var varRe = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+// expandVars replaces the {{name}} references in s with the values of
+// vars, leaving unknown ones as they are.
+func expandVars(s string, vars map[string]string) string {
+	return varRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := vars[varRe.FindStringSubmatch(ref)[1]]; ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// jsonPath returns the value at path in doc, formatted as a string.
+func jsonPath(doc interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = v[key]; !ok {
+				return "", false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			doc = v[i]
+		default:
+			return "", false
+		}
+	}
+	switch v := doc.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
@@ -0,0 +1,184 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestTransaction(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("password") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `<a href="/orders?page=2">next</a>`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"tokens": [{"value": "t1"}]}}`)
+	})
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" || r.URL.Query().Get("page") != "2" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "orders: 3")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	steps := func(password string) []tracer.HTTPStep {
+		return []tracer.HTTPStep{
+			{
+				Name:    "login",
+				Method:  http.MethodPost,
+				URL:     "{{base}}/login",
+				Header:  http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+				Body:    "user=admin&password=" + password,
+				Extract: map[string]*regexp.Regexp{"next": regexp.MustCompile(`href="([^"]+)"`)},
+			},
+			{
+				Name:        "token",
+				URL:         "{{base}}/token",
+				ExtractJSON: map[string]string{"token": "data.tokens.0.value"},
+			},
+			{
+				Name:   "orders",
+				URL:    "{{base}}{{next}}",
+				Header: http.Header{"Authorization": {"Bearer {{ token }}"}},
+				Expect: regexp.MustCompile(`orders: \d+`),
+			},
+		}
+	}
+	vars := map[string]string{"base": srv.URL}
+
+	p := tracer.NewTransaction("shop", steps("secret"), vars)
+	details, err := p.PingDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := details.([]tracer.StepResult)
+	if len(results) != 3 || results[2].Name != "orders" || results[2].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	p = tracer.NewTransaction("shop", steps("wrong"), vars)
+	details, err = p.PingDetails(context.Background())
+	var serr *tracer.StepError
+	if !errors.As(err, &serr) || serr.Step != 0 || serr.Name != "login" {
+		t.Fatalf("unexpected error: found %v, expected a failure of the login step", err)
+	}
+	if results := details.([]tracer.StepResult); len(results) != 1 || results[0].StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	// Expectations set through options apply to the last response.
+	p = tracer.NewTransaction("shop", steps("secret"), vars, tracer.WithExpect(regexp.MustCompile("^refunds")))
+	var eerr *tracer.ExpectationError
+	if err := p.Ping(context.Background()); !errors.As(err, &serr) || serr.Step != 2 || !errors.As(err, &eerr) {
+		t.Fatalf("unexpected error: found %v, expected an expectation failure of the last step", err)
+	}
+}
+
+func TestLoginCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, "<form method=post>")
+			return
+		}
+		if r.FormValue("email") != "ops@example.com" || r.FormValue("password") != "p&ss word" {
+			http.Redirect(w, r, "/login?failed=1", http.StatusSeeOther)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1", Path: "/"})
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("sid"); err != nil || c.Value != "s1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "Welcome back")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	password := "p&ss word"
+	flow := tracer.LoginFlow{
+		LoginURL:      srv.URL + "/login",
+		UsernameField: "email",
+		Cookie:        "sid",
+		ProtectedURL:  srv.URL + "/dashboard",
+		Expect:        regexp.MustCompile("Welcome"),
+		Credentials: tracer.CredentialsFunc(func(context.Context) (tracer.Credentials, error) {
+			return tracer.Credentials{Username: "ops@example.com", Password: password}, nil
+		}),
+	}
+	p, err := tracer.NewLoginCheck("login", flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	password = "expired"
+	err = p.Ping(context.Background())
+	var serr *tracer.StepError
+	if !errors.As(err, &serr) || serr.Name != "session" {
+		t.Fatalf("unexpected error: found %v, expected a failure of the session step", err)
+	}
+
+	t.Setenv("TRACER_TEST_USER", "ops@example.com")
+	flow.Credentials = tracer.EnvCredentials("TRACER_TEST_USER", "TRACER_TEST_PASSWORD")
+	if p, err = tracer.NewLoginCheck("login", flow); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ping(context.Background()); !errors.As(err, &serr) || serr.Name != "credentials" {
+		t.Fatalf("unexpected error: found %v, expected a failure of the credentials step", err)
+	}
+	t.Setenv("TRACER_TEST_PASSWORD", "p&ss word")
+	if err := p.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"fmt"
+)
+
+// WaitUntilOnline blocks until the target stored with id is in state
+// ConnOnline, see WaitState.
+func (t *Tracer) WaitUntilOnline(ctx context.Context, id string) error {
+	return t.WaitState(ctx, id, ConnOnline)
+}
+
+// WaitUntilOffline blocks until the target stored with id is in state
+// ConnOffline, see WaitState.
+func (t *Tracer) WaitUntilOffline(ctx context.Context, id string) error {
+	return t.WaitState(ctx, id, ConnOffline)
+}
+
+// WaitOnline blocks until the target stored with id is reachable, i.e.
+// until its first successful ping, returning immediately if its last
+// ping succeeded already. Unlike WaitUntilOnline, it does not wait for
+// RiseThreshold successes. Returns ErrNotTraced if no target is stored
+// with id, or if it is untraced while waiting, and the error of ctx if
+// it is done first.
+func (t *Tracer) WaitOnline(ctx context.Context, id string) error {
+	return t.wait(ctx, id, func(tg *target) bool {
+		return tg.last != nil && tg.last.Err == nil
+	})
+}
+
+// WaitAllOnline is WaitOnline for each of ids, returning the first error
+// encountered.
+func (t *Tracer) WaitAllOnline(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if err := t.WaitOnline(ctx, id); err != nil {
+			return fmt.Errorf("%v: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// WaitState blocks until the target stored with id reaches state,
+// returning immediately if it is in that state already. Returns
+// ErrNotTraced if no target is stored with id, or if it is untraced while
+// waiting, and the error of ctx if it is done first. When id is traced
+// again while waiting, the wait goes on with the new target.
+func (t *Tracer) WaitState(ctx context.Context, id string, state int) error {
+	return t.wait(ctx, id, func(tg *target) bool {
+		return tg.state == state
+	})
+}
+
+// wait blocks until done, called with the target stored with id locked,
+// reports true. See WaitState.
+func (t *Tracer) wait(ctx context.Context, id string, done func(*target) bool) error {
+	tg, ok := t.lookup(id)
+	if !ok {
+		return ErrNotTraced
+	}
+
+	for {
+		tg.Lock()
+		removed, ok, changed := tg.removed, done(tg), tg.changed
+		tg.Unlock()
+
+		switch {
+		case removed:
+			// Tracing id again replaces its target.
+			next, traced := t.lookup(id)
+			if !traced || next == tg {
+				return ErrNotTraced
+			}
+			tg = next
+			continue
+		case ok:
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
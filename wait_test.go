@@ -0,0 +1,138 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestWaitUntil(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 5
+	tr.PubSub = new(recorder)
+
+	p := &flipPinger{pg: pg{id: "fake"}, fail: 1}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOffline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(time.Millisecond*20, func() { atomic.StoreInt32(&p.fail, 0) })
+	if err := tr.WaitUntilOnline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := tr.WaitUntilOffline(short, "fake"); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: found %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	time.AfterFunc(time.Millisecond*20, func() { tr.Untrace("fake") })
+	if err := tr.WaitUntilOffline(ctx, "fake"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+	if err := tr.WaitUntilOnline(ctx, "unknown"); err != tracer.ErrNotTraced {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
+
+func TestWaitOnline(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 5
+	tr.RiseThreshold = 1000
+	tr.PubSub = new(recorder)
+
+	p := &flipPinger{pg: pg{id: "fake"}, fail: 1}
+	for _, p := range []tracer.Pinger{p, &pg{id: "other"}} {
+		if err := tr.Trace(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := tr.WaitAllOnline(short, "other", "fake"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	atomic.StoreInt32(&p.fail, 0)
+	if err := tr.WaitAllOnline(ctx, "other", "fake"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := tr.Last("fake"); m.State == tracer.ConnOnline {
+		t.Fatalf("unexpected state: found %v, expected a state other than %v", m.State, tracer.ConnOnline)
+	}
+	if err := tr.WaitAllOnline(ctx, "unknown"); !errors.Is(err, tracer.ErrNotTraced) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrNotTraced)
+	}
+}
+
+func TestWaitRetraced(t *testing.T) {
+	tr := tracer.New()
+	tr.RefreshRate = time.Millisecond * 5
+	tr.PubSub = new(recorder)
+
+	if err := tr.Trace(&pg{id: "fake", shouldFail: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tr.WaitUntilOffline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The wait follows the target that replaces the failing one.
+	time.AfterFunc(time.Millisecond*20, func() { tr.Trace(&pg{id: "fake"}) })
+	if err := tr.WaitUntilOnline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrServiceNotRunning is reported by WindowsServicePinger when the
+// service is not in the running state.
+var ErrServiceNotRunning = errors.New("tracer: service not running")
+
+// States of a Windows service, see SERVICE_STATUS.
+const (
+	serviceStopped         = 1
+	serviceStartPending    = 2
+	serviceStopPending     = 3
+	serviceRunning         = 4
+	serviceContinuePending = 5
+	servicePausePending    = 6
+	servicePaused          = 7
+)
+
+// serviceStateString returns a human readable form of the state of a
+// Windows service.
+func serviceStateString(s uint32) string {
+	switch s {
+	case serviceStopped:
+		return "stopped"
+	case serviceStartPending:
+		return "start pending"
+	case serviceStopPending:
+		return "stop pending"
+	case serviceRunning:
+		return "running"
+	case serviceContinuePending:
+		return "continue pending"
+	case servicePausePending:
+		return "pause pending"
+	case servicePaused:
+		return "paused"
+	default:
+		return fmt.Sprintf("state %d", s)
+	}
+}
+
+// WindowsServicePinger is a Pinger that considers a Windows service
+// reachable while it is running, so that its outages can be remediated
+// with the WindowsService action. The service control manager is queried
+// with the rights of any user; on other platforms the pings fail.
+type WindowsServicePinger struct {
+	name string
+	opts *options
+}
+
+// NewWindowsServicePinger returns a WindowsServicePinger watching the
+// service with name, e.g. Spooler, not its display name. Unless WithID is
+// used, name is the ID of the Pinger.
+func NewWindowsServicePinger(name string, opts ...Option) *WindowsServicePinger {
+	o := newOptions(opts)
+	if o.id == "" {
+		o.id = name
+	}
+	return &WindowsServicePinger{name: name, opts: o}
+}
+
+// ID implements Pinger.
+func (p *WindowsServicePinger) ID() string {
+	return p.opts.id
+}
+
+// Addr implements Pinger.
+func (p *WindowsServicePinger) Addr() net.Addr {
+	return &netAddr{network: "winsvc", addr: p.name}
+}
+
+// Ping implements Pinger. It fails with an error wrapping
+// ErrServiceNotRunning when the service is in any other state.
+func (p *WindowsServicePinger) Ping(ctx context.Context) error {
+	ctx, cancel := p.opts.withTimeout(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		state, err := serviceState(p.name)
+		if err == nil && state != serviceRunning {
+			err = fmt.Errorf("%w: %v is %v", ErrServiceNotRunning, p.name, serviceStateString(state))
+		}
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+//go:build windows
+
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	openSCManager      = advapi32.NewProc("OpenSCManagerW")
+	openService        = advapi32.NewProc("OpenServiceW")
+	queryServiceStatus = advapi32.NewProc("QueryServiceStatus")
+	closeServiceHandle = advapi32.NewProc("CloseServiceHandle")
+)
+
+// Access rights of the service control manager and of services.
+const (
+	scManagerConnect   = 0x0001
+	serviceQueryStatus = 0x0004
+)
+
+// serviceStatus mirrors SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceState returns the current state of the Windows service name.
+func serviceState(name string) (uint32, error) {
+	if err := advapi32.Load(); err != nil {
+		return 0, err
+	}
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	scm, _, err := openSCManager.Call(0, 0, scManagerConnect)
+	if scm == 0 {
+		return 0, fmt.Errorf("OpenSCManager: %w", err)
+	}
+	defer closeServiceHandle.Call(scm)
+	h, _, err := openService.Call(scm, uintptr(unsafe.Pointer(pname)), serviceQueryStatus)
+	if h == 0 {
+		return 0, fmt.Errorf("OpenService %v: %w", name, err)
+	}
+	defer closeServiceHandle.Call(h)
+	var st serviceStatus
+	if ok, _, err := queryServiceStatus.Call(h, uintptr(unsafe.Pointer(&st))); ok == 0 {
+		return 0, fmt.Errorf("QueryServiceStatus %v: %w", name, err)
+	}
+	return st.CurrentState, nil
+}
@@ -0,0 +1,161 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MessageVersion is the schema version of Message. New fields may be added
+// to Message without changing it, and consumers are expected to ignore the
+// fields they do not know about; MessageVersion is incremented only when a
+// field is removed or changes meaning.
+const MessageVersion = 1
+
+// ErrUnsupportedVersion is returned when decoding a Message encoded with a
+// schema version newer than MessageVersion.
+var ErrUnsupportedVersion = errors.New("tracer: unsupported message version")
+
+// wireMessage is the JSON representation of Message. Every field added to
+// Message has to be added here as well.
+type wireMessage struct {
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`
+	Err       string          `json:"err,omitempty"`
+	Kind      Kind            `json:"kind,omitempty"`
+	Network   string          `json:"network,omitempty"`
+	Addr      string          `json:"addr,omitempty"`
+	IP        net.IP          `json:"ip,omitempty"`
+	State     int             `json:"state"`
+	Latency   time.Duration   `json:"latency"`
+	Timestamp *time.Time      `json:"timestamp,omitempty"`
+	Seq       uint64          `json:"seq"`
+	Skipped   uint64          `json:"skipped,omitempty"`
+	Attempts  int             `json:"attempts,omitempty"`
+	Canceled  bool            `json:"canceled,omitempty"`
+	Chaos     bool            `json:"chaos,omitempty"`
+	Initial   bool            `json:"initial,omitempty"`
+	Downtime  bool            `json:"downtime,omitempty"`
+	RootCause string          `json:"root_cause,omitempty"`
+	Flapping  bool            `json:"flapping,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	Stale     bool            `json:"stale,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Err is encoded as its
+// message, Addr as its network and string representation, Details with
+// the encoding/json rules.
+func (m Message) MarshalJSON() ([]byte, error) {
+	w := wireMessage{
+		Version:   m.Version,
+		ID:        m.ID,
+		Kind:      m.Kind,
+		IP:        m.IP,
+		State:     m.State,
+		Latency:   m.Latency,
+		Seq:       m.Seq,
+		Skipped:   m.Skipped,
+		Attempts:  m.Attempts,
+		Canceled:  m.Canceled,
+		Chaos:     m.Chaos,
+		Initial:   m.Initial,
+		Downtime:  m.Downtime,
+		RootCause: m.RootCause,
+		Flapping:  m.Flapping,
+		Stale:     m.Stale,
+	}
+	if w.Version == 0 {
+		w.Version = MessageVersion
+	}
+	if !m.Timestamp.IsZero() {
+		w.Timestamp = &m.Timestamp
+	}
+	if m.Err != nil {
+		w.Err = m.Err.Error()
+	}
+	if m.Addr != nil {
+		w.Network = m.Addr.Network()
+		w.Addr = m.Addr.String()
+	}
+	if m.Details != nil {
+		details, err := json.Marshal(m.Details)
+		if err != nil {
+			return nil, err
+		}
+		w.Details = details
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Returns an error wrapping
+// ErrUnsupportedVersion if the message was encoded with a newer schema.
+// Errors are decoded as plain errors carrying the original message,
+// hence they can no longer be compared with the package's sentinel errors.
+// Details are kept as a json.RawMessage, which DetailsAs decodes.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var w wireMessage
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if w.Version > MessageVersion {
+		return fmt.Errorf("%w: %v", ErrUnsupportedVersion, w.Version)
+	}
+
+	*m = Message{
+		Version:   w.Version,
+		ID:        w.ID,
+		Kind:      w.Kind,
+		IP:        w.IP,
+		State:     w.State,
+		Latency:   w.Latency,
+		Seq:       w.Seq,
+		Skipped:   w.Skipped,
+		Attempts:  w.Attempts,
+		Canceled:  w.Canceled,
+		Chaos:     w.Chaos,
+		Initial:   w.Initial,
+		Downtime:  w.Downtime,
+		RootCause: w.RootCause,
+		Flapping:  w.Flapping,
+		Stale:     w.Stale,
+	}
+	if w.Timestamp != nil {
+		m.Timestamp = *w.Timestamp
+	}
+	if w.Err != "" {
+		m.Err = errors.New(w.Err)
+	}
+	if w.Addr != "" {
+		m.Addr = &netAddr{network: w.Network, addr: w.Addr}
+	}
+	if len(w.Details) > 0 {
+		m.Details = w.Details
+	}
+	return nil
+}
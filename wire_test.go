@@ -0,0 +1,88 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestMessageJSON(t *testing.T) {
+	m := tracer.Message{
+		Version:   tracer.MessageVersion,
+		ID:        "fake",
+		Err:       errors.New("should fail"),
+		Addr:      &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80},
+		IP:        net.IPv4(127, 0, 0, 1),
+		State:     tracer.ConnOffline,
+		Latency:   time.Millisecond,
+		Timestamp: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC),
+		Seq:       3,
+		Kind:      tracer.KindOther,
+		Attempts:  2,
+		Details:   &tracer.HTTPResponse{StatusCode: 503},
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d tracer.Message
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != m.ID || d.Seq != m.Seq || d.State != m.State || d.Latency != m.Latency || d.Attempts != m.Attempts || d.Kind != m.Kind || !d.Timestamp.Equal(m.Timestamp) {
+		t.Fatalf("unexpected message: found %+v, expected %+v", d, m)
+	}
+	if d.Err == nil || d.Err.Error() != m.Err.Error() {
+		t.Fatalf("unexpected error: found %v, expected %v", d.Err, m.Err)
+	}
+	if d.Addr.Network() != "tcp" || d.Addr.String() != "127.0.0.1:80" {
+		t.Fatalf("unexpected address: found %v, expected %v", d.Addr, m.Addr)
+	}
+	if !d.IP.Equal(m.IP) {
+		t.Fatalf("unexpected IP: found %v, expected %v", d.IP, m.IP)
+	}
+	if r, ok := tracer.DetailsAs[*tracer.HTTPResponse](d); !ok || r.StatusCode != 503 {
+		t.Fatalf("unexpected details: found %s, expected %+v", d.Details, m.Details)
+	}
+}
+
+func TestMessageJSONVersion(t *testing.T) {
+	var m tracer.Message
+	err := json.Unmarshal([]byte(`{"version":99,"id":"fake","unknown":true}`), &m)
+	if !errors.Is(err, tracer.ErrUnsupportedVersion) {
+		t.Fatalf("unexpected error: found %v, expected %v", err, tracer.ErrUnsupportedVersion)
+	}
+
+	if err := json.Unmarshal([]byte(`{"version":1,"id":"fake","unknown":true}`), &m); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+
+	"github.com/tecnoporto/pubsub"
+)
+
+// WakeOnLAN is an Action that sends a Wake-on-LAN magic packet to a
+// machine, so that home servers and other machines that suspend themselves
+// are brought back up when their target goes offline.
+type WakeOnLAN struct {
+	// ID is the ID of the target to watch.
+	ID string
+
+	// MAC is the hardware address of the machine to wake.
+	MAC net.HardwareAddr
+
+	// Broadcast is the UDP address the packets are sent to,
+	// 255.255.255.255:9 when empty.
+	Broadcast string
+
+	// Retries is the number of packets sent by Watch while the target
+	// stays offline, one when zero. Cooldown is the minimum time between
+	// two of them.
+	Retries  int
+	Cooldown time.Duration
+}
+
+// MagicPacket returns the Wake-on-LAN packet that wakes the machine with
+// hardware address mac: six 0xff bytes followed by sixteen repetitions of
+// mac.
+func MagicPacket(mac net.HardwareAddr) []byte {
+	p := bytes.Repeat([]byte{0xff}, 6)
+	return append(p, bytes.Repeat(mac, 16)...)
+}
+
+// Name implements Action.
+func (w *WakeOnLAN) Name() string {
+	return "wake-on-lan"
+}
+
+// Run implements Action, sending a magic packet to the machine.
+func (w *WakeOnLAN) Run(ctx context.Context, m Message) error {
+	addr := w.Broadcast
+	if addr == "" {
+		addr = "255.255.255.255:9"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(MagicPacket(w.MAC))
+	return err
+}
+
+// Watch subscribes w to the messages of t, sending magic packets while
+// the target is offline, see Actions.
+func (w *WakeOnLAN) Watch(t *Tracer) (pubsub.CancelFunc, error) {
+	a := &Actions{Rules: []Rule{{
+		ID:          w.ID,
+		State:       ConnOffline,
+		Action:      w,
+		MaxAttempts: w.Retries,
+		Cooldown:    w.Cooldown,
+	}}}
+	return a.Watch(t)
+}
@@ -0,0 +1,103 @@
+/*
+MIT License
+
+Copyright (c) 2018 Daniel Morandini
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tracer_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tecnoporto/tracer"
+)
+
+func TestWakeOnLAN(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	// Actions do not depend on the PubSub of the tracer.
+	tr := tracer.New(tracer.WithPubSub(nil))
+	tr.RefreshRate = time.Millisecond
+	w := &tracer.WakeOnLAN{ID: "fake", MAC: mac, Broadcast: conn.LocalAddr().String(), Retries: 2}
+	cancel, err := w.Watch(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	p := &flipPinger{pg: pg{id: "fake"}, fail: 1}
+	if err := tr.Trace(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	buf := make([]byte, 256)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], tracer.MagicPacket(mac)) {
+			t.Fatalf("unexpected packet: found %x, expected %x", buf[:n], tracer.MagicPacket(mac))
+		}
+	}
+
+	// No more than Retries packets per outage.
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, _, err := conn.ReadFrom(buf); err == nil {
+		t.Fatal("too many packets sent")
+	}
+
+	// Packets are sent again after the target came back online.
+	atomic.StoreInt32(&p.fail, 0)
+	ctx, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+	if err := tr.WaitUntilOnline(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&p.fail, 1)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	p := tracer.MagicPacket(mac)
+	if len(p) != 102 || !bytes.Equal(p[:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) || !bytes.Equal(p[96:], mac) {
+		t.Fatalf("unexpected packet: %x", p)
+	}
+}